@@ -0,0 +1,173 @@
+package main
+
+import (
+	"backend/config"
+	"backend/logging"
+	"backend/migrations"
+	"backend/services"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Time allowed for queued deliveries and notifications to finish on exit
+const drainTimeout = 30 * time.Second
+
+// cliUserAgent marks audit events recorded by the CLI
+const cliUserAgent = "helixscan-cli"
+
+// app holds the services commands operate on
+type app struct {
+	cfg    *config.Config
+	logger *slog.Logger
+	db     *gorm.DB
+
+	migrator     *migrations.Migrator
+	tenants      *services.TenantDBManager
+	sinks        *services.SinkManager
+	forwarder    *services.Forwarder
+	alerts       *services.AlertService
+	accounts     *services.AccountService
+	registry     *services.WebhookRegistry
+	helius       *services.HeliusService
+	backfill     *services.BackfillService
+	replays      *services.ReplayService
+	rebuilds     *services.RebuildService
+	retention    *services.RetentionService
+	partitions   *services.PartitionService
+	destinations *services.DestinationService
+	audit        *services.AuditService
+}
+
+// loadConfig loads the configuration the same way the server does
+func loadConfig(opts *rootOptions) (*config.Config, error) {
+	var args []string
+	if opts.configFile != "" {
+		args = []string{"-config", opts.configFile}
+	}
+	cfg, _, err := config.Load(args)
+	return cfg, err
+}
+
+// withApp connects to the platform database, runs fn and then waits for
+// any deliveries or notifications fn queued before closing everything
+func withApp(opts *rootOptions, fn func(ctx context.Context, a *app) error) error {
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	log, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(log)
+
+	db, err := gorm.Open(postgres.Open(cfg.GetDSN()), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	migrator, err := migrations.New(sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return err
+	}
+
+	a := &app{cfg: cfg, logger: log, db: db, migrator: migrator}
+	a.tenants = services.NewTenantDBManager(db, services.TenantPoolLimits{
+		MaxOpenConns:    cfg.TenantMaxOpenConns,
+		MaxIdleConns:    cfg.TenantMaxIdleConns,
+		ConnMaxLifetime: time.Duration(cfg.TenantConnMaxLifetime) * time.Minute,
+	})
+	apiClient := services.NewHeliusAPIClient(cfg.HeliusAPIKey, cfg.HeliusBaseURL, cfg.HeliusRateLimit)
+	a.registry = services.NewWebhookRegistry(db, apiClient, cfg.WebhookURL(), "Bearer "+cfg.HeliusAPIKey)
+	archive := services.NewArchive(services.ArchiveConfig{
+		Driver:      cfg.ArchiveDriver,
+		Dir:         cfg.ArchiveDir,
+		S3Endpoint:  cfg.ArchiveS3Endpoint,
+		S3Region:    cfg.ArchiveS3Region,
+		S3Bucket:    cfg.ArchiveS3Bucket,
+		S3AccessKey: cfg.ArchiveS3AccessKey,
+		S3SecretKey: cfg.ArchiveS3SecretKey,
+	})
+	a.partitions = services.NewPartitionService(db, a.tenants, cfg.PartitionInterval, cfg.PartitionPremake,
+		cfg.PartitionEventRetentionDays, archive, cfg.RetentionBatchSize, log)
+	a.sinks = services.NewSinkManager(db, a.tenants, a.partitions, services.WriteBatching{
+		MaxRows: cfg.WriteBatchSize,
+		Linger:  time.Duration(cfg.WriteBatchLingerMS) * time.Millisecond,
+	})
+	a.forwarder = services.NewForwarder(db, cfg.ForwardWorkers, cfg.ForwardMaxAttempts, log)
+	mailer := services.NewMailer(services.MailerConfig{
+		Driver:   cfg.MailDriver,
+		From:     cfg.MailFrom,
+		SMTPHost: cfg.SMTPHost,
+		SMTPPort: cfg.SMTPPort,
+		SMTPUser: cfg.SMTPUser,
+		SMTPPass: cfg.SMTPPassword,
+		FilePath: cfg.MailFilePath,
+	})
+	a.alerts = services.NewAlertService(db, mailer, cfg.AlertWorkers, log)
+	filters := services.NewFilterService(db, log)
+	a.helius = services.NewHeliusService(db, a.sinks, services.NewHub(), a.forwarder, a.alerts, filters, log)
+	a.backfill = services.NewBackfillService(db, a.helius, log)
+	a.replays = services.NewReplayService(db, a.helius, cfg.ReplayRateLimit, log)
+	a.rebuilds = services.NewRebuildService(db, a.tenants, a.sinks, a.partitions, a.replays, a.helius,
+		time.Duration(cfg.RebuildRetentionHours)*time.Hour, log)
+	a.retention = services.NewRetentionService(db, a.tenants, a.partitions, archive, cfg.RetentionBatchSize,
+		time.Duration(cfg.RetentionIntervalMinutes)*time.Minute, log)
+	a.accounts = services.NewAccountService(db, mailer, cfg.AppURL)
+	a.destinations = services.NewDestinationService(db, a.forwarder)
+	a.audit = services.NewAuditService(db)
+
+	// Interrupting stops long-running commands between events
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	runErr := fn(ctx, a)
+	stop()
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	errs := []error{runErr, a.forwarder.Pool().Shutdown(drainCtx)}
+	for _, pool := range a.alerts.Pools() {
+		errs = append(errs, pool.Shutdown(drainCtx))
+	}
+	// Keeps the filter hit counts replays accumulated
+	errs = append(errs, filters.Flush())
+	a.sinks.Close()
+	a.tenants.Close()
+	errs = append(errs, sqlDB.Close())
+	return errors.Join(errs...)
+}
+
+// recordAudit logs an action taken from the CLI. Failures are reported but
+// don't fail the command, matching the API.
+func (a *app) recordAudit(entry services.AuditEntry) {
+	entry.UserAgent = cliUserAgent
+	if err := a.audit.Record(entry); err != nil {
+		a.logger.Error("failed to record audit event", "action", entry.Action, "error", err)
+	}
+}
+
+func parseID(s string) (uint, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", s)
+	}
+	return uint(id), nil
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"backend/services"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// Bench rows go to a table no webhook writes, dropped after each run
+const benchTableSuffix = "_bench"
+
+func newBenchCommand(opts *rootOptions) *cobra.Command {
+	var flags organizationFlags
+	var categoryName string
+	var events, concurrency int
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure sustained events per second written to an organization's database",
+		Long: "Write synthetic rows of one category to a scratch table in an organization's\n" +
+			"database from concurrent writers, the way webhook deliveries arrive, once\n" +
+			"with every event inserted on its own and once batched with write_batch_size\n" +
+			"and write_batch_linger_ms, and report the events per second of each run.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			category, ok := services.CategoryByName(categoryName)
+			if !ok {
+				return fmt.Errorf("unknown category %q", categoryName)
+			}
+			if events < 1 || concurrency < 1 {
+				return errors.New("--events and --concurrency must be at least 1")
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				orgID, err := flags.resolve(ctx, a)
+				if err != nil {
+					return err
+				}
+				db, err := a.tenants.ForOrganization(orgID)
+				if err != nil {
+					return err
+				}
+
+				runs := []struct {
+					name     string
+					batching services.WriteBatching
+				}{
+					{"unbatched", services.WriteBatching{MaxRows: 1}},
+					{"batched", services.WriteBatching{
+						MaxRows: a.cfg.WriteBatchSize,
+						Linger:  time.Duration(a.cfg.WriteBatchLingerMS) * time.Millisecond,
+					}},
+				}
+				var baseline float64
+				for _, run := range runs {
+					rate, err := benchWrites(ctx, a, db, orgID, category, run.batching, events, concurrency)
+					if err != nil {
+						return fmt.Errorf("%s run: %w", run.name, err)
+					}
+					if baseline == 0 {
+						baseline = rate
+						fmt.Printf("%-10s %d events, %.0f events/s\n", run.name, events, rate)
+						continue
+					}
+					fmt.Printf("%-10s %d events, %.0f events/s (%.1fx)\n", run.name, events, rate, rate/baseline)
+				}
+				return nil
+			})
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().StringVar(&categoryName, "category", services.NFTBidsCategory.Name, "category whose rows are written")
+	cmd.Flags().IntVar(&events, "events", 20000, "events written per run")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 64, "concurrent writers")
+	return cmd
+}
+
+// benchWrites writes events synthetic rows to a fresh scratch table with the
+// given batching and returns the events written per second
+func benchWrites(ctx context.Context, a *app, db *gorm.DB, orgID uint, category *services.Category,
+	batching services.WriteBatching, events, concurrency int) (float64, error) {
+	table := services.TableName(0, category) + benchTableSuffix
+	if err := db.WithContext(ctx).Migrator().DropTable(table); err != nil {
+		return 0, fmt.Errorf("failed to drop %s: %w", table, err)
+	}
+	sink := services.NewDatabaseSink(a.tenants, a.partitions, batching)
+	defer func() {
+		sink.Close()
+		db.Migrator().DropTable(table)
+	}()
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	errs := make([]error, concurrency)
+	start := time.Now()
+	for w := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				id := next.Add(1)
+				if id > int64(events) {
+					return
+				}
+				record := &services.SinkRecord{
+					OrganizationID: orgID,
+					EventID:        uint(id),
+					Category:       category,
+					Values:         benchValues(category, id, start),
+					TableSuffix:    benchTableSuffix,
+				}
+				if err := sink.Write(ctx, record); err != nil {
+					errs[w] = err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if err := errors.Join(errs...); err != nil {
+		return 0, err
+	}
+	return float64(events) / elapsed.Seconds(), nil
+}
+
+// benchValues returns a synthetic row for event id
+func benchValues(category *services.Category, id int64, start time.Time) []interface{} {
+	values := make([]interface{}, len(category.Columns))
+	for i, column := range category.Columns {
+		switch column.Type {
+		case services.ColumnText:
+			values[i] = fmt.Sprintf("bench-%s-%d", column.Name, id%1000)
+		case services.ColumnDecimal:
+			values[i] = float64(id) / 100
+		case services.ColumnTimestamp:
+			values[i] = start.Add(time.Duration(id) * time.Millisecond)
+		}
+	}
+	return values
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func newEventsCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Replay stored events and backfill unprocessed ones",
+	}
+
+	cmd.AddCommand(newReplayCommand(opts), newReplaysCommand(opts), newCancelReplayCommand(opts))
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "backfill <webhook-id>",
+		Short: "Index a webhook's stored events that were never processed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				result, err := a.backfill.Run(ctx, id)
+				if result != nil {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					enc.Encode(result)
+				}
+				return err
+			})
+		},
+	})
+
+	return cmd
+}
+
+func newSyncStatusCommand(opts *rootOptions) *cobra.Command {
+	var userID uint
+	cmd := &cobra.Command{
+		Use:   "sync-status",
+		Short: "Show the data sync status recorded for each user",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				statuses, err := a.backfill.SyncStatus(userID)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "USER\tLAST SYNCED\tSYNCED BLOCKS\tERROR")
+				for _, s := range statuses {
+					fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", s.UserID,
+						s.LastSynced.UTC().Format("2006-01-02 15:04:05"), s.SyncedBlocks, s.ErrorLog)
+				}
+				return w.Flush()
+			})
+		},
+	}
+	cmd.Flags().UintVar(&userID, "user", 0, "only show this user")
+	return cmd
+}
@@ -0,0 +1,52 @@
+// Command helixscan operates a HelixScan deployment: it manages users and
+// webhooks, replays and backfills events, rebuilds, prunes and partitions
+// tables, rotates secrets, benchmarks table writes and migrates the schema
+// by talking directly to the platform database. It reads the same
+// configuration as the server.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// rootOptions are the flags shared by every command
+type rootOptions struct {
+	configFile string
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &rootOptions{}
+	cmd := &cobra.Command{
+		Use:           "helixscan",
+		Short:         "Operate a HelixScan deployment",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.PersistentFlags().StringVar(&opts.configFile, "config", "", "path to a YAML config file (default $HELIXSCAN_CONFIG)")
+
+	cmd.AddCommand(
+		newConfigCommand(opts),
+		newMigrateCommand(opts),
+		newUsersCommand(opts),
+		newWebhooksCommand(opts),
+		newEventsCommand(opts),
+		newRebuildCommand(opts),
+		newRetentionCommand(opts),
+		newStorageCommand(opts),
+		newPartitionsCommand(opts),
+		newSyncStatusCommand(opts),
+		newSecretsCommand(opts),
+		newBenchCommand(opts),
+	)
+	return cmd
+}
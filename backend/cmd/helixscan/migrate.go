@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply, roll back or inspect schema migrations",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "up",
+		Short: "Apply every pending migration",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				return a.migrator.Up(ctx)
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "down",
+		Short: "Roll back the latest applied migration",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				return a.migrator.Down(ctx)
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "to <version>",
+		Short: "Migrate up or down to a version",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid version %q", args[0])
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				return a.migrator.To(ctx, version)
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List migrations and when they were applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				statuses, err := a.migrator.Status(ctx)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+				for _, s := range statuses {
+					applied := "pending"
+					if s.AppliedAt != nil {
+						applied = s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+					}
+					fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+				}
+				return w.Flush()
+			})
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"backend/services"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newPartitionsCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "partitions",
+		Short: "Inspect and maintain partitioned tables",
+		Long: "With partition_interval set to daily or monthly, webhook_events and new\n" +
+			"Postgres category tables are range partitioned by time. The server creates\n" +
+			"partitions partition_premake periods ahead every hour and drops event\n" +
+			"partitions older than partition_event_retention_days, or than the longest\n" +
+			"events retention policy if that is longer.",
+	}
+
+	var orgID uint
+	list := &cobra.Command{
+		Use:   "list [table]",
+		Short: "List a table's partitions, webhook_events by default",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			table := services.EventsTable
+			if len(args) == 1 {
+				table = args[0]
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				db := a.db
+				if orgID != 0 {
+					var err error
+					if db, err = a.tenants.ForOrganization(orgID); err != nil {
+						return err
+					}
+				}
+				partitions, err := a.partitions.List(ctx, db, table)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "PARTITION\tFROM\tTO\tROWS (EST.)\tBYTES")
+				for _, p := range partitions {
+					from, to := formatBound(p.From, "MINVALUE"), formatBound(p.To, "MAXVALUE")
+					if p.Default {
+						from, to = "DEFAULT", ""
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", p.Name, from, to, p.Rows, p.Bytes)
+				}
+				return w.Flush()
+			})
+		},
+	}
+	list.Flags().UintVar(&orgID, "org", 0, "list a table in this organization's database")
+	cmd.AddCommand(list)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "maintain",
+		Short: "Partition webhook_events if needed, create coming partitions and drop expired ones now",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				if !a.partitions.Enabled(a.db) {
+					return errors.New("partitioning is disabled; set partition_interval to daily or monthly")
+				}
+				if err := a.partitions.Maintain(ctx); err != nil {
+					return err
+				}
+				fmt.Println("partitions are up to date")
+				return nil
+			})
+		},
+	})
+	return cmd
+}
+
+func formatBound(t *time.Time, unbounded string) string {
+	if t == nil {
+		return unbounded
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
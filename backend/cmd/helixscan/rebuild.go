@@ -0,0 +1,190 @@
+package main
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func newRebuildCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rebuild",
+		Short: "Rebuild category tables from stored events and swap them in",
+		Long: "Rebuild a webhook's category table, for example after changing its schema\n" +
+			"or decoder. The rebuild replays every stored event of the category into\n" +
+			"user_<webhook>_<category>_next, catches up with new events, copies over\n" +
+			"live rows whose events retention already pruned, compares row counts and\n" +
+			"checksums with the live table and swaps the two by renaming them. The\n" +
+			"replaced table is kept as _old for rebuild_retention_hours so the swap can\n" +
+			"be rolled back.",
+	}
+
+	var force, detach bool
+	start := &cobra.Command{
+		Use:   "start <webhook-id> <category>",
+		Short: "Rebuild a table, running here unless --detach is set",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			webhookID, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				job, err := a.rebuilds.Create(webhookID, args[1], force, 0)
+				if err != nil {
+					return err
+				}
+				a.recordAudit(services.AuditEntry{
+					OrganizationID: job.OrganizationID,
+					Action:         services.AuditRebuildCreate,
+					TargetType:     "rebuild",
+					TargetID:       formatID(job.ID),
+					After:          job,
+				})
+				fmt.Printf("created rebuild %d\n", job.ID)
+				if detach {
+					return nil
+				}
+				return executeRebuild(ctx, a, job.ID)
+			})
+		},
+	}
+	start.Flags().BoolVar(&force, "force", false, "swap even if live rows are missing from the rebuilt table")
+	start.Flags().BoolVar(&detach, "detach", false, "queue the rebuild for the server instead of running it here")
+	cmd.AddCommand(start)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "resume <job-id>",
+		Short: "Continue an interrupted rebuild here",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				return executeRebuild(ctx, a, id)
+			})
+		},
+	})
+
+	var webhookID uint
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List rebuild jobs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				jobs, err := a.rebuilds.List(webhookID)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tWEBHOOK\tCATEGORY\tSTATUS\tLIVE ROWS\tNEW ROWS\tMISSING\tCHANGED\tRETAIN UNTIL")
+				for _, job := range jobs {
+					retainUntil := ""
+					if job.Status == models.RebuildSwapped && job.RetainUntil != nil {
+						retainUntil = job.RetainUntil.UTC().Format("2006-01-02 15:04:05")
+					}
+					fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", job.ID, job.WebhookID, job.Category,
+						job.Status, job.LiveRows, job.NextRows, job.MissingRows, job.ChangedRows, retainUntil)
+				}
+				return w.Flush()
+			})
+		},
+	}
+	list.Flags().UintVar(&webhookID, "webhook", 0, "only list this webhook's rebuilds")
+	cmd.AddCommand(list)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show <job-id>",
+		Short: "Show a rebuild job and its comparison of the two tables",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				job, err := a.rebuilds.Get(id)
+				if err != nil {
+					return err
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(job)
+			})
+		},
+	})
+
+	cmd.AddCommand(
+		newRebuildActionCommand(opts, "cancel", "Stop a rebuild that hasn't started swapping", services.AuditRebuildCancel,
+			func(ctx context.Context, a *app, id uint) (*models.RebuildJob, error) { return a.rebuilds.Cancel(id) }),
+		newRebuildActionCommand(opts, "rollback", "Swap the replaced table back in", services.AuditRebuildRollback,
+			func(ctx context.Context, a *app, id uint) (*models.RebuildJob, error) {
+				return a.rebuilds.Rollback(ctx, id)
+			}),
+		newRebuildActionCommand(opts, "finalize", "Drop the replaced table now, ending the rollback period", services.AuditRebuildFinalize,
+			func(ctx context.Context, a *app, id uint) (*models.RebuildJob, error) {
+				return a.rebuilds.Finalize(ctx, id)
+			}),
+	)
+	return cmd
+}
+
+// newRebuildActionCommand builds a command that changes one rebuild job's
+// state and records it in the audit log
+func newRebuildActionCommand(opts *rootOptions, name, short, action string, run func(context.Context, *app, uint) (*models.RebuildJob, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   name + " <job-id>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				job, err := run(ctx, a, id)
+				if err != nil {
+					return err
+				}
+				a.recordAudit(services.AuditEntry{
+					OrganizationID: job.OrganizationID,
+					Action:         action,
+					TargetType:     "rebuild",
+					TargetID:       formatID(job.ID),
+					After:          job,
+				})
+				fmt.Printf("rebuild %d is %s\n", job.ID, job.Status)
+				return nil
+			})
+		},
+	}
+}
+
+// executeRebuild runs a rebuild in the foreground and prints the outcome
+func executeRebuild(ctx context.Context, a *app, id uint) error {
+	err := a.rebuilds.Execute(ctx, id, printReplayProgress)
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("interrupted; resume with: helixscan rebuild resume %d", id)
+	}
+	job, getErr := a.rebuilds.Get(id)
+	if getErr != nil {
+		return errors.Join(err, getErr)
+	}
+	fmt.Printf("rebuild %d is %s: %d live rows, %d rebuilt, %d missing, %d added, %d changed\n",
+		job.ID, job.Status, job.LiveRows, job.NextRows, job.MissingRows, job.AddedRows, job.ChangedRows)
+	if job.Status == models.RebuildSwapped && job.RetainUntil != nil {
+		fmt.Printf("the replaced table is kept until %s; undo with: helixscan rebuild rollback %d\n",
+			job.RetainUntil.UTC().Format("2006-01-02 15:04:05"), job.ID)
+	}
+	return err
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newReplayCommand(opts *rootOptions) *cobra.Command {
+	var input services.ReplayInput
+	var orgID, resumeID uint
+	var userRef, from, to string
+	var detach bool
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Run stored events through the current filter and processors again",
+		Long: "Run stored events through the current filter and processors again, for\n" +
+			"example after fixing a decoder. Select an organization with --org, --user\n" +
+			"(the organization they own) or --webhook, and narrow the events with the\n" +
+			"category, event ID, slot and time flags; bounds are inclusive except --to.\n\n" +
+			"Rows are upserted by event ID, so replaying never duplicates them. With\n" +
+			"--target shadow they go to *_shadow tables instead of the live ones.\n\n" +
+			"The replay runs here and prints its progress; interrupting it leaves the\n" +
+			"job queued for the server or for --resume. With --detach the server runs it.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if input.FromTime, err = parseTimeFlag("from", from); err != nil {
+				return err
+			}
+			if input.ToTime, err = parseTimeFlag("to", to); err != nil {
+				return err
+			}
+			if resumeID == 0 && orgID == 0 && userRef == "" && input.WebhookID == 0 {
+				return errors.New("select events with --org, --user or --webhook, or pass --resume")
+			}
+
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				id := resumeID
+				if id == 0 {
+					org, err := resolveOrganization(ctx, a, orgID, userRef, input.WebhookID)
+					if err != nil {
+						return err
+					}
+					job, err := a.replays.Create(org, 0, input)
+					if err != nil {
+						return err
+					}
+					a.recordAudit(services.AuditEntry{
+						OrganizationID: job.OrganizationID,
+						Action:         services.AuditReplayCreate,
+						TargetType:     "replay",
+						TargetID:       formatID(job.ID),
+						After:          job,
+					})
+					fmt.Printf("created replay %d covering %d events\n", job.ID, job.Total)
+					id = job.ID
+				}
+				if detach {
+					return nil
+				}
+
+				err := a.replays.Execute(ctx, id, printReplayProgress)
+				if errors.Is(err, context.Canceled) {
+					return fmt.Errorf("interrupted; resume with: helixscan events replay --resume %d", id)
+				}
+				return err
+			})
+		},
+	}
+	cmd.Flags().UintVar(&orgID, "org", 0, "replay this organization's events")
+	cmd.Flags().StringVar(&userRef, "user", "", "replay events of the organization this user (ID or email) owns")
+	cmd.Flags().UintVar(&input.WebhookID, "webhook", 0, "only replay this webhook's events")
+	cmd.Flags().StringVar(&input.Category, "category", "", "only replay events of this category")
+	cmd.Flags().UintVar(&input.FromEventID, "from-id", 0, "first event ID")
+	cmd.Flags().UintVar(&input.ToEventID, "to-id", 0, "last event ID")
+	cmd.Flags().Uint64Var(&input.FromSlot, "from-slot", 0, "first slot")
+	cmd.Flags().Uint64Var(&input.ToSlot, "to-slot", 0, "last slot")
+	cmd.Flags().StringVar(&from, "from", "", "replay events from this time (RFC 3339)")
+	cmd.Flags().StringVar(&to, "to", "", "replay events before this time (RFC 3339)")
+	cmd.Flags().StringVar(&input.Target, "target", services.ReplayTargetLive, "tables to write: live or shadow")
+	cmd.Flags().Float64Var(&input.RatePerSecond, "rate", 0, "events per second (default replay_rate_limit)")
+	cmd.Flags().UintVar(&resumeID, "resume", 0, "continue an interrupted replay job instead of creating one")
+	cmd.Flags().BoolVar(&detach, "detach", false, "queue the job for the server instead of running it here")
+	return cmd
+}
+
+func newReplaysCommand(opts *rootOptions) *cobra.Command {
+	var orgID uint
+	cmd := &cobra.Command{
+		Use:   "replays [job-id]",
+		Short: "List replay jobs, or show one with its progress",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				if len(args) == 1 {
+					id, err := parseID(args[0])
+					if err != nil {
+						return err
+					}
+					job, err := a.replays.Get(0, id)
+					if err != nil {
+						return err
+					}
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(job)
+				}
+
+				jobs, err := a.replays.List(orgID)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tORGANIZATION\tTARGET\tSTATUS\tPROGRESS\tFAILED\tCREATED")
+				for _, job := range jobs {
+					fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d/%d\t%d\t%s\n", job.ID, job.OrganizationID, job.Target,
+						job.Status, job.Processed+job.Failed, job.Total, job.Failed,
+						job.CreatedAt.UTC().Format("2006-01-02 15:04:05"))
+				}
+				return w.Flush()
+			})
+		},
+	}
+	cmd.Flags().UintVar(&orgID, "org", 0, "only list this organization's jobs")
+	return cmd
+}
+
+func newCancelReplayCommand(opts *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cancel-replay <job-id>",
+		Short: "Stop a pending or running replay job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				job, err := a.replays.Cancel(0, id)
+				if err != nil {
+					return err
+				}
+				a.recordAudit(services.AuditEntry{
+					OrganizationID: job.OrganizationID,
+					Action:         services.AuditReplayCancel,
+					TargetType:     "replay",
+					TargetID:       formatID(job.ID),
+					After:          job,
+				})
+				fmt.Printf("replay %d is %s\n", job.ID, job.Status)
+				return nil
+			})
+		},
+	}
+}
+
+// resolveOrganization returns the organization selected by --org, by --user
+// as the one that user owns, or by --webhook
+func resolveOrganization(ctx context.Context, a *app, orgID uint, userRef string, webhookID uint) (uint, error) {
+	if orgID != 0 {
+		return orgID, nil
+	}
+	if userRef != "" {
+		user, err := a.accounts.FindUser(userRef)
+		if err != nil {
+			return 0, err
+		}
+		var owned []uint
+		err = a.db.WithContext(ctx).Model(&models.Membership{}).
+			Where("user_id = ? AND role = ?", user.ID, models.RoleOwner).
+			Order("organization_id").Pluck("organization_id", &owned).Error
+		if err != nil {
+			return 0, fmt.Errorf("failed to load memberships: %w", err)
+		}
+		switch len(owned) {
+		case 0:
+			return 0, fmt.Errorf("%s owns no organization", user.Email)
+		case 1:
+			return owned[0], nil
+		default:
+			return 0, fmt.Errorf("%s owns organizations %v; pick one with --org", user.Email, owned)
+		}
+	}
+	webhook, err := a.registry.Get(ctx, webhookID)
+	if err != nil {
+		return 0, err
+	}
+	return webhook.OrganizationID, nil
+}
+
+func printReplayProgress(job *models.ReplayJob) {
+	done := job.Processed + job.Failed
+	percent := 100.0
+	if job.Total > 0 {
+		percent = float64(done) / float64(job.Total) * 100
+	}
+	status := job.Status
+	if status == models.ReplayRunning {
+		status = fmt.Sprintf("%.1f%%", percent)
+	}
+	fmt.Fprintf(os.Stderr, "replay %d: %d/%d events, %d failed, last event %d (%s)\n",
+		job.ID, done, job.Total, job.Failed, job.LastEventID, status)
+}
+
+func parseTimeFlag(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", name, err)
+	}
+	return &t, nil
+}
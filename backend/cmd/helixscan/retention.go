@@ -0,0 +1,227 @@
+package main
+
+import (
+	"backend/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// organizationFlags selects one organization with --org or --user
+type organizationFlags struct {
+	orgID   uint
+	userRef string
+}
+
+func (f *organizationFlags) register(cmd *cobra.Command) {
+	cmd.Flags().UintVar(&f.orgID, "org", 0, "organization ID")
+	cmd.Flags().StringVar(&f.userRef, "user", "", "the organization this user (ID or email) owns")
+}
+
+func (f *organizationFlags) resolve(ctx context.Context, a *app) (uint, error) {
+	if f.orgID == 0 && f.userRef == "" {
+		return 0, errors.New("select an organization with --org or --user")
+	}
+	return resolveOrganization(ctx, a, f.orgID, f.userRef, 0)
+}
+
+func newRetentionCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retention",
+		Short: "Manage how long raw events and category rows are kept",
+		Long: "Manage retention policies. Each policy limits how long an organization\n" +
+			"keeps its raw webhook events (target \"events\") or the rows of one data\n" +
+			"category. The server prunes expired rows every retention_interval_minutes,\n" +
+			"deleting retention_batch_size rows at a time; with --archive they are first\n" +
+			"written as gzip-compressed JSON Lines to the configured archive.",
+	}
+
+	var listFlags organizationFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List retention policies and the outcome of their last run",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				var orgID uint
+				if listFlags.orgID != 0 || listFlags.userRef != "" {
+					var err error
+					if orgID, err = listFlags.resolve(ctx, a); err != nil {
+						return err
+					}
+				}
+				policies, err := a.retention.ListPolicies(orgID)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ORGANIZATION\tTARGET\tMAX AGE\tARCHIVE\tLAST RUN\tPRUNED\tERROR")
+				for _, policy := range policies {
+					lastRun := ""
+					if policy.LastRunAt != nil {
+						lastRun = policy.LastRunAt.UTC().Format("2006-01-02 15:04:05")
+					}
+					fmt.Fprintf(w, "%d\t%s\t%dd\t%t\t%s\t%d\t%s\n", policy.OrganizationID, policy.Target,
+						policy.MaxAgeDays, policy.Archive, lastRun, policy.LastPruned, policy.LastError)
+				}
+				return w.Flush()
+			})
+		},
+	}
+	listFlags.register(list)
+	cmd.AddCommand(list)
+
+	var setFlags organizationFlags
+	var input services.RetentionInput
+	set := &cobra.Command{
+		Use:   "set <target> <max-age-days>",
+		Short: "Keep a target's rows for a number of days",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			maxAge, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid max age %q", args[1])
+			}
+			input.Target, input.MaxAgeDays = args[0], maxAge
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				orgID, err := setFlags.resolve(ctx, a)
+				if err != nil {
+					return err
+				}
+				policy, err := a.retention.SetPolicy(orgID, input)
+				if err != nil {
+					return err
+				}
+				a.recordAudit(services.AuditEntry{
+					OrganizationID: orgID,
+					Action:         services.AuditRetentionUpdate,
+					TargetType:     "retention_policy",
+					TargetID:       policy.Target,
+					After:          policy,
+				})
+				fmt.Printf("organization %d keeps %s for %d days\n", orgID, policy.Target, policy.MaxAgeDays)
+				return nil
+			})
+		},
+	}
+	setFlags.register(set)
+	set.Flags().BoolVar(&input.Archive, "archive", false, "archive rows before pruning them")
+	cmd.AddCommand(set)
+
+	var deleteFlags organizationFlags
+	remove := &cobra.Command{
+		Use:   "delete <target>",
+		Short: "Keep a target's rows forever again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				orgID, err := deleteFlags.resolve(ctx, a)
+				if err != nil {
+					return err
+				}
+				policy, err := a.retention.DeletePolicy(orgID, args[0])
+				if err != nil {
+					return err
+				}
+				a.recordAudit(services.AuditEntry{
+					OrganizationID: orgID,
+					Action:         services.AuditRetentionDelete,
+					TargetType:     "retention_policy",
+					TargetID:       policy.Target,
+					Before:         policy,
+				})
+				fmt.Printf("deleted %s retention policy of organization %d\n", policy.Target, orgID)
+				return nil
+			})
+		},
+	}
+	deleteFlags.register(remove)
+	cmd.AddCommand(remove)
+
+	var runFlags organizationFlags
+	run := &cobra.Command{
+		Use:   "run",
+		Short: "Prune expired rows now instead of waiting for the server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				var orgID uint
+				if runFlags.orgID != 0 || runFlags.userRef != "" {
+					var err error
+					if orgID, err = runFlags.resolve(ctx, a); err != nil {
+						return err
+					}
+				}
+				var failed int
+				for _, policy := range a.retention.PruneAll(ctx, orgID) {
+					if policy.LastError != "" {
+						failed++
+						fmt.Printf("organization %d %s: %d pruned, %s\n", policy.OrganizationID, policy.Target,
+							policy.LastPruned, policy.LastError)
+						continue
+					}
+					fmt.Printf("organization %d %s: %d pruned\n", policy.OrganizationID, policy.Target, policy.LastPruned)
+				}
+				if failed > 0 {
+					return fmt.Errorf("%d retention policies failed", failed)
+				}
+				return ctx.Err()
+			})
+		},
+	}
+	runFlags.register(run)
+	cmd.AddCommand(run)
+	return cmd
+}
+
+func newStorageCommand(opts *rootOptions) *cobra.Command {
+	var flags organizationFlags
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "storage",
+		Short: "Report the storage an organization's events and tables use",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				orgID, err := flags.resolve(ctx, a)
+				if err != nil {
+					return err
+				}
+				usage, err := a.retention.Storage(ctx, orgID)
+				if err != nil {
+					return err
+				}
+				if asJSON {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(usage)
+				}
+
+				oldest := "-"
+				if usage.Events.Oldest != nil {
+					oldest = usage.Events.Oldest.UTC().Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("events: %d rows, %d payload bytes, oldest %s\n", usage.Events.Count, usage.Events.PayloadBytes, oldest)
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "TABLE\tWEBHOOK\tCATEGORY\tROWS\tBYTES")
+				for _, table := range usage.Tables {
+					fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\n", table.Table, table.WebhookID, table.Category, table.Rows, table.Bytes)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				fmt.Printf("total: %d bytes\n", usage.TotalBytes)
+				return nil
+			})
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the report as JSON")
+	return cmd
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"backend/services"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newSecretsCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Rotate signing secrets",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rotate-destination <organization-id> <destination-id>",
+		Short: "Replace a destination's signing secret and print the new one",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			orgID, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			id, err := parseID(args[1])
+			if err != nil {
+				return err
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				secret, err := a.destinations.RotateSecret(orgID, id)
+				if err != nil {
+					return err
+				}
+				a.recordAudit(services.AuditEntry{
+					OrganizationID: orgID,
+					Action:         services.AuditDestinationRotateSecret,
+					TargetType:     "destination",
+					TargetID:       formatID(id),
+				})
+				fmt.Println(secret)
+				return nil
+			})
+		},
+	})
+
+	// Doesn't touch the database: the JWT secret lives in configuration
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rotate-jwt",
+		Short: "Generate a new JWT secret and the settings to roll it out",
+		Long: "Generate a new JWT secret. Deploy the printed settings so new tokens are\n" +
+			"signed with the new secret while tokens signed with the current one stay\n" +
+			"valid; drop the old secret from jwt_previous_secrets once they expire.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(opts)
+			if err != nil {
+				return err
+			}
+			secret, err := services.GenerateToken()
+			if err != nil {
+				return err
+			}
+			previous := append([]string{cfg.JWTSecret}, cfg.PreviousJWTSecrets()...)
+			fmt.Printf("JWT_SECRET=%s\n", secret)
+			fmt.Printf("JWT_PREVIOUS_SECRETS=%s\n", strings.Join(previous, ","))
+			fmt.Printf("# remove the old secret after %d hours\n", cfg.JWTTTLHours)
+			return nil
+		},
+	})
+
+	return cmd
+}
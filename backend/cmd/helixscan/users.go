@@ -0,0 +1,119 @@
+package main
+
+import (
+	"backend/services"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func newUsersCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "users",
+		Short: "Create, list, disable and enable users",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				users, err := a.accounts.ListUsers()
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tEMAIL\tVERIFIED\tDISABLED\tCREATED")
+				for _, user := range users {
+					disabled := "-"
+					if user.DisabledAt != nil {
+						disabled = user.DisabledAt.UTC().Format("2006-01-02 15:04:05")
+					}
+					fmt.Fprintf(w, "%d\t%s\t%t\t%s\t%s\n", user.ID, user.Email, user.EmailVerifiedAt != nil,
+						disabled, user.CreatedAt.UTC().Format("2006-01-02 15:04:05"))
+				}
+				return w.Flush()
+			})
+		},
+	})
+
+	var password string
+	var verified bool
+	create := &cobra.Command{
+		Use:   "create <email>",
+		Short: "Create a user with a personal organization",
+		Long: "Create a user with a personal organization. The password is read from\n" +
+			"$HELIXSCAN_USER_PASSWORD when --password isn't given.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if password == "" {
+				password = os.Getenv("HELIXSCAN_USER_PASSWORD")
+			}
+			if password == "" {
+				return errors.New("a password is required: pass --password or set $HELIXSCAN_USER_PASSWORD")
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				user, org, err := a.accounts.CreateUser(args[0], password, verified)
+				if err != nil {
+					return err
+				}
+				a.recordAudit(services.AuditEntry{
+					OrganizationID: org.ID,
+					Action:         services.AuditUserCreate,
+					TargetType:     "user",
+					TargetID:       formatID(user.ID),
+				})
+				if !verified {
+					if err := a.accounts.SendVerificationEmail(user); err != nil {
+						a.logger.Error("failed to send verification email", "user_id", user.ID, "error", err)
+					}
+				}
+				fmt.Printf("created user %d (%s) with organization %d\n", user.ID, user.Email, org.ID)
+				return nil
+			})
+		},
+	}
+	create.Flags().StringVar(&password, "password", "", "initial password")
+	create.Flags().BoolVar(&verified, "verified", false, "mark the email address verified instead of emailing a link")
+	cmd.AddCommand(create)
+
+	cmd.AddCommand(newSetDisabledCommand(opts, "disable", true))
+	cmd.AddCommand(newSetDisabledCommand(opts, "enable", false))
+
+	return cmd
+}
+
+func newSetDisabledCommand(opts *rootOptions, use string, disabled bool) *cobra.Command {
+	short, action := "Re-enable a disabled user", services.AuditUserEnable
+	if disabled {
+		short, action = "Stop a user from logging in or acting in their organizations", services.AuditUserDisable
+	}
+	return &cobra.Command{
+		Use:   use + " <id|email>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				user, err := a.accounts.FindUser(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to find user %q: %w", args[0], err)
+				}
+				if err := a.accounts.SetDisabled(user, disabled); err != nil {
+					return err
+				}
+				a.recordAudit(services.AuditEntry{
+					Action:     action,
+					TargetType: "user",
+					TargetID:   formatID(user.ID),
+				})
+				fmt.Printf("user %d (%s) %sd\n", user.ID, user.Email, use)
+				return nil
+			})
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func newWebhooksCommand(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "webhooks",
+		Short: "Inspect Helius webhooks and keep them pointed at this environment",
+	}
+
+	var orgID uint
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List registered webhooks",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				webhooks, err := a.registry.List(ctx, orgID)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tORGANIZATION\tHELIUS ID\tACTIVE\tEVENT TYPES\tURL")
+				for _, webhook := range webhooks {
+					fmt.Fprintf(w, "%d\t%d\t%s\t%t\t%s\t%s\n", webhook.ID, webhook.OrganizationID,
+						webhook.WebhookID, webhook.IsActive, webhook.EventTypes, webhook.WebhookURL)
+				}
+				return w.Flush()
+			})
+		},
+	}
+	list.Flags().UintVar(&orgID, "org", 0, "only list this organization's webhooks")
+	cmd.AddCommand(list)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a webhook and counts of its events by outcome",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				webhook, err := a.registry.Get(ctx, id)
+				if err != nil {
+					return err
+				}
+				stats, err := a.registry.EventStats(ctx, id)
+				if err != nil {
+					return err
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(struct {
+					*models.HeliusWebhook
+					Events *services.WebhookEventStats `json:"events"`
+				}{webhook, stats})
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "check",
+		Short: "List webhooks registered with an outdated callback URL",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				stale, err := a.registry.Stale(ctx)
+				if err != nil {
+					return err
+				}
+				if len(stale) == 0 {
+					fmt.Printf("all webhooks point at %s\n", a.registry.CallbackURL())
+					return nil
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tHELIUS ID\tORGANIZATION\tURL")
+				for _, webhook := range stale {
+					fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", webhook.ID, webhook.WebhookID, webhook.OrganizationID, webhook.WebhookURL)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				return fmt.Errorf("%d webhooks do not point at %s; run webhooks sync", len(stale), a.registry.CallbackURL())
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "sync",
+		Short: "Re-point outdated webhooks at the current callback URL via the Helius API",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withApp(opts, func(ctx context.Context, a *app) error {
+				repointed, err := a.registry.Repoint(ctx)
+				for _, webhook := range repointed {
+					fmt.Printf("webhook %d (%s) now points at %s\n", webhook.ID, webhook.WebhookID, a.registry.CallbackURL())
+					a.recordAudit(services.AuditEntry{
+						OrganizationID: webhook.OrganizationID,
+						Action:         services.AuditWebhookRepoint,
+						TargetType:     "webhook",
+						TargetID:       formatID(webhook.ID),
+						Before:         map[string]string{"webhook_url": webhook.WebhookURL},
+						After:          map[string]string{"webhook_url": a.registry.CallbackURL()},
+					})
+				}
+				return err
+			})
+		},
+	})
+
+	return cmd
+}
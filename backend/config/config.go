@@ -1,39 +1,189 @@
 package config
 
-import (
-	"os"
-)
+import "strings"
 
+// Config is the application configuration. Each setting is read, in
+// increasing order of precedence, from its default, the YAML config file,
+// the environment variable in its env tag and the command-line flag named
+// after its yaml tag (db_host becomes -db-host). Fields tagged secret are
+// redacted when the configuration is printed.
 type Config struct {
-	HeliusAPIKey string
-	DBHost       string
-	DBUser       string
-	DBPassword   string
-	DBName       string
-	DBPort       string
-	ServerPort   string
+	HeliusAPIKey      string  `yaml:"helius_api_key" env:"HELIUS_API_KEY" secret:"true"`
+	HeliusBaseURL     string  `yaml:"helius_base_url" env:"HELIUS_BASE_URL"`
+	HeliusRateLimit   float64 `yaml:"helius_rate_limit" env:"HELIUS_RATE_LIMIT"` // Requests per second; 0 disables
+	DBHost            string  `yaml:"db_host" env:"DB_HOST"`
+	DBUser            string  `yaml:"db_user" env:"DB_USER"`
+	DBPassword        string  `yaml:"db_password" env:"DB_PASSWORD" secret:"true"`
+	DBName            string  `yaml:"db_name" env:"DB_NAME"`
+	DBPort            string  `yaml:"db_port" env:"DB_PORT"`
+	DBSSLMode         string  `yaml:"db_sslmode" env:"DB_SSLMODE"`
+	DBMaxOpenConns    int     `yaml:"db_max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	DBMaxIdleConns    int     `yaml:"db_max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	DBConnMaxLifetime int     `yaml:"db_conn_max_lifetime_minutes" env:"DB_CONN_MAX_LIFETIME_MINUTES"`
+
+	TenantMaxOpenConns    int `yaml:"tenant_max_open_conns" env:"TENANT_MAX_OPEN_CONNS"`
+	TenantMaxIdleConns    int `yaml:"tenant_max_idle_conns" env:"TENANT_MAX_IDLE_CONNS"`
+	TenantConnMaxLifetime int `yaml:"tenant_conn_max_lifetime_minutes" env:"TENANT_CONN_MAX_LIFETIME_MINUTES"`
+
+	Environment       string `yaml:"environment" env:"HELIXSCAN_ENV"`               // dev, staging or prod
+	WebhookPathPrefix string `yaml:"webhook_path_prefix" env:"WEBHOOK_PATH_PREFIX"` // Defaults to /webhooks/<environment>
+
+	ServerPort    string `yaml:"server_port" env:"SERVER_PORT"`
+	AppURL        string `yaml:"app_url" env:"APP_URL"`                 // Frontend, used in email links
+	PublicBaseURL string `yaml:"public_base_url" env:"PUBLIC_BASE_URL"` // Where Helius and API clients reach this server
+
+	JWTSecret          string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	JWTPreviousSecrets string `yaml:"jwt_previous_secrets" env:"JWT_PREVIOUS_SECRETS" secret:"true"` // Comma-separated; still accepted while tokens signed with them expire
+	JWTTTLHours        int    `yaml:"jwt_ttl_hours" env:"JWT_TTL_HOURS"`
+
+	AuthRateLimit int `yaml:"auth_rate_limit" env:"AUTH_RATE_LIMIT"` // Requests per minute per IP to /auth; 0 disables
+	APIRateLimit  int `yaml:"api_rate_limit" env:"API_RATE_LIMIT"`   // Requests per minute per IP to /api; 0 disables
+
+	MailDriver   string `yaml:"mail_driver" env:"MAIL_DRIVER"`
+	MailFrom     string `yaml:"mail_from" env:"MAIL_FROM"`
+	MailFilePath string `yaml:"mail_file_path" env:"MAIL_FILE_PATH"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUser     string `yaml:"smtp_user" env:"SMTP_USER"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+
+	GraphQLMaxComplexity int `yaml:"graphql_max_complexity" env:"GRAPHQL_MAX_COMPLEXITY"`
+	GraphQLMaxDepth      int `yaml:"graphql_max_depth" env:"GRAPHQL_MAX_DEPTH"`
+
+	ForwardWorkers     int `yaml:"forward_workers" env:"FORWARD_WORKERS"`
+	ForwardMaxAttempts int `yaml:"forward_max_attempts" env:"FORWARD_MAX_ATTEMPTS"`
+	AlertWorkers       int `yaml:"alert_workers" env:"ALERT_WORKERS"`
+
+	WriteBatchSize     int `yaml:"write_batch_size" env:"WRITE_BATCH_SIZE"`           // Rows per insert into organization tables; 1 writes each event on its own
+	WriteBatchLingerMS int `yaml:"write_batch_linger_ms" env:"WRITE_BATCH_LINGER_MS"` // How long a batch waits for more rows before it is written
+
+	ReplayRateLimit       float64 `yaml:"replay_rate_limit" env:"REPLAY_RATE_LIMIT"`             // Events per second for replay jobs that don't set a rate; 0 is unlimited
+	RebuildRetentionHours int     `yaml:"rebuild_retention_hours" env:"REBUILD_RETENTION_HOURS"` // How long a table replaced by a rebuild is kept for rollback
+
+	RetentionIntervalMinutes int `yaml:"retention_interval_minutes" env:"RETENTION_INTERVAL_MINUTES"`
+	RetentionBatchSize       int `yaml:"retention_batch_size" env:"RETENTION_BATCH_SIZE"` // Rows deleted per statement
+
+	PartitionInterval           string `yaml:"partition_interval" env:"PARTITION_INTERVAL"`                         // none, daily or monthly
+	PartitionPremake            int    `yaml:"partition_premake" env:"PARTITION_PREMAKE"`                           // Partitions kept created ahead of the current one
+	PartitionEventRetentionDays int    `yaml:"partition_event_retention_days" env:"PARTITION_EVENT_RETENTION_DAYS"` // Event partitions older than this and every events retention policy are dropped; 0 keeps them
+
+	ArchiveDriver      string `yaml:"archive_driver" env:"ARCHIVE_DRIVER"` // none, local or s3
+	ArchiveDir         string `yaml:"archive_dir" env:"ARCHIVE_DIR"`
+	ArchiveS3Endpoint  string `yaml:"archive_s3_endpoint" env:"ARCHIVE_S3_ENDPOINT"`
+	ArchiveS3Region    string `yaml:"archive_s3_region" env:"ARCHIVE_S3_REGION"`
+	ArchiveS3Bucket    string `yaml:"archive_s3_bucket" env:"ARCHIVE_S3_BUCKET"`
+	ArchiveS3AccessKey string `yaml:"archive_s3_access_key" env:"ARCHIVE_S3_ACCESS_KEY"`
+	ArchiveS3SecretKey string `yaml:"archive_s3_secret_key" env:"ARCHIVE_S3_SECRET_KEY" secret:"true"`
+
+	ShutdownTimeoutSeconds int  `yaml:"shutdown_timeout_seconds" env:"SHUTDOWN_TIMEOUT_SECONDS"`
+	MigrateOnStart         bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+
+	LogLevel  string `yaml:"log_level" env:"LOG_LEVEL"`
+	LogFormat string `yaml:"log_format" env:"LOG_FORMAT"`
+
+	OTLPEndpoint     string  `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OTLPInsecure     bool    `yaml:"otlp_insecure" env:"OTEL_EXPORTER_OTLP_INSECURE"`
+	TraceServiceName string  `yaml:"trace_service_name" env:"OTEL_SERVICE_NAME"`
+	TraceSampler     string  `yaml:"trace_sampler" env:"TRACE_SAMPLER"`
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio" env:"TRACE_SAMPLE_RATIO"`
 }
 
-func LoadConfig() *Config {
+// Defaults returns the configuration used for settings that aren't set
+// anywhere else. Credentials have no defaults.
+func Defaults() *Config {
 	return &Config{
-		HeliusAPIKey: getEnvOrDefault("HELIUS_API_KEY", ""),
-		DBHost:       getEnvOrDefault("DB_HOST", "localhost"),
-		DBUser:       getEnvOrDefault("DB_USER", "bounty"),
-		DBPassword:   getEnvOrDefault("DB_PASSWORD", "bounty123"),
-		DBName:       getEnvOrDefault("DB_NAME", "bounty_db"),
-		DBPort:       getEnvOrDefault("DB_PORT", "5432"),
-		ServerPort:   getEnvOrDefault("SERVER_PORT", "3000"),
+		HeliusBaseURL:     "https://api.helius.xyz/v0",
+		HeliusRateLimit:   5,
+		DBHost:            "localhost",
+		DBPort:            "5432",
+		DBSSLMode:         "disable",
+		DBMaxOpenConns:    25,
+		DBMaxIdleConns:    5,
+		DBConnMaxLifetime: 30,
+
+		TenantMaxOpenConns:    10,
+		TenantMaxIdleConns:    2,
+		TenantConnMaxLifetime: 30,
+
+		Environment: "dev",
+
+		ServerPort:    "3000",
+		AppURL:        "http://localhost:3000",
+		PublicBaseURL: "http://localhost:3000",
+
+		JWTTTLHours: 24,
+
+		AuthRateLimit: 30,
+		APIRateLimit:  600,
+
+		MailDriver:   "log",
+		MailFrom:     "no-reply@helixscan.local",
+		MailFilePath: "mail.log",
+		SMTPHost:     "localhost",
+		SMTPPort:     "587",
+
+		GraphQLMaxComplexity: 5000,
+		GraphQLMaxDepth:      8,
+
+		ForwardWorkers:     4,
+		ForwardMaxAttempts: 8,
+		AlertWorkers:       2,
+
+		WriteBatchSize:     500,
+		WriteBatchLingerMS: 5,
+
+		ReplayRateLimit:       100,
+		RebuildRetentionHours: 72,
+
+		RetentionIntervalMinutes: 60,
+		RetentionBatchSize:       1000,
+
+		PartitionInterval: "none",
+		PartitionPremake:  3,
+
+		ArchiveDriver:   "none",
+		ArchiveDir:      "archive",
+		ArchiveS3Region: "us-east-1",
+
+		ShutdownTimeoutSeconds: 30,
+		MigrateOnStart:         true,
+
+		LogLevel:  "info",
+		LogFormat: "text",
+
+		TraceServiceName: "helixscan",
+		TraceSampler:     "always",
+		TraceSampleRatio: 1,
 	}
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// PreviousJWTSecrets returns the non-empty entries of JWTPreviousSecrets
+func (c *Config) PreviousJWTSecrets() []string {
+	var secrets []string
+	for _, secret := range strings.Split(c.JWTPreviousSecrets, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
 	}
-	return defaultValue
+	return secrets
+}
+
+// WebhookPath returns the path Helius delivers this environment's events
+// to. Each environment gets its own so they never receive each other's.
+func (c *Config) WebhookPath() string {
+	prefix := c.WebhookPathPrefix
+	if prefix == "" {
+		prefix = "/webhooks/" + c.Environment
+	}
+	return strings.TrimSuffix(prefix, "/") + "/helius"
+}
+
+// WebhookURL returns the public URL of WebhookPath
+func (c *Config) WebhookURL() string {
+	return strings.TrimSuffix(c.PublicBaseURL, "/") + c.WebhookPath()
 }
 
 func (c *Config) GetDSN() string {
 	return "host=" + c.DBHost + " user=" + c.DBUser + " password=" + c.DBPassword +
-		" dbname=" + c.DBName + " port=" + c.DBPort + " sslmode=disable"
-}
\ No newline at end of file
+		" dbname=" + c.DBName + " port=" + c.DBPort + " sslmode=" + c.DBSSLMode
+}
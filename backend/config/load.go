@@ -0,0 +1,149 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the config file when -config isn't given
+const ConfigFileEnv = "HELIXSCAN_CONFIG"
+
+const redacted = "********"
+
+// Load builds the configuration from defaults, the config file, the
+// environment and args, then validates it. It returns the arguments left
+// after flags.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Defaults()
+
+	fs := flag.NewFlagSet("helixscan", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(ConfigFileEnv), "path to a YAML config file")
+	flagValues := make(map[string]string)
+	eachSetting(cfg, func(s setting) {
+		name := strings.ReplaceAll(s.key, "_", "-")
+		usage := "overrides " + s.key
+		if s.env != "" {
+			usage += " and $" + s.env
+		}
+		fs.Func(name, usage, func(value string) error {
+			flagValues[s.key] = value
+			return nil
+		})
+	})
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var problems []string
+	eachSetting(cfg, func(s setting) {
+		if value, ok := os.LookupEnv(s.env); ok && s.env != "" && value != "" {
+			if err := s.set(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v (from $%s)", s.key, err, s.env))
+			}
+		}
+		if value, ok := flagValues[s.key]; ok {
+			if err := s.set(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v (from -%s)", s.key, err, strings.ReplaceAll(s.key, "_", "-")))
+			}
+		}
+	})
+	if len(problems) > 0 {
+		return nil, nil, &ValidationError{Problems: problems}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Redacted returns the configuration as YAML with secrets masked
+func (c *Config) Redacted() ([]byte, error) {
+	masked := *c
+	eachSetting(&masked, func(s setting) {
+		if s.secret && !s.value.IsZero() {
+			s.value.SetString(redacted)
+		}
+	})
+	return yaml.Marshal(&masked)
+}
+
+// setting is one configurable field
+type setting struct {
+	key    string
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+func eachSetting(cfg *Config, fn func(setting)) {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fn(setting{
+			key:    field.Tag.Get("yaml"),
+			env:    field.Tag.Get("env"),
+			secret: field.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+}
+
+// set parses raw into the setting according to its type
+func (s setting) set(raw string) error {
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", raw)
+		}
+		s.value.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		s.value.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", raw)
+		}
+		s.value.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const minJWTSecretLength = 32
+
+// Keeps a batched insert of the widest category table under the 65535
+// parameters Postgres allows in one statement
+const maxWriteBatchSize = 5000
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks that required settings are present and values are in
+// range, reporting all problems at once
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.required("helius_api_key", c.HeliusAPIKey)
+	v.url("helius_base_url", c.HeliusBaseURL)
+	v.atLeast("helius_rate_limit", c.HeliusRateLimit, 0)
+
+	v.required("db_host", c.DBHost)
+	v.required("db_user", c.DBUser)
+	v.required("db_name", c.DBName)
+	v.port("db_port", c.DBPort)
+	v.oneOf("db_sslmode", c.DBSSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	v.pool("db", c.DBMaxOpenConns, c.DBMaxIdleConns, c.DBConnMaxLifetime)
+	v.pool("tenant", c.TenantMaxOpenConns, c.TenantMaxIdleConns, c.TenantConnMaxLifetime)
+
+	v.oneOf("environment", c.Environment, "dev", "staging", "prod")
+	if c.WebhookPathPrefix != "" && !strings.HasPrefix(c.WebhookPathPrefix, "/") {
+		v.add("webhook_path_prefix", "must start with /")
+	}
+
+	v.port("server_port", c.ServerPort)
+	v.url("app_url", c.AppURL)
+	v.url("public_base_url", c.PublicBaseURL)
+	// Helius has to reach the callback URL from the internet
+	if u, err := url.Parse(c.PublicBaseURL); err == nil && c.Environment != "dev" {
+		if u.Scheme != "https" {
+			v.add("public_base_url", "must use https outside dev")
+		}
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" {
+			v.add("public_base_url", "must be publicly reachable outside dev")
+		}
+	}
+
+	v.required("jwt_secret", c.JWTSecret)
+	if c.JWTSecret != "" && len(c.JWTSecret) < minJWTSecretLength {
+		v.add("jwt_secret", fmt.Sprintf("must be at least %d characters", minJWTSecretLength))
+	}
+	v.atLeast("jwt_ttl_hours", float64(c.JWTTTLHours), 1)
+
+	v.atLeast("auth_rate_limit", float64(c.AuthRateLimit), 0)
+	v.atLeast("api_rate_limit", float64(c.APIRateLimit), 0)
+
+	v.oneOf("mail_driver", c.MailDriver, "smtp", "file", "log")
+	if c.MailDriver == "log" && c.Environment == "prod" {
+		v.add("mail_driver", "must not be log in prod, which delivers no mail")
+	}
+	v.required("mail_from", c.MailFrom)
+	if c.MailDriver == "smtp" {
+		v.required("smtp_host", c.SMTPHost)
+		v.port("smtp_port", c.SMTPPort)
+	}
+
+	v.atLeast("graphql_max_complexity", float64(c.GraphQLMaxComplexity), 1)
+	v.atLeast("graphql_max_depth", float64(c.GraphQLMaxDepth), 1)
+	v.atLeast("forward_workers", float64(c.ForwardWorkers), 1)
+	v.atLeast("forward_max_attempts", float64(c.ForwardMaxAttempts), 1)
+	v.atLeast("alert_workers", float64(c.AlertWorkers), 1)
+	v.atLeast("write_batch_size", float64(c.WriteBatchSize), 1)
+	if c.WriteBatchSize > maxWriteBatchSize {
+		v.add("write_batch_size", fmt.Sprintf("must be at most %d", maxWriteBatchSize))
+	}
+	v.atLeast("write_batch_linger_ms", float64(c.WriteBatchLingerMS), 0)
+	v.atLeast("replay_rate_limit", c.ReplayRateLimit, 0)
+	v.atLeast("rebuild_retention_hours", float64(c.RebuildRetentionHours), 0)
+	v.atLeast("retention_interval_minutes", float64(c.RetentionIntervalMinutes), 1)
+	v.atLeast("retention_batch_size", float64(c.RetentionBatchSize), 1)
+
+	v.oneOf("partition_interval", c.PartitionInterval, "none", "daily", "monthly")
+	v.atLeast("partition_premake", float64(c.PartitionPremake), 1)
+	v.atLeast("partition_event_retention_days", float64(c.PartitionEventRetentionDays), 0)
+
+	v.oneOf("archive_driver", c.ArchiveDriver, "none", "local", "s3")
+	switch c.ArchiveDriver {
+	case "local":
+		v.required("archive_dir", c.ArchiveDir)
+	case "s3":
+		v.url("archive_s3_endpoint", c.ArchiveS3Endpoint)
+		v.required("archive_s3_bucket", c.ArchiveS3Bucket)
+		v.required("archive_s3_access_key", c.ArchiveS3AccessKey)
+		v.required("archive_s3_secret_key", c.ArchiveS3SecretKey)
+	}
+	v.atLeast("shutdown_timeout_seconds", float64(c.ShutdownTimeoutSeconds), 1)
+
+	v.oneOf("log_level", strings.ToLower(c.LogLevel), "debug", "info", "warn", "error")
+	v.oneOf("log_format", strings.ToLower(c.LogFormat), "text", "json")
+
+	v.oneOf("trace_sampler", c.TraceSampler, "always", "never", "ratio")
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		v.add("trace_sample_ratio", "must be between 0 and 1")
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(key, problem string) {
+	v.problems = append(v.problems, key+": "+problem)
+}
+
+func (v *validator) required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(key, "is required")
+	}
+}
+
+func (v *validator) url(key, value string) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(key, fmt.Sprintf("%q is not an http(s) URL", value))
+	}
+}
+
+func (v *validator) port(key, value string) {
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		v.add(key, fmt.Sprintf("%q is not a port number", value))
+	}
+}
+
+func (v *validator) atLeast(key string, value, min float64) {
+	if value < min {
+		v.add(key, fmt.Sprintf("must be at least %g", min))
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(key, fmt.Sprintf("%q must be one of %s", value, strings.Join(allowed, ", ")))
+}
+
+func (v *validator) pool(prefix string, maxOpen, maxIdle, lifetime int) {
+	v.atLeast(prefix+"_max_open_conns", float64(maxOpen), 1)
+	v.atLeast(prefix+"_max_idle_conns", float64(maxIdle), 0)
+	if maxIdle > maxOpen {
+		v.add(prefix+"_max_idle_conns", "must not exceed "+prefix+"_max_open_conns")
+	}
+	v.atLeast(prefix+"_conn_max_lifetime_minutes", float64(lifetime), 1)
+}
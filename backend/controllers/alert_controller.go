@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/services"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AlertController struct {
+	alertService *services.AlertService
+	auditService *services.AuditService
+}
+
+func NewAlertController(alertService *services.AlertService, auditService *services.AuditService) *AlertController {
+	return &AlertController{
+		alertService: alertService,
+		auditService: auditService,
+	}
+}
+
+// ListRules returns the active organization's alert rules
+func (c *AlertController) ListRules(ctx *fiber.Ctx) error {
+	rules, err := c.alertService.List(middleware.CurrentOrganizationID(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list alert rules",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(rules)
+}
+
+// CreateRule adds an alert rule
+func (c *AlertController) CreateRule(ctx *fiber.Ctx) error {
+	var req services.AlertRuleInput
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	rule, err := c.alertService.Create(middleware.CurrentOrganizationID(ctx), req)
+	if err != nil {
+		return ctx.Status(alertErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditAlertRuleCreate,
+		TargetType: "alert_rule",
+		TargetID:   strconv.FormatUint(uint64(rule.ID), 10),
+		After:      rule,
+	})
+
+	return ctx.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// UpdateRule replaces an alert rule's settings
+func (c *AlertController) UpdateRule(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid alert rule ID",
+		})
+	}
+
+	var req services.AlertRuleInput
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	before, after, err := c.alertService.Update(middleware.CurrentOrganizationID(ctx), uint(id), req)
+	if err != nil {
+		return ctx.Status(alertErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditAlertRuleUpdate,
+		TargetType: "alert_rule",
+		TargetID:   strconv.FormatUint(id, 10),
+		Before:     before,
+		After:      after,
+	})
+
+	return ctx.Status(fiber.StatusOK).JSON(after)
+}
+
+// DeleteRule removes an alert rule, keeping its history
+func (c *AlertController) DeleteRule(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid alert rule ID",
+		})
+	}
+
+	rule, err := c.alertService.Delete(middleware.CurrentOrganizationID(ctx), uint(id))
+	if err != nil {
+		return ctx.Status(alertErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditAlertRuleDelete,
+		TargetType: "alert_rule",
+		TargetID:   strconv.FormatUint(id, 10),
+		Before:     rule,
+	})
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// RuleHistory returns the times an alert rule fired, newest first
+func (c *AlertController) RuleHistory(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid alert rule ID",
+		})
+	}
+
+	orgID := middleware.CurrentOrganizationID(ctx)
+	if _, err := c.alertService.Get(orgID, uint(id)); err != nil {
+		return ctx.Status(alertErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := c.alertService.History(orgID, uint(id), ctx.QueryInt("page", 1), ctx.QueryInt("page_size", 0))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load alert history",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(page)
+}
+
+// ListAlertEvents returns every alert fired in the active organization
+func (c *AlertController) ListAlertEvents(ctx *fiber.Ctx) error {
+	page, err := c.alertService.History(middleware.CurrentOrganizationID(ctx), 0,
+		ctx.QueryInt("page", 1), ctx.QueryInt("page_size", 0))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load alert history",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(page)
+}
+
+func alertErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAlertRuleNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrInvalidAlertRule):
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
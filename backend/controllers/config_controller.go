@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	errPasswordRequired     = "Password is required when the driver, host, port or username changes"
+	errSinkPasswordRequired = "Password is required when the driver, addresses or username change"
+)
+
+type ConfigController struct {
+	db            *gorm.DB
+	tenants       *services.TenantDBManager
+	filterService *services.FilterService
+	auditService  *services.AuditService
+}
+
+func NewConfigController(db *gorm.DB, tenants *services.TenantDBManager, filterService *services.FilterService, auditService *services.AuditService) *ConfigController {
+	return &ConfigController{
+		db:            db,
+		tenants:       tenants,
+		filterService: filterService,
+		auditService:  auditService,
+	}
+}
+
+type DatabaseConfigRequest struct {
+	Driver   string `json:"driver"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	DbName   string `json:"db_name"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type SinkConfigRequest struct {
+	Driver    string `json:"driver"`
+	Addresses string `json:"addresses"`
+	Prefix    string `json:"prefix"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	TLS       bool   `json:"tls"`
+}
+
+type IndexingPreferenceRequest struct {
+	NFTBids          bool   `json:"nft_bids"`
+	NFTPrices        bool   `json:"nft_prices"`
+	BorrowableTokens bool   `json:"borrowable_tokens"`
+	TokenPrices      bool   `json:"token_prices"`
+	CustomFilters    string `json:"custom_filters"`
+}
+
+// GetDatabaseConfig returns the active organization's database configuration
+// with the password omitted
+func (c *ConfigController) GetDatabaseConfig(ctx *fiber.Ctx) error {
+	var dbConfig models.DatabaseConfig
+	err := c.db.Where("organization_id = ?", middleware.CurrentOrganizationID(ctx)).First(&dbConfig).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Database configuration not set",
+		})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load database configuration",
+		})
+	}
+
+	dbConfig.Password = ""
+	return ctx.Status(fiber.StatusOK).JSON(dbConfig)
+}
+
+// UpdateDatabaseConfig creates or replaces the active organization's database
+// configuration. An empty password keeps the saved one, as long as the
+// driver, host, port and username are unchanged.
+func (c *ConfigController) UpdateDatabaseConfig(ctx *fiber.Ctx) error {
+	var req DatabaseConfigRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := services.ValidateDriver(req.Driver); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	orgID := middleware.CurrentOrganizationID(ctx)
+	var dbConfig models.DatabaseConfig
+	c.db.Where("organization_id = ?", orgID).First(&dbConfig)
+	before := dbConfig
+
+	dbConfig.OrganizationID = orgID
+	dbConfig.Driver = req.Driver
+	if dbConfig.Driver == "" {
+		dbConfig.Driver = models.DriverPostgres
+	}
+	dbConfig.Host = req.Host
+	dbConfig.Port = req.Port
+	dbConfig.DbName = req.DbName
+	dbConfig.Username = req.Username
+	// The password is never returned, so an empty one keeps the saved one,
+	// but only for the server it was given for
+	if req.Password != "" {
+		dbConfig.Password = req.Password
+	} else if before.Password != "" && !dbConfig.SameServer(&before) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errPasswordRequired,
+		})
+	}
+
+	if err := c.db.Save(&dbConfig).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save database configuration",
+		})
+	}
+	c.tenants.Invalidate(orgID)
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditDatabaseConfigSave,
+		TargetType: "database_config",
+		TargetID:   strconv.FormatUint(uint64(dbConfig.ID), 10),
+		Before:     before,
+		After:      dbConfig,
+	})
+
+	dbConfig.Password = ""
+	return ctx.Status(fiber.StatusOK).JSON(dbConfig)
+}
+
+// TestDatabaseConfig checks that the database described in the request body
+// is reachable. An empty password reuses the saved one, as long as the
+// driver, host, port and username are unchanged.
+func (c *ConfigController) TestDatabaseConfig(ctx *fiber.Ctx) error {
+	var req DatabaseConfigRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := services.ValidateDriver(req.Driver); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	dbConfig := models.DatabaseConfig{
+		Driver:   req.Driver,
+		Host:     req.Host,
+		Port:     req.Port,
+		DbName:   req.DbName,
+		Username: req.Username,
+		Password: req.Password,
+	}
+	if dbConfig.Driver == "" {
+		dbConfig.Driver = models.DriverPostgres
+	}
+	if dbConfig.Password == "" {
+		var saved models.DatabaseConfig
+		if c.db.Where("organization_id = ?", middleware.CurrentOrganizationID(ctx)).First(&saved).Error == nil && saved.Password != "" {
+			// Otherwise the saved password could be sent to any server
+			if !dbConfig.SameServer(&saved) {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": errPasswordRequired,
+				})
+			}
+			dbConfig.Password = saved.Password
+		}
+	}
+
+	if err := services.TestConnection(&dbConfig); err != nil {
+		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"ok":    false,
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"ok": true,
+	})
+}
+
+// GetSinkConfig returns the active organization's sink configuration with
+// the password omitted. Organizations without one use Postgres.
+func (c *ConfigController) GetSinkConfig(ctx *fiber.Ctx) error {
+	var sinkConfig models.SinkConfig
+	err := c.db.Where("organization_id = ?", middleware.CurrentOrganizationID(ctx)).First(&sinkConfig).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ctx.Status(fiber.StatusOK).JSON(models.SinkConfig{
+			OrganizationID: middleware.CurrentOrganizationID(ctx),
+			Driver:         models.SinkPostgres,
+		})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load sink configuration",
+		})
+	}
+
+	sinkConfig.Password = ""
+	return ctx.Status(fiber.StatusOK).JSON(sinkConfig)
+}
+
+// UpdateSinkConfig creates or replaces the active organization's sink
+// configuration. An empty password keeps the saved one, as long as the
+// driver, addresses and username are unchanged.
+func (c *ConfigController) UpdateSinkConfig(ctx *fiber.Ctx) error {
+	var req SinkConfigRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	orgID := middleware.CurrentOrganizationID(ctx)
+	var sinkConfig models.SinkConfig
+	c.db.Where("organization_id = ?", orgID).First(&sinkConfig)
+	before := sinkConfig
+
+	sinkConfig.OrganizationID = orgID
+	sinkConfig.Driver = req.Driver
+	sinkConfig.Addresses = req.Addresses
+	sinkConfig.Prefix = req.Prefix
+	sinkConfig.Username = req.Username
+	// The password is never returned, so an empty one keeps the saved one,
+	// but only for the servers it was given for
+	if req.Password != "" {
+		sinkConfig.Password = req.Password
+	} else if before.Password != "" && !sinkConfig.SameServer(&before) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errSinkPasswordRequired,
+		})
+	}
+	sinkConfig.TLS = req.TLS
+
+	if err := services.ValidateSinkConfig(&sinkConfig); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := c.db.Save(&sinkConfig).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save sink configuration",
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditSinkConfigSave,
+		TargetType: "sink_config",
+		TargetID:   strconv.FormatUint(uint64(sinkConfig.ID), 10),
+		Before:     before,
+		After:      sinkConfig,
+	})
+
+	sinkConfig.Password = ""
+	return ctx.Status(fiber.StatusOK).JSON(sinkConfig)
+}
+
+// GetIndexingPreference returns the active organization's indexing preferences
+func (c *ConfigController) GetIndexingPreference(ctx *fiber.Ctx) error {
+	var pref models.IndexingPreference
+	err := c.db.Where("organization_id = ?", middleware.CurrentOrganizationID(ctx)).First(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Indexing preferences not set",
+		})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load indexing preferences",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(pref)
+}
+
+// UpdateIndexingPreference creates or replaces the active organization's indexing preferences
+func (c *ConfigController) UpdateIndexingPreference(ctx *fiber.Ctx) error {
+	var req IndexingPreferenceRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	orgID := middleware.CurrentOrganizationID(ctx)
+	var pref models.IndexingPreference
+	c.db.Where("organization_id = ?", orgID).First(&pref)
+	before := pref
+
+	pref.OrganizationID = orgID
+	pref.NFTBids = req.NFTBids
+	pref.NFTPrices = req.NFTPrices
+	pref.BorrowableTokens = req.BorrowableTokens
+	pref.TokenPrices = req.TokenPrices
+	pref.CustomFilters = req.CustomFilters
+	if pref.CustomFilters == "" {
+		pref.CustomFilters = "{}"
+	}
+	if _, err := services.ParseFilter(pref.CustomFilters); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := c.db.Save(&pref).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save indexing preferences",
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditIndexingConfigSave,
+		TargetType: "indexing_preference",
+		TargetID:   strconv.FormatUint(uint64(pref.ID), 10),
+		Before:     before,
+		After:      pref,
+	})
+
+	// Counts from the previous filter no longer describe the new one
+	if pref.CustomFilters != before.CustomFilters {
+		if err := c.filterService.ResetStats(orgID); err != nil {
+			middleware.Logger(ctx).Error("failed to reset filter stats", "organization_id", orgID, "error", err)
+		}
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(pref)
+}
+
+// GetFilterStats returns how many events the active organization's custom
+// filter has kept and dropped since it last changed
+func (c *ConfigController) GetFilterStats(ctx *fiber.Ctx) error {
+	stats, err := c.filterService.Stats(middleware.CurrentOrganizationID(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load filter stats",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(stats)
+}
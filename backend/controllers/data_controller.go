@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/services"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DataController struct {
+	queryService *services.QueryService
+}
+
+func NewDataController(queryService *services.QueryService) *DataController {
+	return &DataController{queryService: queryService}
+}
+
+// QueryCategory returns indexed rows for a category. Supported query
+// parameters: address, marketplace, platform, from, to (RFC 3339),
+// min_amount, max_amount, sort (prefix "-" for descending), cursor,
+// limit and fields (comma-separated).
+func (c *DataController) QueryCategory(ctx *fiber.Ctx) error {
+	q := services.DataQuery{
+		Address:     ctx.Query("address"),
+		Marketplace: ctx.Query("marketplace"),
+		Platform:    ctx.Query("platform"),
+		Sort:        ctx.Query("sort"),
+		Cursor:      ctx.Query("cursor"),
+		Limit:       ctx.QueryInt("limit", 0),
+	}
+	if fields := ctx.Query("fields"); fields != "" {
+		q.Fields = strings.Split(fields, ",")
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(ctx.Query("from")); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid from timestamp, expected RFC 3339",
+		})
+	}
+	if q.To, err = parseTimeParam(ctx.Query("to")); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid to timestamp, expected RFC 3339",
+		})
+	}
+	if q.MinAmount, err = parseAmountParam(ctx.Query("min_amount")); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid min_amount",
+		})
+	}
+	if q.MaxAmount, err = parseAmountParam(ctx.Query("max_amount")); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid max_amount",
+		})
+	}
+
+	page, err := c.queryService.Query(middleware.CurrentOrganizationID(ctx), ctx.Params("category"), q)
+	if err != nil {
+		return ctx.Status(dataErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(page)
+}
+
+func parseAmountParam(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &amount, nil
+}
+
+func dataErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUnknownCategory):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrInvalidField), errors.Is(err, services.ErrInvalidSort),
+		errors.Is(err, services.ErrInvalidCursor), errors.Is(err, services.ErrFilterNotValid):
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
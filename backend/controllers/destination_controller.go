@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/services"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DestinationController struct {
+	destinationService *services.DestinationService
+	auditService       *services.AuditService
+}
+
+func NewDestinationController(destinationService *services.DestinationService, auditService *services.AuditService) *DestinationController {
+	return &DestinationController{
+		destinationService: destinationService,
+		auditService:       auditService,
+	}
+}
+
+// ListDestinations returns the active organization's destinations
+func (c *DestinationController) ListDestinations(ctx *fiber.Ctx) error {
+	destinations, err := c.destinationService.List(middleware.CurrentOrganizationID(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list destinations",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(destinations)
+}
+
+// CreateDestination adds a destination and returns its signing secret
+func (c *DestinationController) CreateDestination(ctx *fiber.Ctx) error {
+	var req services.DestinationInput
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	destination, secret, err := c.destinationService.Create(middleware.CurrentOrganizationID(ctx), req)
+	if err != nil {
+		return ctx.Status(destinationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditDestinationCreate,
+		TargetType: "destination",
+		TargetID:   strconv.FormatUint(uint64(destination.ID), 10),
+		After:      destination,
+	})
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"destination": destination,
+		"secret":      secret,
+	})
+}
+
+// UpdateDestination changes a destination's name, URL, categories or state
+func (c *DestinationController) UpdateDestination(ctx *fiber.Ctx) error {
+	id, err := destinationIDParam(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid destination ID",
+		})
+	}
+
+	var req services.DestinationInput
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	before, after, err := c.destinationService.Update(middleware.CurrentOrganizationID(ctx), id, req)
+	if err != nil {
+		return ctx.Status(destinationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditDestinationUpdate,
+		TargetType: "destination",
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+		Before:     before,
+		After:      after,
+	})
+
+	return ctx.Status(fiber.StatusOK).JSON(after)
+}
+
+// RotateSecret issues a new signing secret for a destination
+func (c *DestinationController) RotateSecret(ctx *fiber.Ctx) error {
+	id, err := destinationIDParam(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid destination ID",
+		})
+	}
+
+	secret, err := c.destinationService.RotateSecret(middleware.CurrentOrganizationID(ctx), id)
+	if err != nil {
+		return ctx.Status(destinationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditDestinationRotateSecret,
+		TargetType: "destination",
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+	})
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"secret": secret,
+	})
+}
+
+// DeleteDestination removes a destination and its delivery log
+func (c *DestinationController) DeleteDestination(ctx *fiber.Ctx) error {
+	id, err := destinationIDParam(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid destination ID",
+		})
+	}
+
+	destination, err := c.destinationService.Delete(middleware.CurrentOrganizationID(ctx), id)
+	if err != nil {
+		return ctx.Status(destinationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditDestinationDelete,
+		TargetType: "destination",
+		TargetID:   strconv.FormatUint(uint64(id), 10),
+		Before:     destination,
+	})
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// TestDestination sends a sample event to a destination and reports the result
+func (c *DestinationController) TestDestination(ctx *fiber.Ctx) error {
+	id, err := destinationIDParam(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid destination ID",
+		})
+	}
+
+	delivery, err := c.destinationService.Test(ctx.UserContext(), middleware.CurrentOrganizationID(ctx), id)
+	if err != nil {
+		return ctx.Status(destinationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(delivery)
+}
+
+// ListDeliveries returns a destination's delivery log, filtered by the
+// status query parameter
+func (c *DestinationController) ListDeliveries(ctx *fiber.Ctx) error {
+	id, err := destinationIDParam(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid destination ID",
+		})
+	}
+
+	page, err := c.destinationService.ListDeliveries(
+		middleware.CurrentOrganizationID(ctx),
+		id,
+		ctx.Query("status"),
+		ctx.QueryInt("page", 1),
+		ctx.QueryInt("page_size", 0),
+	)
+	if err != nil {
+		return ctx.Status(destinationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(page)
+}
+
+func destinationIDParam(ctx *fiber.Ctx) (uint, error) {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 64)
+	return uint(id), err
+}
+
+func destinationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrDestinationNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrInvalidDestinationURL), errors.Is(err, services.ErrDestinationName),
+		errors.Is(err, services.ErrUnknownCategory):
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"backend/graph"
+	"backend/middleware"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Interval between SSE keep-alive comments, which also detect disconnects
+const sseKeepAlive = 15 * time.Second
+
+type GraphQLController struct {
+	db     *gorm.DB
+	server *graph.Server
+}
+
+func NewGraphQLController(db *gorm.DB, server *graph.Server) *GraphQLController {
+	return &GraphQLController{db: db, server: server}
+}
+
+// Query executes a GraphQL query sent as a JSON body or query string
+func (c *GraphQLController) Query(ctx *fiber.Ctx) error {
+	req, err := parseGraphQLRequest(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid GraphQL request",
+		})
+	}
+
+	result := c.server.Execute(c.requestContext(ctx, ctx.UserContext()), *req)
+	return ctx.Status(fiber.StatusOK).JSON(result)
+}
+
+// Subscribe streams the results of a GraphQL subscription as Server-Sent
+// Events until the client disconnects
+func (c *GraphQLController) Subscribe(ctx *fiber.Ctx) error {
+	req, err := parseGraphQLRequest(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid GraphQL request",
+		})
+	}
+
+	subCtx, cancel := context.WithCancel(context.Background())
+	results := c.server.Subscribe(c.requestContext(ctx, subCtx), *req)
+
+	ctx.Set(fiber.HeaderContentType, "text/event-stream")
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set(fiber.HeaderConnection, "keep-alive")
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer func() {
+			cancel()
+			// Let the executor goroutine finish any pending send
+			for range results {
+			}
+		}()
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case result, ok := <-results:
+				if !ok {
+					fmt.Fprint(w, "event: complete\ndata:\n\n")
+					w.Flush()
+					return
+				}
+				data, err := json.Marshal(result)
+				if err != nil {
+					return
+				}
+				fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (c *GraphQLController) requestContext(ctx *fiber.Ctx, parent context.Context) context.Context {
+	return graph.NewContext(parent, c.db, graph.Viewer{
+		UserID:         middleware.CurrentUserID(ctx),
+		OrganizationID: middleware.CurrentOrganizationID(ctx),
+	})
+}
+
+func parseGraphQLRequest(ctx *fiber.Ctx) (*graph.Request, error) {
+	var req graph.Request
+	if ctx.Method() == fiber.MethodGet {
+		req.Query = ctx.Query("query")
+		req.OperationName = ctx.Query("operationName")
+		if vars := ctx.Query("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := ctx.BodyParser(&req); err != nil {
+		return nil, err
+	}
+
+	if req.Query == "" {
+		return nil, fmt.Errorf("missing query")
+	}
+	return &req, nil
+}
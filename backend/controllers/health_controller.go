@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type HealthController struct {
+	healthService *services.HealthService
+}
+
+func NewHealthController(healthService *services.HealthService) *HealthController {
+	return &HealthController{healthService: healthService}
+}
+
+// Healthz reports that the process is alive
+func (c *HealthController) Healthz(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": services.HealthOK,
+	})
+}
+
+// Readyz reports whether the instance should receive traffic
+func (c *HealthController) Readyz(ctx *fiber.Ctx) error {
+	readiness := c.healthService.Ready(ctx.UserContext())
+	if !readiness.Ready {
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(readiness)
+	}
+	return ctx.Status(fiber.StatusOK).JSON(readiness)
+}
+
+// Status reports dependency health and the active organization's backlog
+func (c *HealthController) Status(ctx *fiber.Ctx) error {
+	status := c.healthService.Status(ctx.UserContext(), middleware.CurrentOrganizationID(ctx))
+	return ctx.Status(fiber.StatusOK).JSON(status)
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/models"
+	"backend/services"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OrganizationController struct {
+	orgService   *services.OrganizationService
+	auditService *services.AuditService
+}
+
+func NewOrganizationController(orgService *services.OrganizationService, auditService *services.AuditService) *OrganizationController {
+	return &OrganizationController{
+		orgService:   orgService,
+		auditService: auditService,
+	}
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+type InviteRequest struct {
+	Email string      `json:"email"`
+	Role  models.Role `json:"role"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+// CreateOrganization creates a new organization owned by the caller
+func (c *OrganizationController) CreateOrganization(ctx *fiber.Ctx) error {
+	var req CreateOrganizationRequest
+	if err := ctx.BodyParser(&req); err != nil || req.Name == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	org, err := c.orgService.CreateOrganization(middleware.CurrentUserID(ctx), req.Name)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		OrganizationID: org.ID,
+		Action:         services.AuditOrgCreate,
+		TargetType:     "organization",
+		TargetID:       strconv.FormatUint(uint64(org.ID), 10),
+		After:          org,
+	})
+
+	return ctx.Status(fiber.StatusCreated).JSON(services.OrganizationInfo{
+		ID:   org.ID,
+		Name: org.Name,
+		Role: models.RoleOwner,
+	})
+}
+
+// ListOrganizations returns the organizations the caller belongs to
+func (c *OrganizationController) ListOrganizations(ctx *fiber.Ctx) error {
+	orgs, err := c.orgService.ListOrganizations(middleware.CurrentUserID(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list organizations",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(orgs)
+}
+
+// ListMembers returns the members of the active organization
+func (c *OrganizationController) ListMembers(ctx *fiber.Ctx) error {
+	members, err := c.orgService.ListMembers(middleware.CurrentOrganizationID(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list members",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(members)
+}
+
+// Invite creates an invitation to the active organization
+func (c *OrganizationController) Invite(ctx *fiber.Ctx) error {
+	var req InviteRequest
+	if err := ctx.BodyParser(&req); err != nil || req.Email == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	invitation, err := c.orgService.Invite(
+		middleware.CurrentOrganizationID(ctx),
+		middleware.CurrentUserID(ctx),
+		middleware.CurrentRole(ctx),
+		req.Email,
+		req.Role,
+	)
+	if err != nil {
+		return ctx.Status(organizationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditMemberInvite,
+		TargetType: "invitation",
+		TargetID:   strconv.FormatUint(uint64(invitation.ID), 10),
+		After:      invitation,
+	})
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"invitation": invitation,
+		"token":      invitation.Token,
+	})
+}
+
+// AcceptInvitation joins the caller to the organization named by an invitation token
+func (c *OrganizationController) AcceptInvitation(ctx *fiber.Ctx) error {
+	var req AcceptInvitationRequest
+	if err := ctx.BodyParser(&req); err != nil || req.Token == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	membership, err := c.orgService.AcceptInvitation(middleware.CurrentUserID(ctx), req.Token)
+	if err != nil {
+		return ctx.Status(organizationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		OrganizationID: membership.OrganizationID,
+		Action:         services.AuditMemberJoin,
+		TargetType:     "membership",
+		TargetID:       strconv.FormatUint(uint64(membership.ID), 10),
+		After:          membership,
+	})
+
+	return ctx.Status(fiber.StatusOK).JSON(membership)
+}
+
+// RemoveMember removes a user from the active organization
+func (c *OrganizationController) RemoveMember(ctx *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(ctx.Params("userID"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	err = c.orgService.RemoveMember(middleware.CurrentOrganizationID(ctx), middleware.CurrentRole(ctx), uint(userID))
+	if err != nil {
+		return ctx.Status(organizationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditMemberRemove,
+		TargetType: "user",
+		TargetID:   strconv.FormatUint(userID, 10),
+	})
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func organizationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidRole):
+		return fiber.StatusBadRequest
+	case errors.Is(err, services.ErrInvitationNotFound), errors.Is(err, services.ErrMemberNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrInvitationEmail), errors.Is(err, services.ErrInsufficientRole),
+		errors.Is(err, services.ErrEmailNotVerified):
+		return fiber.StatusForbidden
+	case errors.Is(err, services.ErrAlreadyMember), errors.Is(err, services.ErrLastOwner):
+		return fiber.StatusConflict
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/services"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ReplayController struct {
+	replayService *services.ReplayService
+	auditService  *services.AuditService
+}
+
+func NewReplayController(replayService *services.ReplayService, auditService *services.AuditService) *ReplayController {
+	return &ReplayController{
+		replayService: replayService,
+		auditService:  auditService,
+	}
+}
+
+// ListReplays returns the active organization's replay jobs
+func (c *ReplayController) ListReplays(ctx *fiber.Ctx) error {
+	jobs, err := c.replayService.List(middleware.CurrentOrganizationID(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list replay jobs",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(jobs)
+}
+
+// CreateReplay queues a replay of stored events. The background worker
+// picks it up within a few seconds.
+func (c *ReplayController) CreateReplay(ctx *fiber.Ctx) error {
+	var req services.ReplayInput
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	job, err := c.replayService.Create(middleware.CurrentOrganizationID(ctx), middleware.CurrentUserID(ctx), req)
+	if err != nil {
+		return ctx.Status(replayErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditReplayCreate,
+		TargetType: "replay",
+		TargetID:   strconv.FormatUint(uint64(job.ID), 10),
+		After:      job,
+	})
+
+	return ctx.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// GetReplay returns a replay job and its progress
+func (c *ReplayController) GetReplay(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid replay ID",
+		})
+	}
+
+	job, err := c.replayService.Get(middleware.CurrentOrganizationID(ctx), uint(id))
+	if err != nil {
+		return ctx.Status(replayErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(job)
+}
+
+// CancelReplay stops a pending or running replay job
+func (c *ReplayController) CancelReplay(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid replay ID",
+		})
+	}
+
+	job, err := c.replayService.Cancel(middleware.CurrentOrganizationID(ctx), uint(id))
+	if err != nil {
+		return ctx.Status(replayErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditReplayCancel,
+		TargetType: "replay",
+		TargetID:   strconv.FormatUint(uint64(job.ID), 10),
+		After:      job,
+	})
+
+	return ctx.Status(fiber.StatusOK).JSON(job)
+}
+
+func replayErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrReplayNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrReplayTarget), errors.Is(err, services.ErrReplayRange),
+		errors.Is(err, services.ErrReplayRate), errors.Is(err, services.ErrReplayWebhook),
+		errors.Is(err, services.ErrUnknownCategory):
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/services"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RetentionController struct {
+	retentionService *services.RetentionService
+	auditService     *services.AuditService
+}
+
+func NewRetentionController(retentionService *services.RetentionService, auditService *services.AuditService) *RetentionController {
+	return &RetentionController{
+		retentionService: retentionService,
+		auditService:     auditService,
+	}
+}
+
+// ListPolicies returns the active organization's retention policies
+func (c *RetentionController) ListPolicies(ctx *fiber.Ctx) error {
+	policies, err := c.retentionService.ListPolicies(middleware.CurrentOrganizationID(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list retention policies",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(policies)
+}
+
+// SetPolicy creates or replaces the retention policy for one target
+func (c *RetentionController) SetPolicy(ctx *fiber.Ctx) error {
+	var req services.RetentionInput
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	policy, err := c.retentionService.SetPolicy(middleware.CurrentOrganizationID(ctx), req)
+	if err != nil {
+		return ctx.Status(retentionErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditRetentionUpdate,
+		TargetType: "retention_policy",
+		TargetID:   policy.Target,
+		After:      policy,
+	})
+
+	return ctx.Status(fiber.StatusOK).JSON(policy)
+}
+
+// DeletePolicy removes the retention policy for one target
+func (c *RetentionController) DeletePolicy(ctx *fiber.Ctx) error {
+	policy, err := c.retentionService.DeletePolicy(middleware.CurrentOrganizationID(ctx), ctx.Params("target"))
+	if err != nil {
+		return ctx.Status(retentionErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditRetentionDelete,
+		TargetType: "retention_policy",
+		TargetID:   policy.Target,
+		Before:     policy,
+	})
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// GetStorage reports the storage the active organization's data takes
+func (c *RetentionController) GetStorage(ctx *fiber.Ctx) error {
+	usage, err := c.retentionService.Storage(ctx.UserContext(), middleware.CurrentOrganizationID(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to measure storage",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(usage)
+}
+
+func retentionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRetentionNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrRetentionTarget), errors.Is(err, services.ErrRetentionAge),
+		errors.Is(err, services.ErrArchiveDisabled):
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"backend/middleware"
+	"backend/services"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+type StreamController struct {
+	streamService *services.StreamService
+}
+
+func NewStreamController(streamService *services.StreamService) *StreamController {
+	return &StreamController{streamService: streamService}
+}
+
+// Validate checks the subscription parameters shared by the WebSocket and
+// SSE endpoints before the connection is upgraded or streamed
+func (c *StreamController) Validate(ctx *fiber.Ctx) error {
+	for _, name := range splitParam(ctx.Query("categories")) {
+		if _, ok := services.CategoryByName(name); !ok {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown category: " + name,
+			})
+		}
+	}
+	if _, err := lastEventID(ctx.Query("last_event_id"), ctx.Get("Last-Event-ID")); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid last_event_id",
+		})
+	}
+	return ctx.Next()
+}
+
+// RequireUpgrade rejects plain HTTP requests to the WebSocket endpoint
+func (c *StreamController) RequireUpgrade(ctx *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(ctx) {
+		return fiber.ErrUpgradeRequired
+	}
+	return ctx.Next()
+}
+
+// WebSocket streams processed events as JSON messages. Clients filter with
+// the categories, account_keys and collections query parameters and resume
+// with last_event_id.
+func (c *StreamController) WebSocket(conn *websocket.Conn) {
+	orgID, _ := conn.Locals("orgID").(uint)
+	filter := services.StreamFilter{
+		OrganizationID: orgID,
+		Categories:     splitParam(conn.Query("categories")),
+		AccountKeys:    splitParam(conn.Query("account_keys")),
+		Collections:    splitParam(conn.Query("collections")),
+	}
+	afterID, _ := lastEventID(conn.Query("last_event_id"), "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Reading is required to process control frames and notice disconnects
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err := c.streamService.Stream(ctx, filter, afterID, func(e services.StreamEvent) error {
+		return conn.WriteJSON(e)
+	})
+	if err != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()))
+	}
+}
+
+// SSE streams processed events as Server-Sent Events using the same
+// filters as WebSocket. The standard Last-Event-ID header is honoured on
+// reconnect.
+func (c *StreamController) SSE(ctx *fiber.Ctx) error {
+	filter := services.StreamFilter{
+		OrganizationID: middleware.CurrentOrganizationID(ctx),
+		Categories:     splitParam(ctx.Query("categories")),
+		AccountKeys:    splitParam(ctx.Query("account_keys")),
+		Collections:    splitParam(ctx.Query("collections")),
+	}
+	afterID, _ := lastEventID(ctx.Query("last_event_id"), ctx.Get("Last-Event-ID"))
+
+	ctx.Set(fiber.HeaderContentType, "text/event-stream")
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set(fiber.HeaderConnection, "keep-alive")
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		streamCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		out := &sseWriter{w: w, cancel: cancel}
+
+		// Keep-alive comments surface disconnected clients as flush errors
+		go func() {
+			ticker := time.NewTicker(sseKeepAlive)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-streamCtx.Done():
+					return
+				case <-ticker.C:
+					out.write(": keep-alive\n\n")
+				}
+			}
+		}()
+
+		err := c.streamService.Stream(streamCtx, filter, afterID, func(e services.StreamEvent) error {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			return out.write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Category, data))
+		})
+		if err != nil {
+			out.write(fmt.Sprintf("event: error\ndata: %s\n\n", err.Error()))
+		}
+	})
+	return nil
+}
+
+// sseWriter serialises writes from the stream and keep-alive goroutines and
+// cancels the stream once the client has gone away
+type sseWriter struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	cancel context.CancelFunc
+}
+
+func (s *sseWriter) write(frame string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.w.WriteString(frame)
+	if err := s.w.Flush(); err != nil {
+		s.cancel()
+		return err
+	}
+	return nil
+}
+
+func splitParam(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var parts []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func lastEventID(query, header string) (uint, error) {
+	value := query
+	if value == "" {
+		value = header
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	return uint(id), err
+}
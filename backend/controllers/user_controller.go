@@ -3,18 +3,28 @@ package controllers
 import (
 	"backend/middleware"
 	"backend/models"
+	"backend/services"
+	"errors"
+	"math"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type UserController struct {
-	db *gorm.DB
+	db             *gorm.DB
+	accountService *services.AccountService
+	auditService   *services.AuditService
 }
 
-func NewUserController(db *gorm.DB) *UserController {
-	return &UserController{db: db}
+func NewUserController(db *gorm.DB, accountService *services.AccountService, auditService *services.AuditService) *UserController {
+	return &UserController{
+		db:             db,
+		accountService: accountService,
+		auditService:   auditService,
+	}
 }
 
 type SignupRequest struct {
@@ -28,8 +38,22 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	Token  string `json:"token"`
-	UserID uint   `json:"user_id"`
+	Token         string `json:"token"`
+	UserID        uint   `json:"user_id"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
 }
 
 // Signup handles user registration
@@ -41,33 +65,33 @@ func (c *UserController) Signup(ctx *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user already exists
-	var existingUser models.User
-	result := c.db.Where("email = ?", req.Email).First(&existingUser)
-	if result.Error == nil {
+	user, org, err := c.accountService.CreateUser(req.Email, req.Password, false)
+	switch {
+	case errors.Is(err, services.ErrInvalidEmail), errors.Is(err, services.ErrWeakPassword), errors.Is(err, services.ErrPasswordTooLong):
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrUserExists):
 		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error": "User already exists",
 		})
-	}
-
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
+	case err != nil:
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to hash password",
+			"error": "Failed to create user",
 		})
 	}
 
-	// Create new user
-	user := models.User{
-		Email:    req.Email,
-		Password: string(hashedPassword),
-	}
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		ActorID:        user.ID,
+		OrganizationID: org.ID,
+		Action:         services.AuditUserSignup,
+		TargetType:     "user",
+		TargetID:       strconv.FormatUint(uint64(user.ID), 10),
+	})
 
-	if err := c.db.Create(&user).Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create user",
-		})
+	// A failed verification email shouldn't fail signup; the user can request another
+	if err := c.accountService.SendVerificationEmail(user); err != nil {
+		middleware.Logger(ctx).Error("failed to send verification email", "user_id", user.ID, "error", err)
 	}
 
 	// Generate JWT token
@@ -93,17 +117,38 @@ func (c *UserController) Login(ctx *fiber.Ctx) error {
 		})
 	}
 
-	// Find user by email
-	var user models.User
-	result := c.db.Where("email = ?", req.Email).First(&user)
-	if result.Error != nil {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid credentials",
+	// Verify credentials, honouring any lockout
+	user, lockedUntil, err := c.accountService.Authenticate(req.Email, req.Password)
+	if err != nil {
+		action := services.AuditUserLoginFailed
+		if errors.Is(err, services.ErrAccountLocked) {
+			action = services.AuditUserLocked
+		}
+		entry := services.AuditEntry{
+			Action:     action,
+			TargetType: "email",
+			TargetID:   req.Email,
+		}
+		if user != nil {
+			recordMemberAudit(c.auditService, ctx, user.ID, entry)
+		} else {
+			recordAudit(c.auditService, ctx, entry)
+		}
+	}
+	if errors.Is(err, services.ErrAccountDisabled) {
+		return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
-
-	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	if errors.Is(err, services.ErrAccountLocked) {
+		retryAfter := int(math.Ceil(time.Until(*lockedUntil).Seconds()))
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return ctx.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":       err.Error(),
+			"retry_after": retryAfter,
+		})
+	}
+	if err != nil {
 		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
@@ -117,8 +162,122 @@ func (c *UserController) Login(ctx *fiber.Ctx) error {
 		})
 	}
 
+	recordMemberAudit(c.auditService, ctx, user.ID, services.AuditEntry{
+		ActorID:    user.ID,
+		Action:     services.AuditUserLogin,
+		TargetType: "user",
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+	})
+
 	return ctx.Status(fiber.StatusOK).JSON(AuthResponse{
-		Token:  token,
-		UserID: user.ID,
+		Token:         token,
+		UserID:        user.ID,
+		EmailVerified: user.EmailVerifiedAt != nil,
+	})
+}
+
+// VerifyEmail confirms a user's email address from a verification token
+func (c *UserController) VerifyEmail(ctx *fiber.Ctx) error {
+	var req TokenRequest
+	if err := ctx.BodyParser(&req); err != nil || req.Token == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID, err := c.accountService.VerifyEmail(req.Token)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired token",
+		})
+	}
+
+	recordMemberAudit(c.auditService, ctx, userID, services.AuditEntry{
+		ActorID:    userID,
+		Action:     services.AuditUserEmailVerified,
+		TargetType: "user",
+		TargetID:   strconv.FormatUint(uint64(userID), 10),
+	})
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Email verified",
+	})
+}
+
+// ResendVerification sends a fresh verification email to the authenticated user
+func (c *UserController) ResendVerification(ctx *fiber.Ctx) error {
+	var user models.User
+	if err := c.db.First(&user, middleware.CurrentUserID(ctx)).Error; err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	err := c.accountService.SendVerificationEmail(&user)
+	if errors.Is(err, services.ErrAlreadyVerified) {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send verification email",
+		})
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Verification email sent",
+	})
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the email belongs to an account.
+func (c *UserController) ForgotPassword(ctx *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := ctx.BodyParser(&req); err != nil || req.Email == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := c.accountService.RequestPasswordReset(req.Email); err != nil {
+		middleware.Logger(ctx).Error("failed to send password reset email", "error", err)
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If the address is registered, a reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using a single-use reset token
+func (c *UserController) ResetPassword(ctx *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := ctx.BodyParser(&req); err != nil || req.Token == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID, err := c.accountService.ResetPassword(req.Token, req.Password)
+	if errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrWeakPassword) || errors.Is(err, services.ErrPasswordTooLong) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset password",
+		})
+	}
+
+	recordMemberAudit(c.auditService, ctx, userID, services.AuditEntry{
+		ActorID:    userID,
+		Action:     services.AuditUserPasswordReset,
+		TargetType: "user",
+		TargetID:   strconv.FormatUint(uint64(userID), 10),
+	})
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password updated",
 	})
 }
\ No newline at end of file
@@ -1,19 +1,25 @@
 package controllers
 
 import (
+	"backend/middleware"
 	"backend/models"
 	"backend/services"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type WebhookController struct {
 	heliusService *services.HeliusService
+	registry      *services.WebhookRegistry
+	auditService  *services.AuditService
 }
 
-func NewWebhookController(heliusService *services.HeliusService) *WebhookController {
+func NewWebhookController(heliusService *services.HeliusService, registry *services.WebhookRegistry, auditService *services.AuditService) *WebhookController {
 	return &WebhookController{
 		heliusService: heliusService,
+		registry:      registry,
+		auditService:  auditService,
 	}
 }
 
@@ -21,26 +27,28 @@ func NewWebhookController(heliusService *services.HeliusService) *WebhookControl
 func (c *WebhookController) HandleWebhook(ctx *fiber.Ctx) error {
 	var event models.WebhookEvent
 	if err := ctx.BodyParser(&event); err != nil {
+		services.RecordWebhookReceived("invalid")
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
-	if err := c.heliusService.ProcessWebhookEvent(&event); err != nil {
+	if err := c.heliusService.ProcessWebhookEvent(ctx.UserContext(), &event); err != nil {
+		services.RecordWebhookReceived("failed")
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	services.RecordWebhookReceived("accepted")
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Event processed successfully",
 	})
 }
 
-// ConfigureWebhook allows users to set up their webhook preferences
+// ConfigureWebhook registers a webhook for the active organization
 func (c *WebhookController) ConfigureWebhook(ctx *fiber.Ctx) error {
 	type WebhookConfig struct {
-		UserID      uint     `json:"user_id"`
 		AccountKeys []string `json:"account_keys"`
 		EventTypes  []string `json:"event_types"`
 	}
@@ -52,12 +60,19 @@ func (c *WebhookController) ConfigureWebhook(ctx *fiber.Ctx) error {
 		})
 	}
 
-	webhook, err := c.heliusService.RegisterWebhook(config.UserID, config.AccountKeys, config.EventTypes)
+	webhook, err := c.registry.Register(ctx.UserContext(), middleware.CurrentOrganizationID(ctx), config.AccountKeys, config.EventTypes)
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	recordAudit(c.auditService, ctx, services.AuditEntry{
+		Action:     services.AuditWebhookRegister,
+		TargetType: "webhook",
+		TargetID:   strconv.FormatUint(uint64(webhook.ID), 10),
+		After:      webhook,
+	})
+
 	return ctx.Status(fiber.StatusCreated).JSON(webhook)
 }
\ No newline at end of file
@@ -0,0 +1,196 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Arguments that multiply the cost of a field's selection set
+var sizeArguments = []string{"first", "limit"}
+
+// Cost multiplier for list fields called without a size argument
+const defaultListSize = 50
+
+// Limits bounds the cost of a single GraphQL operation
+type Limits struct {
+	MaxComplexity int
+	MaxDepth      int
+}
+
+var errOperationNotFound = errors.New("operation not found")
+
+// checkComplexity rejects operations that exceed the configured limits.
+// Each field costs one, and a field's children are multiplied by its
+// first/limit argument so paging through large lists is accounted for.
+// Fields of schema that take such an argument count as defaultListSize
+// when it is left out.
+func checkComplexity(schema *graphql.Schema, doc *ast.Document, operationName string, variables map[string]interface{}, limits Limits) error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.FragmentDefinition:
+			fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				operation = d
+			}
+		}
+	}
+	if operation == nil {
+		return errOperationNotFound
+	}
+
+	c := &complexityWalker{schema: schema, fragments: fragments, variables: variables, limits: limits}
+	cost, err := c.selectionSet(operation.SelectionSet, c.rootType(operation.Operation), 1, map[string]bool{})
+	if err != nil {
+		return err
+	}
+	if limits.MaxComplexity > 0 && cost > limits.MaxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", cost, limits.MaxComplexity)
+	}
+	return nil
+}
+
+type complexityWalker struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	limits    Limits
+}
+
+// rootType returns the schema type operations of kind select from
+func (c *complexityWalker) rootType(kind string) graphql.Type {
+	if c.schema == nil {
+		return nil
+	}
+	switch kind {
+	case ast.OperationTypeSubscription:
+		return c.schema.SubscriptionType()
+	case ast.OperationTypeMutation:
+		return c.schema.MutationType()
+	default:
+		return c.schema.QueryType()
+	}
+}
+
+// selectionSet returns the cost of set, selected from parent. parent is nil
+// where the schema type isn't known, in which case only the arguments
+// given are counted.
+func (c *complexityWalker) selectionSet(set *ast.SelectionSet, parent graphql.Type, depth int, visiting map[string]bool) (int, error) {
+	if set == nil {
+		return 0, nil
+	}
+	if c.limits.MaxDepth > 0 && depth > c.limits.MaxDepth {
+		return 0, fmt.Errorf("query depth exceeds the limit of %d", c.limits.MaxDepth)
+	}
+
+	total := 0
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			definition := fieldDefinition(parent, s.Name.Value)
+			var fieldType graphql.Type
+			if definition != nil {
+				fieldType, _ = graphql.GetNamed(definition.Type).(graphql.Type)
+			}
+			children, err := c.selectionSet(s.SelectionSet, fieldType, depth+1, visiting)
+			if err != nil {
+				return 0, err
+			}
+			total += 1 + children*c.multiplier(s, definition)
+
+		case *ast.InlineFragment:
+			cost, err := c.selectionSet(s.SelectionSet, c.conditionType(s.TypeCondition, parent), depth, visiting)
+			if err != nil {
+				return 0, err
+			}
+			total += cost
+
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			fragment, ok := c.fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			visiting[name] = true
+			cost, err := c.selectionSet(fragment.SelectionSet, c.conditionType(fragment.TypeCondition, parent), depth, visiting)
+			delete(visiting, name)
+			if err != nil {
+				return 0, err
+			}
+			total += cost
+		}
+	}
+	return total, nil
+}
+
+// conditionType returns the type a fragment's condition names, or parent
+// when it has none
+func (c *complexityWalker) conditionType(condition *ast.Named, parent graphql.Type) graphql.Type {
+	if condition == nil || c.schema == nil {
+		return parent
+	}
+	return c.schema.Type(condition.Name.Value)
+}
+
+// fieldDefinition looks up a field of an object or interface type, returning
+// nil if parent is unknown or has no such field
+func fieldDefinition(parent graphql.Type, name string) *graphql.FieldDefinition {
+	switch t := parent.(type) {
+	case *graphql.Object:
+		return t.Fields()[name]
+	case *graphql.Interface:
+		return t.Fields()[name]
+	}
+	return nil
+}
+
+// multiplier returns the size argument of a list field, defaultListSize if
+// it takes one but was called without it, or 1
+func (c *complexityWalker) multiplier(field *ast.Field, definition *graphql.FieldDefinition) int {
+	if field.SelectionSet == nil {
+		return 1
+	}
+	for _, arg := range field.Arguments {
+		for _, name := range sizeArguments {
+			if arg.Name.Value != name {
+				continue
+			}
+			if n := c.intValue(arg.Value); n > 0 {
+				return n
+			}
+			return defaultListSize
+		}
+	}
+	if definition != nil {
+		for _, arg := range definition.Args {
+			for _, name := range sizeArguments {
+				if arg.Name() == name {
+					return defaultListSize
+				}
+			}
+		}
+	}
+	return 1
+}
+
+func (c *complexityWalker) intValue(value ast.Value) int {
+	switch v := value.(type) {
+	case *ast.IntValue:
+		n, _ := strconv.Atoi(v.Value)
+		return n
+	case *ast.Variable:
+		switch n := c.variables[v.Name.Value].(type) {
+		case float64:
+			return int(n)
+		case int:
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// testSchema has a paged list field, one taking a limit, and a plain
+// object field
+func testSchema(t *testing.T) *graphql.Schema {
+	t.Helper()
+	item := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Item",
+		Fields: graphql.Fields{
+			"id":   &graphql.Field{Type: graphql.String},
+			"name": &graphql.Field{Type: graphql.String},
+		},
+	})
+	connection := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ItemConnection",
+		Fields: graphql.Fields{
+			"rows":       &graphql.Field{Type: graphql.NewList(item)},
+			"nextCursor": &graphql.Field{Type: graphql.String},
+		},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"items": &graphql.Field{
+					Type: connection,
+					Args: graphql.FieldConfigArgument{"first": &graphql.ArgumentConfig{Type: graphql.Int}},
+				},
+				"recent": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(item))),
+					Args: graphql.FieldConfigArgument{"limit": &graphql.ArgumentConfig{Type: graphql.Int}},
+				},
+				"item": &graphql.Field{Type: item},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("failed to build schema: %v", err)
+	}
+	return &schema
+}
+
+func TestCheckComplexity(t *testing.T) {
+	schema := testSchema(t)
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		cost      int
+	}{
+		{"first", `{ items(first: 10) { rows { id name } } }`, nil, 1 + 10*3},
+		{"variable", `query($n: Int) { items(first: $n) { rows { id } } }`, map[string]interface{}{"n": 4}, 1 + 4*2},
+		{"missing first", `{ items { rows { id } } }`, nil, 1 + defaultListSize*2},
+		{"missing limit", `{ recent { id name } }`, nil, 1 + defaultListSize*2},
+		{"missing limit in fragment", `{ ...f } fragment f on Query { recent { id } }`, nil, 1 + defaultListSize},
+		{"no size argument", `{ item { id name } }`, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(tt.query)})})
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+			if err := checkComplexity(schema, doc, "", tt.variables, Limits{MaxComplexity: tt.cost}); err != nil {
+				t.Errorf("checkComplexity with a limit of %d = %v, want nil", tt.cost, err)
+			}
+			if err := checkComplexity(schema, doc, "", tt.variables, Limits{MaxComplexity: tt.cost - 1}); err == nil {
+				t.Errorf("checkComplexity with a limit of %d = nil, want the cost of %d rejected", tt.cost-1, tt.cost)
+			}
+		})
+	}
+}
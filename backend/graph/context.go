@@ -0,0 +1,35 @@
+package graph
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type viewerKey struct{}
+
+type loadersKey struct{}
+
+// Viewer is the authenticated caller a GraphQL request runs as
+type Viewer struct {
+	UserID         uint
+	OrganizationID uint
+}
+
+// NewContext returns a request context carrying the viewer and a fresh set
+// of batch loaders. Loaders cache per request, so a new context must be
+// created for every operation.
+func NewContext(ctx context.Context, db *gorm.DB, viewer Viewer) context.Context {
+	ctx = context.WithValue(ctx, viewerKey{}, viewer)
+	return context.WithValue(ctx, loadersKey{}, newLoaders(db, viewer.OrganizationID))
+}
+
+func viewerFrom(ctx context.Context) Viewer {
+	viewer, _ := ctx.Value(viewerKey{}).(Viewer)
+	return viewer
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	l, _ := ctx.Value(loadersKey{}).(*loaders)
+	return l
+}
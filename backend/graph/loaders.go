@@ -0,0 +1,114 @@
+package graph
+
+import (
+	"backend/models"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// batchLoader collects keys requested while a query level is resolved and
+// fetches them with a single call when the first result is needed. Resolvers
+// return the thunk from Load; graphql-go resolves thunks breadth-first, so
+// every key of a list is registered before any is fetched.
+type batchLoader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending map[K]bool
+	results map[K]V
+	err     error
+}
+
+func newBatchLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{
+		fetch:   fetch,
+		pending: make(map[K]bool),
+		results: make(map[K]V),
+	}
+}
+
+// Load registers key and returns a thunk yielding its value
+func (l *batchLoader[K, V]) Load(key K) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.results[key]; !ok {
+		l.pending[key] = true
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			keys := make([]K, 0, len(l.pending))
+			for k := range l.pending {
+				keys = append(keys, k)
+			}
+			l.pending = make(map[K]bool)
+
+			results, err := l.fetch(keys)
+			if err != nil {
+				l.err = err
+			}
+			for k, v := range results {
+				l.results[k] = v
+			}
+		}
+
+		if l.err != nil {
+			return nil, l.err
+		}
+		value, ok := l.results[key]
+		if !ok {
+			return nil, nil
+		}
+		return value, nil
+	}
+}
+
+// loaders holds the per-request batch loaders
+type loaders struct {
+	webhooks    *batchLoader[uint, *models.HeliusWebhook]
+	eventCounts *batchLoader[uint, int64]
+}
+
+func newLoaders(db *gorm.DB, orgID uint) *loaders {
+	return &loaders{
+		webhooks: newBatchLoader(func(ids []uint) (map[uint]*models.HeliusWebhook, error) {
+			var webhooks []models.HeliusWebhook
+			err := db.Where("id IN ? AND organization_id = ?", ids, orgID).Find(&webhooks).Error
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[uint]*models.HeliusWebhook, len(webhooks))
+			for i := range webhooks {
+				byID[webhooks[i].ID] = &webhooks[i]
+			}
+			return byID, nil
+		}),
+
+		eventCounts: newBatchLoader(func(ids []uint) (map[uint]int64, error) {
+			var rows []struct {
+				WebhookID uint
+				Count     int64
+			}
+			err := db.Model(&models.WebhookEvent{}).
+				Select("webhook_id, COUNT(*) AS count").
+				Where("webhook_id IN ?", ids).
+				Group("webhook_id").
+				Scan(&rows).Error
+			if err != nil {
+				return nil, err
+			}
+			counts := make(map[uint]int64, len(ids))
+			for _, id := range ids {
+				counts[id] = 0
+			}
+			for _, row := range rows {
+				counts[row.WebhookID] = row.Count
+			}
+			return counts, nil
+		}),
+	}
+}
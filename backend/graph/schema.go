@@ -0,0 +1,427 @@
+package graph
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"gorm.io/gorm"
+)
+
+// Server executes GraphQL operations against the platform and tenant databases
+type Server struct {
+	db            *gorm.DB
+	queryService  *services.QueryService
+	streamService *services.StreamService
+	schema        graphql.Schema
+	limits        Limits
+}
+
+// Request is a GraphQL operation as posted by clients
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+func NewServer(db *gorm.DB, queryService *services.QueryService, streamService *services.StreamService, limits Limits) (*Server, error) {
+	s := &Server{
+		db:            db,
+		queryService:  queryService,
+		streamService: streamService,
+		limits:        limits,
+	}
+
+	schema, err := s.buildSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GraphQL schema: %w", err)
+	}
+	s.schema = schema
+	return s, nil
+}
+
+// Execute runs a query operation. ctx must come from NewContext.
+func (s *Server) Execute(ctx context.Context, req Request) *graphql.Result {
+	if err := s.validate(req); err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	return graphql.Do(graphql.Params{
+		Schema:         s.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+}
+
+// Subscribe runs a subscription operation, streaming results until ctx is
+// cancelled. ctx must come from NewContext.
+func (s *Server) Subscribe(ctx context.Context, req Request) chan *graphql.Result {
+	if err := s.validate(req); err != nil {
+		results := make(chan *graphql.Result, 1)
+		results <- &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+		close(results)
+		return results
+	}
+
+	return graphql.Subscribe(graphql.Params{
+		Schema:         s.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+}
+
+// validate parses the request and enforces the complexity limits before
+// any resolver runs
+func (s *Server) validate(req Request) error {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return err
+	}
+	return checkComplexity(&s.schema, doc, req.OperationName, req.Variables, s.limits)
+}
+
+func (s *Server) buildSchema() (graphql.Schema, error) {
+	webhookType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Webhook",
+		Fields: graphql.Fields{
+			"id":          {Type: graphql.NewNonNull(graphql.Int), Resolve: webhookField(func(w *models.HeliusWebhook) interface{} { return w.ID })},
+			"heliusId":    {Type: graphql.String, Resolve: webhookField(func(w *models.HeliusWebhook) interface{} { return w.WebhookID })},
+			"webhookUrl":  {Type: graphql.String, Resolve: webhookField(func(w *models.HeliusWebhook) interface{} { return w.WebhookURL })},
+			"accountKeys": {Type: graphql.NewList(graphql.String), Resolve: webhookField(func(w *models.HeliusWebhook) interface{} { return splitList(w.AccountKeys) })},
+			"eventTypes":  {Type: graphql.NewList(graphql.String), Resolve: webhookField(func(w *models.HeliusWebhook) interface{} { return splitList(w.EventTypes) })},
+			"isActive":    {Type: graphql.Boolean, Resolve: webhookField(func(w *models.HeliusWebhook) interface{} { return w.IsActive })},
+			"createdAt":   {Type: graphql.DateTime, Resolve: webhookField(func(w *models.HeliusWebhook) interface{} { return w.CreatedAt })},
+			"eventCount": {
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					webhook, ok := p.Source.(*models.HeliusWebhook)
+					if !ok {
+						return nil, nil
+					}
+					return loadersFrom(p.Context).eventCounts.Load(webhook.ID), nil
+				},
+			},
+		},
+	})
+
+	eventType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Event",
+		Fields: graphql.Fields{
+			"id":         {Type: graphql.NewNonNull(graphql.Int), Resolve: eventField(func(e *services.StreamEvent) interface{} { return e.ID })},
+			"webhookId":  {Type: graphql.Int, Resolve: eventField(func(e *services.StreamEvent) interface{} { return e.WebhookID })},
+			"category":   {Type: graphql.String, Resolve: eventField(func(e *services.StreamEvent) interface{} { return e.Category })},
+			"eventType":  {Type: graphql.String, Resolve: eventField(func(e *services.StreamEvent) interface{} { return e.EventType })},
+			"accountKey": {Type: graphql.String, Resolve: eventField(func(e *services.StreamEvent) interface{} { return e.AccountKey })},
+			"collection": {Type: graphql.String, Resolve: eventField(func(e *services.StreamEvent) interface{} { return e.Collection })},
+			"slot":       {Type: graphql.Float, Resolve: eventField(func(e *services.StreamEvent) interface{} { return float64(e.Slot) })},
+			"timestamp":  {Type: graphql.DateTime, Resolve: eventField(func(e *services.StreamEvent) interface{} { return e.Timestamp })},
+			"payload":    {Type: graphql.String, Resolve: eventField(func(e *services.StreamEvent) interface{} { return string(e.Data) })},
+		},
+	})
+
+	syncStatusType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "SyncStatus",
+		Fields: graphql.Fields{
+			"lastSynced":   {Type: graphql.DateTime},
+			"syncedBlocks": {Type: graphql.Int},
+			"errorLog":     {Type: graphql.String},
+		},
+	})
+
+	queryFields := graphql.Fields{
+		"webhooks": {
+			Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(webhookType))),
+			Resolve: s.resolveWebhooks,
+		},
+		"syncStatus": {
+			Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(syncStatusType))),
+			Resolve: s.resolveSyncStatus,
+		},
+	}
+	for _, category := range services.Categories {
+		queryFields[lowerCamel(category.Name)] = s.categoryField(category, webhookType)
+	}
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name:   "Query",
+			Fields: queryFields,
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"events": {
+					Type: eventType,
+					Args: graphql.FieldConfigArgument{
+						"categories":  {Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+						"accountKeys": {Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+						"collections": {Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+						"after":       {Type: graphql.Int, Description: "Resume after this event ID"},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: s.subscribeEvents,
+				},
+			},
+		}),
+	})
+}
+
+// categoryField builds the paged query field for an indexed category from
+// its column definitions
+func (s *Server) categoryField(category *services.Category, webhookType *graphql.Object) *graphql.Field {
+	rowFields := graphql.Fields{
+		"id":        {Type: graphql.NewNonNull(graphql.Int), Resolve: rowField("id")},
+		"webhookId": {Type: graphql.NewNonNull(graphql.Int), Resolve: rowField("webhook_id")},
+		"createdAt": {Type: graphql.DateTime, Resolve: rowField("created_at")},
+		"webhook": {
+			Type: webhookType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				row, _ := p.Source.(map[string]interface{})
+				id, ok := row["webhook_id"]
+				if !ok {
+					return nil, nil
+				}
+				return loadersFrom(p.Context).webhooks.Load(toUint(id)), nil
+			},
+		},
+	}
+	for _, col := range category.Columns {
+		rowFields[lowerCamel(col.Name)] = &graphql.Field{Type: columnType(col.Type), Resolve: rowField(col.Name)}
+	}
+
+	typeName := upperCamel(category.EventType)
+	rowType := graphql.NewObject(graphql.ObjectConfig{Name: typeName, Fields: rowFields})
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: typeName + "Connection",
+		Fields: graphql.Fields{
+			"rows":       {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(rowType)))},
+			"nextCursor": {Type: graphql.String},
+		},
+	})
+
+	return &graphql.Field{
+		Type: graphql.NewNonNull(connectionType),
+		Args: graphql.FieldConfigArgument{
+			"address":     {Type: graphql.String},
+			"marketplace": {Type: graphql.String},
+			"platform":    {Type: graphql.String},
+			"from":        {Type: graphql.DateTime},
+			"to":          {Type: graphql.DateTime},
+			"minAmount":   {Type: graphql.Float},
+			"maxAmount":   {Type: graphql.Float},
+			"sort":        {Type: graphql.String, Description: "Column name, prefixed with - for descending"},
+			"after":       {Type: graphql.String},
+			"first":       {Type: graphql.Int},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			q := services.DataQuery{}
+			q.Address, _ = p.Args["address"].(string)
+			q.Marketplace, _ = p.Args["marketplace"].(string)
+			q.Platform, _ = p.Args["platform"].(string)
+			q.From, _ = p.Args["from"].(time.Time)
+			q.To, _ = p.Args["to"].(time.Time)
+			q.Cursor, _ = p.Args["after"].(string)
+			q.Limit, _ = p.Args["first"].(int)
+			if sort, ok := p.Args["sort"].(string); ok {
+				q.Sort = snakeCase(sort)
+			}
+			if v, ok := p.Args["minAmount"].(float64); ok {
+				q.MinAmount = &v
+			}
+			if v, ok := p.Args["maxAmount"].(float64); ok {
+				q.MaxAmount = &v
+			}
+
+			page, err := s.queryService.Query(viewerFrom(p.Context).OrganizationID, category.Name, q)
+			if err != nil {
+				return nil, err
+			}
+
+			var next interface{}
+			if page.NextCursor != "" {
+				next = page.NextCursor
+			}
+			return map[string]interface{}{
+				"rows":       page.Rows,
+				"nextCursor": next,
+			}, nil
+		},
+	}
+}
+
+func (s *Server) resolveWebhooks(p graphql.ResolveParams) (interface{}, error) {
+	var webhooks []models.HeliusWebhook
+	err := s.db.Where("organization_id = ?", viewerFrom(p.Context).OrganizationID).
+		Order("id").
+		Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.HeliusWebhook, len(webhooks))
+	for i := range webhooks {
+		result[i] = &webhooks[i]
+	}
+	return result, nil
+}
+
+func (s *Server) resolveSyncStatus(p graphql.ResolveParams) (interface{}, error) {
+	var statuses []models.DataSyncStatus
+	err := s.db.Where("user_id = ?", viewerFrom(p.Context).UserID).
+		Order("id").
+		Find(&statuses).Error
+	return statuses, err
+}
+
+// subscribeEvents streams processed events for the viewer's organization
+func (s *Server) subscribeEvents(p graphql.ResolveParams) (interface{}, error) {
+	filter := services.StreamFilter{
+		OrganizationID: viewerFrom(p.Context).OrganizationID,
+		Categories:     stringList(p.Args["categories"]),
+		AccountKeys:    stringList(p.Args["accountKeys"]),
+		Collections:    stringList(p.Args["collections"]),
+	}
+	for _, name := range filter.Categories {
+		if _, ok := services.CategoryByName(name); !ok {
+			return nil, fmt.Errorf("%w: %s", services.ErrUnknownCategory, name)
+		}
+	}
+	after, _ := p.Args["after"].(int)
+
+	events := make(chan interface{})
+	go func() {
+		defer close(events)
+		s.streamService.Stream(p.Context, filter, uint(after), func(e services.StreamEvent) error {
+			select {
+			case events <- &e:
+				return nil
+			case <-p.Context.Done():
+				return p.Context.Err()
+			}
+		})
+	}()
+	return events, nil
+}
+
+func rowField(key string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		row, _ := p.Source.(map[string]interface{})
+		return row[key], nil
+	}
+}
+
+func webhookField(get func(*models.HeliusWebhook) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		webhook, ok := p.Source.(*models.HeliusWebhook)
+		if !ok {
+			return nil, nil
+		}
+		return get(webhook), nil
+	}
+}
+
+func eventField(get func(*services.StreamEvent) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		event, ok := p.Source.(*services.StreamEvent)
+		if !ok {
+			return nil, nil
+		}
+		return get(event), nil
+	}
+}
+
+func columnType(t services.ColumnType) graphql.Output {
+	switch t {
+	case services.ColumnDecimal:
+		return graphql.Float
+	case services.ColumnTimestamp:
+		return graphql.DateTime
+	default:
+		return graphql.String
+	}
+}
+
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, fmt.Sprint(item))
+	}
+	return list
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func toUint(v interface{}) uint {
+	switch n := v.(type) {
+	case int64:
+		return uint(n)
+	case int32:
+		return uint(n)
+	case int:
+		return uint(n)
+	case uint:
+		return n
+	case float64:
+		return uint(n)
+	}
+	return 0
+}
+
+// lowerCamel converts snake_case to lowerCamelCase
+func lowerCamel(s string) string {
+	upper := upperCamel(s)
+	if upper == "" {
+		return upper
+	}
+	return strings.ToLower(upper[:1]) + upper[1:]
+}
+
+// upperCamel converts snake_case to UpperCamelCase
+func upperCamel(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// snakeCase converts a lowerCamelCase sort field, with optional "-" prefix,
+// back to its column name
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r + ('a' - 'A'))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -3,63 +3,393 @@ package main
 import (
 	"backend/config"
 	"backend/controllers"
+	"backend/graph"
+	"backend/logging"
 	"backend/middleware"
+	"backend/migrations"
 	"backend/models"
 	"backend/services"
-	"log"
+	"backend/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/gofiber/websocket/v2"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 func main() {
 	// Load configuration
-	cfg := config.LoadConfig()
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments %q; operational commands are in the helixscan CLI (cmd/helixscan)\n", args)
+		os.Exit(2)
+	}
+	middleware.ConfigureJWT(cfg.JWTSecret, cfg.PreviousJWTSecrets(), time.Duration(cfg.JWTTTLHours)*time.Hour)
+
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		slog.Error("invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:    cfg.OTLPEndpoint,
+		Insecure:    cfg.OTLPInsecure,
+		ServiceName: cfg.TraceServiceName,
+		Sampler:     cfg.TraceSampler,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		logger.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
 
 	// Database connection
 	db, err := gorm.Open(postgres.Open(cfg.GetDSN()), &gorm.Config{})
 	if err != nil {
-		panic("Failed to connect to database")
-	}
-
-	// Auto Migrate the schema
-	// Auto-migrate all models
-	err = db.AutoMigrate(
-		&models.User{},
-		&models.DatabaseConfig{},
-		&models.IndexingPreference{},
-		&models.DataSyncStatus{},
-		&models.HeliusWebhook{},
-		&models.WebhookEvent{},
-	)
+		logger.Error("failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		logger.Error("failed to enable query tracing", "error", err)
+		os.Exit(1)
+	}
+
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		logger.Error("failed to access database", "error", err)
+		os.Exit(1)
+	}
+	sqlDB.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.DBConnMaxLifetime) * time.Minute)
+
+	// Schema migrations
+	migrator, err := migrations.New(sqlDB)
+	if err != nil {
+		logger.Error("failed to load migrations", "error", err)
+		os.Exit(1)
+	}
+	if cfg.MigrateOnStart {
+		if err := migrator.Up(context.Background()); err != nil {
+			logger.Error("failed to migrate database", "error", err)
+			os.Exit(1)
+		}
+	}
+	schemaVersion, err := migrator.Current(context.Background())
+	if err != nil {
+		logger.Error("failed to read schema version", "error", err)
+		os.Exit(1)
+	}
+
+	// Background loops stop when the server shuts down
+	background, stopBackground := context.WithCancel(context.Background())
+	var backgroundLoops sync.WaitGroup
+	runInBackground := func(run func(context.Context)) {
+		backgroundLoops.Add(1)
+		go func() {
+			defer backgroundLoops.Done()
+			run(background)
+		}()
 	}
 
 	// Initialize services
-	heliusService := services.NewHeliusService(db, cfg.HeliusAPIKey)
+	tenants := services.NewTenantDBManager(db, services.TenantPoolLimits{
+		MaxOpenConns:    cfg.TenantMaxOpenConns,
+		MaxIdleConns:    cfg.TenantMaxIdleConns,
+		ConnMaxLifetime: time.Duration(cfg.TenantConnMaxLifetime) * time.Minute,
+	})
+	apiClient := services.NewHeliusAPIClient(cfg.HeliusAPIKey, cfg.HeliusBaseURL, cfg.HeliusRateLimit)
+	// Helius echoes the header it was registered with on every delivery
+	registry := services.NewWebhookRegistry(db, apiClient, cfg.WebhookURL(), "Bearer "+cfg.HeliusAPIKey)
+	if stale, err := registry.Stale(context.Background()); err != nil {
+		logger.Warn("failed to check webhook callback URLs", "error", err)
+	} else if len(stale) > 0 {
+		logger.Warn("webhooks are registered with an outdated callback URL; run helixscan webhooks sync",
+			"count", len(stale), "url", registry.CallbackURL())
+	}
+	archive := services.NewArchive(services.ArchiveConfig{
+		Driver:      cfg.ArchiveDriver,
+		Dir:         cfg.ArchiveDir,
+		S3Endpoint:  cfg.ArchiveS3Endpoint,
+		S3Region:    cfg.ArchiveS3Region,
+		S3Bucket:    cfg.ArchiveS3Bucket,
+		S3AccessKey: cfg.ArchiveS3AccessKey,
+		S3SecretKey: cfg.ArchiveS3SecretKey,
+	})
+	partitionService := services.NewPartitionService(db, tenants, cfg.PartitionInterval, cfg.PartitionPremake,
+		cfg.PartitionEventRetentionDays, archive, cfg.RetentionBatchSize, logger)
+	runInBackground(partitionService.Run)
+	sinks := services.NewSinkManager(db, tenants, partitionService, services.WriteBatching{
+		MaxRows: cfg.WriteBatchSize,
+		Linger:  time.Duration(cfg.WriteBatchLingerMS) * time.Millisecond,
+	})
+	hub := services.NewHub()
+	forwarder := services.NewForwarder(db, cfg.ForwardWorkers, cfg.ForwardMaxAttempts, logger)
+	runInBackground(forwarder.Run)
+	mailer := services.NewMailer(services.MailerConfig{
+		Driver:   cfg.MailDriver,
+		From:     cfg.MailFrom,
+		SMTPHost: cfg.SMTPHost,
+		SMTPPort: cfg.SMTPPort,
+		SMTPUser: cfg.SMTPUser,
+		SMTPPass: cfg.SMTPPassword,
+		FilePath: cfg.MailFilePath,
+	})
+	alertService := services.NewAlertService(db, mailer, cfg.AlertWorkers, logger)
+	filterService := services.NewFilterService(db, logger)
+	runInBackground(filterService.Run)
+	heliusService := services.NewHeliusService(db, sinks, hub, forwarder, alertService, filterService, logger)
+	replayService := services.NewReplayService(db, heliusService, cfg.ReplayRateLimit, logger)
+	runInBackground(replayService.Run)
+	rebuildService := services.NewRebuildService(db, tenants, sinks, partitionService, replayService, heliusService,
+		time.Duration(cfg.RebuildRetentionHours)*time.Hour, logger)
+	runInBackground(rebuildService.Run)
+	retentionService := services.NewRetentionService(db, tenants, partitionService, archive, cfg.RetentionBatchSize,
+		time.Duration(cfg.RetentionIntervalMinutes)*time.Minute, logger)
+	runInBackground(retentionService.Run)
+	orgService := services.NewOrganizationService(db)
+	accountService := services.NewAccountService(db, mailer, cfg.AppURL)
+	auditService := services.NewAuditService(db)
+	queryService := services.NewQueryService(db, tenants)
+	streamService := services.NewStreamService(db, hub)
+	destinationService := services.NewDestinationService(db, forwarder)
+	pools := append([]*services.WorkerPool{forwarder.Pool()}, alertService.Pools()...)
+	healthService := services.NewHealthService(db, tenants, apiClient, pools...)
+	if schemaVersion == migrator.Latest() {
+		healthService.MarkMigrated()
+	} else {
+		logger.Warn("database schema is out of date; run helixscan migrate up",
+			"version", schemaVersion, "latest", migrator.Latest())
+	}
+	services.RegisterRuntimeMetrics(tenants, pools...)
+	graphServer, err := graph.NewServer(db, queryService, streamService, graph.Limits{
+		MaxComplexity: cfg.GraphQLMaxComplexity,
+		MaxDepth:      cfg.GraphQLMaxDepth,
+	})
+	if err != nil {
+		logger.Error("failed to build GraphQL schema", "error", err)
+		os.Exit(1)
+	}
 
 	// Initialize controllers
-	webhookController := controllers.NewWebhookController(heliusService)
-	userController := controllers.NewUserController(db)
+	webhookController := controllers.NewWebhookController(heliusService, registry, auditService)
+	userController := controllers.NewUserController(db, accountService, auditService)
+	orgController := controllers.NewOrganizationController(orgService, auditService)
+	configController := controllers.NewConfigController(db, tenants, filterService, auditService)
+	auditController := controllers.NewAuditController(auditService)
+	dataController := controllers.NewDataController(queryService)
+	graphqlController := controllers.NewGraphQLController(db, graphServer)
+	streamController := controllers.NewStreamController(streamService)
+	destinationController := controllers.NewDestinationController(destinationService, auditService)
+	alertController := controllers.NewAlertController(alertService, auditService)
+	replayController := controllers.NewReplayController(replayService, auditService)
+	retentionController := controllers.NewRetentionController(retentionService, auditService)
+	healthController := controllers.NewHealthController(healthService)
 
 	// Initialize Fiber
 	app := fiber.New()
+	app.Use(middleware.Tracing())
+	app.Use(middleware.RequestID(logger))
 
 	// Basic route
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("Blockchain Indexing Platform API")
 	})
 
+	// Probes for the orchestrator; /status is the detailed view for admins
+	app.Get("/healthz", healthController.Healthz)
+	app.Get("/readyz", healthController.Readyz)
+	app.Get("/status", middleware.Protected(accountService), middleware.ResolveOrganization(orgService),
+		middleware.RequireRole(models.RoleAdmin), healthController.Status)
+
+	// Prometheus scrape endpoint
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+
+	// Per-IP rate limits; a limit of 0 disables them
+	if cfg.AuthRateLimit > 0 {
+		app.Use("/auth", limiter.New(limiter.Config{Max: cfg.AuthRateLimit, Expiration: time.Minute}))
+	}
+	if cfg.APIRateLimit > 0 {
+		app.Use("/api", limiter.New(limiter.Config{Max: cfg.APIRateLimit, Expiration: time.Minute}))
+	}
+
 	// Auth routes
 	app.Post("/auth/signup", userController.Signup)
 	app.Post("/auth/login", userController.Login)
+	app.Post("/auth/verify-email", userController.VerifyEmail)
+	app.Post("/auth/verify-email/resend", middleware.Protected(accountService), userController.ResendVerification)
+	app.Post("/auth/password/forgot", userController.ForgotPassword)
+	app.Post("/auth/password/reset", userController.ResetPassword)
+
+	// Helius deliveries for this environment; the path is part of the registered callback URL
+	app.Post(cfg.WebhookPath(), middleware.WebhookAuth(registry.AuthHeader()), webhookController.HandleWebhook)
 
 	// Protected webhook routes
-	app.Post("/webhooks/helius", middleware.Protected(), webhookController.HandleWebhook)
-	app.Post("/webhooks/configure", middleware.Protected(), webhookController.ConfigureWebhook)
+	app.Post("/webhooks/configure", middleware.Protected(accountService), middleware.ResolveOrganization(orgService),
+		middleware.RequireRole(models.RoleAdmin), webhookController.ConfigureWebhook)
+
+	// Real-time event streams; browsers may pass credentials as query parameters
+	stream := app.Group("/stream", middleware.QueryCredentials(), middleware.Protected(accountService),
+		middleware.ResolveOrganization(orgService), streamController.Validate)
+	stream.Get("/ws", streamController.RequireUpgrade, websocket.New(streamController.WebSocket))
+	stream.Get("/sse", streamController.SSE)
+
+	// Organization routes; X-Organization-ID selects the active organization
+	app.Get("/api/organizations", middleware.Protected(accountService), orgController.ListOrganizations)
+	app.Post("/api/organizations", middleware.Protected(accountService), orgController.CreateOrganization)
+	app.Post("/api/invitations/accept", middleware.Protected(accountService), orgController.AcceptInvitation)
+
+	api := app.Group("/api", middleware.Protected(accountService), middleware.ResolveOrganization(orgService))
+	api.Get("/organization/members", orgController.ListMembers)
+	api.Post("/organization/invitations", middleware.RequireRole(models.RoleAdmin), orgController.Invite)
+	api.Delete("/organization/members/:userID", middleware.RequireRole(models.RoleAdmin), orgController.RemoveMember)
+
+	// Organization configuration routes
+	api.Get("/config/database", middleware.RequireRole(models.RoleAdmin), configController.GetDatabaseConfig)
+	api.Post("/config/database", middleware.RequireRole(models.RoleAdmin), configController.UpdateDatabaseConfig)
+	api.Post("/config/database/test", middleware.RequireRole(models.RoleAdmin), configController.TestDatabaseConfig)
+	api.Get("/config/sink", middleware.RequireRole(models.RoleAdmin), configController.GetSinkConfig)
+	api.Post("/config/sink", middleware.RequireRole(models.RoleAdmin), configController.UpdateSinkConfig)
+	api.Get("/config/indexing", configController.GetIndexingPreference)
+	api.Post("/config/indexing", middleware.RequireRole(models.RoleAdmin), configController.UpdateIndexingPreference)
+	api.Get("/config/indexing/filter-stats", configController.GetFilterStats)
 
-	// Start server
-	app.Listen(":" + cfg.ServerPort)
+	// Outbound webhook destinations
+	api.Get("/destinations", middleware.RequireRole(models.RoleAdmin), destinationController.ListDestinations)
+	api.Post("/destinations", middleware.RequireRole(models.RoleAdmin), destinationController.CreateDestination)
+	api.Put("/destinations/:id", middleware.RequireRole(models.RoleAdmin), destinationController.UpdateDestination)
+	api.Delete("/destinations/:id", middleware.RequireRole(models.RoleAdmin), destinationController.DeleteDestination)
+	api.Post("/destinations/:id/secret", middleware.RequireRole(models.RoleAdmin), destinationController.RotateSecret)
+	api.Post("/destinations/:id/test", middleware.RequireRole(models.RoleAdmin), destinationController.TestDestination)
+	api.Get("/destinations/:id/deliveries", middleware.RequireRole(models.RoleAdmin), destinationController.ListDeliveries)
+
+	// Alert rules and history
+	api.Get("/alerts", alertController.ListRules)
+	api.Post("/alerts", middleware.RequireRole(models.RoleAdmin), alertController.CreateRule)
+	api.Put("/alerts/:id", middleware.RequireRole(models.RoleAdmin), alertController.UpdateRule)
+	api.Delete("/alerts/:id", middleware.RequireRole(models.RoleAdmin), alertController.DeleteRule)
+	api.Get("/alerts/:id/history", alertController.RuleHistory)
+	api.Get("/alert-events", alertController.ListAlertEvents)
+
+	// Replays of stored events
+	api.Get("/replays", middleware.RequireRole(models.RoleAdmin), replayController.ListReplays)
+	api.Post("/replays", middleware.RequireRole(models.RoleAdmin), replayController.CreateReplay)
+	api.Get("/replays/:id", middleware.RequireRole(models.RoleAdmin), replayController.GetReplay)
+	api.Post("/replays/:id/cancel", middleware.RequireRole(models.RoleAdmin), replayController.CancelReplay)
+
+	// Retention policies and storage use
+	api.Get("/retention", middleware.RequireRole(models.RoleAdmin), retentionController.ListPolicies)
+	api.Put("/retention", middleware.RequireRole(models.RoleAdmin), retentionController.SetPolicy)
+	api.Delete("/retention/:target", middleware.RequireRole(models.RoleAdmin), retentionController.DeletePolicy)
+	api.Get("/storage", middleware.RequireRole(models.RoleAdmin), retentionController.GetStorage)
+
+	// Indexed data
+	api.Get("/data/:category", dataController.QueryCategory)
+	api.Get("/graphql", graphqlController.Query)
+	api.Post("/graphql", graphqlController.Query)
+	api.Post("/graphql/subscriptions", graphqlController.Subscribe)
+
+	// Audit log
+	api.Get("/audit-events", middleware.RequireRole(models.RoleAdmin), auditController.ListEvents)
+
+	// Start server and serve until SIGINT or SIGTERM
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(":" + cfg.ServerPort)
+	}()
+
+	select {
+	case err := <-listenErr:
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	case <-signals.Done():
+	}
+	// A second signal kills the process without waiting for the drain
+	stopSignals()
+
+	timeout := time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second
+	logger.Info("shutting down", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	clean := shutdown(ctx, logger, []shutdownStep{
+		{"stop readiness", func(context.Context) error {
+			healthService.MarkDraining()
+			return nil
+		}},
+		{"close streams", func(context.Context) error {
+			hub.Close()
+			return nil
+		}},
+		// Waits for in-flight requests, including HandleWebhook, to finish
+		{"stop http server", app.ShutdownWithContext},
+		// Stops polling for retries, pauses replays, rebuilds and pruning
+		// and flushes buffered filter counts
+		{"stop background loops", func(ctx context.Context) error {
+			stopBackground()
+			done := make(chan struct{})
+			go func() {
+				backgroundLoops.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}},
+		// Pools stop taking jobs and finish the ones queued; pending
+		// deliveries stay in the database for the next start
+		{"drain " + forwarder.Pool().Name(), forwarder.Pool().Shutdown},
+		{"drain alert pools", func(ctx context.Context) error {
+			var errs []error
+			for _, pool := range alertService.Pools() {
+				errs = append(errs, pool.Shutdown(ctx))
+			}
+			return errors.Join(errs...)
+		}},
+		{"close sinks", func(context.Context) error {
+			sinks.Close()
+			return nil
+		}},
+		{"close tenant databases", func(context.Context) error {
+			tenants.Close()
+			return nil
+		}},
+		{"flush traces", shutdownTracing},
+		{"close platform database", func(context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.Close()
+		}},
+	})
+	if !clean {
+		logger.Error("shutdown did not complete cleanly")
+		os.Exit(1)
+	}
+	logger.Info("shutdown complete")
 }
\ No newline at end of file
@@ -1,15 +1,35 @@
 package middleware
 
 import (
+	"backend/services"
+	"crypto/subtle"
 	"errors"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
-var jwtSecret = []byte("your-secret-key") // In production, this should be loaded from environment variables
+var (
+	jwtSecret []byte
+	// Earlier secrets still accepted so rotating the secret doesn't log everyone out
+	jwtPreviousSecrets [][]byte
+	jwtTTL             = 24 * time.Hour
+)
+
+// ConfigureJWT sets the key tokens are signed with, older keys that are
+// still accepted, and how long new tokens last. It must be called before
+// serving requests.
+func ConfigureJWT(secret string, previousSecrets []string, ttl time.Duration) {
+	jwtSecret = []byte(secret)
+	jwtPreviousSecrets = nil
+	for _, previous := range previousSecrets {
+		jwtPreviousSecrets = append(jwtPreviousSecrets, []byte(previous))
+	}
+	jwtTTL = ttl
+}
 
 type Claims struct {
 	UserID uint `json:"user_id"`
@@ -21,7 +41,7 @@ func GenerateToken(userID uint) (string, error) {
 	claims := Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jwtTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -35,8 +55,22 @@ func GenerateToken(userID uint) (string, error) {
 	return tokenString, nil
 }
 
-// Protected middleware to verify JWT tokens
-func Protected() fiber.Handler {
+// WebhookAuth accepts only requests whose Authorization header equals
+// expected, the header Helius was told to send with each delivery
+func WebhookAuth(expected string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if subtle.ConstantTimeCompare([]byte(c.Get("Authorization")), []byte(expected)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid webhook credentials",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// Protected middleware to verify JWT tokens. Tokens of users who have since
+// been disabled or deleted are rejected.
+func Protected(accounts *services.AccountService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authorization := c.Get("Authorization")
 		if authorization == "" {
@@ -56,7 +90,11 @@ func Protected() fiber.Handler {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, errors.New("unexpected signing method")
 			}
-			return jwtSecret, nil
+			keys := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{jwtSecret}}
+			for _, previous := range jwtPreviousSecrets {
+				keys.Keys = append(keys.Keys, previous)
+			}
+			return keys, nil
 		})
 
 		if err != nil {
@@ -72,6 +110,22 @@ func Protected() fiber.Handler {
 			})
 		}
 
+		if _, err := accounts.ActiveUser(claims.UserID); err != nil {
+			if errors.Is(err, services.ErrAccountDisabled) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Account has been disabled",
+				})
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired token",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load user",
+			})
+		}
+
 		// Add user ID to context
 		c.Locals("userID", claims.UserID)
 		return c.Next()
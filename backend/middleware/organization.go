@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"backend/models"
+	"backend/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OrganizationHeader selects the active organization for a request
+const OrganizationHeader = "X-Organization-ID"
+
+// ResolveOrganization loads the caller's membership in the organization named
+// by the X-Organization-ID header, falling back to their oldest organization.
+// It must run after Protected.
+func ResolveOrganization(orgService *services.OrganizationService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var orgID uint
+		if header := c.Get(OrganizationHeader); header != "" {
+			id, err := strconv.ParseUint(header, 10, 64)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid organization ID",
+				})
+			}
+			orgID = uint(id)
+		}
+
+		membership, err := orgService.ResolveMembership(CurrentUserID(c), orgID)
+		if err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Not a member of this organization",
+			})
+		}
+
+		c.Locals("orgID", membership.OrganizationID)
+		c.Locals("role", membership.Role)
+		return c.Next()
+	}
+}
+
+// RequireRole rejects requests whose active role is below min.
+// It must run after ResolveOrganization.
+func RequireRole(min models.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !CurrentRole(c).AtLeast(min) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Insufficient permissions",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// CurrentUserID returns the authenticated user's ID
+func CurrentUserID(c *fiber.Ctx) uint {
+	userID, _ := c.Locals("userID").(uint)
+	return userID
+}
+
+// CurrentOrganizationID returns the active organization's ID
+func CurrentOrganizationID(c *fiber.Ctx) uint {
+	orgID, _ := c.Locals("orgID").(uint)
+	return orgID
+}
+
+// CurrentRole returns the caller's role in the active organization
+func CurrentRole(c *fiber.Ctx) models.Role {
+	role, _ := c.Locals("role").(models.Role)
+	return role
+}
+
+// QueryCredentials lets clients that cannot set request headers, such as
+// browser WebSocket and EventSource connections, pass the bearer token and
+// organization as access_token and organization_id query parameters.
+// It must run before Protected.
+func QueryCredentials() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token := c.Query("access_token"); token != "" && c.Get(fiber.HeaderAuthorization) == "" {
+			c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		}
+		if orgID := c.Query("organization_id"); orgID != "" && c.Get(OrganizationHeader) == "" {
+			c.Request().Header.Set(OrganizationHeader, orgID)
+		}
+		return c.Next()
+	}
+}
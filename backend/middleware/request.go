@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"backend/logging"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// RequestID assigns every request an ID, reusing the caller's X-Request-ID
+// when present, and echoes it in the response. The ID travels in the
+// request's user context so services can tag their logs with it, and each
+// request is logged once it completes.
+func RequestID(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		c.Set(RequestIDHeader, id)
+		c.Locals("requestID", id)
+		c.Locals("logger", logger.With("request_id", id))
+		c.SetUserContext(logging.WithRequestID(c.UserContext(), id))
+
+		start := time.Now()
+		err := c.Next()
+		if err != nil {
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		logger.InfoContext(c.UserContext(), "request",
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", c.Response().StatusCode(),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return nil
+	}
+}
+
+// CurrentRequestID returns the request's ID
+func CurrentRequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("requestID").(string)
+	return id
+}
+
+// Logger returns a logger tagged with the request's ID
+func Logger(c *fiber.Ctx) *slog.Logger {
+	if logger, ok := c.Locals("logger").(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,325 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestLoadOrdersMigrationsByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0010_later.up.sql":    {Data: []byte("SELECT 10;")},
+		"sql/0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+		"sql/0002_second.down.sql": {Data: []byte("SELECT -2;")},
+		"sql/0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+	}
+	migrations, err := load(fsys)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	want := []Migration{
+		{Version: 1, Name: "first", Up: "SELECT 1;"},
+		{Version: 2, Name: "second", Up: "SELECT 2;", Down: "SELECT -2;"},
+		{Version: 10, Name: "later", Up: "SELECT 10;"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("load returned %d migrations, want %d", len(migrations), len(want))
+	}
+	for i := range want {
+		if migrations[i] != want[i] {
+			t.Errorf("migration %d = %+v, want %+v", i, migrations[i], want[i])
+		}
+	}
+}
+
+func TestLoadRejectsMalformedMigrations(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"wrong suffix", []string{"sql/0001_first.sql"}, "must end in .up.sql or .down.sql"},
+		{"no version", []string{"sql/first.up.sql"}, "must be named NNNN_name"},
+		{"version zero", []string{"sql/0000_first.up.sql"}, "must be named NNNN_name"},
+		{"two names", []string{"sql/0001_first.up.sql", "sql/0001_other.down.sql"}, "migration 1 has two names"},
+		{"down only", []string{"sql/0001_first.down.sql"}, "migration 1 has no up script"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, name := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+			}
+			_, err := load(fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("load = %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrationsAreNumberedInSequence(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d_%s follows version %d", m.Version, m.Name, i)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
+
+// testDB returns a database whose connections use a fresh schema of the
+// database named by HELIXSCAN_TEST_DATABASE_URL, skipping the test without it
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("HELIXSCAN_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("HELIXSCAN_TEST_DATABASE_URL is not set")
+	}
+
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("invalid HELIXSCAN_TEST_DATABASE_URL: %v", err)
+	}
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	admin := stdlib.OpenDB(*config)
+	t.Cleanup(func() { admin.Close() })
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	config.RuntimeParams["search_path"] = schema
+	db := stdlib.OpenDB(*config)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	t.Helper()
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name = $1)`, table).Scan(&exists)
+	if err != nil {
+		t.Fatalf("failed to look up %s: %v", table, err)
+	}
+	return exists
+}
+
+func TestUpAndDown(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	m, err := New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if current, err := m.Current(ctx); err != nil || current != m.Latest() {
+		t.Fatalf("Current = %d, %v after Up, want %d", current, err, m.Latest())
+	}
+	for _, table := range []string{"users", "organizations", "helius_webhooks", "replay_jobs", "rebuild_jobs", "retention_policies"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("table %s missing after Up", table)
+		}
+	}
+	// Applying again is a no-op
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("second Up: %v", err)
+	}
+
+	if err := m.Down(ctx); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if current, _ := m.Current(ctx); current != m.Latest()-1 {
+		t.Errorf("Current = %d after Down, want %d", current, m.Latest()-1)
+	}
+
+	if err := m.To(ctx, 0); err != nil {
+		t.Fatalf("To(0): %v", err)
+	}
+	if current, _ := m.Current(ctx); current != 0 {
+		t.Errorf("Current = %d after To(0), want 0", current)
+	}
+	if tableExists(t, db, "users") {
+		t.Error("users still exists after rolling everything back")
+	}
+
+	// And forward again from nothing
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up after rolling back: %v", err)
+	}
+	if err := m.To(ctx, m.Latest()+1); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("To(unknown) = %v, want ErrUnknownVersion", err)
+	}
+}
+
+func TestConcurrentUpAppliesEachMigrationOnce(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := New(db)
+			if err == nil {
+				err = m.Up(ctx)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("concurrent Up: %v", err)
+	}
+
+	var applied int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil {
+		t.Fatalf("failed to count migrations: %v", err)
+	}
+	m, _ := New(db)
+	if applied != len(m.migrations) {
+		t.Errorf("%d migrations recorded, want %d", applied, len(m.migrations))
+	}
+}
+
+func TestUpWaitsForTheMigrationLock(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	m, err := New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	holder, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer holder.Close()
+	if _, err := holder.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		t.Fatalf("failed to take the lock: %v", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := m.Up(waitCtx); err == nil || !strings.Contains(err.Error(), "failed to acquire migration lock") {
+		t.Fatalf("Up while locked = %v, want it to time out waiting for the lock", err)
+	}
+	if tableExists(t, db, "users") {
+		t.Fatal("Up applied migrations without the lock")
+	}
+
+	if _, err := holder.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+		t.Fatalf("failed to release the lock: %v", err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up after the lock was released: %v", err)
+	}
+}
+
+func TestUpMovesUserOwnedRowsToPersonalOrganizations(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	// Tables as an AutoMigrate release from before organizations left them
+	_, err := db.Exec(`
+		CREATE TABLE users (id bigserial PRIMARY KEY, created_at timestamptz, updated_at timestamptz,
+			deleted_at timestamptz, email text, password text);
+		CREATE TABLE helius_webhooks (id bigserial PRIMARY KEY, created_at timestamptz, updated_at timestamptz,
+			deleted_at timestamptz, user_id bigint, webhook_id text);
+		CREATE TABLE database_configs (id bigserial PRIMARY KEY, created_at timestamptz, updated_at timestamptz,
+			deleted_at timestamptz, user_id bigint, host text);
+		CREATE TABLE indexing_preferences (id bigserial PRIMARY KEY, created_at timestamptz, updated_at timestamptz,
+			deleted_at timestamptz, user_id bigint, nft_bids boolean);
+		INSERT INTO users (email, password, created_at) VALUES ('a@example.com', 'x', now()), ('b@example.com', 'x', now());
+		INSERT INTO helius_webhooks (user_id, webhook_id) VALUES (1, 'wh-a1'), (1, 'wh-a2'), (2, 'wh-b');
+		INSERT INTO database_configs (user_id, host) VALUES (1, 'old'), (1, 'new');
+		INSERT INTO indexing_preferences (user_id, nft_bids) VALUES (2, true);`)
+	if err != nil {
+		t.Fatalf("failed to create legacy tables: %v", err)
+	}
+
+	m, err := New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	orgs := make(map[int64]int64)
+	rows, err := db.Query(`SELECT m.user_id, m.organization_id FROM memberships m
+		JOIN organizations o ON o.id = m.organization_id
+		JOIN users u ON u.id = m.user_id AND u.email = o.name
+		WHERE m.role = 'owner'`)
+	if err != nil {
+		t.Fatalf("failed to read memberships: %v", err)
+	}
+	for rows.Next() {
+		var userID, orgID int64
+		if err := rows.Scan(&userID, &orgID); err != nil {
+			t.Fatal(err)
+		}
+		orgs[userID] = orgID
+	}
+	rows.Close()
+	if len(orgs) != 2 {
+		t.Fatalf("personal organizations = %v, want one per user", orgs)
+	}
+
+	owned := func(query string) map[string]sql.NullInt64 {
+		t.Helper()
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		defer rows.Close()
+		owners := make(map[string]sql.NullInt64)
+		for rows.Next() {
+			var key string
+			var orgID sql.NullInt64
+			if err := rows.Scan(&key, &orgID); err != nil {
+				t.Fatal(err)
+			}
+			owners[key] = orgID
+		}
+		return owners
+	}
+
+	webhooks := owned(`SELECT webhook_id, organization_id FROM helius_webhooks`)
+	for webhook, user := range map[string]int64{"wh-a1": 1, "wh-a2": 1, "wh-b": 2} {
+		if got := webhooks[webhook]; got.Int64 != orgs[user] {
+			t.Errorf("webhook %s belongs to organization %v, want %d", webhook, got, orgs[user])
+		}
+	}
+	// A user's newest database config moves; the older one can't share it
+	configs := owned(`SELECT host, organization_id FROM database_configs`)
+	if configs["new"].Int64 != orgs[1] || configs["old"].Valid {
+		t.Errorf("database configs owned by %v, want new in organization %d and old in none", configs, orgs[1])
+	}
+	prefs := owned(`SELECT CAST(id AS text), organization_id FROM indexing_preferences`)
+	if prefs["1"].Int64 != orgs[2] {
+		t.Errorf("indexing preferences owned by %v, want organization %d", prefs, orgs[2])
+	}
+}
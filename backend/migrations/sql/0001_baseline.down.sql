@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS alert_events;
+DROP TABLE IF EXISTS alert_rules;
+DROP TABLE IF EXISTS delivery_attempts;
+DROP TABLE IF EXISTS deliveries;
+DROP TABLE IF EXISTS destinations;
+DROP TABLE IF EXISTS webhook_events;
+DROP TABLE IF EXISTS helius_webhooks;
+DROP TABLE IF EXISTS data_sync_statuses;
+DROP TABLE IF EXISTS sink_configs;
+DROP TABLE IF EXISTS filter_stats;
+DROP TABLE IF EXISTS indexing_preferences;
+DROP TABLE IF EXISTS database_configs;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS user_tokens;
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS organizations;
+DROP TABLE IF EXISTS users;
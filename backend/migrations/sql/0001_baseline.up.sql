@@ -0,0 +1,465 @@
+-- Baseline: the schema AutoMigrate produced before versioned migrations.
+-- Databases created by AutoMigrate already have some of these tables, but
+-- possibly from a release before some of their columns existed, so each
+-- table is followed by its columns again; both are skipped when present.
+-- Rows still owned through the old user_id columns are moved to
+-- organizations by 0008_personal_organizations.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                    bigserial PRIMARY KEY,
+    created_at            timestamptz,
+    updated_at            timestamptz,
+    deleted_at            timestamptz,
+    email                 text,
+    password              text,
+    api_key               text,
+    email_verified_at     timestamptz,
+    failed_login_attempts bigint DEFAULT 0,
+    locked_until          timestamptz,
+    CONSTRAINT uni_users_email UNIQUE (email),
+    CONSTRAINT uni_users_api_key UNIQUE (api_key)
+);
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS created_at            timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at            timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at            timestamptz,
+    ADD COLUMN IF NOT EXISTS email                 text,
+    ADD COLUMN IF NOT EXISTS password              text,
+    ADD COLUMN IF NOT EXISTS api_key               text,
+    ADD COLUMN IF NOT EXISTS email_verified_at     timestamptz,
+    ADD COLUMN IF NOT EXISTS failed_login_attempts bigint DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS locked_until          timestamptz;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name       text
+);
+ALTER TABLE organizations
+    ADD COLUMN IF NOT EXISTS created_at timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at timestamptz,
+    ADD COLUMN IF NOT EXISTS name       text;
+CREATE INDEX IF NOT EXISTS idx_organizations_deleted_at ON organizations (deleted_at);
+
+CREATE TABLE IF NOT EXISTS memberships (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    deleted_at      timestamptz,
+    organization_id bigint,
+    user_id         bigint,
+    role            varchar(16),
+    CONSTRAINT fk_organizations_memberships FOREIGN KEY (organization_id) REFERENCES organizations (id),
+    CONSTRAINT fk_users_memberships FOREIGN KEY (user_id) REFERENCES users (id)
+);
+ALTER TABLE memberships
+    ADD COLUMN IF NOT EXISTS created_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS organization_id bigint,
+    ADD COLUMN IF NOT EXISTS user_id         bigint,
+    ADD COLUMN IF NOT EXISTS role            varchar(16);
+CREATE INDEX IF NOT EXISTS idx_memberships_deleted_at ON memberships (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_membership_org_user ON memberships (organization_id, user_id);
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    deleted_at      timestamptz,
+    organization_id bigint,
+    email           text,
+    role            varchar(16),
+    token           text,
+    invited_by_id   bigint,
+    expires_at      timestamptz,
+    accepted_at     timestamptz,
+    CONSTRAINT uni_invitations_token UNIQUE (token)
+);
+ALTER TABLE invitations
+    ADD COLUMN IF NOT EXISTS created_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS organization_id bigint,
+    ADD COLUMN IF NOT EXISTS email           text,
+    ADD COLUMN IF NOT EXISTS role            varchar(16),
+    ADD COLUMN IF NOT EXISTS token           text,
+    ADD COLUMN IF NOT EXISTS invited_by_id   bigint,
+    ADD COLUMN IF NOT EXISTS expires_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS accepted_at     timestamptz;
+CREATE INDEX IF NOT EXISTS idx_invitations_deleted_at ON invitations (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_invitations_organization_id ON invitations (organization_id);
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id    bigint,
+    purpose    varchar(32),
+    token_hash text,
+    expires_at timestamptz,
+    used_at    timestamptz,
+    CONSTRAINT uni_user_tokens_token_hash UNIQUE (token_hash)
+);
+ALTER TABLE user_tokens
+    ADD COLUMN IF NOT EXISTS created_at timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at timestamptz,
+    ADD COLUMN IF NOT EXISTS user_id    bigint,
+    ADD COLUMN IF NOT EXISTS purpose    varchar(32),
+    ADD COLUMN IF NOT EXISTS token_hash text,
+    ADD COLUMN IF NOT EXISTS expires_at timestamptz,
+    ADD COLUMN IF NOT EXISTS used_at    timestamptz;
+CREATE INDEX IF NOT EXISTS idx_user_tokens_deleted_at ON user_tokens (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    actor_id        bigint,
+    organization_id bigint,
+    action          text,
+    target_type     text,
+    target_id       text,
+    changes         jsonb,
+    ip              text,
+    user_agent      text
+);
+ALTER TABLE audit_events
+    ADD COLUMN IF NOT EXISTS created_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS actor_id        bigint,
+    ADD COLUMN IF NOT EXISTS organization_id bigint,
+    ADD COLUMN IF NOT EXISTS action          text,
+    ADD COLUMN IF NOT EXISTS target_type     text,
+    ADD COLUMN IF NOT EXISTS target_id       text,
+    ADD COLUMN IF NOT EXISTS changes         jsonb,
+    ADD COLUMN IF NOT EXISTS ip              text,
+    ADD COLUMN IF NOT EXISTS user_agent      text;
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_organization_id ON audit_events (organization_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
+
+CREATE TABLE IF NOT EXISTS database_configs (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    deleted_at      timestamptz,
+    organization_id bigint,
+    driver          varchar(16) DEFAULT 'postgres',
+    host            text,
+    port            text,
+    db_name         text,
+    username        text,
+    password        text,
+    CONSTRAINT fk_organizations_db_config FOREIGN KEY (organization_id) REFERENCES organizations (id)
+);
+ALTER TABLE database_configs
+    ADD COLUMN IF NOT EXISTS created_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS organization_id bigint,
+    ADD COLUMN IF NOT EXISTS driver          varchar(16) DEFAULT 'postgres',
+    ADD COLUMN IF NOT EXISTS host            text,
+    ADD COLUMN IF NOT EXISTS port            text,
+    ADD COLUMN IF NOT EXISTS db_name         text,
+    ADD COLUMN IF NOT EXISTS username        text,
+    ADD COLUMN IF NOT EXISTS password        text;
+CREATE INDEX IF NOT EXISTS idx_database_configs_deleted_at ON database_configs (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_database_configs_organization_id ON database_configs (organization_id);
+
+CREATE TABLE IF NOT EXISTS indexing_preferences (
+    id                bigserial PRIMARY KEY,
+    created_at        timestamptz,
+    updated_at        timestamptz,
+    deleted_at        timestamptz,
+    organization_id   bigint,
+    nft_bids          boolean,
+    nft_prices        boolean,
+    borrowable_tokens boolean,
+    token_prices      boolean,
+    custom_filters    json,
+    CONSTRAINT fk_organizations_indexing_preference FOREIGN KEY (organization_id) REFERENCES organizations (id)
+);
+ALTER TABLE indexing_preferences
+    ADD COLUMN IF NOT EXISTS created_at        timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at        timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at        timestamptz,
+    ADD COLUMN IF NOT EXISTS organization_id   bigint,
+    ADD COLUMN IF NOT EXISTS nft_bids          boolean,
+    ADD COLUMN IF NOT EXISTS nft_prices        boolean,
+    ADD COLUMN IF NOT EXISTS borrowable_tokens boolean,
+    ADD COLUMN IF NOT EXISTS token_prices      boolean,
+    ADD COLUMN IF NOT EXISTS custom_filters    json;
+CREATE INDEX IF NOT EXISTS idx_indexing_preferences_deleted_at ON indexing_preferences (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_indexing_preferences_organization_id ON indexing_preferences (organization_id);
+
+CREATE TABLE IF NOT EXISTS filter_stats (
+    organization_id bigint PRIMARY KEY,
+    hits            bigint,
+    misses          bigint,
+    updated_at      timestamptz
+);
+ALTER TABLE filter_stats
+    ADD COLUMN IF NOT EXISTS hits       bigint,
+    ADD COLUMN IF NOT EXISTS misses     bigint,
+    ADD COLUMN IF NOT EXISTS updated_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS sink_configs (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    deleted_at      timestamptz,
+    organization_id bigint,
+    driver          varchar(16),
+    addresses       text,
+    prefix          text,
+    username        text,
+    password        text,
+    tls             boolean
+);
+ALTER TABLE sink_configs
+    ADD COLUMN IF NOT EXISTS created_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS organization_id bigint,
+    ADD COLUMN IF NOT EXISTS driver          varchar(16),
+    ADD COLUMN IF NOT EXISTS addresses       text,
+    ADD COLUMN IF NOT EXISTS prefix          text,
+    ADD COLUMN IF NOT EXISTS username        text,
+    ADD COLUMN IF NOT EXISTS password        text,
+    ADD COLUMN IF NOT EXISTS tls             boolean;
+CREATE INDEX IF NOT EXISTS idx_sink_configs_deleted_at ON sink_configs (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sink_configs_organization_id ON sink_configs (organization_id);
+
+CREATE TABLE IF NOT EXISTS data_sync_statuses (
+    id            bigserial PRIMARY KEY,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    deleted_at    timestamptz,
+    user_id       bigint,
+    last_synced   timestamp,
+    synced_blocks bigint,
+    error_log     text
+);
+ALTER TABLE data_sync_statuses
+    ADD COLUMN IF NOT EXISTS created_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS user_id       bigint,
+    ADD COLUMN IF NOT EXISTS last_synced   timestamp,
+    ADD COLUMN IF NOT EXISTS synced_blocks bigint,
+    ADD COLUMN IF NOT EXISTS error_log     text;
+CREATE INDEX IF NOT EXISTS idx_data_sync_statuses_deleted_at ON data_sync_statuses (deleted_at);
+
+CREATE TABLE IF NOT EXISTS helius_webhooks (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    deleted_at      timestamptz,
+    organization_id bigint,
+    webhook_url     text,
+    webhook_id      text,
+    account_keys    text[],
+    event_types     text[],
+    is_active       boolean DEFAULT true,
+    CONSTRAINT uni_helius_webhooks_webhook_url UNIQUE (webhook_url),
+    CONSTRAINT uni_helius_webhooks_webhook_id UNIQUE (webhook_id)
+);
+ALTER TABLE helius_webhooks
+    ADD COLUMN IF NOT EXISTS created_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS organization_id bigint,
+    ADD COLUMN IF NOT EXISTS webhook_url     text,
+    ADD COLUMN IF NOT EXISTS webhook_id      text,
+    ADD COLUMN IF NOT EXISTS account_keys    text[],
+    ADD COLUMN IF NOT EXISTS event_types     text[],
+    ADD COLUMN IF NOT EXISTS is_active       boolean DEFAULT true;
+CREATE INDEX IF NOT EXISTS idx_helius_webhooks_deleted_at ON helius_webhooks (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_helius_webhooks_organization_id ON helius_webhooks (organization_id);
+
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id            bigserial PRIMARY KEY,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    deleted_at    timestamptz,
+    webhook_id    bigint,
+    event_type    text,
+    account_key   text,
+    slot          bigint,
+    timestamp     timestamptz,
+    payload       jsonb,
+    processed     boolean DEFAULT false,
+    processed_at  timestamptz,
+    filtered      boolean DEFAULT false,
+    error_message text
+);
+ALTER TABLE webhook_events
+    ADD COLUMN IF NOT EXISTS created_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS webhook_id    bigint,
+    ADD COLUMN IF NOT EXISTS event_type    text,
+    ADD COLUMN IF NOT EXISTS account_key   text,
+    ADD COLUMN IF NOT EXISTS slot          bigint,
+    ADD COLUMN IF NOT EXISTS timestamp     timestamptz,
+    ADD COLUMN IF NOT EXISTS payload       jsonb,
+    ADD COLUMN IF NOT EXISTS processed     boolean DEFAULT false,
+    ADD COLUMN IF NOT EXISTS processed_at  timestamptz,
+    ADD COLUMN IF NOT EXISTS filtered      boolean DEFAULT false,
+    ADD COLUMN IF NOT EXISTS error_message text;
+CREATE INDEX IF NOT EXISTS idx_webhook_events_deleted_at ON webhook_events (deleted_at);
+
+CREATE TABLE IF NOT EXISTS destinations (
+    id                   bigserial PRIMARY KEY,
+    created_at           timestamptz,
+    updated_at           timestamptz,
+    organization_id      bigint,
+    name                 text,
+    url                  text,
+    secret               text,
+    categories           text,
+    is_active            boolean DEFAULT true,
+    consecutive_failures bigint,
+    disabled_at          timestamptz,
+    disabled_reason      text
+);
+ALTER TABLE destinations
+    ADD COLUMN IF NOT EXISTS created_at           timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at           timestamptz,
+    ADD COLUMN IF NOT EXISTS organization_id      bigint,
+    ADD COLUMN IF NOT EXISTS name                 text,
+    ADD COLUMN IF NOT EXISTS url                  text,
+    ADD COLUMN IF NOT EXISTS secret               text,
+    ADD COLUMN IF NOT EXISTS categories           text,
+    ADD COLUMN IF NOT EXISTS is_active            boolean DEFAULT true,
+    ADD COLUMN IF NOT EXISTS consecutive_failures bigint,
+    ADD COLUMN IF NOT EXISTS disabled_at          timestamptz,
+    ADD COLUMN IF NOT EXISTS disabled_reason      text;
+CREATE INDEX IF NOT EXISTS idx_destinations_organization_id ON destinations (organization_id);
+
+CREATE TABLE IF NOT EXISTS deliveries (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    destination_id  bigint,
+    event_id        bigint,
+    payload         jsonb,
+    status          varchar(16),
+    attempts        bigint,
+    next_attempt_at timestamptz,
+    delivered_at    timestamptz,
+    last_error      text,
+    test            boolean,
+    trace_parent    varchar(64)
+);
+ALTER TABLE deliveries
+    ADD COLUMN IF NOT EXISTS created_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS destination_id  bigint,
+    ADD COLUMN IF NOT EXISTS event_id        bigint,
+    ADD COLUMN IF NOT EXISTS payload         jsonb,
+    ADD COLUMN IF NOT EXISTS status          varchar(16),
+    ADD COLUMN IF NOT EXISTS attempts        bigint,
+    ADD COLUMN IF NOT EXISTS next_attempt_at timestamptz,
+    ADD COLUMN IF NOT EXISTS delivered_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS last_error      text,
+    ADD COLUMN IF NOT EXISTS test            boolean,
+    ADD COLUMN IF NOT EXISTS trace_parent    varchar(64);
+CREATE INDEX IF NOT EXISTS idx_deliveries_destination_id ON deliveries (destination_id);
+CREATE INDEX IF NOT EXISTS idx_deliveries_event_id ON deliveries (event_id);
+CREATE INDEX IF NOT EXISTS idx_deliveries_status ON deliveries (status);
+CREATE INDEX IF NOT EXISTS idx_deliveries_next_attempt_at ON deliveries (next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS delivery_attempts (
+    id            bigserial PRIMARY KEY,
+    created_at    timestamptz,
+    delivery_id   bigint,
+    attempt       bigint,
+    status_code   bigint,
+    error         text,
+    response_body text,
+    duration_ms   bigint,
+    CONSTRAINT fk_deliveries_attempt_log FOREIGN KEY (delivery_id) REFERENCES deliveries (id)
+);
+ALTER TABLE delivery_attempts
+    ADD COLUMN IF NOT EXISTS created_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS delivery_id   bigint,
+    ADD COLUMN IF NOT EXISTS attempt       bigint,
+    ADD COLUMN IF NOT EXISTS status_code   bigint,
+    ADD COLUMN IF NOT EXISTS error         text,
+    ADD COLUMN IF NOT EXISTS response_body text,
+    ADD COLUMN IF NOT EXISTS duration_ms   bigint;
+CREATE INDEX IF NOT EXISTS idx_delivery_attempts_delivery_id ON delivery_attempts (delivery_id);
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id                bigserial PRIMARY KEY,
+    created_at        timestamptz,
+    updated_at        timestamptz,
+    deleted_at        timestamptz,
+    organization_id   bigint,
+    name              text,
+    category          varchar(32),
+    condition         varchar(32),
+    field             text,
+    threshold         decimal,
+    address           text,
+    collection        text,
+    window_seconds    bigint,
+    cooldown_seconds  bigint,
+    channels          text,
+    email             text,
+    webhook_url       text,
+    is_active         boolean DEFAULT true,
+    last_value        decimal,
+    last_triggered_at timestamptz
+);
+ALTER TABLE alert_rules
+    ADD COLUMN IF NOT EXISTS created_at        timestamptz,
+    ADD COLUMN IF NOT EXISTS updated_at        timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at        timestamptz,
+    ADD COLUMN IF NOT EXISTS organization_id   bigint,
+    ADD COLUMN IF NOT EXISTS name              text,
+    ADD COLUMN IF NOT EXISTS category          varchar(32),
+    ADD COLUMN IF NOT EXISTS condition         varchar(32),
+    ADD COLUMN IF NOT EXISTS field             text,
+    ADD COLUMN IF NOT EXISTS threshold         decimal,
+    ADD COLUMN IF NOT EXISTS address           text,
+    ADD COLUMN IF NOT EXISTS collection        text,
+    ADD COLUMN IF NOT EXISTS window_seconds    bigint,
+    ADD COLUMN IF NOT EXISTS cooldown_seconds  bigint,
+    ADD COLUMN IF NOT EXISTS channels          text,
+    ADD COLUMN IF NOT EXISTS email             text,
+    ADD COLUMN IF NOT EXISTS webhook_url       text,
+    ADD COLUMN IF NOT EXISTS is_active         boolean DEFAULT true,
+    ADD COLUMN IF NOT EXISTS last_value        decimal,
+    ADD COLUMN IF NOT EXISTS last_triggered_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_alert_rules_deleted_at ON alert_rules (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_alert_rules_organization_id ON alert_rules (organization_id);
+
+CREATE TABLE IF NOT EXISTS alert_events (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    rule_id         bigint,
+    organization_id bigint,
+    event_id        bigint,
+    value           decimal,
+    message         text,
+    notifications   jsonb
+);
+ALTER TABLE alert_events
+    ADD COLUMN IF NOT EXISTS created_at      timestamptz,
+    ADD COLUMN IF NOT EXISTS rule_id         bigint,
+    ADD COLUMN IF NOT EXISTS organization_id bigint,
+    ADD COLUMN IF NOT EXISTS event_id        bigint,
+    ADD COLUMN IF NOT EXISTS value           decimal,
+    ADD COLUMN IF NOT EXISTS message         text,
+    ADD COLUMN IF NOT EXISTS notifications   jsonb;
+CREATE INDEX IF NOT EXISTS idx_alert_events_rule_id ON alert_events (rule_id);
+CREATE INDEX IF NOT EXISTS idx_alert_events_organization_id ON alert_events (organization_id);
@@ -0,0 +1,3 @@
+ALTER TABLE helius_webhooks
+    ALTER COLUMN account_keys TYPE text[] USING string_to_array(account_keys, ','),
+    ALTER COLUMN event_types TYPE text[] USING string_to_array(event_types, ',');
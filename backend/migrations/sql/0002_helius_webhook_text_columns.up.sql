@@ -0,0 +1,4 @@
+-- account_keys and event_types hold comma-joined strings, not arrays
+ALTER TABLE helius_webhooks
+    ALTER COLUMN account_keys TYPE text USING array_to_string(account_keys, ','),
+    ALTER COLUMN event_types TYPE text USING array_to_string(event_types, ',');
@@ -0,0 +1,3 @@
+-- Fails if several webhooks already share a callback URL
+DROP INDEX IF EXISTS idx_helius_webhooks_webhook_url;
+ALTER TABLE helius_webhooks ADD CONSTRAINT uni_helius_webhooks_webhook_url UNIQUE (webhook_url);
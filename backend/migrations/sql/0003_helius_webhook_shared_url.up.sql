@@ -0,0 +1,3 @@
+-- Every webhook registered from an environment delivers to the same callback URL
+ALTER TABLE helius_webhooks DROP CONSTRAINT IF EXISTS uni_helius_webhooks_webhook_url;
+CREATE INDEX IF NOT EXISTS idx_helius_webhooks_webhook_url ON helius_webhooks (webhook_url);
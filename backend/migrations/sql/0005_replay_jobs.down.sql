@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_webhook_events_webhook_id;
+DROP TABLE IF EXISTS replay_jobs;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS replay_jobs (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    organization_id bigint,
+    webhook_id      bigint,
+    category        text,
+    from_event_id   bigint,
+    to_event_id     bigint,
+    from_slot       bigint,
+    to_slot         bigint,
+    from_time       timestamptz,
+    to_time         timestamptz,
+    target          varchar(16),
+    rate_per_second double precision,
+    status          varchar(16),
+    total           bigint,
+    processed       bigint,
+    failed          bigint,
+    last_event_id   bigint,
+    last_error      text,
+    requested_by_id bigint,
+    started_at      timestamptz,
+    finished_at     timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_replay_jobs_organization_id ON replay_jobs (organization_id);
+CREATE INDEX IF NOT EXISTS idx_replay_jobs_status ON replay_jobs (status);
+
+-- Replays page through a webhook's events in ID order
+CREATE INDEX IF NOT EXISTS idx_webhook_events_webhook_id ON webhook_events (webhook_id, id);
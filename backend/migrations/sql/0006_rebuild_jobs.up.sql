@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS rebuild_jobs (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    organization_id bigint,
+    webhook_id      bigint,
+    category        text,
+    status          varchar(16),
+    force           boolean,
+    replay_job_id   bigint,
+    last_event_id   bigint,
+    live_rows       bigint,
+    next_rows       bigint,
+    legacy_rows     bigint,
+    missing_rows    bigint,
+    added_rows      bigint,
+    changed_rows    bigint,
+    live_checksum   text,
+    next_checksum   text,
+    last_error      text,
+    retain_until    timestamptz,
+    requested_by_id bigint,
+    swapped_at      timestamptz,
+    finished_at     timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_rebuild_jobs_organization_id ON rebuild_jobs (organization_id);
+CREATE INDEX IF NOT EXISTS idx_rebuild_jobs_webhook_id ON rebuild_jobs (webhook_id);
+CREATE INDEX IF NOT EXISTS idx_rebuild_jobs_status ON rebuild_jobs (status);
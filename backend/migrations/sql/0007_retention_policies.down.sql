@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_webhook_events_created_at;
+DROP TABLE IF EXISTS retention_policies;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS retention_policies (
+    id              bigserial PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    organization_id bigint,
+    target          text,
+    max_age_days    bigint,
+    archive         boolean,
+    last_run_at     timestamptz,
+    last_pruned     bigint,
+    last_error      text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_retention_org_target ON retention_policies (organization_id, target);
+
+-- Pruning finds expired events by when they were received
+CREATE INDEX IF NOT EXISTS idx_webhook_events_created_at ON webhook_events (created_at);
@@ -0,0 +1,3 @@
+-- The backfilled organizations keep their data; the user_id columns were
+-- left untouched, so there is nothing to restore
+SELECT 1;
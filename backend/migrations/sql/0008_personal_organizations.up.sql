@@ -0,0 +1,54 @@
+-- Users who signed up before organizations existed have no membership, and
+-- their webhooks, database config and indexing preferences are still owned
+-- through the user_id column AutoMigrate left behind. Give each of them a
+-- personal organization, as signup does, and move that data into it.
+DO $$
+DECLARE
+    u      record;
+    org_id bigint;
+BEGIN
+    FOR u IN
+        SELECT id, email, created_at, deleted_at FROM users
+        WHERE NOT EXISTS (SELECT 1 FROM memberships WHERE memberships.user_id = users.id)
+        ORDER BY id
+    LOOP
+        INSERT INTO organizations (created_at, updated_at, deleted_at, name)
+        VALUES (u.created_at, now(), u.deleted_at, u.email)
+        RETURNING id INTO org_id;
+        INSERT INTO memberships (created_at, updated_at, organization_id, user_id, role)
+        VALUES (u.created_at, now(), org_id, u.id, 'owner');
+    END LOOP;
+
+    -- Each user's rows move to the first organization they own. Database
+    -- config and preferences are one per organization, so only a user's
+    -- newest row of those moves.
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'helius_webhooks' AND column_name = 'user_id') THEN
+        UPDATE helius_webhooks SET organization_id = owner.organization_id
+        FROM (SELECT DISTINCT ON (user_id) user_id, organization_id FROM memberships
+              WHERE role = 'owner' ORDER BY user_id, id) owner
+        WHERE helius_webhooks.organization_id IS NULL AND helius_webhooks.user_id = owner.user_id;
+    END IF;
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'database_configs' AND column_name = 'user_id') THEN
+        UPDATE database_configs SET organization_id = owner.organization_id
+        FROM (SELECT DISTINCT ON (user_id) user_id, organization_id FROM memberships
+              WHERE role = 'owner' ORDER BY user_id, id) owner
+        WHERE database_configs.organization_id IS NULL AND database_configs.user_id = owner.user_id
+          AND database_configs.id = (SELECT max(id) FROM database_configs newest
+                                     WHERE newest.user_id = database_configs.user_id)
+          AND NOT EXISTS (SELECT 1 FROM database_configs taken
+                          WHERE taken.organization_id = owner.organization_id);
+    END IF;
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'indexing_preferences' AND column_name = 'user_id') THEN
+        UPDATE indexing_preferences SET organization_id = owner.organization_id
+        FROM (SELECT DISTINCT ON (user_id) user_id, organization_id FROM memberships
+              WHERE role = 'owner' ORDER BY user_id, id) owner
+        WHERE indexing_preferences.organization_id IS NULL AND indexing_preferences.user_id = owner.user_id
+          AND indexing_preferences.id = (SELECT max(id) FROM indexing_preferences newest
+                                         WHERE newest.user_id = indexing_preferences.user_id)
+          AND NOT EXISTS (SELECT 1 FROM indexing_preferences taken
+                          WHERE taken.organization_id = owner.organization_id);
+    END IF;
+END $$;
@@ -0,0 +1,4 @@
+-- Crossing rules start again from no previous value
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS last_value decimal;
+DROP TABLE IF EXISTS alert_volume_hits;
+DROP TABLE IF EXISTS alert_rule_states;
@@ -0,0 +1,20 @@
+-- Crossing conditions compare an event with the last value seen for the
+-- same address, and volume conditions count hits across every replica, so
+-- both now live in their own tables. A rule's single last_value can't be
+-- split by address and is dropped.
+CREATE TABLE IF NOT EXISTS alert_rule_states (
+    rule_id    bigint NOT NULL,
+    address    text NOT NULL,
+    last_value decimal NOT NULL,
+    updated_at timestamptz,
+    PRIMARY KEY (rule_id, address)
+);
+
+CREATE TABLE IF NOT EXISTS alert_volume_hits (
+    id      bigserial PRIMARY KEY,
+    rule_id bigint NOT NULL,
+    seen_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_alert_volume_hits_rule_seen ON alert_volume_hits (rule_id, seen_at);
+
+ALTER TABLE alert_rules DROP COLUMN IF EXISTS last_value;
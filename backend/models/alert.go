@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Alert conditions
+const (
+	ConditionAbove        = "above"
+	ConditionBelow        = "below"
+	ConditionCrossesAbove = "crosses_above"
+	ConditionCrossesBelow = "crosses_below"
+	ConditionVolumeAbove  = "volume_above" // More than Threshold matching events within Window
+)
+
+// Alert notification channels
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+	ChannelDiscord = "discord"
+)
+
+// AlertRule triggers notifications when processed events meet a condition
+type AlertRule struct {
+	gorm.Model
+	OrganizationID  uint       `json:"organization_id" gorm:"index"`
+	Name            string     `json:"name"`
+	Category        string     `json:"category" gorm:"type:varchar(32)"`
+	Condition       string     `json:"condition" gorm:"type:varchar(32)"`
+	Field           string     `json:"field"` // Numeric column compared to Threshold; unused for volume rules
+	Threshold       float64    `json:"threshold"`
+	Address         string     `json:"address"`    // Optional; matches any of the category's address columns
+	Collection      string     `json:"collection"` // Optional; matches the event's NFT collection
+	WindowSeconds   int        `json:"window_seconds"`
+	CooldownSeconds int        `json:"cooldown_seconds"`
+	Channels        string     `json:"channels"` // Comma-separated
+	Email           string     `json:"email"`
+	WebhookURL      string     `json:"webhook_url"` // Target for webhook, Slack and Discord channels
+	IsActive        bool       `json:"is_active" gorm:"default:true"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at"`
+}
+
+// AlertRuleState is the last value a crossing rule saw for one address
+type AlertRuleState struct {
+	RuleID    uint      `json:"rule_id" gorm:"primaryKey;autoIncrement:false"`
+	Address   string    `json:"address" gorm:"primaryKey"`
+	LastValue float64   `json:"last_value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AlertVolumeHit is one event counted towards a volume rule's window
+type AlertVolumeHit struct {
+	ID     uint      `json:"id" gorm:"primarykey"`
+	RuleID uint      `json:"rule_id"`
+	SeenAt time.Time `json:"seen_at"`
+}
+
+// AlertEvent is one firing of an alert rule
+type AlertEvent struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time `json:"created_at"`
+	RuleID         uint      `json:"rule_id" gorm:"index"`
+	OrganizationID uint      `json:"organization_id" gorm:"index"`
+	EventID        uint      `json:"event_id"`
+	Value          float64   `json:"value"`
+	Message        string    `json:"message"`
+	Notifications  string    `json:"notifications" gorm:"type:jsonb"` // Per-channel delivery results
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAuditEventImmutable = errors.New("audit events are append-only")
+
+// AuditEvent records a security-relevant or configuration action.
+// Rows are never updated or deleted.
+type AuditEvent struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+	ActorID        *uint     `json:"actor_id" gorm:"index"`
+	OrganizationID *uint     `json:"organization_id" gorm:"index"`
+	Action         string    `json:"action" gorm:"index"`
+	TargetType     string    `json:"target_type"`
+	TargetID       string    `json:"target_id"`
+	Changes        string    `json:"changes" gorm:"type:jsonb"`
+	IP             string    `json:"ip"`
+	UserAgent      string    `json:"user_agent"`
+}
+
+func (AuditEvent) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+func (AuditEvent) BeforeDelete(*gorm.DB) error {
+	return ErrAuditEventImmutable
+}
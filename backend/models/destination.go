@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Destination is a customer HTTP endpoint that receives processed events
+type Destination struct {
+	ID                  uint       `json:"id" gorm:"primarykey"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	OrganizationID      uint       `json:"organization_id" gorm:"index"`
+	Name                string     `json:"name"`
+	URL                 string     `json:"url"`
+	Secret              string     `json:"-"`
+	Categories          string     `json:"categories"` // Comma-separated; empty means all categories
+	IsActive            bool       `json:"is_active" gorm:"default:true"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+}
+
+// Delivery tracks sending one event to one destination, across retries
+type Delivery struct {
+	ID            uint       `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DestinationID uint       `json:"destination_id" gorm:"index"`
+	EventID       uint       `json:"event_id" gorm:"index"`
+	Payload       string     `json:"-" gorm:"type:jsonb"`
+	Status        string     `json:"status" gorm:"type:varchar(16);index"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at" gorm:"index"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	Test          bool       `json:"test"`
+	TraceParent   string     `json:"-" gorm:"type:varchar(64)"` // W3C trace context of the event that queued it
+
+	AttemptLog []DeliveryAttempt `json:"attempt_log,omitempty" gorm:"foreignKey:DeliveryID"`
+}
+
+// DeliveryAttempt records the outcome of a single HTTP request
+type DeliveryAttempt struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time `json:"created_at"`
+	DeliveryID   uint      `json:"delivery_id" gorm:"index"`
+	Attempt      int       `json:"attempt"`
+	StatusCode   int       `json:"status_code"`
+	Error        string    `json:"error,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
+}
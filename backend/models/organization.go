@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Role is the permission level a user holds within an organization
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+	RoleViewer Role = "viewer"
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// AtLeast reports whether r grants every permission of min
+func (r Role) AtLeast(min Role) bool {
+	return roleRanks[r] >= roleRanks[min]
+}
+
+// Organization groups users that share webhooks, database configuration
+// and indexing preferences
+type Organization struct {
+	gorm.Model
+	Name               string             `json:"name"`
+	Memberships        []Membership       `json:"-"`
+	DBConfig           DatabaseConfig     `json:"-"`
+	IndexingPreference IndexingPreference `json:"-"`
+}
+
+// Membership links a user to an organization with a role
+type Membership struct {
+	gorm.Model
+	OrganizationID uint         `json:"organization_id" gorm:"uniqueIndex:idx_membership_org_user"`
+	UserID         uint         `json:"user_id" gorm:"uniqueIndex:idx_membership_org_user"`
+	Role           Role         `json:"role" gorm:"type:varchar(16)"`
+	Organization   Organization `json:"-"`
+	User           User         `json:"-"`
+}
+
+// Invitation is a pending offer for an email address to join an organization
+type Invitation struct {
+	gorm.Model
+	OrganizationID uint       `json:"organization_id" gorm:"index"`
+	Email          string     `json:"email"`
+	Role           Role       `json:"role" gorm:"type:varchar(16)"`
+	Token          string     `json:"-" gorm:"unique"`
+	InvitedByID    uint       `json:"invited_by_id"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Rebuild job states
+const (
+	RebuildPending    = "pending"
+	RebuildBuilding   = "building"  // Replaying events into the _next table
+	RebuildVerifying  = "verifying" // Catching up, comparing and swapping
+	RebuildSwapped    = "swapped"   // Live; the previous table is kept for rollback
+	RebuildCompleted  = "completed" // The previous table has been dropped
+	RebuildRolledBack = "rolled_back"
+	RebuildFailed     = "failed"
+	RebuildCancelled  = "cancelled"
+)
+
+// RebuildJob rebuilds one of a webhook's category tables from its stored
+// events next to the live table, then swaps the two
+type RebuildJob struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	OrganizationID uint       `json:"organization_id" gorm:"index"`
+	WebhookID      uint       `json:"webhook_id" gorm:"index"`
+	Category       string     `json:"category"`
+	Status         string     `json:"status" gorm:"type:varchar(16);index"`
+	Force          bool       `json:"force"` // Swap even if live rows are missing from the rebuild
+	ReplayJobID    uint       `json:"replay_job_id"`
+	LastEventID    uint       `json:"last_event_id"` // Newest event written to the rebuilt table
+	LiveRows       int64      `json:"live_rows"`
+	NextRows       int64      `json:"next_rows"`
+	LegacyRows     int64      `json:"legacy_rows"` // Live rows written before rows carried an event ID
+	MissingRows    int64      `json:"missing_rows"`
+	AddedRows      int64      `json:"added_rows"`
+	ChangedRows    int64      `json:"changed_rows"`
+	LiveChecksum   string     `json:"live_checksum"`
+	NextChecksum   string     `json:"next_checksum"`
+	LastError      string     `json:"last_error,omitempty"`
+	RetainUntil    *time.Time `json:"retain_until"` // When the previous table is dropped
+	RequestedByID  uint       `json:"requested_by_id"`
+	SwappedAt      *time.Time `json:"swapped_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Replay job states
+const (
+	ReplayPending   = "pending"
+	ReplayRunning   = "running"
+	ReplayCompleted = "completed"
+	ReplayFailed    = "failed"
+	ReplayCancelled = "cancelled"
+)
+
+// ReplayJob reruns an organization's stored events through the current
+// processors. Zero-valued bounds are open; events are replayed in ID order
+// and LastEventID records how far the job got, so it can resume.
+type ReplayJob struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"` // Doubles as the heartbeat of a running job
+	OrganizationID uint       `json:"organization_id" gorm:"index"`
+	WebhookID      uint       `json:"webhook_id"` // Zero replays every webhook of the organization
+	Category       string     `json:"category"`   // Empty replays every category
+	FromEventID    uint       `json:"from_event_id"`
+	ToEventID      uint       `json:"to_event_id"`
+	FromSlot       uint64     `json:"from_slot"`
+	ToSlot         uint64     `json:"to_slot"`
+	FromTime       *time.Time `json:"from_time"`
+	ToTime         *time.Time `json:"to_time"`
+	Target         string     `json:"target" gorm:"type:varchar(16)"` // live or shadow
+	RatePerSecond  float64    `json:"rate_per_second"`
+	Status         string     `json:"status" gorm:"type:varchar(16);index"`
+	Total          int64      `json:"total"`
+	Processed      int64      `json:"processed"`
+	Failed         int64      `json:"failed"`
+	LastEventID    uint       `json:"last_event_id"`
+	LastError      string     `json:"last_error,omitempty"`
+	RequestedByID  uint       `json:"requested_by_id"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
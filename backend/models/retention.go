@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RetentionEvents is the retention target for an organization's raw
+// webhook events; other targets name a data category
+const RetentionEvents = "events"
+
+// RetentionPolicy limits how long an organization keeps raw events or the
+// rows of one data category. Pruned rows are archived first if Archive is
+// set and an archive is configured.
+type RetentionPolicy struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	OrganizationID uint       `json:"organization_id" gorm:"uniqueIndex:idx_retention_org_target"`
+	Target         string     `json:"target" gorm:"uniqueIndex:idx_retention_org_target"`
+	MaxAgeDays     int        `json:"max_age_days"`
+	Archive        bool       `json:"archive"`
+	LastRunAt      *time.Time `json:"last_run_at"`
+	LastPruned     int64      `json:"last_pruned"` // Rows deleted by the last run
+	LastError      string     `json:"last_error,omitempty"`
+}
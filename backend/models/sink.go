@@ -0,0 +1,30 @@
+package models
+
+import "gorm.io/gorm"
+
+// Sink drivers
+const (
+	SinkPostgres = "postgres" // The organization's own database, whatever its driver
+	SinkKafka    = "kafka"
+	SinkNATS     = "nats"
+	SinkRedis    = "redis"
+)
+
+// SinkConfig selects where an organization's processed events are written.
+// Organizations without one write to their configured database.
+type SinkConfig struct {
+	gorm.Model
+	OrganizationID uint   `json:"organization_id" gorm:"uniqueIndex"`
+	Driver         string `json:"driver" gorm:"type:varchar(16)"`
+	Addresses      string `json:"addresses"` // Comma-separated brokers, servers or host:port
+	Prefix         string `json:"prefix"`    // Topic, subject or stream key prefix
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	TLS            bool   `json:"tls"`
+}
+
+// SameServer reports whether c connects to the same servers as the same
+// user as other, so that other's password may be reused for it
+func (c *SinkConfig) SameServer(other *SinkConfig) bool {
+	return c.Driver == other.Driver && c.Addresses == other.Addresses && c.Username == other.Username
+}
@@ -1,42 +1,142 @@
 package models
 
 import (
-	"gorm.io/gorm"
+	"net"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
 )
 
 type User struct {
-    gorm.Model
-    Email        string `json:"email" gorm:"unique"`
-	Password     string `json:"password"`
-	ApiKey       string `json:"api_key" gorm:"unique"`
-    DBConfig DatabaseConfig
+	gorm.Model
+	Email               string       `json:"email" gorm:"unique"`
+	Password            string       `json:"password"`
+	ApiKey              string       `json:"api_key" gorm:"unique"`
+	EmailVerifiedAt     *time.Time   `json:"email_verified_at"`
+	FailedLoginAttempts int          `json:"-" gorm:"default:0"`
+	LockedUntil         *time.Time   `json:"-"`
+	DisabledAt          *time.Time   `json:"disabled_at"`
+	Memberships         []Membership `json:"-"`
+}
+
+// Token purposes for UserToken
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+)
+
+// UserToken is a single-use, expiring token sent to a user by email.
+// Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	gorm.Model
+	UserID    uint       `json:"user_id" gorm:"index"`
+	Purpose   string     `json:"purpose" gorm:"type:varchar(32)"`
+	TokenHash string     `json:"-" gorm:"unique"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
 }
 
+// Database drivers supported for organization databases
+const (
+	DriverPostgres   = "postgres"
+	DriverMySQL      = "mysql"
+	DriverClickHouse = "clickhouse"
+)
+
 type DatabaseConfig struct {
 	gorm.Model
-	UserID      uint   `json:"user_id"`
-	Host        string `json:"host"`
-	Port        string `json:"port"`
-	DbName      string `json:"db_name"`
-	Username    string `json:"username"`
-	Password    string `json:"password"`
+	OrganizationID uint   `json:"organization_id" gorm:"uniqueIndex"`
+	Driver         string `json:"driver" gorm:"type:varchar(16);default:postgres"`
+	Host           string `json:"host"`
+	Port           string `json:"port"`
+	DbName         string `json:"db_name"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+}
+
+// DSN returns the connection string for the configured database in the
+// format its driver expects. Every value is escaped, so none can add
+// connection parameters of its own.
+func (c *DatabaseConfig) DSN() string {
+	switch c.Driver {
+	case DriverMySQL:
+		cfg := mysql.NewConfig()
+		cfg.User = c.Username
+		cfg.Passwd = c.Password
+		cfg.Net = "tcp"
+		cfg.Addr = c.address()
+		cfg.DBName = c.DbName
+		cfg.ParseTime = true
+		cfg.Loc = time.UTC
+		cfg.Params = map[string]string{"charset": "utf8mb4"}
+		return cfg.FormatDSN()
+	case DriverClickHouse:
+		u := url.URL{
+			Scheme: "clickhouse",
+			User:   url.UserPassword(c.Username, c.Password),
+			Host:   c.address(),
+			Path:   "/" + c.DbName,
+		}
+		return u.String()
+	default:
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(c.Username, c.Password),
+			Host:     c.address(),
+			Path:     "/" + c.DbName,
+			RawQuery: "sslmode=disable",
+		}
+		return u.String()
+	}
+}
+
+// address joins the configured host and port, bracketing IPv6 hosts
+func (c *DatabaseConfig) address() string {
+	if c.Port == "" {
+		if strings.Contains(c.Host, ":") {
+			return "[" + c.Host + "]"
+		}
+		return c.Host
+	}
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+// SameServer reports whether c connects to the same server as the same user
+// as other, so that other's password may be reused for it
+func (c *DatabaseConfig) SameServer(other *DatabaseConfig) bool {
+	return c.Driver == other.Driver && c.Host == other.Host && c.Port == other.Port && c.Username == other.Username
 }
 
 type IndexingPreference struct {
-    gorm.Model
-    UserID           uint	 
-    NFTBids         bool
-    NFTPrices       bool
-    BorrowableTokens bool
-    TokenPrices     bool
-    CustomFilters   string `gorm:"type:json" json:"custom_filters"` // Changed to string with json type
+	gorm.Model
+	OrganizationID   uint   `json:"organization_id" gorm:"uniqueIndex"`
+	NFTBids          bool   `json:"nft_bids"`
+	NFTPrices        bool   `json:"nft_prices"`
+	BorrowableTokens bool   `json:"borrowable_tokens"`
+	TokenPrices      bool   `json:"token_prices"`
+	CustomFilters    string `gorm:"type:json" json:"custom_filters"` // Changed to string with json type
+}
+
+// FilterStats counts the events an organization's custom filter kept (hits)
+// and dropped (misses)
+type FilterStats struct {
+	OrganizationID uint      `json:"organization_id" gorm:"primaryKey;autoIncrement:false"`
+	Hits           int64     `json:"hits"`
+	Misses         int64     `json:"misses"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (FilterStats) TableName() string {
+	return "filter_stats"
 }
 
 type DataSyncStatus struct {
-    gorm.Model
-    UserID         uint
-    LastSynced     time.Time `gorm:"type:timestamp"`
-    SyncedBlocks   int
-    ErrorLog       string
+	gorm.Model
+	UserID       uint
+	LastSynced   time.Time `gorm:"type:timestamp"`
+	SyncedBlocks int
+	ErrorLog     string
 }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Values that would add or change parameters if not escaped
+var awkwardConfig = DatabaseConfig{
+	Host:     "db.example.com",
+	Port:     "5433",
+	DbName:   "events db",
+	Username: "app@acme",
+	Password: `p@ss:w/o?rd sslmode=require ' "x"`,
+}
+
+func TestPostgresDSNEscapesValues(t *testing.T) {
+	cfg := awkwardConfig
+	cfg.Driver = DriverPostgres
+	parsed, err := pgconn.ParseConfig(cfg.DSN())
+	if err != nil {
+		t.Fatalf("ParseConfig(%s): %v", cfg.DSN(), err)
+	}
+	if parsed.Host != cfg.Host || parsed.Port != 5433 || parsed.Database != cfg.DbName ||
+		parsed.User != cfg.Username || parsed.Password != cfg.Password || parsed.TLSConfig != nil {
+		t.Errorf("DSN parsed as host %s port %d db %q user %q password %q, TLS %v",
+			parsed.Host, parsed.Port, parsed.Database, parsed.User, parsed.Password, parsed.TLSConfig != nil)
+	}
+}
+
+func TestMySQLDSNEscapesValues(t *testing.T) {
+	cfg := awkwardConfig
+	cfg.Driver = DriverMySQL
+	parsed, err := mysql.ParseDSN(cfg.DSN())
+	if err != nil {
+		t.Fatalf("ParseDSN(%s): %v", cfg.DSN(), err)
+	}
+	if parsed.Addr != "db.example.com:5433" || parsed.DBName != cfg.DbName ||
+		parsed.User != cfg.Username || parsed.Passwd != cfg.Password || !parsed.ParseTime {
+		t.Errorf("DSN parsed as %s db %q user %q password %q parseTime %v",
+			parsed.Addr, parsed.DBName, parsed.User, parsed.Passwd, parsed.ParseTime)
+	}
+}
+
+func TestDSNBracketsIPv6Hosts(t *testing.T) {
+	cfg := DatabaseConfig{Driver: DriverPostgres, Host: "::1", Port: "5432", DbName: "db", Username: "u"}
+	parsed, err := pgconn.ParseConfig(cfg.DSN())
+	if err != nil || parsed.Host != "::1" {
+		t.Errorf("ParseConfig(%s) = %v, %v, want host ::1", cfg.DSN(), parsed, err)
+	}
+}
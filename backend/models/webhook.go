@@ -6,15 +6,15 @@ import (
 	"gorm.io/gorm"
 )
 
-// HeliusWebhook represents the webhook configuration for a user
+// HeliusWebhook represents the webhook configuration for an organization
 type HeliusWebhook struct {
 	gorm.Model
-	UserID      uint   `json:"user_id"`
-	WebhookURL  string `json:"webhook_url" gorm:"unique"`
-	WebhookID   string `json:"webhook_id" gorm:"unique"`
-	AccountKeys string `json:"account_keys" gorm:"type:text[]"` // Array of account addresses to monitor
-	EventTypes  string `json:"event_types" gorm:"type:text[]"`  // Array of event types to monitor
-	IsActive    bool   `json:"is_active" gorm:"default:true"`
+	OrganizationID uint   `json:"organization_id" gorm:"index"`
+	WebhookURL     string `json:"webhook_url" gorm:"index"` // Shared by every webhook registered from one environment
+	WebhookID      string `json:"webhook_id" gorm:"unique"`
+	AccountKeys    string `json:"account_keys"` // Comma-separated account addresses to monitor
+	EventTypes     string `json:"event_types"`  // Comma-separated event types to monitor
+	IsActive       bool   `json:"is_active" gorm:"default:true"`
 }
 
 // WebhookEvent represents an event received from Helius
@@ -28,5 +28,6 @@ type WebhookEvent struct {
 	Payload      string    `json:"payload" gorm:"type:jsonb"`
 	Processed    bool      `json:"processed" gorm:"default:false"`
 	ProcessedAt  time.Time `json:"processed_at"`
+	Filtered     bool      `json:"filtered" gorm:"default:false"` // Dropped by the organization's custom filter
 	ErrorMessage string    `json:"error_message"`
 }
\ No newline at end of file
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"backend/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	verificationTokenTTL = 48 * time.Hour
+	resetTokenTTL        = time.Hour
+
+	minPasswordLength = 10 // Characters
+	// bcrypt ignores everything past its first 72 bytes
+	maxPasswordBytes = 72
+
+	// Failed logins beyond this threshold lock the account for lockoutBase,
+	// doubling with each further failure up to lockoutMax
+	lockoutThreshold = 5
+	lockoutBase      = time.Minute
+	lockoutMax       = 24 * time.Hour
+)
+
+var (
+	ErrInvalidEmail     = errors.New("invalid email address")
+	ErrWeakPassword     = errors.New("password must be at least 10 characters and contain upper-case, lower-case and numeric characters")
+	ErrPasswordTooLong  = errors.New("password must not be longer than 72 bytes")
+	ErrInvalidToken     = errors.New("invalid or expired token")
+	ErrAccountLocked    = errors.New("account temporarily locked due to failed login attempts")
+	ErrInvalidLogin     = errors.New("invalid credentials")
+	ErrAlreadyVerified  = errors.New("email already verified")
+	ErrEmailNotVerified = errors.New("email address has not been verified")
+	ErrUserExists       = errors.New("user already exists")
+	ErrAccountDisabled  = errors.New("account has been disabled")
+)
+
+// AccountService implements credential checks, email verification and
+// password resets
+type AccountService struct {
+	db     *gorm.DB
+	mailer Mailer
+	appURL string
+}
+
+func NewAccountService(db *gorm.DB, mailer Mailer, appURL string) *AccountService {
+	return &AccountService{
+		db:     db,
+		mailer: mailer,
+		appURL: strings.TrimSuffix(appURL, "/"),
+	}
+}
+
+// NormalizeEmail validates an email address and returns it lower-cased
+func NormalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// ValidatePassword enforces the password strength rules
+func ValidatePassword(password, email string) error {
+	if len(password) > maxPasswordBytes {
+		return ErrPasswordTooLong
+	}
+	if utf8.RuneCountInString(password) < minPasswordLength || strings.EqualFold(password, email) {
+		return ErrWeakPassword
+	}
+
+	var upper, lower, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// CreateUser creates a user with a personal organization. Users created
+// with verified set skip email verification.
+func (s *AccountService) CreateUser(email, password string, verified bool) (*models.User, *models.Organization, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ValidatePassword(password, email); err != nil {
+		return nil, nil, err
+	}
+
+	var existing models.User
+	if s.db.Where("LOWER(email) = ?", email).First(&existing).Error == nil {
+		return nil, nil, ErrUserExists
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &models.User{
+		Email:    email,
+		Password: string(hashedPassword),
+	}
+	if verified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	var org *models.Organization
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		org, err = CreatePersonalOrganization(tx, user)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, org, nil
+}
+
+// ListUsers returns every user, oldest first
+func (s *AccountService) ListUsers() ([]models.User, error) {
+	var users []models.User
+	if err := s.db.Order("id").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+	return users, nil
+}
+
+// FindUser looks a user up by ID or email address
+func (s *AccountService) FindUser(ref string) (*models.User, error) {
+	var user models.User
+	query := s.db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(ref)))
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		query = s.db.Where("id = ?", id)
+	}
+	if err := query.First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ActiveUser loads a user who may still act on their account, returning
+// ErrAccountDisabled for disabled ones
+func (s *AccountService) ActiveUser(id uint) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	return &user, nil
+}
+
+// SetDisabled disables or re-enables a user. Disabled users can't log in
+// or act within their organizations.
+func (s *AccountService) SetDisabled(user *models.User, disabled bool) error {
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now()
+		disabledAt = &now
+	}
+	if err := s.db.Model(user).Update("disabled_at", disabledAt).Error; err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	return nil
+}
+
+// Authenticate checks a user's credentials, applying progressive lockout
+// after repeated failures. The returned time is when a locked account
+// becomes available again. Failures for an existing account return it
+// along with the error, so they can be attributed to it.
+func (s *AccountService) Authenticate(email, password string) (*models.User, *time.Time, error) {
+	var user models.User
+	if err := s.db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error; err != nil {
+		// Spend as long as a wrong password would, so the response time
+		// doesn't tell which addresses have accounts
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, nil, ErrInvalidLogin
+	}
+
+	if user.DisabledAt != nil {
+		return &user, nil, ErrAccountDisabled
+	}
+
+	now := time.Now()
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return &user, user.LockedUntil, ErrAccountLocked
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		// Incremented in the database, so concurrent failures each count
+		err := s.db.Model(&user).Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_login_attempts"}}}).
+			Update("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error
+		if err != nil {
+			return &user, nil, fmt.Errorf("failed to record failed login: %w", err)
+		}
+		if user.FailedLoginAttempts >= lockoutThreshold {
+			until := now.Add(lockoutDuration(user.FailedLoginAttempts))
+			// A concurrent failure may already have set a later lock
+			s.db.Model(&models.User{}).Where("id = ? AND (locked_until IS NULL OR locked_until < ?)", user.ID, until).
+				Update("locked_until", until)
+			return &user, &until, ErrAccountLocked
+		}
+		return &user, nil, ErrInvalidLogin
+	}
+
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		s.db.Model(&user).Updates(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		})
+	}
+	return &user, nil, nil
+}
+
+// dummyPasswordHash is compared against for unknown email addresses
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("helixscan-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func lockoutDuration(failures int) time.Duration {
+	d := lockoutBase
+	for i := lockoutThreshold; i < failures && d < lockoutMax; i++ {
+		d *= 2
+	}
+	if d > lockoutMax {
+		d = lockoutMax
+	}
+	return d
+}
+
+// SendVerificationEmail issues a new email verification token for the user
+func (s *AccountService) SendVerificationEmail(user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+
+	token, err := s.issueToken(user.ID, models.TokenPurposeEmailVerification, verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address by opening the link below:\n\n%s/verify-email?token=%s\n\nThe link expires in %s.",
+			s.appURL, token, verificationTokenTTL),
+	})
+}
+
+// VerifyEmail consumes a verification token and marks the user's email
+// verified, returning the user's ID
+func (s *AccountService) VerifyEmail(token string) (uint, error) {
+	var userID uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeToken(tx, token, models.TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+		userID = userToken.UserID
+		return tx.Model(&models.User{}).Where("id = ?", userID).
+			Update("email_verified_at", time.Now()).Error
+	})
+	return userID, err
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to a user.
+// Unknown addresses are ignored so callers cannot probe for accounts.
+func (s *AccountService) RequestPasswordReset(email string) error {
+	var user models.User
+	if err := s.db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error; err != nil {
+		return nil
+	}
+
+	token, err := s.issueToken(user.ID, models.TokenPurposePasswordReset, resetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("A password reset was requested for your account. Open the link below to choose a new password:\n\n%s/reset-password?token=%s\n\nThe link expires in %s. If you did not request this, you can ignore this email.",
+			s.appURL, token, resetTokenTTL),
+	})
+}
+
+// ResetPassword consumes a reset token, sets a new password and clears any
+// lockout, returning the user's ID
+func (s *AccountService) ResetPassword(token, password string) (uint, error) {
+	var userID uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeToken(tx, token, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = userToken.UserID
+
+		var user models.User
+		if err := tx.First(&user, userToken.UserID).Error; err != nil {
+			return err
+		}
+		if err := ValidatePassword(password, user.Email); err != nil {
+			return err
+		}
+
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+
+		// Any other outstanding reset links are void once the password changes
+		err = tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, models.TokenPurposePasswordReset).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"password":              string(hashed),
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error
+	})
+	return userID, err
+}
+
+func (s *AccountService) issueToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	userToken := &models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.db.Create(userToken).Error; err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+	return token, nil
+}
+
+func consumeToken(tx *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	var userToken models.UserToken
+	err := tx.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?",
+		hashToken(token), purpose, time.Now()).First(&userToken).Error
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Conditional update so concurrent requests cannot both consume the token
+	result := tx.Model(&userToken).Where("used_at IS NULL").Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidToken
+	}
+	return &userToken, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{"Correct1Horse", nil},
+		{"Short1Pw", ErrWeakPassword},
+		{"nouppercase1", ErrWeakPassword},
+		{"NoDigitsHere", ErrWeakPassword},
+		{"User@Example.com1", nil},
+		{"user@example.com", ErrWeakPassword},
+		// Characters are counted, not bytes
+		{"Äöü1Äöü1Ä", ErrWeakPassword},
+		{"Äöü1Äöü1Äö", nil},
+		{strings.Repeat("Aa1", 24), nil},
+		{strings.Repeat("Aa1", 24) + "b", ErrPasswordTooLong},
+		{strings.Repeat("Ä", 36) + "a1", ErrPasswordTooLong},
+	}
+	for _, tt := range tests {
+		if err := ValidatePassword(tt.password, "user@example.com"); !errors.Is(err, tt.want) {
+			t.Errorf("ValidatePassword(%q) = %v, want %v", tt.password, err, tt.want)
+		}
+	}
+}
+
+const testPassword = "Correct1Horse"
+
+func newTestAccounts(t *testing.T, db *gorm.DB) (*AccountService, *testMailer) {
+	t.Helper()
+	mailer := &testMailer{}
+	return NewAccountService(db, mailer, "https://helixscan.test/"), mailer
+}
+
+func TestCreateUser(t *testing.T) {
+	db := testDB(t)
+	accounts, _ := newTestAccounts(t, db)
+
+	user, org, err := accounts.CreateUser(" New.User@Example.com ", testPassword, false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if user.Email != "new.user@example.com" || user.EmailVerifiedAt != nil {
+		t.Errorf("created %s, verified at %v; want new.user@example.com unverified", user.Email, user.EmailVerifiedAt)
+	}
+	var membership models.Membership
+	if err := db.Where("user_id = ? AND organization_id = ?", user.ID, org.ID).First(&membership).Error; err != nil {
+		t.Fatalf("failed to load membership: %v", err)
+	}
+	if membership.Role != models.RoleOwner {
+		t.Errorf("user is %s of their organization, want owner", membership.Role)
+	}
+
+	if _, _, err := accounts.CreateUser("NEW.USER@example.com", testPassword, false); !errors.Is(err, ErrUserExists) {
+		t.Errorf("CreateUser with a taken address = %v, want ErrUserExists", err)
+	}
+	if _, _, err := accounts.CreateUser("other@example.com", "weak", false); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("CreateUser with a weak password = %v, want ErrWeakPassword", err)
+	}
+	if _, _, err := accounts.CreateUser("not an address", testPassword, false); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("CreateUser with an invalid address = %v, want ErrInvalidEmail", err)
+	}
+}
+
+func TestAuthenticateLocksOutRepeatedFailures(t *testing.T) {
+	db := testDB(t)
+	accounts, _ := newTestAccounts(t, db)
+	if _, _, err := accounts.CreateUser("user@example.com", testPassword, true); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	for i := 1; i < lockoutThreshold; i++ {
+		if _, _, err := accounts.Authenticate("user@example.com", "Wrong1Password"); !errors.Is(err, ErrInvalidLogin) {
+			t.Fatalf("failure %d = %v, want ErrInvalidLogin", i, err)
+		}
+	}
+	user, until, err := accounts.Authenticate("user@example.com", "Wrong1Password")
+	if !errors.Is(err, ErrAccountLocked) || until == nil {
+		t.Fatalf("failure %d = %v until %v, want ErrAccountLocked", lockoutThreshold, err, until)
+	}
+	if user == nil || user.Email != "user@example.com" {
+		t.Errorf("lockout returned user %v, want the locked account", user)
+	}
+	if d := time.Until(*until); d <= 0 || d > lockoutBase {
+		t.Errorf("locked for %s, want up to %s", d, lockoutBase)
+	}
+	// The right password doesn't help while locked
+	if _, _, err := accounts.Authenticate("user@example.com", testPassword); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("correct password while locked = %v, want ErrAccountLocked", err)
+	}
+
+	if err := db.Model(&models.User{}).Where("id = ?", user.ID).Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("failed to expire lock: %v", err)
+	}
+	if _, _, err := accounts.Authenticate("USER@example.com", testPassword); err != nil {
+		t.Fatalf("correct password after the lock expired = %v", err)
+	}
+	var reloaded models.User
+	if err := db.First(&reloaded, user.ID).Error; err != nil {
+		t.Fatalf("failed to reload user: %v", err)
+	}
+	if reloaded.FailedLoginAttempts != 0 || reloaded.LockedUntil != nil {
+		t.Errorf("user has %d failed attempts, locked until %v after logging in; want both cleared",
+			reloaded.FailedLoginAttempts, reloaded.LockedUntil)
+	}
+
+	if _, _, err := accounts.Authenticate("nobody@example.com", testPassword); !errors.Is(err, ErrInvalidLogin) {
+		t.Errorf("unknown address = %v, want ErrInvalidLogin", err)
+	}
+}
+
+var resetLink = regexp.MustCompile(`/reset-password\?token=(\S+)`)
+
+func TestPasswordResetFlow(t *testing.T) {
+	db := testDB(t)
+	accounts, mailer := newTestAccounts(t, db)
+	user, _, err := accounts.CreateUser("user@example.com", testPassword, true)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if err := accounts.RequestPasswordReset("nobody@example.com"); err != nil || len(mailer.Sent()) != 0 {
+		t.Fatalf("reset for an unknown address = %v with %d emails, want nil and none", err, len(mailer.Sent()))
+	}
+	if err := accounts.RequestPasswordReset("User@Example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	sent := mailer.Sent()
+	if len(sent) != 1 || sent[0].To != "user@example.com" {
+		t.Fatalf("sent %+v, want one email to user@example.com", sent)
+	}
+	match := resetLink.FindStringSubmatch(sent[0].Body)
+	if match == nil {
+		t.Fatalf("reset email has no link: %s", sent[0].Body)
+	}
+	token := match[1]
+
+	// A rejected password leaves the token usable
+	if _, err := accounts.ResetPassword(token, "weak"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("ResetPassword with a weak password = %v, want ErrWeakPassword", err)
+	}
+	const newPassword = "Battery2Staple"
+	userID, err := accounts.ResetPassword(token, newPassword)
+	if err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if userID != user.ID {
+		t.Errorf("ResetPassword returned user %d, want %d", userID, user.ID)
+	}
+	if _, err := accounts.ResetPassword(token, "Another3Password"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("reusing the token = %v, want ErrInvalidToken", err)
+	}
+	if _, err := accounts.ResetPassword("not-a-token", "Another3Password"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unknown token = %v, want ErrInvalidToken", err)
+	}
+
+	if _, _, err := accounts.Authenticate("user@example.com", testPassword); !errors.Is(err, ErrInvalidLogin) {
+		t.Errorf("old password = %v, want ErrInvalidLogin", err)
+	}
+	if _, _, err := accounts.Authenticate("user@example.com", newPassword); err != nil {
+		t.Errorf("new password = %v", err)
+	}
+}
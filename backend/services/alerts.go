@@ -0,0 +1,583 @@
+package services
+
+import (
+	"backend/models"
+	"backend/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	alertNotifyTimeout     = 10 * time.Second
+	defaultAlertPageSize   = 50
+	maxAlertPageSize       = 200
+	alertEvaluateQueueSize = 1024
+)
+
+var (
+	ErrAlertRuleNotFound = errors.New("alert rule not found")
+	ErrInvalidAlertRule  = errors.New("invalid alert rule")
+)
+
+// AlertRuleInput holds the editable fields of an alert rule
+type AlertRuleInput struct {
+	Name            string   `json:"name"`
+	Category        string   `json:"category"`
+	Condition       string   `json:"condition"`
+	Field           string   `json:"field"`
+	Threshold       float64  `json:"threshold"`
+	Address         string   `json:"address"`
+	Collection      string   `json:"collection"`
+	WindowSeconds   int      `json:"window_seconds"`
+	CooldownSeconds int      `json:"cooldown_seconds"`
+	Channels        []string `json:"channels"`
+	Email           string   `json:"email"`
+	WebhookURL      string   `json:"webhook_url"`
+	IsActive        *bool    `json:"is_active"`
+}
+
+// AlertEventPage is one page of alert history
+type AlertEventPage struct {
+	Events   []models.AlertEvent `json:"events"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"page_size"`
+	Total    int64               `json:"total"`
+}
+
+// AlertNotification is the body posted to generic webhook channels
+type AlertNotification struct {
+	RuleID      uint        `json:"rule_id"`
+	RuleName    string      `json:"rule_name"`
+	Category    string      `json:"category"`
+	Condition   string      `json:"condition"`
+	Threshold   float64     `json:"threshold"`
+	Value       float64     `json:"value"`
+	Message     string      `json:"message"`
+	Event       StreamEvent `json:"event"`
+	TriggeredAt time.Time   `json:"triggered_at"`
+}
+
+// AlertService evaluates alert rules against processed events and sends
+// notifications when they fire
+type AlertService struct {
+	db     *gorm.DB
+	mailer Mailer
+	client *http.Client
+	logger *slog.Logger
+
+	// Rules are evaluated on a single worker so crossing conditions see
+	// events in order; notifications go out on their own pool
+	evaluator *WorkerPool
+	notifier  *WorkerPool
+}
+
+func NewAlertService(db *gorm.DB, mailer Mailer, notifyWorkers int, logger *slog.Logger) *AlertService {
+	return &AlertService{
+		db:        db,
+		mailer:    mailer,
+		client:    newPublicClient(alertNotifyTimeout),
+		logger:    logger,
+		evaluator: NewWorkerPool("alerts", 1, alertEvaluateQueueSize),
+		notifier:  NewWorkerPool("alert-notifications", notifyWorkers, notifyWorkers*64),
+	}
+}
+
+// Pools returns the worker pools alerts run on
+func (s *AlertService) Pools() []*WorkerPool {
+	return []*WorkerPool{s.evaluator, s.notifier}
+}
+
+// Evaluate queues e, decoded to record, for evaluation against its
+// organization's alert rules. Evaluation joins the trace in ctx but isn't
+// cancelled with it.
+func (s *AlertService) Evaluate(ctx context.Context, e StreamEvent, record *SinkRecord) {
+	parent := ctx
+	if !s.evaluator.Submit(func(ctx context.Context) { s.evaluate(tracing.Detach(ctx, parent), e, record) }) {
+		s.logger.Warn("alert queue full, skipped event", "event_id", e.ID, "webhook_id", e.WebhookID)
+	}
+}
+
+func (s *AlertService) evaluate(ctx context.Context, e StreamEvent, record *SinkRecord) {
+	ctx, span := tracing.Start(ctx, "alerts.evaluate", trace.WithAttributes(
+		attribute.Int64("helixscan.event_id", int64(e.ID)),
+	))
+	defer span.End()
+
+	var rules []models.AlertRule
+	err := s.db.WithContext(ctx).
+		Where("organization_id = ? AND category = ? AND is_active = ?", e.OrganizationID, e.Category, true).
+		Find(&rules).Error
+	if err != nil {
+		s.logger.Error("failed to load alert rules", "organization_id", e.OrganizationID, "error", err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	category := record.Category
+	fields := record.Fields()
+	for i := range rules {
+		rule := &rules[i]
+		if !ruleMatches(rule, category, e, fields) {
+			continue
+		}
+		value, fired, err := s.check(ctx, rule, category, e, fields)
+		if err != nil {
+			s.logger.Error("failed to evaluate alert rule", "rule_id", rule.ID, "event_id", e.ID, "error", err)
+			continue
+		}
+		if fired && s.claim(rule) {
+			s.fire(ctx, rule, e, value)
+		}
+	}
+}
+
+// ruleMatches applies a rule's address and collection filters
+func ruleMatches(rule *models.AlertRule, category *Category, e StreamEvent, fields map[string]interface{}) bool {
+	if rule.Collection != "" && rule.Collection != e.Collection {
+		return false
+	}
+	if rule.Address == "" {
+		return true
+	}
+	for _, column := range category.AddressColumns {
+		if fmt.Sprint(fields[column]) == rule.Address {
+			return true
+		}
+	}
+	return false
+}
+
+// check reports whether the rule's condition holds for e, updating the
+// state that crossing and volume conditions depend on
+func (s *AlertService) check(ctx context.Context, rule *models.AlertRule, category *Category, e StreamEvent, fields map[string]interface{}) (float64, bool, error) {
+	if rule.Condition == models.ConditionVolumeAbove {
+		count, err := s.recordVolume(ctx, rule, e.Timestamp)
+		if err != nil {
+			return 0, false, err
+		}
+		return float64(count), float64(count) > rule.Threshold, nil
+	}
+
+	value, ok := numericField(fields, rule.Field)
+	if !ok {
+		return 0, false, nil
+	}
+
+	switch rule.Condition {
+	case models.ConditionAbove:
+		return value, value > rule.Threshold, nil
+	case models.ConditionBelow:
+		return value, value < rule.Threshold, nil
+	}
+
+	// Values of different tokens or NFTs can't cross each other
+	previous, err := s.swapLastValue(ctx, rule.ID, subjectAddress(category, fields), value)
+	if err != nil {
+		return 0, false, err
+	}
+	switch rule.Condition {
+	case models.ConditionCrossesAbove:
+		return value, previous != nil && *previous <= rule.Threshold && value > rule.Threshold, nil
+	case models.ConditionCrossesBelow:
+		return value, previous != nil && *previous >= rule.Threshold && value < rule.Threshold, nil
+	default:
+		return value, false, nil
+	}
+}
+
+// subjectAddress returns the address of the token or NFT a record is about
+func subjectAddress(category *Category, fields map[string]interface{}) string {
+	if len(category.AddressColumns) == 0 {
+		return ""
+	}
+	return fmt.Sprint(fields[category.AddressColumns[0]])
+}
+
+// swapLastValue stores value as the last one the rule saw for address,
+// returning the value it replaces, if any
+func (s *AlertService) swapLastValue(ctx context.Context, ruleID uint, address string, value float64) (*float64, error) {
+	var previous *float64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var state models.AlertRuleState
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("rule_id = ? AND address = ?", ruleID, address).
+			Take(&state).Error
+		if err == nil {
+			previous = &state.LastValue
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "rule_id"}, {Name: "address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"last_value", "updated_at"}),
+		}).Create(&models.AlertRuleState{RuleID: ruleID, Address: address, LastValue: value}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert rule state: %w", err)
+	}
+	return previous, nil
+}
+
+// recordVolume counts the rule's matching events inside its window,
+// including the one at t. Hits are stored so every replica's events count.
+func (s *AlertService) recordVolume(ctx context.Context, rule *models.AlertRule, t time.Time) (int64, error) {
+	now := time.Now()
+	cutoff := now.Add(-time.Duration(rule.WindowSeconds) * time.Second)
+	if t.IsZero() || t.Before(cutoff) {
+		t = now
+	}
+
+	db := s.db.WithContext(ctx)
+	if err := db.Create(&models.AlertVolumeHit{RuleID: rule.ID, SeenAt: t}).Error; err != nil {
+		return 0, fmt.Errorf("failed to record alert volume: %w", err)
+	}
+	// Hits that have left the window no longer count
+	if err := db.Where("rule_id = ? AND seen_at <= ?", rule.ID, cutoff).Delete(&models.AlertVolumeHit{}).Error; err != nil {
+		return 0, fmt.Errorf("failed to prune alert volume: %w", err)
+	}
+	var count int64
+	err := db.Model(&models.AlertVolumeHit{}).
+		Where("rule_id = ? AND seen_at > ?", rule.ID, cutoff).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count alert volume: %w", err)
+	}
+	return count, nil
+}
+
+// resetState forgets the values and hits crossing and volume conditions
+// have seen for a rule
+func resetState(db *gorm.DB, ruleID uint) error {
+	if err := db.Where("rule_id = ?", ruleID).Delete(&models.AlertRuleState{}).Error; err != nil {
+		return fmt.Errorf("failed to reset alert rule state: %w", err)
+	}
+	if err := db.Where("rule_id = ?", ruleID).Delete(&models.AlertVolumeHit{}).Error; err != nil {
+		return fmt.Errorf("failed to reset alert volume: %w", err)
+	}
+	return nil
+}
+
+// claim marks the rule triggered unless it is still cooling down
+func (s *AlertService) claim(rule *models.AlertRule) bool {
+	now := time.Now()
+	cutoff := now.Add(-time.Duration(rule.CooldownSeconds) * time.Second)
+	result := s.db.Model(&models.AlertRule{}).
+		Where("id = ? AND (last_triggered_at IS NULL OR last_triggered_at <= ?)", rule.ID, cutoff).
+		UpdateColumn("last_triggered_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	rule.LastTriggeredAt = &now
+
+	if rule.Condition == models.ConditionVolumeAbove {
+		// Start counting afresh so the next alert reflects new activity
+		err := s.db.Where("rule_id = ? AND seen_at <= ?", rule.ID, now).Delete(&models.AlertVolumeHit{}).Error
+		if err != nil {
+			s.logger.Error("failed to reset alert volume", "rule_id", rule.ID, "error", err)
+		}
+	}
+	return true
+}
+
+// fire records an alert event and sends its notifications
+func (s *AlertService) fire(ctx context.Context, rule *models.AlertRule, e StreamEvent, value float64) {
+	alert := &models.AlertEvent{
+		RuleID:         rule.ID,
+		OrganizationID: rule.OrganizationID,
+		EventID:        e.ID,
+		Value:          value,
+		Message:        alertMessage(rule, value),
+		Notifications:  "{}",
+	}
+	if err := s.db.WithContext(ctx).Create(alert).Error; err != nil {
+		s.logger.Error("failed to record alert", "rule_id", rule.ID, "event_id", e.ID, "error", err)
+		return
+	}
+
+	notification := AlertNotification{
+		RuleID:      rule.ID,
+		RuleName:    rule.Name,
+		Category:    rule.Category,
+		Condition:   rule.Condition,
+		Threshold:   rule.Threshold,
+		Value:       value,
+		Message:     alert.Message,
+		Event:       e,
+		TriggeredAt: alert.CreatedAt,
+	}
+	ruleCopy := *rule
+	parent := ctx
+	if !s.notifier.Submit(func(ctx context.Context) { s.notify(tracing.Detach(ctx, parent), &ruleCopy, alert, notification) }) {
+		s.logger.Warn("alert notification queue full, alert not sent", "alert_id", alert.ID, "rule_id", rule.ID)
+	}
+}
+
+// notify sends an alert on each of the rule's channels and records the results
+func (s *AlertService) notify(ctx context.Context, rule *models.AlertRule, alert *models.AlertEvent, n AlertNotification) {
+	ctx, span := tracing.Start(ctx, "alerts.notify", trace.WithAttributes(
+		attribute.Int64("helixscan.alert_id", int64(alert.ID)),
+	))
+	defer span.End()
+
+	results := make(map[string]string)
+	for _, channel := range splitCommaList(rule.Channels) {
+		var err error
+		switch channel {
+		case models.ChannelEmail:
+			err = s.mailer.Send(Message{
+				To:      rule.Email,
+				Subject: "HelixScan alert: " + rule.Name,
+				Body:    n.Message + "\n\nEvent " + fmt.Sprint(n.Event.ID) + " at " + n.Event.Timestamp.UTC().Format(time.RFC3339),
+			})
+		case models.ChannelWebhook:
+			err = s.postJSON(ctx, rule.WebhookURL, n)
+		case models.ChannelSlack:
+			err = s.postJSON(ctx, rule.WebhookURL, map[string]string{"text": n.Message})
+		case models.ChannelDiscord:
+			err = s.postJSON(ctx, rule.WebhookURL, map[string]string{"content": n.Message})
+		}
+
+		results[channel] = "sent"
+		if err != nil {
+			results[channel] = err.Error()
+			s.logger.Error("failed to send alert", "alert_id", alert.ID, "channel", channel, "error", err)
+		}
+	}
+
+	encoded, _ := json.Marshal(results)
+	s.db.Model(alert).Update("notifications", string(encoded))
+}
+
+func (s *AlertService) postJSON(ctx context.Context, target string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// List returns the organization's alert rules
+func (s *AlertService) List(orgID uint) ([]models.AlertRule, error) {
+	var rules []models.AlertRule
+	if err := s.db.Where("organization_id = ?", orgID).Order("id").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to list alert rules: %w", err)
+	}
+	return rules, nil
+}
+
+// Get returns one of the organization's alert rules
+func (s *AlertService) Get(orgID, id uint) (*models.AlertRule, error) {
+	var rule models.AlertRule
+	err := s.db.Where("id = ? AND organization_id = ?", id, orgID).First(&rule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAlertRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load alert rule: %w", err)
+	}
+	return &rule, nil
+}
+
+// Create adds an alert rule
+func (s *AlertService) Create(orgID uint, input AlertRuleInput) (*models.AlertRule, error) {
+	rule := &models.AlertRule{OrganizationID: orgID, IsActive: true}
+	if err := applyAlertRuleInput(rule, input); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(rule).Error; err != nil {
+		return nil, fmt.Errorf("failed to create alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+// Update replaces an alert rule's settings. Changing the condition resets
+// the state used by crossing and volume conditions.
+func (s *AlertService) Update(orgID, id uint, input AlertRuleInput) (before, after *models.AlertRule, err error) {
+	rule, err := s.Get(orgID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	previous := *rule
+
+	if err := applyAlertRuleInput(rule, input); err != nil {
+		return nil, nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if rule.Condition != previous.Condition || rule.Field != previous.Field {
+			if err := resetState(tx, rule.ID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(rule).Error; err != nil {
+			return fmt.Errorf("failed to update alert rule: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &previous, rule, nil
+}
+
+// Delete removes an alert rule. Its history is kept.
+func (s *AlertService) Delete(orgID, id uint) (*models.AlertRule, error) {
+	rule, err := s.Get(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := resetState(tx, rule.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(rule).Error; err != nil {
+			return fmt.Errorf("failed to delete alert rule: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// History returns the organization's alert events, newest first, optionally
+// limited to one rule
+func (s *AlertService) History(orgID, ruleID uint, page, pageSize int) (*AlertEventPage, error) {
+	if pageSize <= 0 {
+		pageSize = defaultAlertPageSize
+	}
+	if pageSize > maxAlertPageSize {
+		pageSize = maxAlertPageSize
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	query := s.db.Model(&models.AlertEvent{}).Where("organization_id = ?", orgID)
+	if ruleID != 0 {
+		query = query.Where("rule_id = ?", ruleID)
+	}
+
+	result := &AlertEventPage{Page: page, PageSize: pageSize}
+	if err := query.Count(&result.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count alert events: %w", err)
+	}
+	err := query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&result.Events).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert events: %w", err)
+	}
+	return result, nil
+}
+
+func applyAlertRuleInput(rule *models.AlertRule, input AlertRuleInput) error {
+	category, ok := CategoryByName(input.Category)
+	if !ok {
+		return fmt.Errorf("%w: unknown category %q", ErrInvalidAlertRule, input.Category)
+	}
+	if strings.TrimSpace(input.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAlertRule)
+	}
+
+	switch input.Condition {
+	case models.ConditionAbove, models.ConditionBelow, models.ConditionCrossesAbove, models.ConditionCrossesBelow:
+		if column, ok := category.Column(input.Field); !ok || column.Type != ColumnDecimal {
+			return fmt.Errorf("%w: field must be a numeric column of %s", ErrInvalidAlertRule, category.Name)
+		}
+	case models.ConditionVolumeAbove:
+		if input.WindowSeconds <= 0 {
+			return fmt.Errorf("%w: window_seconds is required for volume rules", ErrInvalidAlertRule)
+		}
+		input.Field = ""
+	default:
+		return fmt.Errorf("%w: unknown condition %q", ErrInvalidAlertRule, input.Condition)
+	}
+	if input.CooldownSeconds < 0 {
+		return fmt.Errorf("%w: cooldown_seconds must not be negative", ErrInvalidAlertRule)
+	}
+
+	if len(input.Channels) == 0 {
+		return fmt.Errorf("%w: at least one channel is required", ErrInvalidAlertRule)
+	}
+	for _, channel := range input.Channels {
+		switch channel {
+		case models.ChannelEmail:
+			if _, err := NormalizeEmail(input.Email); err != nil {
+				return fmt.Errorf("%w: email channel needs a valid email", ErrInvalidAlertRule)
+			}
+		case models.ChannelWebhook, models.ChannelSlack, models.ChannelDiscord:
+			parsed, err := url.Parse(input.WebhookURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("%w: %s channel needs an http or https webhook_url", ErrInvalidAlertRule, channel)
+			}
+			if err := CheckPublicURL(parsed.String()); err != nil {
+				return fmt.Errorf("%w: webhook_url: %v", ErrInvalidAlertRule, err)
+			}
+		default:
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalidAlertRule, channel)
+		}
+	}
+
+	rule.Name = strings.TrimSpace(input.Name)
+	rule.Category = category.Name
+	rule.Condition = input.Condition
+	rule.Field = input.Field
+	rule.Threshold = input.Threshold
+	rule.Address = input.Address
+	rule.Collection = input.Collection
+	rule.WindowSeconds = input.WindowSeconds
+	rule.CooldownSeconds = input.CooldownSeconds
+	rule.Channels = strings.Join(input.Channels, ",")
+	rule.Email = input.Email
+	rule.WebhookURL = input.WebhookURL
+	if input.IsActive != nil {
+		rule.IsActive = *input.IsActive
+	}
+	return nil
+}
+
+func alertMessage(rule *models.AlertRule, value float64) string {
+	if rule.Condition == models.ConditionVolumeAbove {
+		return fmt.Sprintf("%s: %g %s events in %ds (threshold %g)",
+			rule.Name, value, rule.Category, rule.WindowSeconds, rule.Threshold)
+	}
+	return fmt.Sprintf("%s: %s %s %g (now %g)",
+		rule.Name, rule.Field, strings.ReplaceAll(rule.Condition, "_", " "), rule.Threshold, value)
+}
+
+// numericField reads a decimal column from a record's fields
+func numericField(fields map[string]interface{}, name string) (float64, bool) {
+	v, ok := fields[name].(float64)
+	return v, ok
+}
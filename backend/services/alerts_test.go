@@ -0,0 +1,130 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestAlertRulesRejectPrivateWebhookURLs(t *testing.T) {
+	input := AlertRuleInput{
+		Name:      "floor",
+		Category:  NFTPricesCategory.Name,
+		Condition: models.ConditionAbove,
+		Field:     "price",
+		Channels:  []string{models.ChannelSlack},
+	}
+	for _, rawURL := range []string{"http://127.0.0.1/hook", "http://10.0.0.8/hook", "http://[::1]/hook"} {
+		input.WebhookURL = rawURL
+		if err := applyAlertRuleInput(&models.AlertRule{}, input); !errors.Is(err, ErrInvalidAlertRule) {
+			t.Errorf("webhook_url %s = %v, want ErrInvalidAlertRule", rawURL, err)
+		}
+	}
+	input.WebhookURL = "https://93.184.216.34/hook"
+	if err := applyAlertRuleInput(&models.AlertRule{}, input); err != nil {
+		t.Errorf("public webhook_url = %v", err)
+	}
+}
+
+// newTestAlerts returns an alert service sending email to mailer
+func newTestAlerts(t *testing.T, db *gorm.DB, mailer Mailer) *AlertService {
+	t.Helper()
+	alerts := NewAlertService(db, mailer, 1, testLogger())
+	t.Cleanup(func() {
+		for _, pool := range alerts.Pools() {
+			pool.Shutdown(context.Background())
+		}
+	})
+	return alerts
+}
+
+// evaluatePrice evaluates an nft_price event against the organization's rules
+func evaluatePrice(alerts *AlertService, orgID, webhookID, eventID uint, nft string, price float64) {
+	at := time.Now()
+	e := StreamEvent{
+		ID:             eventID,
+		OrganizationID: orgID,
+		WebhookID:      webhookID,
+		Category:       NFTPricesCategory.Name,
+		Timestamp:      at,
+	}
+	alerts.evaluate(context.Background(), e, &SinkRecord{
+		OrganizationID: orgID,
+		WebhookID:      webhookID,
+		EventID:        eventID,
+		Category:       NFTPricesCategory,
+		Values:         []interface{}{nft, price, "magiceden", at},
+	})
+}
+
+// alertsFired returns the number of times rule has fired
+func alertsFired(t *testing.T, db *gorm.DB, rule *models.AlertRule) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Model(&models.AlertEvent{}).Where("rule_id = ?", rule.ID).Count(&n).Error; err != nil {
+		t.Fatalf("failed to count alert events: %v", err)
+	}
+	return n
+}
+
+func TestCrossingAlertsTrackEachAddress(t *testing.T) {
+	db := testDB(t)
+	alerts := newTestAlerts(t, db, &testMailer{})
+	orgID, webhooks := createTestOrganization(t, db, 1)
+	rule, err := alerts.Create(orgID, AlertRuleInput{
+		Name:      "floor",
+		Category:  NFTPricesCategory.Name,
+		Condition: models.ConditionCrossesAbove,
+		Field:     "price",
+		Threshold: 10,
+		Channels:  []string{models.ChannelEmail},
+		Email:     "alerts@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// NftB's price is above the threshold, but NftA's never was
+	for i, price := range []struct {
+		nft   string
+		price float64
+	}{{"NftA", 5}, {"NftB", 20}, {"NftB", 25}} {
+		evaluatePrice(alerts, orgID, webhooks[0], uint(i+1), price.nft, price.price)
+	}
+	if n := alertsFired(t, db, rule); n != 0 {
+		t.Fatalf("rule fired %d times before any address crossed", n)
+	}
+	evaluatePrice(alerts, orgID, webhooks[0], 4, "NftA", 15)
+	if n := alertsFired(t, db, rule); n != 1 {
+		t.Errorf("rule fired %d times after NftA crossed, want 1", n)
+	}
+}
+
+func TestVolumeAlertsCountEveryReplica(t *testing.T) {
+	db := testDB(t)
+	replicas := []*AlertService{newTestAlerts(t, db, &testMailer{}), newTestAlerts(t, db, &testMailer{})}
+	orgID, webhooks := createTestOrganization(t, db, 1)
+	rule, err := replicas[0].Create(orgID, AlertRuleInput{
+		Name:          "busy",
+		Category:      NFTPricesCategory.Name,
+		Condition:     models.ConditionVolumeAbove,
+		Threshold:     2,
+		WindowSeconds: 60,
+		Channels:      []string{models.ChannelEmail},
+		Email:         "alerts@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	for i := uint(1); i <= 3; i++ {
+		evaluatePrice(replicas[i%2], orgID, webhooks[0], i, "NftA", 1)
+	}
+	if n := alertsFired(t, db, rule); n != 1 {
+		t.Errorf("rule fired %d times after 3 events across replicas, want 1", n)
+	}
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"backend/models"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit actions
+const (
+	AuditUserSignup         = "user.signup"
+	AuditUserLogin          = "user.login"
+	AuditUserLoginFailed    = "user.login_failed"
+	AuditUserLocked         = "user.locked"
+	AuditUserEmailVerified  = "user.email_verified"
+	AuditUserPasswordReset  = "user.password_reset"
+	AuditUserCreate         = "user.create"
+	AuditUserDisable        = "user.disable"
+	AuditUserEnable         = "user.enable"
+	AuditOrgCreate          = "organization.create"
+	AuditMemberInvite       = "organization.member_invite"
+	AuditMemberJoin         = "organization.member_join"
+	AuditMemberRemove       = "organization.member_remove"
+	AuditWebhookRegister    = "webhook.register"
+	AuditWebhookRepoint     = "webhook.repoint"
+	AuditDatabaseConfigSave = "config.database.update"
+	AuditIndexingConfigSave = "config.indexing.update"
+	AuditSinkConfigSave     = "config.sink.update"
+
+	AuditDestinationCreate       = "destination.create"
+	AuditDestinationUpdate       = "destination.update"
+	AuditDestinationRotateSecret = "destination.rotate_secret"
+	AuditDestinationDelete       = "destination.delete"
+
+	AuditAlertRuleCreate = "alert_rule.create"
+	AuditAlertRuleUpdate = "alert_rule.update"
+	AuditAlertRuleDelete = "alert_rule.delete"
+
+	AuditReplayCreate = "replay.create"
+	AuditReplayCancel = "replay.cancel"
+
+	AuditRebuildCreate   = "rebuild.create"
+	AuditRebuildCancel   = "rebuild.cancel"
+	AuditRebuildRollback = "rebuild.rollback"
+	AuditRebuildFinalize = "rebuild.finalize"
+
+	AuditRetentionUpdate = "retention.update"
+	AuditRetentionDelete = "retention.delete"
+)
+
+const (
+	redactedValue        = "[REDACTED]"
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// Field names whose values never appear in an audit diff
+var sensitiveFieldMarkers = []string{"password", "secret", "token", "api_key", "apikey"}
+
+// Bookkeeping fields that are left out of diffs
+var ignoredDiffFields = map[string]bool{
+	"ID":        true,
+	"CreatedAt": true,
+	"UpdatedAt": true,
+	"DeletedAt": true,
+}
+
+// AuditEntry describes an action to record
+type AuditEntry struct {
+	ActorID        uint
+	OrganizationID uint
+	Action         string
+	TargetType     string
+	TargetID       string
+	Before         interface{}
+	After          interface{}
+	IP             string
+	UserAgent      string
+}
+
+// AuditFilter narrows an audit log query
+type AuditFilter struct {
+	OrganizationID uint
+	ActorID        uint
+	Action         string
+	TargetType     string
+	TargetID       string
+	From           time.Time
+	To             time.Time
+	Page           int
+	PageSize       int
+}
+
+// AuditPage is one page of audit events
+type AuditPage struct {
+	Events   []models.AuditEvent `json:"events"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"page_size"`
+	Total    int64               `json:"total"`
+}
+
+// FieldChange is the before and after value of a single field
+type FieldChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record appends an entry to the audit log
+func (s *AuditService) Record(entry AuditEntry) error {
+	changes, err := json.Marshal(Diff(entry.Before, entry.After))
+	if err != nil {
+		return fmt.Errorf("failed to encode audit changes: %w", err)
+	}
+
+	event := &models.AuditEvent{
+		ActorID:        optionalID(entry.ActorID),
+		OrganizationID: optionalID(entry.OrganizationID),
+		Action:         entry.Action,
+		TargetType:     entry.TargetType,
+		TargetID:       entry.TargetID,
+		Changes:        string(changes),
+		IP:             entry.IP,
+		UserAgent:      entry.UserAgent,
+	}
+	if err := s.db.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to store audit event: %w", err)
+	}
+	return nil
+}
+
+// RecordForMember records entry in the audit log of every organization
+// userID belongs to, so account events that happen outside any
+// organization, such as logins, are visible to each. Users without
+// memberships get one event with no organization.
+func (s *AuditService) RecordForMember(userID uint, entry AuditEntry) error {
+	var orgIDs []uint
+	if err := s.db.Model(&models.Membership{}).Where("user_id = ?", userID).Pluck("organization_id", &orgIDs).Error; err != nil {
+		return fmt.Errorf("failed to load memberships: %w", err)
+	}
+	if len(orgIDs) == 0 {
+		return s.Record(entry)
+	}
+	for _, orgID := range orgIDs {
+		entry.OrganizationID = orgID
+		if err := s.Record(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query returns audit events matching filter, newest first
+func (s *AuditService) Query(filter AuditFilter) (*AuditPage, error) {
+	if filter.PageSize <= 0 {
+		filter.PageSize = defaultAuditPageSize
+	}
+	if filter.PageSize > maxAuditPageSize {
+		filter.PageSize = maxAuditPageSize
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	query := s.db.Model(&models.AuditEvent{}).Where("organization_id = ?", filter.OrganizationID)
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	page := &AuditPage{Page: filter.Page, PageSize: filter.PageSize}
+	if err := query.Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&page.Events).Error
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Diff returns the fields that differ between before and after, with
+// sensitive values redacted. Either side may be nil for creations and
+// deletions.
+func Diff(before, after interface{}) map[string]FieldChange {
+	beforeFields := toFieldMap(before)
+	afterFields := toFieldMap(after)
+
+	changes := make(map[string]FieldChange)
+	for key, afterValue := range afterFields {
+		beforeValue, ok := beforeFields[key]
+		if ok && reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		changes[key] = redactChange(key, FieldChange{Before: beforeValue, After: afterValue})
+	}
+	for key, beforeValue := range beforeFields {
+		if _, ok := afterFields[key]; !ok {
+			changes[key] = redactChange(key, FieldChange{Before: beforeValue})
+		}
+	}
+	return changes
+}
+
+func toFieldMap(v interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return fields
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return fields
+	}
+	for key := range ignoredDiffFields {
+		delete(fields, key)
+	}
+	return fields
+}
+
+func redactChange(key string, change FieldChange) FieldChange {
+	lower := strings.ToLower(key)
+	for _, marker := range sensitiveFieldMarkers {
+		if strings.Contains(lower, marker) {
+			if change.Before != nil && change.Before != "" {
+				change.Before = redactedValue
+			}
+			if change.After != nil && change.After != "" {
+				change.After = redactedValue
+			}
+			return change
+		}
+	}
+	return change
+}
+
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
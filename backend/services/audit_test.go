@@ -0,0 +1,37 @@
+package services
+
+import (
+	"backend/models"
+	"testing"
+)
+
+func TestRecordForMemberReachesEveryOrganization(t *testing.T) {
+	db := testDB(t)
+	audit := NewAuditService(db)
+	user := models.User{Email: "member@example.com", ApiKey: "member-key"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	var orgIDs []uint
+	for range 2 {
+		orgID, _ := createTestOrganization(t, db, 0)
+		if err := db.Create(&models.Membership{OrganizationID: orgID, UserID: user.ID, Role: models.RoleMember}).Error; err != nil {
+			t.Fatalf("failed to create membership: %v", err)
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+
+	entry := AuditEntry{Action: AuditUserLoginFailed, TargetType: "email", TargetID: user.Email}
+	if err := audit.RecordForMember(user.ID, entry); err != nil {
+		t.Fatalf("RecordForMember: %v", err)
+	}
+	for _, orgID := range orgIDs {
+		page, err := audit.Query(AuditFilter{OrganizationID: orgID, Action: AuditUserLoginFailed})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		if page.Total != 1 {
+			t.Errorf("organization %d's audit log has %d failed logins, want 1", orgID, page.Total)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const backfillBatchSize = 500
+
+// BackfillResult counts what a backfill did
+type BackfillResult struct {
+	Processed int    `json:"processed"`
+	Failed    int    `json:"failed"`
+	Slots     int    `json:"slots"`
+	LastSlot  uint64 `json:"last_slot"`
+}
+
+// BackfillService indexes stored events that were never processed, such as
+// those that failed while an organization's database was unreachable, and
+// records progress in DataSyncStatus
+type BackfillService struct {
+	db     *gorm.DB
+	helius *HeliusService
+	logger *slog.Logger
+}
+
+func NewBackfillService(db *gorm.DB, helius *HeliusService, logger *slog.Logger) *BackfillService {
+	return &BackfillService{
+		db:     db,
+		helius: helius,
+		logger: logger,
+	}
+}
+
+// Run processes every unprocessed event of a webhook in ID order. Events
+// that fail again are counted and left for the next run.
+func (s *BackfillService) Run(ctx context.Context, webhookID uint) (*BackfillResult, error) {
+	var webhook models.HeliusWebhook
+	if err := s.db.WithContext(ctx).First(&webhook, webhookID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load webhook: %w", err)
+	}
+
+	result := &BackfillResult{}
+	slots := make(map[uint64]struct{})
+	var lastErr error
+	var lastID uint
+	for ctx.Err() == nil {
+		var batch []models.WebhookEvent
+		err := s.db.WithContext(ctx).
+			Where("webhook_id = ? AND processed = ? AND id > ?", webhook.ID, false, lastID).
+			Order("id").Limit(backfillBatchSize).Find(&batch).Error
+		if err != nil {
+			return result, fmt.Errorf("failed to load events: %w", err)
+		}
+
+		for i := range batch {
+			event := &batch[i]
+			lastID = event.ID
+			// These events never reached subscribers or destinations
+			if err := s.helius.Reprocess(ctx, event, ReprocessOptions{Notify: true}); err != nil {
+				result.Failed++
+				lastErr = fmt.Errorf("event %d: %w", event.ID, err)
+				continue
+			}
+			result.Processed++
+			slots[event.Slot] = struct{}{}
+			if event.Slot > result.LastSlot {
+				result.LastSlot = event.Slot
+			}
+		}
+
+		if len(batch) < backfillBatchSize {
+			break
+		}
+	}
+	result.Slots = len(slots)
+
+	if err := s.recordSync(ctx, &webhook, result, lastErr); err != nil {
+		s.logger.ErrorContext(ctx, "failed to record sync status", "webhook_id", webhook.ID, "error", err)
+	}
+	s.logger.InfoContext(ctx, "backfill finished", "webhook_id", webhook.ID,
+		"processed", result.Processed, "failed", result.Failed)
+	return result, ctx.Err()
+}
+
+// recordSync updates the DataSyncStatus of the organization's owner.
+// DataSyncStatus predates organizations and is kept per user.
+func (s *BackfillService) recordSync(ctx context.Context, webhook *models.HeliusWebhook, result *BackfillResult, lastErr error) error {
+	var owner models.Membership
+	err := s.db.WithContext(ctx).
+		Where("organization_id = ? AND role = ?", webhook.OrganizationID, models.RoleOwner).
+		Order("id").First(&owner).Error
+	if err != nil {
+		return fmt.Errorf("failed to find organization owner: %w", err)
+	}
+
+	var status models.DataSyncStatus
+	err = s.db.WithContext(ctx).Where("user_id = ?", owner.UserID).First(&status).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	status.UserID = owner.UserID
+	status.LastSynced = time.Now()
+	status.SyncedBlocks += result.Slots
+	status.ErrorLog = ""
+	if lastErr != nil {
+		status.ErrorLog = lastErr.Error()
+	}
+	return s.db.WithContext(ctx).Save(&status).Error
+}
+
+// SyncStatus returns the DataSyncStatus of userID, or of every user when
+// userID is zero
+func (s *BackfillService) SyncStatus(userID uint) ([]models.DataSyncStatus, error) {
+	query := s.db.Order("user_id")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	var statuses []models.DataSyncStatus
+	if err := query.Find(&statuses).Error; err != nil {
+		return nil, fmt.Errorf("failed to load sync status: %w", err)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"backend/models"
+	"fmt"
+	"strings"
+)
+
+// ColumnType is the logical type of an indexed column
+type ColumnType int
+
+const (
+	ColumnText ColumnType = iota
+	ColumnDecimal
+	ColumnTimestamp
+)
+
+// PartitionColumn is the column partitioned category tables are split by
+const PartitionColumn = "timestamp"
+
+// Column describes one data column of a category table
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Category describes an indexed data category, the event type that feeds it
+// and the table it is stored in
+type Category struct {
+	Name      string // table suffix, e.g. "nft_bids"
+	EventType string // webhook event type, e.g. "nft_bid"
+	Columns   []Column
+
+	// Columns used by the query API's address, amount, marketplace and
+	// platform filters; empty when the filter does not apply
+	AddressColumns    []string
+	AmountColumn      string
+	MarketplaceColumn string
+	PlatformColumn    string
+}
+
+var (
+	NFTBidsCategory = &Category{
+		Name:      "nft_bids",
+		EventType: "nft_bid",
+		Columns: []Column{
+			{Name: "nft_address", Type: ColumnText},
+			{Name: "bidder", Type: ColumnText},
+			{Name: "amount", Type: ColumnDecimal},
+			{Name: "timestamp", Type: ColumnTimestamp},
+		},
+		AddressColumns: []string{"nft_address", "bidder"},
+		AmountColumn:   "amount",
+	}
+
+	NFTPricesCategory = &Category{
+		Name:      "nft_prices",
+		EventType: "nft_price",
+		Columns: []Column{
+			{Name: "nft_address", Type: ColumnText},
+			{Name: "price", Type: ColumnDecimal},
+			{Name: "market", Type: ColumnText},
+			{Name: "timestamp", Type: ColumnTimestamp},
+		},
+		AddressColumns:    []string{"nft_address"},
+		AmountColumn:      "price",
+		MarketplaceColumn: "market",
+	}
+
+	TokenBorrowsCategory = &Category{
+		Name:      "token_borrows",
+		EventType: "token_borrow",
+		Columns: []Column{
+			{Name: "token_address", Type: ColumnText},
+			{Name: "amount", Type: ColumnDecimal},
+			{Name: "apy", Type: ColumnDecimal},
+			{Name: "platform", Type: ColumnText},
+			{Name: "timestamp", Type: ColumnTimestamp},
+		},
+		AddressColumns: []string{"token_address"},
+		AmountColumn:   "amount",
+		PlatformColumn: "platform",
+	}
+
+	TokenPricesCategory = &Category{
+		Name:      "token_prices",
+		EventType: "token_price",
+		Columns: []Column{
+			{Name: "token_address", Type: ColumnText},
+			{Name: "price", Type: ColumnDecimal},
+			{Name: "platform", Type: ColumnText},
+			{Name: "timestamp", Type: ColumnTimestamp},
+		},
+		AddressColumns: []string{"token_address"},
+		AmountColumn:   "price",
+		PlatformColumn: "platform",
+	}
+
+	// Categories lists every indexed category
+	Categories = []*Category{
+		NFTBidsCategory,
+		NFTPricesCategory,
+		TokenBorrowsCategory,
+		TokenPricesCategory,
+	}
+)
+
+// CategoryByName looks up a category by its table suffix
+func CategoryByName(name string) (*Category, bool) {
+	for _, c := range Categories {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// CategoryByEventType looks up the category fed by a webhook event type
+func CategoryByEventType(eventType string) (*Category, bool) {
+	for _, c := range Categories {
+		if c.EventType == eventType {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// TableName returns the table holding a webhook's rows for category
+func TableName(webhookID uint, category *Category) string {
+	return fmt.Sprintf("user_%d_%s", webhookID, category.Name)
+}
+
+// Column returns the named column, if the category has it
+func (c *Category) Column(name string) (Column, bool) {
+	for _, col := range c.Columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
+
+// ColumnNames returns the category's data column names in table order
+func (c *Category) ColumnNames() []string {
+	names := make([]string, len(c.Columns))
+	for i, col := range c.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// sqlDialect holds the DDL differences between supported databases
+type sqlDialect struct {
+	columnTypes map[ColumnType]string
+	id          string
+	createdAt   string
+	options     string // Appended after the column list; %s is the table name
+	// ClickHouse has no auto-increment, so the event ID is inserted as id
+	// and ReplacingMergeTree collapses rows written twice. Tables are sorted
+	// and collapsed by id alone, so an event written again with another
+	// timestamp still replaces its row.
+	explicitID bool
+	// Elsewhere rows are keyed by a unique event_id column and upserted
+	eventID  string
+	onUpsert string // Appended to inserts; %[1]s is the conflict key, %[2]s the assignments
+	assign   string // Assignment of one column, %[1]s, to its new value
+	// Lists tables named like user% with their estimated rows and the bytes
+	// they take on disk, including indexes, as name, estimated_rows and bytes
+	tableStats string
+}
+
+var sqlDialects = map[string]*sqlDialect{
+	models.DriverPostgres: {
+		columnTypes: map[ColumnType]string{
+			ColumnText:      "TEXT NOT NULL",
+			ColumnDecimal:   "DECIMAL NOT NULL",
+			ColumnTimestamp: "TIMESTAMP NOT NULL",
+		},
+		id:        "id SERIAL PRIMARY KEY",
+		createdAt: "created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP",
+		eventID:   "event_id BIGINT UNIQUE",
+		onUpsert:  " ON CONFLICT (%[1]s) DO UPDATE SET %[2]s",
+		assign:    "%[1]s = EXCLUDED.%[1]s",
+		// Summed over the partition tree, as a partitioned table has no
+		// storage or statistics of its own
+		tableStats: "SELECT c.relname AS name, " +
+			"COALESCE(SUM(GREATEST(p.reltuples, 0)) FILTER (WHERE t.isleaf), 0)::bigint AS estimated_rows, " +
+			"COALESCE(SUM(pg_total_relation_size(p.oid)), 0)::bigint AS bytes " +
+			"FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace " +
+			"CROSS JOIN LATERAL pg_partition_tree(c.oid) t JOIN pg_class p ON p.oid = t.relid " +
+			"WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p') AND NOT c.relispartition " +
+			"AND c.relname LIKE 'user%' GROUP BY c.relname",
+	},
+	models.DriverMySQL: {
+		columnTypes: map[ColumnType]string{
+			ColumnText:      "VARCHAR(255) NOT NULL",
+			ColumnDecimal:   "DECIMAL(38,18) NOT NULL",
+			ColumnTimestamp: "DATETIME(6) NOT NULL",
+		},
+		id:        "id BIGINT AUTO_INCREMENT PRIMARY KEY",
+		createdAt: "created_at DATETIME(6) DEFAULT CURRENT_TIMESTAMP(6)",
+		options:   " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		eventID:   "event_id BIGINT UNSIGNED UNIQUE",
+		onUpsert:  " ON DUPLICATE KEY UPDATE %[2]s",
+		assign:    "%[1]s = VALUES(%[1]s)",
+		tableStats: "SELECT table_name AS name, COALESCE(table_rows, 0) AS estimated_rows, " +
+			"COALESCE(data_length + index_length, 0) AS bytes FROM information_schema.tables " +
+			"WHERE table_schema = DATABASE() AND table_name LIKE 'user%'",
+	},
+	models.DriverClickHouse: {
+		columnTypes: map[ColumnType]string{
+			ColumnText:      "LowCardinality(String)",
+			ColumnDecimal:   "Float64",
+			ColumnTimestamp: "DateTime64(3, 'UTC')",
+		},
+		id:         "id UInt64",
+		createdAt:  "created_at DateTime64(3, 'UTC') DEFAULT now64(3)",
+		options:    " ENGINE = ReplacingMergeTree ORDER BY id",
+		explicitID: true,
+		// Counted from the active parts' metadata, without reading them
+		tableStats: "SELECT name, toInt64(ifNull(total_rows, 0)) AS estimated_rows, toInt64(ifNull(total_bytes, 0)) AS bytes " +
+			"FROM system.tables WHERE database = currentDatabase() AND name LIKE 'user%'",
+	},
+}
+
+// dialectFor returns the dialect for driver, defaulting to Postgres
+func dialectFor(driver string) *sqlDialect {
+	if d, ok := sqlDialects[driver]; ok {
+		return d
+	}
+	return sqlDialects[models.DriverPostgres]
+}
+
+// CreateTableSQL returns the DDL for a category table in driver's dialect
+func (c *Category) CreateTableSQL(driver, table string) string {
+	d := dialectFor(driver)
+	defs := []string{d.id}
+	if d.eventID != "" {
+		defs = append(defs, d.eventID)
+	}
+	for _, col := range c.Columns {
+		columnType := d.columnTypes[col.Type]
+		// Addresses are too high-cardinality for LowCardinality(String)
+		if driver == models.DriverClickHouse && col.Type == ColumnText && c.isAddressColumn(col.Name) {
+			columnType = "String"
+		}
+		defs = append(defs, fmt.Sprintf("%s %s", col.Name, columnType))
+	}
+	defs = append(defs, d.createdAt)
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)%s", table, strings.Join(defs, ", "), d.options)
+}
+
+// PartitionedTableSQL returns the DDL for a Postgres category table range
+// partitioned by PartitionColumn. Its keys must include that column, so
+// event IDs are only unique per timestamp; writes remove an event's row
+// with another timestamp first, using DeleteMovedSQL.
+func (c *Category) PartitionedTableSQL(table string) string {
+	d := sqlDialects[models.DriverPostgres]
+	defs := []string{"id SERIAL", "event_id BIGINT"}
+	for _, col := range c.Columns {
+		defs = append(defs, fmt.Sprintf("%s %s", col.Name, d.columnTypes[col.Type]))
+	}
+	defs = append(defs, d.createdAt,
+		fmt.Sprintf("PRIMARY KEY (id, %s)", PartitionColumn),
+		fmt.Sprintf("UNIQUE (event_id, %s)", PartitionColumn))
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s) PARTITION BY RANGE (%s)",
+		table, strings.Join(defs, ", "), PartitionColumn)
+}
+
+// AddEventIDSQL returns the DDL adding the event_id column to a category
+// table created without one, or "" if the dialect keys rows by id
+func (c *Category) AddEventIDSQL(driver, table string) string {
+	d := dialectFor(driver)
+	if d.eventID == "" {
+		return ""
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, d.eventID)
+}
+
+// InsertSQL returns an upsert of rows rows into a category table, taking
+// for each row the event ID and then the data columns as parameters in
+// table order. Writing an event again replaces its row.
+func (c *Category) InsertSQL(driver, table string, rows int) string {
+	return c.insertSQL(dialectFor(driver), table, "event_id", rows)
+}
+
+// PartitionedInsertSQL returns InsertSQL for a table created by
+// PartitionedTableSQL, whose rows conflict on event ID and timestamp
+func (c *Category) PartitionedInsertSQL(table string, rows int) string {
+	return c.insertSQL(sqlDialects[models.DriverPostgres], table, "event_id, "+PartitionColumn, rows)
+}
+
+// DeleteMovedSQL returns a statement deleting the rows of a table created by
+// PartitionedTableSQL whose event is written again with another timestamp,
+// such as by a replay after a decoder fix, which the upsert would otherwise
+// keep next to the new row. It takes the rows' event IDs, then each event
+// ID again followed by its new timestamp.
+func (c *Category) DeleteMovedSQL(table string, rows int) string {
+	ids := strings.TrimSuffix(strings.Repeat("?, ", rows), ", ")
+	pairs := strings.TrimSuffix(strings.Repeat("(?, ?), ", rows), ", ")
+	return fmt.Sprintf("DELETE FROM %s WHERE event_id IN (%s) AND (event_id, %s) NOT IN (%s)",
+		table, ids, PartitionColumn, pairs)
+}
+
+func (c *Category) insertSQL(d *sqlDialect, table, conflict string, rows int) string {
+	key := "event_id"
+	if d.explicitID {
+		key = "id"
+	}
+	columns := append([]string{key}, c.ColumnNames()...)
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	values := strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ")
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(columns, ", "), values)
+	if d.onUpsert != "" {
+		assignments := make([]string, len(c.Columns))
+		for i, col := range c.Columns {
+			assignments[i] = fmt.Sprintf(d.assign, col.Name)
+		}
+		sql += fmt.Sprintf(d.onUpsert, conflict, strings.Join(assignments, ", "))
+	}
+	return sql
+}
+
+// SelectRowsSQL returns a query reading a category table's rows in event
+// order, with the event ID ahead of the data columns
+func (c *Category) SelectRowsSQL(driver, table string) string {
+	d := dialectFor(driver)
+	key, final := "event_id", ""
+	if d.explicitID {
+		// Rows written twice are only collapsed when read with FINAL
+		key, final = "id", " FINAL"
+	}
+	return fmt.Sprintf("SELECT %s, %s FROM %s%s ORDER BY %s",
+		key, strings.Join(c.ColumnNames(), ", "), table, final, key)
+}
+
+// RenameTablesSQL returns the statements renaming each table in renames
+// to the name that follows it. Postgres must run them in one transaction,
+// and MySQL's single RENAME TABLE statement is atomic. ClickHouse renames
+// tables one at a time, so a swap of two tables is done with EXCHANGE
+// TABLES, which fails rather than swap non-atomically in a database that
+// isn't of the Atomic engine, before the replaced table is renamed.
+func RenameTablesSQL(driver string, renames [][2]string) []string {
+	switch dialectFor(driver) {
+	case sqlDialects[models.DriverPostgres]:
+		statements := make([]string, len(renames))
+		for i, r := range renames {
+			statements[i] = fmt.Sprintf("ALTER TABLE %s RENAME TO %s", r[0], r[1])
+		}
+		return statements
+	case sqlDialects[models.DriverClickHouse]:
+		// {a, b}, {c, a} moves a out of the way for c
+		if len(renames) == 2 && renames[1][1] == renames[0][0] {
+			a, b, c := renames[0][0], renames[0][1], renames[1][0]
+			return []string{
+				fmt.Sprintf("EXCHANGE TABLES %s AND %s", a, c),
+				fmt.Sprintf("RENAME TABLE %s TO %s", c, b),
+			}
+		}
+	}
+	pairs := make([]string, len(renames))
+	for i, r := range renames {
+		pairs[i] = fmt.Sprintf("%s TO %s", r[0], r[1])
+	}
+	return []string{"RENAME TABLE " + strings.Join(pairs, ", ")}
+}
+
+// ExpiredRowsSQL returns a query for the oldest rows of a category table
+// with a timestamp before the first parameter, at most the second
+// parameter of them
+func (c *Category) ExpiredRowsSQL(table string) string {
+	return fmt.Sprintf("SELECT * FROM %s WHERE timestamp < ? ORDER BY id LIMIT ?", table)
+}
+
+// DeleteRowsSQL returns a statement deleting the rows of a category table
+// whose id is in the parameter. ClickHouse runs it as a lightweight delete.
+func (c *Category) DeleteRowsSQL(table string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE id IN ?", table)
+}
+
+// TableStatsSQL returns a query listing the category tables in driver's
+// database with their estimated rows and bytes on disk, read from table
+// statistics rather than by scanning the tables
+func TableStatsSQL(driver string) string {
+	return dialectFor(driver).tableStats
+}
+
+// InsertArgs appends one row's parameters for InsertSQL and
+// PartitionedInsertSQL to args
+func (c *Category) InsertArgs(args []interface{}, id uint, values []interface{}) []interface{} {
+	args = append(args, uint64(id))
+	return append(args, values...)
+}
+
+func (c *Category) isAddressColumn(name string) bool {
+	for _, col := range c.AddressColumns {
+		if col == name {
+			return true
+		}
+	}
+	return false
+}
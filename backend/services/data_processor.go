@@ -2,19 +2,24 @@ package services
 
 import (
 	"backend/models"
+	"backend/tracing"
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"time"
 
-	"gorm.io/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DataProcessor struct {
-	db *gorm.DB
+	sinks  *SinkManager
+	logger *slog.Logger
 }
 
-func NewDataProcessor(db *gorm.DB) *DataProcessor {
-	return &DataProcessor{db: db}
+func NewDataProcessor(sinks *SinkManager, logger *slog.Logger) *DataProcessor {
+	return &DataProcessor{sinks: sinks, logger: logger}
 }
 
 // NFTBid represents the structure of an NFT bid event
@@ -50,113 +55,99 @@ type TokenPrice struct {
 	Timestamp    int64   `json:"timestamp"`
 }
 
-// ProcessNFTBid processes and stores NFT bid data
-func (p *DataProcessor) ProcessNFTBid(event *models.WebhookEvent) error {
-	var bid NFTBid
-	if err := json.Unmarshal([]byte(event.Payload), &bid); err != nil {
-		return fmt.Errorf("failed to parse NFT bid data: %v", err)
+// DecodeEvent parses an event's payload into a record for the category its
+// type feeds
+func DecodeEvent(webhook *models.HeliusWebhook, event *models.WebhookEvent) (*SinkRecord, error) {
+	var category *Category
+	var values []interface{}
+	switch event.EventType {
+	case NFTBidsCategory.EventType:
+		var bid NFTBid
+		if err := json.Unmarshal([]byte(event.Payload), &bid); err != nil {
+			return nil, fmt.Errorf("failed to parse NFT bid data: %v", err)
+		}
+		category = NFTBidsCategory
+		values = []interface{}{bid.NFTAddress, bid.Bidder, bid.Amount, time.Unix(bid.Timestamp, 0)}
+	case NFTPricesCategory.EventType:
+		var price NFTPrice
+		if err := json.Unmarshal([]byte(event.Payload), &price); err != nil {
+			return nil, fmt.Errorf("failed to parse NFT price data: %v", err)
+		}
+		category = NFTPricesCategory
+		values = []interface{}{price.NFTAddress, price.Price, price.Market, time.Unix(price.Timestamp, 0)}
+	case TokenBorrowsCategory.EventType:
+		var borrow TokenBorrow
+		if err := json.Unmarshal([]byte(event.Payload), &borrow); err != nil {
+			return nil, fmt.Errorf("failed to parse token borrow data: %v", err)
+		}
+		category = TokenBorrowsCategory
+		values = []interface{}{borrow.TokenAddress, borrow.Amount, borrow.APY, borrow.Platform, time.Unix(borrow.Timestamp, 0)}
+	case TokenPricesCategory.EventType:
+		var price TokenPrice
+		if err := json.Unmarshal([]byte(event.Payload), &price); err != nil {
+			return nil, fmt.Errorf("failed to parse token price data: %v", err)
+		}
+		category = TokenPricesCategory
+		values = []interface{}{price.TokenAddress, price.Price, price.Platform, time.Unix(price.Timestamp, 0)}
+	default:
+		return nil, fmt.Errorf("unsupported event type: %s", event.EventType)
 	}
 
-	// Create a table dynamically for the user if it doesn't exist
-	tableName := fmt.Sprintf("user_%d_nft_bids", event.WebhookID)
-	p.db.Exec(fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s (
-			id SERIAL PRIMARY KEY,
-			nft_address TEXT NOT NULL,
-			bidder TEXT NOT NULL,
-			amount DECIMAL NOT NULL,
-			timestamp TIMESTAMP NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`, tableName))
-
-	// Insert the bid data
-	sql := fmt.Sprintf(
-		"INSERT INTO %s (nft_address, bidder, amount, timestamp) VALUES (?, ?, ?, ?)",
-		tableName,
-	)
-	result := p.db.Exec(sql, bid.NFTAddress, bid.Bidder, bid.Amount, time.Unix(bid.Timestamp, 0))
-	return result.Error
+	return &SinkRecord{
+		OrganizationID: webhook.OrganizationID,
+		WebhookID:      event.WebhookID,
+		EventID:        event.ID,
+		Category:       category,
+		Values:         values,
+	}, nil
 }
 
-// ProcessNFTPrice processes and stores NFT price data
-func (p *DataProcessor) ProcessNFTPrice(event *models.WebhookEvent) error {
-	var price NFTPrice
-	if err := json.Unmarshal([]byte(event.Payload), &price); err != nil {
-		return fmt.Errorf("failed to parse NFT price data: %v", err)
+// Process decodes an event and writes it to the organization's sink,
+// returning the record written. With a table suffix it is written to that
+// set of shadow tables in the organization's database instead.
+func (p *DataProcessor) Process(ctx context.Context, webhook *models.HeliusWebhook, event *models.WebhookEvent, tableSuffix string) (*SinkRecord, error) {
+	record, err := DecodeEvent(webhook, event)
+	if err != nil {
+		return nil, err
 	}
-
-	tableName := fmt.Sprintf("user_%d_nft_prices", event.WebhookID)
-	p.db.Exec(fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s (
-			id SERIAL PRIMARY KEY,
-			nft_address TEXT NOT NULL,
-			price DECIMAL NOT NULL,
-			market TEXT NOT NULL,
-			timestamp TIMESTAMP NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`, tableName))
-
-	sql := fmt.Sprintf(
-		"INSERT INTO %s (nft_address, price, market, timestamp) VALUES (?, ?, ?, ?)",
-		tableName,
-	)
-	result := p.db.Exec(sql, price.NFTAddress, price.Price, price.Market, time.Unix(price.Timestamp, 0))
-	return result.Error
-}
-
-// ProcessTokenBorrow processes and stores token borrow data
-func (p *DataProcessor) ProcessTokenBorrow(event *models.WebhookEvent) error {
-	var borrow TokenBorrow
-	if err := json.Unmarshal([]byte(event.Payload), &borrow); err != nil {
-		return fmt.Errorf("failed to parse token borrow data: %v", err)
+	record.TableSuffix = tableSuffix
+	if err := p.store(ctx, event, record); err != nil {
+		return nil, err
 	}
-
-	tableName := fmt.Sprintf("user_%d_token_borrows", event.WebhookID)
-	p.db.Exec(fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s (
-			id SERIAL PRIMARY KEY,
-			token_address TEXT NOT NULL,
-			amount DECIMAL NOT NULL,
-			apy DECIMAL NOT NULL,
-			platform TEXT NOT NULL,
-			timestamp TIMESTAMP NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`, tableName))
-
-	sql := fmt.Sprintf(
-		"INSERT INTO %s (token_address, amount, apy, platform, timestamp) VALUES (?, ?, ?, ?, ?)",
-		tableName,
-	)
-	result := p.db.Exec(sql, borrow.TokenAddress, borrow.Amount, borrow.APY, borrow.Platform, time.Unix(borrow.Timestamp, 0))
-	return result.Error
+	return record, nil
 }
 
-// ProcessTokenPrice processes and stores token price data
-func (p *DataProcessor) ProcessTokenPrice(event *models.WebhookEvent) error {
-	var price TokenPrice
-	if err := json.Unmarshal([]byte(event.Payload), &price); err != nil {
-		return fmt.Errorf("failed to parse token price data: %v", err)
+// store writes one record to the owning organization's sink
+func (p *DataProcessor) store(ctx context.Context, event *models.WebhookEvent, record *SinkRecord) (err error) {
+	category := record.Category
+	ctx, span := tracing.Start(ctx, "processor.store", trace.WithAttributes(
+		attribute.String("helixscan.category", categoryLabel(category)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	var sink Sink = p.sinks.Database()
+	release := func() {}
+	if record.TableSuffix == "" {
+		sink, release, err = p.sinks.ForOrganization(record.OrganizationID)
 	}
-
-	tableName := fmt.Sprintf("user_%d_token_prices", event.WebhookID)
-	p.db.Exec(fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s (
-			id SERIAL PRIMARY KEY,
-			token_address TEXT NOT NULL,
-			price DECIMAL NOT NULL,
-			platform TEXT NOT NULL,
-			timestamp TIMESTAMP NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`, tableName))
-
-	sql := fmt.Sprintf(
-		"INSERT INTO %s (token_address, price, platform, timestamp) VALUES (?, ?, ?, ?)",
-		tableName,
-	)
-	result := p.db.Exec(sql, price.TokenAddress, price.Price, price.Platform, time.Unix(price.Timestamp, 0))
-	return result.Error
-}
\ No newline at end of file
+	if err != nil {
+		sinkWriteErrors.WithLabelValues(categoryLabel(category), metricError).Inc()
+		p.logger.ErrorContext(ctx, "failed to open sink",
+			append(eventLogAttrs(event), "organization_id", record.OrganizationID, "error", err)...)
+		return err
+	}
+	defer release()
+
+	start := time.Now()
+	err = sink.Write(ctx, record)
+	processingDuration.WithLabelValues(categoryLabel(category)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		sinkWriteErrors.WithLabelValues(categoryLabel(category), sinkDriverLabel(sink)).Inc()
+		p.logger.ErrorContext(ctx, "failed to write event to sink",
+			append(eventLogAttrs(event), "category", categoryLabel(category), "sink", sinkDriverLabel(sink), "error", err)...)
+		return err
+	}
+	p.logger.DebugContext(ctx, "event written to sink",
+		append(eventLogAttrs(event), "category", categoryLabel(category), "sink", sinkDriverLabel(sink))...)
+	return nil
+}
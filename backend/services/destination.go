@@ -0,0 +1,237 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDeliveryPageSize = 50
+	maxDeliveryPageSize     = 200
+)
+
+var (
+	ErrDestinationNotFound   = errors.New("destination not found")
+	ErrInvalidDestinationURL = errors.New("destination URL must be an absolute http or https URL")
+	ErrDestinationName       = errors.New("destination name is required")
+)
+
+// DestinationInput holds the editable fields of a destination. Nil fields
+// are left unchanged on update.
+type DestinationInput struct {
+	Name       *string   `json:"name"`
+	URL        *string   `json:"url"`
+	Categories *[]string `json:"categories"`
+	IsActive   *bool     `json:"is_active"`
+}
+
+// DeliveryPage is one page of a destination's delivery log
+type DeliveryPage struct {
+	Deliveries []models.Delivery `json:"deliveries"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"page_size"`
+	Total      int64             `json:"total"`
+}
+
+type DestinationService struct {
+	db        *gorm.DB
+	forwarder *Forwarder
+}
+
+func NewDestinationService(db *gorm.DB, forwarder *Forwarder) *DestinationService {
+	return &DestinationService{db: db, forwarder: forwarder}
+}
+
+// List returns the organization's destinations
+func (s *DestinationService) List(orgID uint) ([]models.Destination, error) {
+	var destinations []models.Destination
+	if err := s.db.Where("organization_id = ?", orgID).Order("id").Find(&destinations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list destinations: %w", err)
+	}
+	return destinations, nil
+}
+
+// Get returns one of the organization's destinations
+func (s *DestinationService) Get(orgID, id uint) (*models.Destination, error) {
+	var destination models.Destination
+	err := s.db.Where("id = ? AND organization_id = ?", id, orgID).First(&destination).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDestinationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load destination: %w", err)
+	}
+	return &destination, nil
+}
+
+// Create adds a destination with a newly generated signing secret, which is
+// returned only here and from RotateSecret
+func (s *DestinationService) Create(orgID uint, input DestinationInput) (*models.Destination, string, error) {
+	destination := &models.Destination{OrganizationID: orgID, IsActive: true}
+	if err := applyDestinationInput(destination, input); err != nil {
+		return nil, "", err
+	}
+	if destination.Name == "" {
+		return nil, "", ErrDestinationName
+	}
+	if destination.URL == "" {
+		return nil, "", ErrInvalidDestinationURL
+	}
+
+	secret, err := GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	destination.Secret = secret
+
+	if err := s.db.Create(destination).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create destination: %w", err)
+	}
+	return destination, secret, nil
+}
+
+// Update changes a destination. Re-activating a disabled destination clears
+// its failure count.
+func (s *DestinationService) Update(orgID, id uint, input DestinationInput) (before, after *models.Destination, err error) {
+	destination, err := s.Get(orgID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	previous := *destination
+
+	if err := applyDestinationInput(destination, input); err != nil {
+		return nil, nil, err
+	}
+	if destination.Name == "" {
+		return nil, nil, ErrDestinationName
+	}
+	if destination.IsActive && !previous.IsActive {
+		destination.ConsecutiveFailures = 0
+		destination.DisabledAt = nil
+		destination.DisabledReason = ""
+	}
+
+	if err := s.db.Save(destination).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to update destination: %w", err)
+	}
+	return &previous, destination, nil
+}
+
+// RotateSecret replaces a destination's signing secret and returns it
+func (s *DestinationService) RotateSecret(orgID, id uint) (string, error) {
+	destination, err := s.Get(orgID, id)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.Model(destination).Update("secret", secret).Error; err != nil {
+		return "", fmt.Errorf("failed to rotate secret: %w", err)
+	}
+	return secret, nil
+}
+
+// Delete removes a destination and its delivery log
+func (s *DestinationService) Delete(orgID, id uint) (*models.Destination, error) {
+	destination, err := s.Get(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		deliveries := tx.Model(&models.Delivery{}).Select("id").Where("destination_id = ?", destination.ID)
+		if err := tx.Where("delivery_id IN (?)", deliveries).Delete(&models.DeliveryAttempt{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("destination_id = ?", destination.ID).Delete(&models.Delivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(destination).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete destination: %w", err)
+	}
+	return destination, nil
+}
+
+// Test sends a sample event to a destination and returns the result
+func (s *DestinationService) Test(ctx context.Context, orgID, id uint) (*models.Delivery, error) {
+	destination, err := s.Get(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.forwarder.TestDelivery(ctx, destination)
+}
+
+// ListDeliveries returns a destination's deliveries with their attempts,
+// newest first, optionally filtered by status
+func (s *DestinationService) ListDeliveries(orgID, id uint, status string, page, pageSize int) (*DeliveryPage, error) {
+	if _, err := s.Get(orgID, id); err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		pageSize = defaultDeliveryPageSize
+	}
+	if pageSize > maxDeliveryPageSize {
+		pageSize = maxDeliveryPageSize
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	query := s.db.Model(&models.Delivery{}).Where("destination_id = ?", id)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	result := &DeliveryPage{Page: page, PageSize: pageSize}
+	if err := query.Count(&result.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count deliveries: %w", err)
+	}
+	err := query.Preload("AttemptLog", func(db *gorm.DB) *gorm.DB { return db.Order("attempt") }).
+		Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&result.Deliveries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	return result, nil
+}
+
+func applyDestinationInput(destination *models.Destination, input DestinationInput) error {
+	if input.Name != nil {
+		destination.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.URL != nil {
+		parsed, err := url.Parse(*input.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return ErrInvalidDestinationURL
+		}
+		if err := CheckPublicURL(parsed.String()); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDestinationURL, err)
+		}
+		destination.URL = parsed.String()
+	}
+	if input.Categories != nil {
+		for _, name := range *input.Categories {
+			if _, ok := CategoryByName(name); !ok {
+				return fmt.Errorf("%w: %s", ErrUnknownCategory, name)
+			}
+		}
+		destination.Categories = strings.Join(*input.Categories, ",")
+	}
+	if input.IsActive != nil {
+		destination.IsActive = *input.IsActive
+	}
+	return nil
+}
@@ -0,0 +1,623 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Custom filters decide which events an organization stores. They are saved
+// as JSON in IndexingPreference.CustomFilters and evaluated against every
+// decoded event before it is written; events that don't match are marked
+// filtered and skipped. An empty document ({}) matches everything.
+//
+// A filter is one node. Each node is an object with exactly one of these keys:
+//
+//	{"all": [node, ...]}                      every node matches
+//	{"any": [node, ...]}                      at least one node matches
+//	{"not": node}                             node does not match
+//	{"field": "apy", "op": "gte", "value": 5} compare a payload field
+//	{"address": {"allow": [...], "deny": [...]}}
+//	                                          any address column is allowed
+//	                                          and none is denied
+//	{"amount": {"min": 1.5, "max": 100}}      the category's amount column
+//	                                          is within the inclusive bounds
+//	{"marketplace": ["magic_eden", ...]}      case-insensitive match on the
+//	{"platform": ["solend", ...]}             marketplace or platform column
+//	{"category": ["nft_bids", ...]}           the event's category
+//
+// Field comparisons accept the operators eq, ne, gt, gte, lt, lte, in,
+// not_in and contains. Fields are payload columns (for example nft_address,
+// price, apy, market) or one of category, event_type, account_key and
+// collection. A comparison against a field the event doesn't have does not
+// match. Address, marketplace and platform nodes on categories without such
+// columns never match.
+//
+// Example: bids over 10 SOL outside a deny list, or any Solend borrow
+//
+//	{"any": [
+//	  {"all": [
+//	    {"category": ["nft_bids"]},
+//	    {"amount": {"min": 10}},
+//	    {"address": {"deny": ["BadBidder111"]}}
+//	  ]},
+//	  {"platform": ["solend"]}
+//	]}
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+const filterStatsFlushInterval = 10 * time.Second
+
+// Filter fields that come from the event rather than its payload
+var filterMetaFields = map[string]bool{
+	"category":    true,
+	"event_type":  true,
+	"account_key": true,
+	"collection":  true,
+}
+
+var filterOperators = map[string]bool{
+	"eq": true, "ne": true, "gt": true, "gte": true, "lt": true, "lte": true,
+	"in": true, "not_in": true, "contains": true,
+}
+
+// FilterEvent is the view of an event that filters are evaluated against
+type FilterEvent struct {
+	Category *Category
+	Fields   map[string]interface{}
+}
+
+// NewFilterEvent decodes an event's payload for filtering
+func NewFilterEvent(event *models.WebhookEvent, collection string) (*FilterEvent, error) {
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(event.Payload), &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode event payload: %w", err)
+	}
+
+	category, _ := CategoryByEventType(event.EventType)
+	if category != nil {
+		fields["category"] = category.Name
+	}
+	fields["event_type"] = event.EventType
+	fields["account_key"] = event.AccountKey
+	if collection != "" {
+		fields["collection"] = collection
+	}
+	return &FilterEvent{Category: category, Fields: fields}, nil
+}
+
+// Filter is a parsed custom filter
+type Filter struct {
+	root filterNode
+}
+
+type filterNode interface {
+	match(e *FilterEvent) bool
+}
+
+// ParseFilter parses and validates a filter document
+func ParseFilter(raw string) (*Filter, error) {
+	if strings.TrimSpace(raw) == "" {
+		return &Filter{}, nil
+	}
+	var doc json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+
+	root, err := parseFilterNode(doc, "filter", true)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{root: root}, nil
+}
+
+// Match reports whether e passes the filter
+func (f *Filter) Match(e *FilterEvent) bool {
+	return f == nil || f.root == nil || f.root.match(e)
+}
+
+func parseFilterNode(raw json.RawMessage, path string, allowEmpty bool) (filterNode, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, filterError(path, "must be an object")
+	}
+	if len(obj) == 0 {
+		if allowEmpty {
+			return nil, nil
+		}
+		return nil, filterError(path, "must not be empty")
+	}
+
+	if _, ok := obj["field"]; ok {
+		return parseComparison(obj, path)
+	}
+	if len(obj) != 1 {
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, filterError(path, "must have exactly one key, got "+strings.Join(keys, ", "))
+	}
+
+	for key, value := range obj {
+		nodePath := path + "." + key
+		switch key {
+		case "all", "any":
+			var items []json.RawMessage
+			if err := json.Unmarshal(value, &items); err != nil || len(items) == 0 {
+				return nil, filterError(nodePath, "must be a non-empty array")
+			}
+			children := make([]filterNode, len(items))
+			for i, item := range items {
+				child, err := parseFilterNode(item, fmt.Sprintf("%s[%d]", nodePath, i), false)
+				if err != nil {
+					return nil, err
+				}
+				children[i] = child
+			}
+			if key == "all" {
+				return allNode(children), nil
+			}
+			return anyNode(children), nil
+
+		case "not":
+			child, err := parseFilterNode(value, nodePath, false)
+			if err != nil {
+				return nil, err
+			}
+			return notNode{child}, nil
+
+		case "address":
+			var lists struct {
+				Allow []string `json:"allow"`
+				Deny  []string `json:"deny"`
+			}
+			if err := strictUnmarshal(value, &lists); err != nil {
+				return nil, filterError(nodePath, "must be {\"allow\": [...], \"deny\": [...]}")
+			}
+			if len(lists.Allow) == 0 && len(lists.Deny) == 0 {
+				return nil, filterError(nodePath, "needs an allow or deny list")
+			}
+			return addressNode{allow: stringSet(lists.Allow, false), deny: stringSet(lists.Deny, false)}, nil
+
+		case "amount":
+			var bounds struct {
+				Min *float64 `json:"min"`
+				Max *float64 `json:"max"`
+			}
+			if err := strictUnmarshal(value, &bounds); err != nil {
+				return nil, filterError(nodePath, "must be {\"min\": number, \"max\": number}")
+			}
+			if bounds.Min == nil && bounds.Max == nil {
+				return nil, filterError(nodePath, "needs min or max")
+			}
+			if bounds.Min != nil && bounds.Max != nil && *bounds.Min > *bounds.Max {
+				return nil, filterError(nodePath, "min must not exceed max")
+			}
+			return amountNode{min: bounds.Min, max: bounds.Max}, nil
+
+		case "marketplace", "platform", "category":
+			var values []string
+			if err := json.Unmarshal(value, &values); err != nil || len(values) == 0 {
+				return nil, filterError(nodePath, "must be a non-empty array of strings")
+			}
+			if key == "category" {
+				for _, name := range values {
+					if _, ok := CategoryByName(name); !ok {
+						return nil, filterError(nodePath, "unknown category "+name)
+					}
+				}
+			}
+			return matchNode{kind: key, values: stringSet(values, key != "category")}, nil
+
+		default:
+			return nil, filterError(nodePath, "unknown filter")
+		}
+	}
+	return nil, nil
+}
+
+func parseComparison(obj map[string]json.RawMessage, path string) (filterNode, error) {
+	var cmp struct {
+		Field string      `json:"field"`
+		Op    string      `json:"op"`
+		Value interface{} `json:"value"`
+	}
+	raw, _ := json.Marshal(obj)
+	if err := strictUnmarshal(raw, &cmp); err != nil {
+		return nil, filterError(path, "comparisons take only field, op and value")
+	}
+	if !knownFilterField(cmp.Field) {
+		return nil, filterError(path+".field", "unknown field "+cmp.Field)
+	}
+	if !filterOperators[cmp.Op] {
+		return nil, filterError(path+".op", "unknown operator "+cmp.Op)
+	}
+
+	switch cmp.Op {
+	case "in", "not_in":
+		if _, ok := cmp.Value.([]interface{}); !ok {
+			return nil, filterError(path+".value", cmp.Op+" needs an array")
+		}
+	case "gt", "gte", "lt", "lte":
+		if _, ok := cmp.Value.(float64); !ok {
+			return nil, filterError(path+".value", cmp.Op+" needs a number")
+		}
+	case "contains":
+		if _, ok := cmp.Value.(string); !ok {
+			return nil, filterError(path+".value", "contains needs a string")
+		}
+	default:
+		if cmp.Value == nil {
+			return nil, filterError(path+".value", "is required")
+		}
+	}
+	return comparisonNode{field: cmp.Field, op: cmp.Op, value: cmp.Value}, nil
+}
+
+func knownFilterField(name string) bool {
+	if filterMetaFields[name] {
+		return true
+	}
+	for _, category := range Categories {
+		if _, ok := category.Column(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func filterError(path, message string) error {
+	return fmt.Errorf("%w: %s %s", ErrInvalidFilter, path, message)
+}
+
+func strictUnmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func stringSet(values []string, foldCase bool) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if foldCase {
+			v = strings.ToLower(v)
+		}
+		set[v] = true
+	}
+	return set
+}
+
+type allNode []filterNode
+
+func (n allNode) match(e *FilterEvent) bool {
+	for _, child := range n {
+		if !child.match(e) {
+			return false
+		}
+	}
+	return true
+}
+
+type anyNode []filterNode
+
+func (n anyNode) match(e *FilterEvent) bool {
+	for _, child := range n {
+		if child.match(e) {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct {
+	child filterNode
+}
+
+func (n notNode) match(e *FilterEvent) bool {
+	return !n.child.match(e)
+}
+
+type addressNode struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+func (n addressNode) match(e *FilterEvent) bool {
+	if e.Category == nil || len(e.Category.AddressColumns) == 0 {
+		return false
+	}
+	allowed := len(n.allow) == 0
+	for _, column := range e.Category.AddressColumns {
+		address, _ := e.Fields[column].(string)
+		if n.deny[address] {
+			return false
+		}
+		if n.allow[address] {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+type amountNode struct {
+	min, max *float64
+}
+
+func (n amountNode) match(e *FilterEvent) bool {
+	if e.Category == nil || e.Category.AmountColumn == "" {
+		return false
+	}
+	amount, ok := numericField(e.Fields, e.Category.AmountColumn)
+	if !ok {
+		return false
+	}
+	return (n.min == nil || amount >= *n.min) && (n.max == nil || amount <= *n.max)
+}
+
+type matchNode struct {
+	kind   string
+	values map[string]bool
+}
+
+func (n matchNode) match(e *FilterEvent) bool {
+	var column string
+	switch n.kind {
+	case "category":
+		column = "category"
+	case "marketplace":
+		if e.Category != nil {
+			column = e.Category.MarketplaceColumn
+		}
+	case "platform":
+		if e.Category != nil {
+			column = e.Category.PlatformColumn
+		}
+	}
+	if column == "" {
+		return false
+	}
+
+	value, _ := e.Fields[column].(string)
+	if n.kind != "category" {
+		value = strings.ToLower(value)
+	}
+	return n.values[value]
+}
+
+type comparisonNode struct {
+	field string
+	op    string
+	value interface{}
+}
+
+func (n comparisonNode) match(e *FilterEvent) bool {
+	actual, ok := e.Fields[n.field]
+	if !ok || actual == nil {
+		return false
+	}
+
+	switch n.op {
+	case "eq":
+		return filterValuesEqual(actual, n.value)
+	case "ne":
+		return !filterValuesEqual(actual, n.value)
+	case "in", "not_in":
+		found := false
+		for _, candidate := range n.value.([]interface{}) {
+			if filterValuesEqual(actual, candidate) {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in")
+	case "contains":
+		s, ok := actual.(string)
+		return ok && strings.Contains(strings.ToLower(s), strings.ToLower(n.value.(string)))
+	}
+
+	number, ok := actual.(float64)
+	if !ok {
+		return false
+	}
+	threshold := n.value.(float64)
+	switch n.op {
+	case "gt":
+		return number > threshold
+	case "gte":
+		return number >= threshold
+	case "lt":
+		return number < threshold
+	case "lte":
+		return number <= threshold
+	}
+	return false
+}
+
+func filterValuesEqual(a, b interface{}) bool {
+	if x, ok := a.(float64); ok {
+		y, ok := b.(float64)
+		return ok && x == y
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// FilterService applies each organization's custom filter and counts how
+// many events it kept and dropped. Counts are buffered in memory and
+// flushed to FilterStats periodically.
+type FilterService struct {
+	db     *gorm.DB
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	filters map[uint]*compiledFilter
+	pending map[uint]*models.FilterStats
+}
+
+type compiledFilter struct {
+	filter *Filter
+	source string
+}
+
+func NewFilterService(db *gorm.DB, logger *slog.Logger) *FilterService {
+	return &FilterService{
+		db:      db,
+		logger:  logger,
+		filters: make(map[uint]*compiledFilter),
+		pending: make(map[uint]*models.FilterStats),
+	}
+}
+
+// Check reports whether event passes orgID's custom filter. Organizations
+// without a filter keep every event and are not counted.
+func (s *FilterService) Check(orgID uint, event *models.WebhookEvent, collection string) (bool, error) {
+	var pref models.IndexingPreference
+	err := s.db.Select("custom_filters").Where("organization_id = ?", orgID).First(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load custom filters: %w", err)
+	}
+
+	filter, err := s.compiled(orgID, pref.CustomFilters)
+	if err != nil {
+		return false, err
+	}
+	if filter.root == nil {
+		return true, nil
+	}
+
+	filterEvent, err := NewFilterEvent(event, collection)
+	if err != nil {
+		return false, err
+	}
+	matched := filter.Match(filterEvent)
+	s.count(orgID, matched)
+	return matched, nil
+}
+
+// compiled returns orgID's parsed filter, reparsing when its source changes
+func (s *FilterService) compiled(orgID uint, source string) (*Filter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached, ok := s.filters[orgID]; ok && cached.source == source {
+		return cached.filter, nil
+	}
+	filter, err := ParseFilter(source)
+	if err != nil {
+		return nil, err
+	}
+	s.filters[orgID] = &compiledFilter{filter: filter, source: source}
+	return filter, nil
+}
+
+func (s *FilterService) count(orgID uint, matched bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, ok := s.pending[orgID]
+	if !ok {
+		stats = &models.FilterStats{OrganizationID: orgID}
+		s.pending[orgID] = stats
+	}
+	if matched {
+		stats.Hits++
+	} else {
+		stats.Misses++
+	}
+}
+
+// Run flushes counts periodically until ctx is done, then flushes once more
+func (s *FilterService) Run(ctx context.Context) {
+	ticker := time.NewTicker(filterStatsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(); err != nil {
+				s.logger.Error("failed to flush filter stats", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				s.logger.Error("failed to flush filter stats", "error", err)
+			}
+		}
+	}
+}
+
+// Flush adds buffered counts to the stored totals. Counts of organizations
+// that fail to flush are kept for the next flush and don't hold up others.
+func (s *FilterService) Flush() error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[uint]*models.FilterStats)
+	s.mu.Unlock()
+
+	var errs []error
+	for orgID, stats := range pending {
+		err := s.db.Exec(`INSERT INTO filter_stats (organization_id, hits, misses, updated_at)
+			VALUES (?, ?, ?, NOW())
+			ON CONFLICT (organization_id) DO UPDATE SET
+				hits = filter_stats.hits + EXCLUDED.hits,
+				misses = filter_stats.misses + EXCLUDED.misses,
+				updated_at = EXCLUDED.updated_at`,
+			orgID, stats.Hits, stats.Misses).Error
+		if err != nil {
+			// Put the counts back so they are retried on the next flush
+			s.mu.Lock()
+			if current, ok := s.pending[orgID]; ok {
+				current.Hits += stats.Hits
+				current.Misses += stats.Misses
+			} else {
+				s.pending[orgID] = stats
+			}
+			s.mu.Unlock()
+			errs = append(errs, fmt.Errorf("failed to flush filter stats of organization %d: %w", orgID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns orgID's filter counts, including those not yet flushed
+func (s *FilterService) Stats(orgID uint) (*models.FilterStats, error) {
+	stats := models.FilterStats{OrganizationID: orgID}
+	err := s.db.Where("organization_id = ?", orgID).First(&stats).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load filter stats: %w", err)
+	}
+
+	s.mu.Lock()
+	if pending, ok := s.pending[orgID]; ok {
+		stats.Hits += pending.Hits
+		stats.Misses += pending.Misses
+	}
+	s.mu.Unlock()
+	return &stats, nil
+}
+
+// ResetStats clears orgID's counters, typically after the filter changes
+func (s *FilterService) ResetStats(orgID uint) error {
+	s.mu.Lock()
+	delete(s.pending, orgID)
+	s.mu.Unlock()
+
+	if err := s.db.Where("organization_id = ?", orgID).Delete(&models.FilterStats{}).Error; err != nil {
+		return fmt.Errorf("failed to reset filter stats: %w", err)
+	}
+	return nil
+}
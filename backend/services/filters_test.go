@@ -0,0 +1,200 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func filterEvent(t *testing.T, eventType, payload string) *FilterEvent {
+	t.Helper()
+	e, err := NewFilterEvent(&models.WebhookEvent{EventType: eventType, AccountKey: "Acct111", Payload: payload}, "mad_lads")
+	if err != nil {
+		t.Fatalf("NewFilterEvent: %v", err)
+	}
+	return e
+}
+
+func TestParseFilterRejectsInvalidDocuments(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   string
+	}{
+		{"not json", `{"all": [`, ""},
+		{"not an object", `[]`, "filter must be an object"},
+		{"two keys", `{"not": {"category": ["nft_bids"]}, "category": ["nft_bids"]}`, "must have exactly one key, got category, not"},
+		{"unknown node", `{"nope": 1}`, "filter.nope unknown filter"},
+		{"empty all", `{"all": []}`, "filter.all must be a non-empty array"},
+		{"empty child", `{"any": [{}]}`, "filter.any[0] must not be empty"},
+		{"empty not", `{"not": {}}`, "filter.not must not be empty"},
+		{"address without lists", `{"address": {}}`, "needs an allow or deny list"},
+		{"address unknown key", `{"address": {"only": ["a"]}}`, "must be {\"allow\""},
+		{"amount without bounds", `{"amount": {}}`, "needs min or max"},
+		{"amount inverted", `{"amount": {"min": 5, "max": 1}}`, "min must not exceed max"},
+		{"unknown category", `{"category": ["nft_mints"]}`, "unknown category nft_mints"},
+		{"empty marketplace", `{"marketplace": []}`, "must be a non-empty array of strings"},
+		{"unknown field", `{"field": "owner", "op": "eq", "value": "x"}`, "filter.field unknown field owner"},
+		{"unknown operator", `{"field": "apy", "op": "between", "value": 1}`, "filter.op unknown operator between"},
+		{"extra comparison key", `{"field": "apy", "op": "gt", "value": 1, "unit": "%"}`, "comparisons take only field, op and value"},
+		{"in without array", `{"field": "market", "op": "in", "value": "x"}`, "in needs an array"},
+		{"gt without number", `{"field": "apy", "op": "gt", "value": "5"}`, "gt needs a number"},
+		{"contains without string", `{"field": "market", "op": "contains", "value": 1}`, "contains needs a string"},
+		{"eq without value", `{"field": "market", "op": "eq"}`, "filter.value is required"},
+		{"nested error path", `{"all": [{"category": ["nft_bids"]}, {"not": {"amount": {}}}]}`, "filter.all[1].not.amount needs min or max"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFilter(tt.filter)
+			if !errors.Is(err, ErrInvalidFilter) {
+				t.Fatalf("ParseFilter(%s) = %v, want ErrInvalidFilter", tt.filter, err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseFilter(%s) = %q, want it to mention %q", tt.filter, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyFilterMatchesEverything(t *testing.T) {
+	e := filterEvent(t, "nft_bid", `{"amount": 1}`)
+	for _, raw := range []string{"", "  ", "{}"} {
+		f, err := ParseFilter(raw)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", raw, err)
+		}
+		if !f.Match(e) {
+			t.Errorf("ParseFilter(%q) doesn't match", raw)
+		}
+	}
+	var f *Filter
+	if !f.Match(e) {
+		t.Error("nil filter doesn't match")
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	bid := `{"nft_address": "Nft111", "bidder": "Bidder111", "amount": 12.5, "timestamp": "2024-05-01T00:00:00Z"}`
+	borrow := `{"token_address": "Tok111", "amount": 300, "apy": 4.2, "platform": "Solend", "timestamp": "2024-05-01T00:00:00Z"}`
+	price := `{"nft_address": "Nft111", "price": 7, "market": "Magic_Eden", "timestamp": "2024-05-01T00:00:00Z"}`
+
+	tests := []struct {
+		name      string
+		filter    string
+		eventType string
+		payload   string
+		want      bool
+	}{
+		{"category", `{"category": ["nft_bids", "nft_prices"]}`, "nft_bid", bid, true},
+		{"other category", `{"category": ["nft_bids"]}`, "token_borrow", borrow, false},
+
+		{"address allowed", `{"address": {"allow": ["Bidder111"]}}`, "nft_bid", bid, true},
+		{"address not allowed", `{"address": {"allow": ["Other111"]}}`, "nft_bid", bid, false},
+		{"address denied", `{"address": {"allow": ["Nft111"], "deny": ["Bidder111"]}}`, "nft_bid", bid, false},
+		{"address deny only", `{"address": {"deny": ["Other111"]}}`, "nft_bid", bid, true},
+
+		{"amount within", `{"amount": {"min": 10, "max": 12.5}}`, "nft_bid", bid, true},
+		{"amount below", `{"amount": {"min": 13}}`, "nft_bid", bid, false},
+		{"amount uses the category's column", `{"amount": {"max": 7}}`, "nft_price", price, true},
+
+		{"marketplace folds case", `{"marketplace": ["magic_eden"]}`, "nft_price", price, true},
+		{"marketplace on a category without one", `{"marketplace": ["magic_eden"]}`, "nft_bid", bid, false},
+		{"platform", `{"platform": ["SOLEND"]}`, "token_borrow", borrow, true},
+
+		{"eq number", `{"field": "apy", "op": "eq", "value": 4.2}`, "token_borrow", borrow, true},
+		{"eq number against text", `{"field": "apy", "op": "eq", "value": "4.2"}`, "token_borrow", borrow, false},
+		{"ne", `{"field": "platform", "op": "ne", "value": "Solend"}`, "token_borrow", borrow, false},
+		{"gte", `{"field": "apy", "op": "gte", "value": 4.2}`, "token_borrow", borrow, true},
+		{"lt", `{"field": "apy", "op": "lt", "value": 4.2}`, "token_borrow", borrow, false},
+		{"gt on text", `{"field": "platform", "op": "gt", "value": 1}`, "token_borrow", borrow, false},
+		{"in", `{"field": "bidder", "op": "in", "value": ["A", "Bidder111"]}`, "nft_bid", bid, true},
+		{"not_in", `{"field": "bidder", "op": "not_in", "value": ["A", "Bidder111"]}`, "nft_bid", bid, false},
+		{"contains folds case", `{"field": "market", "op": "contains", "value": "EDEN"}`, "nft_price", price, true},
+		{"missing field", `{"field": "apy", "op": "ne", "value": 1}`, "nft_bid", bid, false},
+		{"meta fields", `{"all": [{"field": "account_key", "op": "eq", "value": "Acct111"}, {"field": "collection", "op": "eq", "value": "mad_lads"}, {"field": "event_type", "op": "eq", "value": "nft_bid"}]}`, "nft_bid", bid, true},
+
+		{"not", `{"not": {"category": ["nft_bids"]}}`, "nft_bid", bid, false},
+		{"all fails on one", `{"all": [{"category": ["nft_bids"]}, {"amount": {"min": 100}}]}`, "nft_bid", bid, false},
+		{"any passes on one", `{"any": [{"category": ["token_borrows"]}, {"amount": {"min": 10}}]}`, "nft_bid", bid, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter(%s): %v", tt.filter, err)
+			}
+			if got := f.Match(filterEvent(t, tt.eventType, tt.payload)); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterDocumentExample(t *testing.T) {
+	// The example from the language description
+	f, err := ParseFilter(`{"any": [
+	  {"all": [
+	    {"category": ["nft_bids"]},
+	    {"amount": {"min": 10}},
+	    {"address": {"deny": ["BadBidder111"]}}
+	  ]},
+	  {"platform": ["solend"]}
+	]}`)
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+
+	tests := []struct {
+		eventType string
+		payload   string
+		want      bool
+	}{
+		{"nft_bid", `{"nft_address": "Nft111", "bidder": "Bidder111", "amount": 10}`, true},
+		{"nft_bid", `{"nft_address": "Nft111", "bidder": "BadBidder111", "amount": 50}`, false},
+		{"nft_bid", `{"nft_address": "Nft111", "bidder": "Bidder111", "amount": 9.99}`, false},
+		{"token_borrow", `{"token_address": "Tok111", "amount": 1, "platform": "Solend"}`, true},
+		{"token_borrow", `{"token_address": "Tok111", "amount": 1, "platform": "Kamino"}`, false},
+	}
+	for _, tt := range tests {
+		if got := f.Match(filterEvent(t, tt.eventType, tt.payload)); got != tt.want {
+			t.Errorf("Match(%s %s) = %v, want %v", tt.eventType, tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestFlushKeepsGoingAndKeepsFailedCounts(t *testing.T) {
+	db := dryRunDB(t)
+	errUpsert := errors.New("upsert failed")
+	var flushed []uint
+	err := db.Callback().Raw().Before("gorm:raw").Register("test:fail", func(tx *gorm.DB) {
+		orgID := tx.Statement.Vars[0].(uint)
+		if orgID == 2 {
+			tx.AddError(errUpsert)
+			return
+		}
+		flushed = append(flushed, orgID)
+	})
+	if err != nil {
+		t.Fatalf("failed to register callback: %v", err)
+	}
+	s := NewFilterService(db, testLogger())
+	for orgID := uint(1); orgID <= 3; orgID++ {
+		s.count(orgID, true)
+		s.count(orgID, false)
+	}
+
+	err = s.Flush()
+	if !errors.Is(err, errUpsert) {
+		t.Fatalf("Flush = %v, want the upsert error", err)
+	}
+	if len(flushed) != 2 {
+		t.Errorf("flushed organizations %v, want 1 and 3 despite 2 failing", flushed)
+	}
+	s.count(2, true)
+	if len(s.pending) != 1 || s.pending[2].Hits != 2 || s.pending[2].Misses != 1 {
+		t.Errorf("pending after a failed flush = %v, want organization 2's counts kept and added to", s.pending)
+	}
+}
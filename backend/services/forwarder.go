@@ -0,0 +1,371 @@
+package services
+
+import (
+	"backend/models"
+	"backend/tracing"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Headers sent with every forwarded event
+const (
+	SignatureHeader       = "X-HelixScan-Signature"
+	EventIDHeader         = "X-HelixScan-Event-ID"
+	DeliveryIDHeader      = "X-HelixScan-Delivery-ID"
+	DeliveryAttemptHeader = "X-HelixScan-Delivery-Attempt"
+)
+
+const (
+	deliveryTimeout      = 10 * time.Second
+	deliveryPollInterval = 5 * time.Second
+	deliveryPollBatch    = 100
+	retryBaseDelay       = 10 * time.Second
+	retryMaxDelay        = time.Hour
+	// How long a claimed delivery is held before another worker may retry it
+	deliveryLease = time.Minute
+	// Consecutive failed attempts after which a destination is disabled
+	destinationFailureLimit = 20
+	// Bytes of the response body kept in the delivery log
+	responseBodyLogLimit = 1024
+)
+
+// Forwarder delivers processed events to customer destinations, retrying
+// failed deliveries with exponential backoff
+type Forwarder struct {
+	db          *gorm.DB
+	client      *http.Client
+	pool        *WorkerPool
+	maxAttempts int
+	logger      *slog.Logger
+}
+
+func NewForwarder(db *gorm.DB, workers, maxAttempts int, logger *slog.Logger) *Forwarder {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	return &Forwarder{
+		db:          db,
+		client:      newPublicClient(deliveryTimeout),
+		pool:        NewWorkerPool("forwarder", workers, workers*64),
+		maxAttempts: maxAttempts,
+		logger:      logger,
+	}
+}
+
+// Pool returns the worker pool deliveries run on
+func (f *Forwarder) Pool() *WorkerPool {
+	return f.pool
+}
+
+// Enqueue creates a delivery for every active destination of the event's
+// organization that subscribes to its category
+func (f *Forwarder) Enqueue(ctx context.Context, e StreamEvent) error {
+	var destinations []models.Destination
+	if err := f.db.WithContext(ctx).Where("organization_id = ? AND is_active = ?", e.OrganizationID, true).
+		Find(&destinations).Error; err != nil {
+		return fmt.Errorf("failed to load destinations: %w", err)
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	now := time.Now()
+	traceParent := tracing.Inject(ctx)
+	for _, destination := range destinations {
+		if !destinationAccepts(&destination, e.Category) {
+			continue
+		}
+		delivery := &models.Delivery{
+			DestinationID: destination.ID,
+			EventID:       e.ID,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &now,
+			TraceParent:   traceParent,
+		}
+		if err := f.db.WithContext(ctx).Create(delivery).Error; err != nil {
+			return fmt.Errorf("failed to create delivery: %w", err)
+		}
+		f.dispatch(delivery.ID)
+	}
+	return nil
+}
+
+// Run picks up due retries until ctx is done, along with deliveries whose
+// lease ran out because the process sending them died
+func (f *Forwarder) Run(ctx context.Context) {
+	ticker := time.NewTicker(deliveryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var ids []uint
+			err := f.db.Model(&models.Delivery{}).
+				Where("status IN ? AND next_attempt_at <= ?", []string{models.DeliveryPending, models.DeliverySending}, time.Now()).
+				Order("next_attempt_at").
+				Limit(deliveryPollBatch).
+				Pluck("id", &ids).Error
+			if err != nil {
+				f.logger.Error("failed to poll pending deliveries", "error", err)
+				continue
+			}
+			for _, id := range ids {
+				f.dispatch(id)
+			}
+		}
+	}
+}
+
+// dispatch hands a delivery to the worker pool. If the queue is full the
+// delivery stays pending and is picked up by the next poll.
+func (f *Forwarder) dispatch(deliveryID uint) {
+	f.pool.Submit(func(ctx context.Context) {
+		f.deliver(ctx, deliveryID)
+	})
+}
+
+// deliver makes one attempt at a pending delivery
+func (f *Forwarder) deliver(ctx context.Context, deliveryID uint) {
+	// Lease the delivery so concurrent polls and replicas don't send it
+	// twice. While sending, next_attempt_at holds the lease's expiry.
+	now := time.Now()
+	claim := f.db.Model(&models.Delivery{}).
+		Where("id = ? AND status IN ? AND next_attempt_at <= ?",
+			deliveryID, []string{models.DeliveryPending, models.DeliverySending}, now).
+		Updates(map[string]interface{}{"status": models.DeliverySending, "next_attempt_at": now.Add(deliveryLease)})
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return
+	}
+
+	var delivery models.Delivery
+	if err := f.db.First(&delivery, deliveryID).Error; err != nil {
+		return
+	}
+	// Retries run long after the request that queued them; carry its trace
+	ctx = tracing.Extract(ctx, delivery.TraceParent)
+	var destination models.Destination
+	if err := f.db.First(&destination, delivery.DestinationID).Error; err != nil || !destination.IsActive {
+		f.db.Model(&delivery).Updates(map[string]interface{}{
+			"status":          models.DeliveryFailed,
+			"next_attempt_at": nil,
+			"last_error":      "destination is disabled",
+		})
+		return
+	}
+
+	attempt := f.send(ctx, &destination, &delivery)
+	if attempt.Error == "" {
+		now := time.Now()
+		f.db.Model(&delivery).Updates(map[string]interface{}{
+			"status":          models.DeliverySucceeded,
+			"attempts":        attempt.Attempt,
+			"next_attempt_at": nil,
+			"delivered_at":    &now,
+			"last_error":      "",
+		})
+		destinationDeliveries.WithLabelValues("succeeded").Inc()
+		if destination.ConsecutiveFailures > 0 {
+			f.db.Model(&destination).Update("consecutive_failures", 0)
+		}
+		return
+	}
+
+	updates := map[string]interface{}{
+		"status":          models.DeliveryPending,
+		"attempts":        attempt.Attempt,
+		"next_attempt_at": time.Now().Add(retryDelay(attempt.Attempt)),
+		"last_error":      attempt.Error,
+	}
+	result := "retry"
+	if attempt.Attempt >= f.maxAttempts {
+		updates["status"] = models.DeliveryFailed
+		updates["next_attempt_at"] = nil
+		result = "failed"
+	}
+	f.db.Model(&delivery).Updates(updates)
+	destinationDeliveries.WithLabelValues(result).Inc()
+	f.recordFailure(&destination)
+}
+
+// recordFailure counts a failed attempt against a destination and disables
+// it once the limit is reached
+func (f *Forwarder) recordFailure(destination *models.Destination) {
+	f.db.Model(destination).Update("consecutive_failures", gorm.Expr("consecutive_failures + 1"))
+	f.db.First(destination, destination.ID)
+	if destination.ConsecutiveFailures < destinationFailureLimit || !destination.IsActive {
+		return
+	}
+
+	now := time.Now()
+	reason := fmt.Sprintf("disabled after %d consecutive failed deliveries", destination.ConsecutiveFailures)
+	f.db.Model(destination).Updates(map[string]interface{}{
+		"is_active":       false,
+		"disabled_at":     &now,
+		"disabled_reason": reason,
+	})
+	f.db.Model(&models.Delivery{}).
+		Where("destination_id = ? AND status = ?", destination.ID, models.DeliveryPending).
+		Updates(map[string]interface{}{
+			"status":          models.DeliveryFailed,
+			"next_attempt_at": nil,
+			"last_error":      "destination is disabled",
+		})
+	f.logger.Warn("destination disabled", "destination_id", destination.ID, "reason", reason)
+}
+
+// TestDelivery sends a sample event to a destination once, without retries
+// and without counting against the destination's failure limit
+func (f *Forwarder) TestDelivery(ctx context.Context, destination *models.Destination) (*models.Delivery, error) {
+	event := StreamEvent{
+		OrganizationID: destination.OrganizationID,
+		Category:       "test",
+		EventType:      "test",
+		Timestamp:      time.Now().UTC(),
+		Data:           json.RawMessage(`{"message":"This is a test delivery from HelixScan"}`),
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	delivery := &models.Delivery{
+		DestinationID: destination.ID,
+		Payload:       string(payload),
+		Status:        models.DeliverySending,
+		Test:          true,
+	}
+	if err := f.db.Create(delivery).Error; err != nil {
+		return nil, fmt.Errorf("failed to create delivery: %w", err)
+	}
+
+	attempt := f.send(ctx, destination, delivery)
+	delivery.Attempts = attempt.Attempt
+	delivery.LastError = attempt.Error
+	delivery.Status = models.DeliveryFailed
+	if attempt.Error == "" {
+		now := time.Now()
+		delivery.Status = models.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	}
+	if err := f.db.Save(delivery).Error; err != nil {
+		return nil, fmt.Errorf("failed to update delivery: %w", err)
+	}
+	delivery.AttemptLog = []models.DeliveryAttempt{attempt}
+	return delivery, nil
+}
+
+// send POSTs the delivery's payload and records the attempt
+func (f *Forwarder) send(ctx context.Context, destination *models.Destination, delivery *models.Delivery) models.DeliveryAttempt {
+	attempt := models.DeliveryAttempt{
+		DeliveryID: delivery.ID,
+		Attempt:    delivery.Attempts + 1,
+	}
+
+	ctx, span := tracing.Start(ctx, "forwarder.deliver", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.Int64("helixscan.delivery_id", int64(delivery.ID)),
+		attribute.Int64("helixscan.destination_id", int64(destination.ID)),
+		attribute.Int("helixscan.attempt", attempt.Attempt),
+	))
+	start := time.Now()
+	statusCode, body, err := f.post(ctx, destination, delivery, attempt.Attempt)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	attempt.StatusCode = statusCode
+	attempt.ResponseBody = body
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	tracing.End(span, err)
+
+	if err := f.db.Create(&attempt).Error; err != nil {
+		f.logger.Error("failed to record delivery attempt", "delivery_id", delivery.ID, "error", err)
+	}
+	return attempt
+}
+
+func (f *Forwarder) post(ctx context.Context, destination *models.Destination, delivery *models.Delivery, attempt int) (int, string, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, destination.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "HelixScan-Webhooks/1.0")
+	req.Header.Set(SignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(destination.Secret, timestamp, body)))
+	req.Header.Set(EventIDHeader, strconv.FormatUint(uint64(delivery.EventID), 10))
+	req.Header.Set(DeliveryIDHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(DeliveryAttemptHeader, strconv.Itoa(attempt))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, responseBodyLogLimit))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+// Sign computes the hex HMAC-SHA256 of "<timestamp>.<body>" with secret.
+// Receivers recompute it from the t= value of the signature header.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay doubles from retryBaseDelay per attempt, capped at retryMaxDelay,
+// with up to 20% jitter so retries to one endpoint spread out
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// destinationAccepts reports whether a destination subscribes to category
+func destinationAccepts(destination *models.Destination, category string) bool {
+	if destination.Categories == "" {
+		return true
+	}
+	for _, name := range strings.Split(destination.Categories, ",") {
+		if strings.TrimSpace(name) == category {
+			return true
+		}
+	}
+	return false
+}
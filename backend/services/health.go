@@ -0,0 +1,222 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const healthCheckTimeout = 3 * time.Second
+
+// Component states reported by health checks
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// ComponentHealth is the result of checking one dependency
+type ComponentHealth struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// PoolStatus describes a worker pool
+type PoolStatus struct {
+	Name       string `json:"name"`
+	Running    bool   `json:"running"`
+	QueueDepth int    `json:"queue_depth"`
+}
+
+// TenantDBHealth describes an organization's database connection pool
+type TenantDBHealth struct {
+	ComponentHealth
+	Driver          string `json:"driver"`
+	OpenConnections int    `json:"open_connections"`
+	InUse           int    `json:"in_use"`
+	Idle            int    `json:"idle"`
+}
+
+// Readiness is the result of a readiness check
+type Readiness struct {
+	Status string                     `json:"status"`
+	Checks map[string]ComponentHealth `json:"checks"`
+	Ready  bool                       `json:"-"`
+}
+
+// SystemStatus is the detailed status reported to organization admins
+type SystemStatus struct {
+	Status                      string          `json:"status"`
+	PlatformDB                  ComponentHealth `json:"platform_db"`
+	HeliusAPI                   ComponentHealth `json:"helius_api"`
+	TenantDB                    TenantDBHealth  `json:"tenant_db"`
+	WorkerPools                 []PoolStatus    `json:"worker_pools"`
+	UnprocessedEvents           int64           `json:"unprocessed_events"`
+	OldestUnprocessedAgeSeconds float64         `json:"oldest_unprocessed_age_seconds"`
+}
+
+// HealthService answers liveness, readiness and status checks
+type HealthService struct {
+	db        *gorm.DB
+	tenants   *TenantDBManager
+	apiClient *HeliusAPIClient
+	pools     []*WorkerPool
+	migrated  atomic.Bool
+	draining  atomic.Bool
+}
+
+func NewHealthService(db *gorm.DB, tenants *TenantDBManager, apiClient *HeliusAPIClient, pools ...*WorkerPool) *HealthService {
+	return &HealthService{
+		db:        db,
+		tenants:   tenants,
+		apiClient: apiClient,
+		pools:     pools,
+	}
+}
+
+// MarkMigrated records that the platform schema is up to date
+func (s *HealthService) MarkMigrated() {
+	s.migrated.Store(true)
+}
+
+// MarkDraining records that the instance is shutting down, so load
+// balancers stop sending it traffic
+func (s *HealthService) MarkDraining() {
+	s.draining.Store(true)
+}
+
+// Ready reports whether the instance can serve traffic: it isn't shutting
+// down, the platform database answers, migrations have run and every
+// worker pool is running
+func (s *HealthService) Ready(ctx context.Context) *Readiness {
+	r := &Readiness{Checks: make(map[string]ComponentHealth), Ready: true}
+
+	r.Checks["database"] = s.checkDB(ctx, s.db)
+
+	r.Checks["migrations"] = ComponentHealth{Status: HealthOK}
+	if !s.migrated.Load() {
+		r.Checks["migrations"] = ComponentHealth{Status: HealthDown, Error: "migrations not applied"}
+	}
+
+	r.Checks["shutdown"] = ComponentHealth{Status: HealthOK}
+	if s.draining.Load() {
+		r.Checks["shutdown"] = ComponentHealth{Status: HealthDown, Error: "shutting down"}
+	}
+
+	r.Checks["workers"] = ComponentHealth{Status: HealthOK}
+	for _, pool := range s.pools {
+		if !pool.Running() {
+			r.Checks["workers"] = ComponentHealth{Status: HealthDown, Error: pool.Name() + " is stopped"}
+			break
+		}
+	}
+
+	r.Status = HealthOK
+	for _, check := range r.Checks {
+		if check.Status != HealthOK {
+			r.Status = HealthDown
+			r.Ready = false
+		}
+	}
+	return r
+}
+
+// Status reports the health of the platform's dependencies and of orgID's
+// pipeline: its database, its backlog and the age of its oldest
+// unprocessed event
+func (s *HealthService) Status(ctx context.Context, orgID uint) *SystemStatus {
+	status := &SystemStatus{
+		PlatformDB: s.checkDB(ctx, s.db),
+		HeliusAPI:  s.checkHelius(ctx),
+		TenantDB:   s.checkTenantDB(ctx, orgID),
+	}
+
+	for _, pool := range s.pools {
+		status.WorkerPools = append(status.WorkerPools, PoolStatus{
+			Name:       pool.Name(),
+			Running:    pool.Running(),
+			QueueDepth: pool.QueueDepth(),
+		})
+	}
+
+	webhooks := s.db.Model(&models.HeliusWebhook{}).Select("id").Where("organization_id = ?", orgID)
+	s.db.WithContext(ctx).Model(&models.WebhookEvent{}).
+		Where("webhook_id IN (?) AND processed = ?", webhooks, false).
+		Count(&status.UnprocessedEvents)
+
+	var oldest models.WebhookEvent
+	err := s.db.WithContext(ctx).
+		Where("webhook_id IN (?) AND processed = ?", webhooks, false).
+		Order("created_at").
+		Limit(1).
+		Find(&oldest).Error
+	if err == nil && oldest.ID != 0 {
+		status.OldestUnprocessedAgeSeconds = time.Since(oldest.CreatedAt).Seconds()
+	}
+
+	status.Status = HealthOK
+	if status.PlatformDB.Status != HealthOK {
+		status.Status = HealthDown
+	} else if status.HeliusAPI.Status != HealthOK || status.TenantDB.Status != HealthOK {
+		status.Status = HealthDegraded
+	}
+	for _, pool := range status.WorkerPools {
+		if !pool.Running {
+			status.Status = HealthDown
+		}
+	}
+	return status
+}
+
+func (s *HealthService) checkDB(ctx context.Context, db *gorm.DB) ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	return componentHealth(start, err)
+}
+
+func (s *HealthService) checkHelius(ctx context.Context) ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	return componentHealth(start, s.apiClient.Ping(ctx))
+}
+
+func (s *HealthService) checkTenantDB(ctx context.Context, orgID uint) TenantDBHealth {
+	start := time.Now()
+	db, err := s.tenants.ForOrganization(orgID)
+	if err != nil {
+		return TenantDBHealth{ComponentHealth: componentHealth(start, err)}
+	}
+
+	health := TenantDBHealth{
+		ComponentHealth: s.checkDB(ctx, db),
+		Driver:          db.Dialector.Name(),
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		stats := sqlDB.Stats()
+		health.OpenConnections = stats.OpenConnections
+		health.InUse = stats.InUse
+		health.Idle = stats.Idle
+	}
+	return health
+}
+
+func componentHealth(start time.Time, err error) ComponentHealth {
+	health := ComponentHealth{Status: HealthOK, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		health.Status = HealthDown
+		health.Error = err.Error()
+	}
+	return health
+}
@@ -2,113 +2,187 @@ package services
 
 import (
 	"backend/models"
+	"backend/tracing"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
+	"log/slog"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
 type HeliusService struct {
 	db            *gorm.DB
-	heliusApiKey  string
 	dataProcessor *DataProcessor
-	apiClient     *HeliusAPIClient
+	hub           *Hub
+	forwarder     *Forwarder
+	alerts        *AlertService
+	filters       *FilterService
+	logger        *slog.Logger
 }
 
-func NewHeliusService(db *gorm.DB, apiKey string) *HeliusService {
+func NewHeliusService(db *gorm.DB, sinks *SinkManager, hub *Hub, forwarder *Forwarder, alerts *AlertService, filters *FilterService, logger *slog.Logger) *HeliusService {
 	return &HeliusService{
 		db:            db,
-		heliusApiKey:  apiKey,
-		dataProcessor: NewDataProcessor(db),
-		apiClient:     NewHeliusAPIClient(apiKey),
+		dataProcessor: NewDataProcessor(sinks, logger),
+		hub:           hub,
+		forwarder:     forwarder,
+		alerts:        alerts,
+		filters:       filters,
+		logger:        logger,
 	}
 }
 
-// RegisterWebhook creates a new webhook configuration for a user
-func (s *HeliusService) RegisterWebhook(userID uint, accountKeys []string, eventTypes []string) (*models.HeliusWebhook, error) {
-	// Create webhook configuration in Helius
-	webhookURL := fmt.Sprintf("%s/webhooks/helius", "https://your-api-domain.com") // Replace with your actual domain
-
-	// Register webhook with Helius API
-	resp, err := s.apiClient.RegisterWebhook(WebhookRegistrationRequest{
-		WebhookURL:       webhookURL,
-		AccountAddresses: accountKeys,
-		EventTypes:       eventTypes,
-		AuthHeader:       "Bearer " + s.heliusApiKey, // Add auth header for webhook security
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to register webhook with Helius: %w", err)
-	}
-
-	// Create webhook record in database
-	webhook := &models.HeliusWebhook{
-		UserID:      userID,
-		WebhookURL:  webhookURL,
-		WebhookID:   resp.WebhookID,
-		AccountKeys: strings.Join(accountKeys, ","), // Store as comma-separated string
-		EventTypes:  strings.Join(eventTypes, ","),  // Store as comma-separated string
-		IsActive:    true,
-	}
-
-	result := s.db.Create(webhook)
-	if result.Error != nil {
-		return nil, fmt.Errorf("failed to store webhook in database: %w", result.Error)
-	}
-
-	return webhook, nil
-}
-
 // ProcessWebhookEvent handles incoming webhook events from Helius
-func (s *HeliusService) ProcessWebhookEvent(event *models.WebhookEvent) error {
+func (s *HeliusService) ProcessWebhookEvent(ctx context.Context, event *models.WebhookEvent) (err error) {
+	ctx, span := tracing.Start(ctx, "helius.process_event", trace.WithAttributes(
+		attribute.Int64("helixscan.webhook_id", int64(event.WebhookID)),
+		attribute.String("helixscan.event_type", event.EventType),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	// Validate webhook exists and is active
 	var webhook models.HeliusWebhook
-	result := s.db.First(&webhook, event.WebhookID)
+	result := s.db.WithContext(ctx).First(&webhook, event.WebhookID)
 	if result.Error != nil {
+		s.logger.WarnContext(ctx, "event for unknown webhook", eventLogAttrs(event)...)
 		return errors.New("webhook not found")
 	}
 
 	if !webhook.IsActive {
+		s.logger.WarnContext(ctx, "event for inactive webhook", eventLogAttrs(event)...)
 		return errors.New("webhook is inactive")
 	}
 
 	// Store the event
 	event.Timestamp = time.Now()
-	result = s.db.Create(event)
+	result = s.db.WithContext(ctx).Create(event)
 	if result.Error != nil {
+		s.logger.ErrorContext(ctx, "failed to store event", append(eventLogAttrs(event), "error", result.Error)...)
 		return result.Error
 	}
+	span.SetAttributes(attribute.Int64("helixscan.event_id", int64(event.ID)))
+	logger := s.logger.With(eventLogAttrs(event)...)
+	logger.DebugContext(ctx, "event received", "organization_id", webhook.OrganizationID)
 
-	// Process the event based on type
-	switch event.EventType {
-	case "nft_bid":
-		return s.processNFTBid(event)
-	case "nft_price":
-		return s.processNFTPrice(event)
-	case "token_borrow":
-		return s.processTokenBorrow(event)
-	case "token_price":
-		return s.processTokenPrice(event)
-	default:
-		return fmt.Errorf("unsupported event type: %s", event.EventType)
-	}
+	return s.handle(ctx, &webhook, event, logger, ReprocessOptions{Notify: true})
 }
 
-// Helper functions for processing different event types
-func (s *HeliusService) processNFTBid(event *models.WebhookEvent) error {
-	return s.dataProcessor.ProcessNFTBid(event)
+// ReprocessOptions controls how a stored event is run again
+type ReprocessOptions struct {
+	// Publish the event to stream subscribers, alert rules and destinations
+	Notify bool
+	// Write to the database tables with this suffix instead of the live
+	// ones, leaving the event's recorded outcome untouched
+	TableSuffix string
 }
 
-func (s *HeliusService) processNFTPrice(event *models.WebhookEvent) error {
-	return s.dataProcessor.ProcessNFTPrice(event)
+// Reprocess runs a stored event through the current filter and processors
+// again, for example after a decoder fix
+func (s *HeliusService) Reprocess(ctx context.Context, event *models.WebhookEvent, opts ReprocessOptions) (err error) {
+	ctx, span := tracing.Start(ctx, "helius.reprocess_event", trace.WithAttributes(
+		attribute.Int64("helixscan.webhook_id", int64(event.WebhookID)),
+		attribute.Int64("helixscan.event_id", int64(event.ID)),
+		attribute.String("helixscan.event_type", event.EventType),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	var webhook models.HeliusWebhook
+	if err := s.db.WithContext(ctx).First(&webhook, event.WebhookID).Error; err != nil {
+		return fmt.Errorf("failed to load webhook: %w", err)
+	}
+	return s.handle(ctx, &webhook, event, s.logger.With(eventLogAttrs(event)...), opts)
 }
 
-func (s *HeliusService) processTokenBorrow(event *models.WebhookEvent) error {
-	return s.dataProcessor.ProcessTokenBorrow(event)
+// handle filters and stores a recorded event, records the outcome on it
+// and notifies subscribers, alert rules and destinations as opts ask
+func (s *HeliusService) handle(ctx context.Context, webhook *models.HeliusWebhook, event *models.WebhookEvent, logger *slog.Logger, opts ReprocessOptions) error {
+	span := trace.SpanFromContext(ctx)
+	// Shadow writes must not change what the live tables are said to hold
+	recordOutcome := func(updates map[string]interface{}) {
+		if opts.TableSuffix == "" {
+			s.db.WithContext(ctx).Model(event).Updates(updates)
+		}
+	}
+
+	// Apply the organization's custom filter before anything is written
+	eventType := eventTypeLabel(event.EventType)
+	keep, err := s.filters.Check(webhook.OrganizationID, event, payloadCollection(event.Payload))
+	if err != nil {
+		eventsProcessed.WithLabelValues(eventType, "failed").Inc()
+		logger.ErrorContext(ctx, "failed to apply custom filter", "error", err)
+		recordOutcome(map[string]interface{}{"error_message": err.Error()})
+		return err
+	}
+	if !keep {
+		span.SetAttributes(attribute.Bool("helixscan.filtered", true))
+		eventsProcessed.WithLabelValues(eventType, "filtered").Inc()
+		logger.DebugContext(ctx, "event dropped by custom filter")
+		recordOutcome(map[string]interface{}{
+			"processed":    true,
+			"processed_at": time.Now(),
+			"filtered":     true,
+		})
+		return nil
+	}
+
+	record, err := s.dataProcessor.Process(ctx, webhook, event, opts.TableSuffix)
+	if err != nil {
+		eventsProcessed.WithLabelValues(eventType, "failed").Inc()
+		logger.ErrorContext(ctx, "failed to process event", "error", err)
+		recordOutcome(map[string]interface{}{"error_message": err.Error()})
+		return err
+	}
+	eventsProcessed.WithLabelValues(eventType, "stored").Inc()
+	logger.InfoContext(ctx, "event processed")
+
+	if opts.TableSuffix != "" {
+		return nil
+	}
+	event.Processed = true
+	event.ProcessedAt = time.Now()
+	event.Filtered = false
+	event.ErrorMessage = ""
+	// Clears the outcome of any earlier attempt
+	recordOutcome(map[string]interface{}{
+		"processed":     true,
+		"processed_at":  event.ProcessedAt,
+		"filtered":      false,
+		"error_message": "",
+	})
+
+	if !opts.Notify {
+		return nil
+	}
+	streamEvent := NewStreamEvent(webhook, event, record)
+	s.hub.Publish(streamEvent)
+	s.alerts.Evaluate(ctx, streamEvent, record)
+	if err := s.forwarder.Enqueue(ctx, streamEvent); err != nil {
+		logger.ErrorContext(ctx, "failed to forward event", "error", err)
+	}
+	return nil
 }
 
-func (s *HeliusService) processTokenPrice(event *models.WebhookEvent) error {
-	return s.dataProcessor.ProcessTokenPrice(event)
+// eventLogAttrs identifies an event in log lines
+func eventLogAttrs(event *models.WebhookEvent) []any {
+	return []any{
+		"webhook_id", event.WebhookID,
+		"event_id", event.ID,
+		"event_type", event.EventType,
+		"signature", payloadSignature(event.Payload),
+	}
+}
+
+// payloadSignature returns the transaction signature Helius includes in
+// event payloads, if any
+func payloadSignature(payload string) string {
+	var fields struct {
+		Signature string `json:"signature"`
+	}
+	json.Unmarshal([]byte(payload), &fields)
+	return fields.Signature
 }
\ No newline at end of file
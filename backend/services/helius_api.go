@@ -1,15 +1,24 @@
 package services
 
 import (
+	"backend/tracing"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 type HeliusAPIClient struct {
 	apiKey  string
 	baseURL string
+	limiter *rate.Limiter
 }
 
 type WebhookRegistrationRequest struct {
@@ -23,15 +32,28 @@ type WebhookRegistrationResponse struct {
 	WebhookID string `json:"webhookID"`
 }
 
-func NewHeliusAPIClient(apiKey string) *HeliusAPIClient {
+// NewHeliusAPIClient creates a client for the Helius API at baseURL making
+// at most requestsPerSecond calls per second (unlimited if zero)
+func NewHeliusAPIClient(apiKey, baseURL string, requestsPerSecond float64) *HeliusAPIClient {
+	limit := rate.Inf
+	if requestsPerSecond > 0 {
+		limit = rate.Limit(requestsPerSecond)
+	}
 	return &HeliusAPIClient{
 		apiKey:  apiKey,
-		baseURL: "https://api.helius.xyz/v0",
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		limiter: rate.NewLimiter(limit, 1),
 	}
 }
 
 // RegisterWebhook registers a new webhook with Helius
-func (c *HeliusAPIClient) RegisterWebhook(req WebhookRegistrationRequest) (*WebhookRegistrationResponse, error) {
+func (c *HeliusAPIClient) RegisterWebhook(ctx context.Context, req WebhookRegistrationRequest) (_ *WebhookRegistrationResponse, err error) {
+	ctx, span := tracing.Start(ctx, "helius.register_webhook", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { tracing.End(span, err) }()
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limited: %w", err)
+	}
 	url := fmt.Sprintf("%s/webhooks", c.baseURL)
 
 	payload, err := json.Marshal(req)
@@ -39,7 +61,7 @@ func (c *HeliusAPIClient) RegisterWebhook(req WebhookRegistrationRequest) (*Webh
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -48,11 +70,15 @@ func (c *HeliusAPIClient) RegisterWebhook(req WebhookRegistrationRequest) (*Webh
 	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
 
 	client := &http.Client{}
+	start := time.Now()
 	resp, err := client.Do(httpReq)
 	if err != nil {
+		observeHeliusCall("register_webhook", start, 0)
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	observeHeliusCall("register_webhook", start, resp.StatusCode)
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
@@ -64,4 +90,72 @@ func (c *HeliusAPIClient) RegisterWebhook(req WebhookRegistrationRequest) (*Webh
 	}
 
 	return &response, nil
+}
+
+// EditWebhook replaces the configuration of an existing Helius webhook
+func (c *HeliusAPIClient) EditWebhook(ctx context.Context, webhookID string, req WebhookRegistrationRequest) (err error) {
+	ctx, span := tracing.Start(ctx, "helius.edit_webhook", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { tracing.End(span, err) }()
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limited: %w", err)
+	}
+	url := fmt.Sprintf("%s/webhooks/%s", c.baseURL, webhookID)
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		observeHeliusCall("edit_webhook", start, 0)
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	resp.Body.Close()
+	observeHeliusCall("edit_webhook", start, resp.StatusCode)
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Ping checks that the Helius API is reachable with the configured key
+func (c *HeliusAPIClient) Ping(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "helius.ping", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { tracing.End(span, err) }()
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limited: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/webhooks", c.baseURL), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		observeHeliusCall("ping", start, 0)
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	resp.Body.Close()
+	observeHeliusCall("ping", start, resp.StatusCode)
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
 }
\ No newline at end of file
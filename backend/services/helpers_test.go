@@ -0,0 +1,184 @@
+package services
+
+import (
+	"backend/migrations"
+	"backend/models"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunDB returns a Postgres DB that builds statements without running
+// them, for tests that record or fail them with callbacks
+func dryRunDB(tb testing.TB) *gorm.DB {
+	tb.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		tb.Fatalf("failed to open database: %v", err)
+	}
+	return db
+}
+
+// testDB returns a platform database on a fresh, migrated schema of the
+// Postgres database named by HELIXSCAN_TEST_DATABASE_URL, skipping the test
+// without one. Organizations without a DatabaseConfig keep their category
+// tables in it too.
+func testDB(tb testing.TB) *gorm.DB {
+	tb.Helper()
+	dsn := os.Getenv("HELIXSCAN_TEST_DATABASE_URL")
+	if dsn == "" {
+		tb.Skip("HELIXSCAN_TEST_DATABASE_URL is not set")
+	}
+
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		tb.Fatalf("invalid HELIXSCAN_TEST_DATABASE_URL: %v", err)
+	}
+	schema := fmt.Sprintf("services_test_%d", time.Now().UnixNano())
+	admin := stdlib.OpenDB(*config)
+	tb.Cleanup(func() { admin.Close() })
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		tb.Fatalf("failed to create schema: %v", err)
+	}
+	tb.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	config.RuntimeParams["search_path"] = schema
+	sqlDB := stdlib.OpenDB(*config)
+	tb.Cleanup(func() { sqlDB.Close() })
+	m, err := migrations.New(sqlDB)
+	if err != nil {
+		tb.Fatalf("failed to load migrations: %v", err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		tb.Fatalf("failed to migrate: %v", err)
+	}
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		tb.Fatalf("failed to open database: %v", err)
+	}
+	return db
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// testMailer keeps the messages it is asked to send
+type testMailer struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (m *testMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns the messages sent so far
+func (m *testMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
+
+var testWebhooks atomic.Int64
+
+// createTestOrganization stores an organization with the given number of
+// webhooks, returning the IDs of both
+func createTestOrganization(tb testing.TB, db *gorm.DB, webhooks int) (uint, []uint) {
+	tb.Helper()
+	org := models.Organization{Name: "test"}
+	if err := db.Create(&org).Error; err != nil {
+		tb.Fatalf("failed to create organization: %v", err)
+	}
+	ids := make([]uint, webhooks)
+	for i := range ids {
+		webhook := models.HeliusWebhook{
+			OrganizationID: org.ID,
+			WebhookID:      fmt.Sprintf("test-webhook-%d", testWebhooks.Add(1)),
+			EventTypes:     "NFT_BID",
+			IsActive:       true,
+		}
+		if err := db.Create(&webhook).Error; err != nil {
+			tb.Fatalf("failed to create webhook: %v", err)
+		}
+		ids[i] = webhook.ID
+	}
+	return org.ID, ids
+}
+
+// bidValues returns an nft_bids row in column order
+func bidValues(bidder string, amount interface{}, at time.Time) []interface{} {
+	return []interface{}{"Nft111", bidder, amount, at}
+}
+
+// countRows returns the number of rows in table
+func countRows(tb testing.TB, db *gorm.DB, table string) int64 {
+	tb.Helper()
+	var n int64
+	if err := db.Raw("SELECT COUNT(*) FROM " + table).Scan(&n).Error; err != nil {
+		tb.Fatalf("failed to count %s: %v", table, err)
+	}
+	return n
+}
+
+// testServices wires the services that store and replay events against a
+// test database, keeping category tables partitioned by interval
+type testServices struct {
+	tenants    *TenantDBManager
+	partitions *PartitionService
+	sinks      *SinkManager
+	helius     *HeliusService
+	replays    *ReplayService
+}
+
+func newTestServices(tb testing.TB, db *gorm.DB, interval string) *testServices {
+	tb.Helper()
+	s := &testServices{tenants: NewTenantDBManager(db, TenantPoolLimits{})}
+	s.partitions = NewPartitionService(db, s.tenants, interval, 1, 0, nil, 100, testLogger())
+	s.sinks = NewSinkManager(db, s.tenants, s.partitions, WriteBatching{})
+	s.helius = NewHeliusService(db, s.sinks, nil, nil, nil, NewFilterService(db, testLogger()), testLogger())
+	s.replays = NewReplayService(db, s.helius, 0, testLogger())
+	tb.Cleanup(func() {
+		s.sinks.Close()
+		s.tenants.Close()
+	})
+	return s
+}
+
+// storeBids stores one nft_bid event per timestamp for the webhook,
+// returning them in ID order
+func storeBids(tb testing.TB, db *gorm.DB, webhookID uint, at ...time.Time) []models.WebhookEvent {
+	tb.Helper()
+	events := make([]models.WebhookEvent, len(at))
+	for i, t := range at {
+		events[i] = models.WebhookEvent{
+			WebhookID: webhookID,
+			EventType: NFTBidsCategory.EventType,
+			Timestamp: t,
+			Payload:   fmt.Sprintf(`{"nft_address": "Nft111", "bidder": "Bidder%d", "amount": 1.5, "timestamp": %d}`, i, t.Unix()),
+		}
+		if err := db.Create(&events[i]).Error; err != nil {
+			tb.Fatalf("failed to store event: %v", err)
+		}
+	}
+	return events
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Events buffered per subscriber before it is considered too slow
+	subscriberBuffer = 256
+	catchUpBatchSize = 500
+	// Event IDs remembered per stream to drop events sent twice, such as
+	// ones both caught up on and published meanwhile
+	recentEventIDs = 4096
+)
+
+var ErrSubscriberTooSlow = errors.New("subscriber fell behind and was disconnected; resume from the last received event ID")
+
+var ErrStreamClosed = errors.New("server is shutting down; reconnect and resume from the last received event ID")
+
+// StreamEvent is a successfully processed event as delivered to clients and
+// destinations. Data holds the columns the event was decoded to, not the
+// raw Helius payload.
+type StreamEvent struct {
+	ID             uint            `json:"id"`
+	OrganizationID uint            `json:"-"`
+	WebhookID      uint            `json:"webhook_id"`
+	Category       string          `json:"category"`
+	EventType      string          `json:"event_type"`
+	AccountKey     string          `json:"account_key"`
+	Collection     string          `json:"collection,omitempty"`
+	Slot           uint64          `json:"slot"`
+	Timestamp      time.Time       `json:"timestamp"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// NewStreamEvent builds the client-facing form of a stored event from the
+// record it was decoded to
+func NewStreamEvent(webhook *models.HeliusWebhook, event *models.WebhookEvent, record *SinkRecord) StreamEvent {
+	e := StreamEvent{
+		ID:             event.ID,
+		OrganizationID: webhook.OrganizationID,
+		WebhookID:      event.WebhookID,
+		Category:       record.Category.Name,
+		EventType:      event.EventType,
+		AccountKey:     event.AccountKey,
+		Collection:     payloadCollection(event.Payload),
+		Slot:           event.Slot,
+		Timestamp:      event.Timestamp,
+	}
+	// Fields are strings, numbers and formatted times, which always encode
+	e.Data, _ = json.Marshal(record.jsonFields())
+	return e
+}
+
+// payloadCollection returns the NFT collection named by an event payload, if any
+func payloadCollection(payload string) string {
+	var fields struct {
+		Collection string `json:"collection"`
+	}
+	json.Unmarshal([]byte(payload), &fields)
+	return fields.Collection
+}
+
+// StreamFilter selects the events a subscriber receives. Empty lists match
+// everything; non-empty lists must each match.
+type StreamFilter struct {
+	OrganizationID uint
+	Categories     []string
+	AccountKeys    []string
+	Collections    []string
+}
+
+// Matches reports whether e passes the filter
+func (f StreamFilter) Matches(e StreamEvent) bool {
+	return e.OrganizationID == f.OrganizationID &&
+		matchesAny(f.Categories, e.Category) &&
+		matchesAny(f.AccountKeys, e.AccountKey) &&
+		matchesAny(f.Collections, e.Collection)
+}
+
+func matchesAny(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives matching events on C until it is closed
+type Subscription struct {
+	C      chan StreamEvent
+	filter StreamFilter
+	closed bool
+	// err explains why the hub closed C; nil after Unsubscribe
+	err error
+}
+
+// Hub fans processed events out to in-process subscribers
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a subscriber for events matching filter
+func (h *Hub) Subscribe(filter StreamFilter) *Subscription {
+	sub := &Subscription{
+		C:      make(chan StreamEvent, subscriberBuffer),
+		filter: filter,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		sub.closed = true
+		sub.err = ErrStreamClosed
+		close(sub.C)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub, nil)
+}
+
+// Close disconnects every subscriber and refuses new ones, ending open
+// streams so the server can shut down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		h.remove(sub, ErrStreamClosed)
+	}
+}
+
+func (h *Hub) remove(sub *Subscription, reason error) {
+	delete(h.subs, sub)
+	if !sub.closed {
+		sub.closed = true
+		sub.err = reason
+		close(sub.C)
+	}
+}
+
+// Publish delivers e to every matching subscriber without blocking.
+// Subscribers whose buffer is full are disconnected.
+func (h *Hub) Publish(e StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if !sub.filter.Matches(e) {
+			continue
+		}
+		select {
+		case sub.C <- e:
+		default:
+			h.remove(sub, ErrSubscriberTooSlow)
+		}
+	}
+}
+
+// StreamService combines stored history with the live hub so clients can
+// resume from the last event ID they saw
+type StreamService struct {
+	db  *gorm.DB
+	hub *Hub
+}
+
+func NewStreamService(db *gorm.DB, hub *Hub) *StreamService {
+	return &StreamService{db: db, hub: hub}
+}
+
+// Stream calls send for every event matching filter, first replaying stored
+// events after lastEventID and then following the hub, until ctx is done
+// or send fails. Live events arrive in processing order rather than ID
+// order, so duplicates are dropped by ID instead of by position.
+func (s *StreamService) Stream(ctx context.Context, filter StreamFilter, lastEventID uint, send func(StreamEvent) error) error {
+	// Subscribe before catching up so nothing published meanwhile is lost
+	sub := s.hub.Subscribe(filter)
+	defer s.hub.Unsubscribe(sub)
+
+	sent := newRecentIDs(recentEventIDs)
+	deliver := func(e StreamEvent) error {
+		if !sent.add(e.ID) {
+			return nil
+		}
+		return send(e)
+	}
+
+	if lastEventID > 0 {
+		if err := s.catchUp(ctx, filter, lastEventID, deliver); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-sub.C:
+			if !ok {
+				return sub.err
+			}
+			if err := deliver(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// recentIDs is a bounded set of the event IDs last sent on a stream
+type recentIDs struct {
+	seen  map[uint]struct{}
+	order []uint // Ring of the IDs in seen, oldest at next
+	next  int
+}
+
+func newRecentIDs(size int) *recentIDs {
+	return &recentIDs{seen: make(map[uint]struct{}, size), order: make([]uint, 0, size)}
+}
+
+// add records id, forgetting the oldest ID once full, and reports whether
+// it wasn't already in the set
+func (r *recentIDs) add(id uint) bool {
+	if _, ok := r.seen[id]; ok {
+		return false
+	}
+	if len(r.order) < cap(r.order) {
+		r.order = append(r.order, id)
+	} else {
+		delete(r.seen, r.order[r.next])
+		r.order[r.next] = id
+		r.next = (r.next + 1) % len(r.order)
+	}
+	r.seen[id] = struct{}{}
+	return true
+}
+
+// catchUp replays stored processed events after afterID in ID order
+func (s *StreamService) catchUp(ctx context.Context, filter StreamFilter, afterID uint, send func(StreamEvent) error) error {
+	var webhooks []models.HeliusWebhook
+	if err := s.db.Where("organization_id = ?", filter.OrganizationID).Find(&webhooks).Error; err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	byID := make(map[uint]*models.HeliusWebhook, len(webhooks))
+	ids := make([]uint, len(webhooks))
+	for i := range webhooks {
+		byID[webhooks[i].ID] = &webhooks[i]
+		ids[i] = webhooks[i].ID
+	}
+
+	var eventTypes []string
+	for _, name := range filter.Categories {
+		if category, ok := CategoryByName(name); ok {
+			eventTypes = append(eventTypes, category.EventType)
+		}
+	}
+
+	last := afterID
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		query := s.db.Where("id > ? AND webhook_id IN ? AND processed = ? AND filtered = ?", last, ids, true, false)
+		if len(eventTypes) > 0 {
+			query = query.Where("event_type IN ?", eventTypes)
+		}
+		if len(filter.AccountKeys) > 0 {
+			query = query.Where("account_key IN ?", filter.AccountKeys)
+		}
+
+		var batch []models.WebhookEvent
+		if err := query.Order("id").Limit(catchUpBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+
+		for i := range batch {
+			last = batch[i].ID
+			webhook := byID[batch[i].WebhookID]
+			record, err := DecodeEvent(webhook, &batch[i])
+			if err != nil {
+				continue
+			}
+			e := NewStreamEvent(webhook, &batch[i], record)
+			if !filter.Matches(e) {
+				continue
+			}
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < catchUpBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRecentIDsForgetsTheOldest(t *testing.T) {
+	r := newRecentIDs(3)
+	for _, id := range []uint{1, 2, 3} {
+		if !r.add(id) {
+			t.Fatalf("add(%d) of a new ID = false", id)
+		}
+	}
+	if r.add(2) {
+		t.Error("add(2) of a recent ID = true")
+	}
+	r.add(4)
+	if !r.add(1) {
+		t.Error("add(1) = false after it was evicted")
+	}
+	if r.add(4) || r.add(3) {
+		t.Error("add of an ID still in the set = true")
+	}
+}
+
+func TestStreamSendsLiveEventsOutOfOrderOnce(t *testing.T) {
+	hub := NewHub()
+	s := NewStreamService(nil, hub)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []uint
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Stream(ctx, StreamFilter{OrganizationID: 1}, 0, func(e StreamEvent) error {
+			got = append(got, e.ID)
+			if len(got) == 3 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		hub.mu.Lock()
+		subscribed := len(hub.subs) > 0
+		hub.mu.Unlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stream never subscribed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A slow transaction commits event 3 after 5, and 5 is sent again
+	for _, id := range []uint{5, 3, 5, 4} {
+		hub.Publish(StreamEvent{ID: id, OrganizationID: 1})
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if fmt.Sprint(got) != "[5 3 4]" {
+		t.Errorf("sent %v, want [5 3 4]", got)
+	}
+}
+
+func TestStreamResumesFromStoredEventsThenGoesLive(t *testing.T) {
+	db := testDB(t)
+	orgID, webhooks := createTestOrganization(t, db, 1)
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	events := storeBids(t, db, webhooks[0], at, at, at)
+	if err := db.Model(&events).Update("processed", true).Error; err != nil {
+		t.Fatalf("failed to mark events processed: %v", err)
+	}
+
+	hub := NewHub()
+	s := NewStreamService(db, hub)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	live := events[2].ID + 100
+
+	var got []uint
+	err := s.Stream(ctx, StreamFilter{OrganizationID: orgID}, events[0].ID, func(e StreamEvent) error {
+		got = append(got, e.ID)
+		switch e.ID {
+		case events[1].ID:
+			// Published while catching up, one of them already stored
+			hub.Publish(StreamEvent{ID: events[2].ID, OrganizationID: orgID})
+			hub.Publish(StreamEvent{ID: live, OrganizationID: orgID})
+		case live:
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if want := fmt.Sprint([]uint{events[1].ID, events[2].ID, live}); fmt.Sprint(got) != want {
+		t.Errorf("sent %v, want %s", got, want)
+	}
+}
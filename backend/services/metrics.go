@@ -0,0 +1,169 @@
+package services
+
+import (
+	"backend/models"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metric labels only take values from fixed sets (event types, categories,
+// drivers, status classes) so cardinality doesn't grow with the number of
+// organizations or webhooks.
+
+var (
+	webhooksReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "helixscan_webhooks_received_total",
+		Help: "Webhook deliveries received from Helius, by outcome.",
+	}, []string{"status"})
+
+	eventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "helixscan_events_total",
+		Help: "Events handled by the processing pipeline, by event type and outcome.",
+	}, []string{"event_type", "outcome"})
+
+	processingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "helixscan_processing_duration_seconds",
+		Help:    "Time spent writing an event to its organization's sink, by category.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"category"})
+
+	sinkBatchRows = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "helixscan_sink_batch_rows",
+		Help:    "Rows written to organization tables per batched insert, by category.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"category"})
+
+	sinkWriteErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "helixscan_sink_write_errors_total",
+		Help: "Failed writes to organization tables and streaming sinks, by category and sink driver.",
+	}, []string{"category", "driver"})
+
+	heliusAPIDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "helixscan_helius_api_duration_seconds",
+		Help:    "Helius API call latency, by operation and status class.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	destinationDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "helixscan_destination_deliveries_total",
+		Help: "Outbound webhook delivery attempts, by result.",
+	}, []string{"result"})
+)
+
+// Label values for bounded metric labels
+const (
+	metricOther = "other"
+	metricError = "error"
+)
+
+// RegisterRuntimeMetrics exposes queue depths and tenant connection pool
+// totals, which are read when metrics are scraped
+func RegisterRuntimeMetrics(tenants *TenantDBManager, pools ...*WorkerPool) {
+	for _, pool := range pools {
+		pool := pool
+		labels := prometheus.Labels{"pool": pool.Name()}
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "helixscan_worker_queue_depth",
+			Help:        "Jobs waiting for a worker, by pool.",
+			ConstLabels: labels,
+		}, func() float64 {
+			return float64(pool.QueueDepth())
+		})
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "helixscan_worker_running",
+			Help:        "Whether a worker pool is accepting jobs.",
+			ConstLabels: labels,
+		}, func() float64 {
+			if pool.Running() {
+				return 1
+			}
+			return 0
+		})
+	}
+
+	prometheus.MustRegister(&tenantPoolCollector{tenants: tenants})
+}
+
+// tenantPoolCollector reports tenant connection pool statistics summed
+// across organizations
+type tenantPoolCollector struct {
+	tenants *TenantDBManager
+}
+
+var (
+	tenantPoolsDesc = prometheus.NewDesc("helixscan_tenant_pools",
+		"Open tenant database connection pools.", nil, nil)
+	tenantConnectionsDesc = prometheus.NewDesc("helixscan_tenant_connections",
+		"Tenant database connections across all pools, by state.", []string{"state"}, nil)
+	tenantWaitsDesc = prometheus.NewDesc("helixscan_tenant_connection_waits_total",
+		"Times a tenant query waited for a free connection.", nil, nil)
+	tenantWaitDurationDesc = prometheus.NewDesc("helixscan_tenant_connection_wait_seconds_total",
+		"Total time tenant queries spent waiting for a connection.", nil, nil)
+)
+
+func (c *tenantPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tenantPoolsDesc
+	ch <- tenantConnectionsDesc
+	ch <- tenantWaitsDesc
+	ch <- tenantWaitDurationDesc
+}
+
+func (c *tenantPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.tenants.Stats()
+	ch <- prometheus.MustNewConstMetric(tenantPoolsDesc, prometheus.GaugeValue, float64(stats.Pools))
+	ch <- prometheus.MustNewConstMetric(tenantConnectionsDesc, prometheus.GaugeValue, float64(stats.InUse), "in_use")
+	ch <- prometheus.MustNewConstMetric(tenantConnectionsDesc, prometheus.GaugeValue, float64(stats.Idle), "idle")
+	ch <- prometheus.MustNewConstMetric(tenantWaitsDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(tenantWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
+
+// RecordWebhookReceived counts an incoming Helius webhook by outcome
+func RecordWebhookReceived(status string) {
+	webhooksReceived.WithLabelValues(status).Inc()
+}
+
+// eventTypeLabel bounds event type labels to the known categories
+func eventTypeLabel(eventType string) string {
+	if _, ok := CategoryByEventType(eventType); ok {
+		return eventType
+	}
+	return metricOther
+}
+
+func categoryLabel(category *Category) string {
+	if category == nil {
+		return metricOther
+	}
+	return category.Name
+}
+
+// sinkDriverLabel names a sink by its driver rather than its address
+func sinkDriverLabel(sink Sink) string {
+	switch sink.(type) {
+	case *DatabaseSink:
+		return "database"
+	case *KafkaSink:
+		return models.SinkKafka
+	case *NATSSink:
+		return models.SinkNATS
+	case *RedisSink:
+		return models.SinkRedis
+	default:
+		return metricOther
+	}
+}
+
+// statusClass reduces an HTTP status code to "2xx", "4xx" and so on
+func statusClass(code int) string {
+	if code <= 0 {
+		return metricError
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+func observeHeliusCall(operation string, start time.Time, statusCode int) {
+	heliusAPIDuration.WithLabelValues(operation, statusClass(statusCode)).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"backend/models"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrInvitationNotFound = errors.New("invitation not found or expired")
+	ErrInvitationEmail    = errors.New("invitation was issued for a different email")
+	ErrAlreadyMember      = errors.New("user is already a member of this organization")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrLastOwner          = errors.New("an organization must keep at least one owner")
+	ErrInsufficientRole   = errors.New("insufficient role for this action")
+)
+
+type OrganizationService struct {
+	db *gorm.DB
+}
+
+func NewOrganizationService(db *gorm.DB) *OrganizationService {
+	return &OrganizationService{db: db}
+}
+
+// MemberInfo is a membership joined with the member's email
+type MemberInfo struct {
+	UserID    uint        `json:"user_id"`
+	Email     string      `json:"email"`
+	Role      models.Role `json:"role"`
+	CreatedAt time.Time   `json:"joined_at"`
+}
+
+// OrganizationInfo is an organization together with the caller's role in it
+type OrganizationInfo struct {
+	ID   uint        `json:"id"`
+	Name string      `json:"name"`
+	Role models.Role `json:"role"`
+}
+
+// CreateOrganization creates an organization owned by userID
+func (s *OrganizationService) CreateOrganization(userID uint, name string) (*models.Organization, error) {
+	org := &models.Organization{Name: name}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return createOrganization(tx, org, userID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+	return org, nil
+}
+
+// CreatePersonalOrganization creates the default organization for a new user
+// inside an existing transaction
+func CreatePersonalOrganization(tx *gorm.DB, user *models.User) (*models.Organization, error) {
+	org := &models.Organization{Name: user.Email}
+	if err := createOrganization(tx, org, user.ID); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func createOrganization(tx *gorm.DB, org *models.Organization, ownerID uint) error {
+	if err := tx.Create(org).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.Membership{
+		OrganizationID: org.ID,
+		UserID:         ownerID,
+		Role:           models.RoleOwner,
+	}).Error
+}
+
+// ListOrganizations returns every organization the user belongs to
+func (s *OrganizationService) ListOrganizations(userID uint) ([]OrganizationInfo, error) {
+	var orgs []OrganizationInfo
+	err := s.db.Table("memberships").
+		Select("organizations.id, organizations.name, memberships.role").
+		Joins("JOIN organizations ON organizations.id = memberships.organization_id AND organizations.deleted_at IS NULL").
+		Where("memberships.user_id = ? AND memberships.deleted_at IS NULL", userID).
+		Order("organizations.id").
+		Scan(&orgs).Error
+	return orgs, err
+}
+
+// ResolveMembership returns the user's membership in orgID, or in their
+// oldest organization when orgID is zero
+func (s *OrganizationService) ResolveMembership(userID, orgID uint) (*models.Membership, error) {
+	var membership models.Membership
+	// Disabled users keep their memberships but can't act on them
+	query := s.db.Joins("JOIN users ON users.id = memberships.user_id AND users.disabled_at IS NULL").
+		Where("memberships.user_id = ?", userID)
+	if orgID != 0 {
+		query = query.Where("memberships.organization_id = ?", orgID)
+	}
+	if err := query.Order("memberships.id").First(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// ListMembers returns the members of an organization
+func (s *OrganizationService) ListMembers(orgID uint) ([]MemberInfo, error) {
+	var members []MemberInfo
+	err := s.db.Table("memberships").
+		Select("memberships.user_id, users.email, memberships.role, memberships.created_at").
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.organization_id = ? AND memberships.deleted_at IS NULL", orgID).
+		Order("memberships.id").
+		Scan(&members).Error
+	return members, err
+}
+
+// Invite creates an invitation for email to join orgID with the given role.
+// Only owners may invite other owners.
+func (s *OrganizationService) Invite(orgID, inviterID uint, inviterRole models.Role, email string, role models.Role) (*models.Invitation, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+	if role == models.RoleOwner && inviterRole != models.RoleOwner {
+		return nil, ErrInsufficientRole
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	var count int64
+	s.db.Table("memberships").
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.organization_id = ? AND memberships.deleted_at IS NULL AND LOWER(users.email) = ?", orgID, email).
+		Count(&count)
+	if count > 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &models.Invitation{
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		Token:          token,
+		InvitedByID:    inviterID,
+		ExpiresAt:      time.Now().Add(invitationTTL),
+	}
+	if err := s.db.Create(invitation).Error; err != nil {
+		return nil, fmt.Errorf("failed to store invitation: %w", err)
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation adds the user to the invitation's organization
+func (s *OrganizationService) AcceptInvitation(userID uint, token string) (*models.Membership, error) {
+	var membership *models.Membership
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var invitation models.Invitation
+		err := tx.Where("token = ? AND accepted_at IS NULL AND expires_at > ?", token, time.Now()).
+			First(&invitation).Error
+		if err != nil {
+			return ErrInvitationNotFound
+		}
+
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		if !strings.EqualFold(user.Email, invitation.Email) {
+			return ErrInvitationEmail
+		}
+		if user.EmailVerifiedAt == nil {
+			return ErrEmailNotVerified
+		}
+
+		var existing int64
+		tx.Model(&models.Membership{}).
+			Where("organization_id = ? AND user_id = ?", invitation.OrganizationID, userID).
+			Count(&existing)
+		if existing > 0 {
+			return ErrAlreadyMember
+		}
+
+		membership = &models.Membership{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         userID,
+			Role:           invitation.Role,
+		}
+		if err := tx.Create(membership).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		invitation.AcceptedAt = &now
+		return tx.Save(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// RemoveMember removes userID from orgID. Admins may remove members and
+// viewers; only owners may remove admins or other owners, and the last
+// owner can never be removed.
+func (s *OrganizationService) RemoveMember(orgID uint, actorRole models.Role, userID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var membership models.Membership
+		err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error
+		if err != nil {
+			return ErrMemberNotFound
+		}
+
+		if membership.Role.AtLeast(models.RoleAdmin) && actorRole != models.RoleOwner {
+			return ErrInsufficientRole
+		}
+
+		if membership.Role == models.RoleOwner {
+			var owners int64
+			tx.Model(&models.Membership{}).
+				Where("organization_id = ? AND role = ?", orgID, models.RoleOwner).
+				Count(&owners)
+			if owners <= 1 {
+				return ErrLastOwner
+			}
+		}
+
+		// Hard delete so the user can be invited again later
+		return tx.Unscoped().Delete(&membership).Error
+	})
+}
+
+// GenerateToken returns a random hex-encoded token suitable for single-use links
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
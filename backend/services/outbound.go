@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const outboundLookupTimeout = 5 * time.Second
+
+var ErrPrivateAddress = errors.New("URL must not point to a private, loopback or link-local address")
+
+// publicIP reports whether ip is routable on the public internet, as
+// customer-supplied URLs must be
+func publicIP(ip net.IP) bool {
+	return !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// CheckPublicURL resolves rawURL's host and fails with ErrPrivateAddress if
+// any of its addresses isn't public
+func CheckPublicURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := parsed.Hostname()
+	ctx, cancel := context.WithTimeout(context.Background(), outboundLookupTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// newPublicClient returns an HTTP client that refuses to connect to
+// addresses that aren't public. The check runs on every dial, so a URL
+// validated when it was saved can't later reach the internal network
+// through a changed DNS record or a redirect.
+func newPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would make the connection on our behalf, unchecked
+	transport.Proxy = nil
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
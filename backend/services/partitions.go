@@ -0,0 +1,689 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Partition intervals
+const (
+	PartitionNone    = "none"
+	PartitionDaily   = "daily"
+	PartitionMonthly = "monthly"
+)
+
+const (
+	// EventsTable is the platform table raw webhook events are stored in
+	EventsTable = "webhook_events"
+	// eventsPartitionColumn is the column webhook_events is split by. Events
+	// are partitioned by when they were received, which only moves forward,
+	// rather than by their block time.
+	eventsPartitionColumn = "created_at"
+	// eventsLegacyPartition holds the events received before partitioning
+	// was turned on
+	eventsLegacyPartition = EventsTable + "_legacy"
+	// eventsPartitionCheck lets attaching the legacy partition skip
+	// scanning it for rows outside its range
+	eventsPartitionCheck = EventsTable + "_partition_check"
+
+	partitionMaintenanceInterval = time.Hour
+	// Partition DDL gives up rather than queue behind long queries, since
+	// every write to the table would queue behind it in turn
+	partitionLockTimeout = "5s"
+	// partitionLockKey serializes converting webhook_events across replicas
+	partitionLockKey = 7_372_684_242
+)
+
+var ErrNotPartitioned = errors.New("table is not partitioned")
+
+// partitionBound matches the range of a partition as rendered by pg_get_expr
+var partitionBound = regexp.MustCompile(`^FOR VALUES FROM \((.+)\) TO \((.+)\)$`)
+
+// Partition is one partition of a range partitioned table
+type Partition struct {
+	Name    string     `json:"name"`
+	From    *time.Time `json:"from"` // nil for MINVALUE and the default partition
+	To      *time.Time `json:"to"`   // nil for MAXVALUE and the default partition
+	Default bool       `json:"default"`
+	Rows    int64      `json:"rows"` // Estimated from planner statistics
+	Bytes   int64      `json:"bytes"`
+}
+
+// contains reports whether t falls in the partition's range
+func (p *Partition) contains(t time.Time) bool {
+	return !p.Default && (p.From == nil || !t.Before(*p.From)) && (p.To == nil || t.Before(*p.To))
+}
+
+// PartitionService splits webhook_events and Postgres category tables into
+// daily or monthly range partitions. It converts webhook_events in place,
+// creates partitions ahead of time and detaches and drops expired ones,
+// which unlike deleting rows leaves no dead tuples behind.
+//
+// Inserts go to the parent table, which routes each row to its partition.
+// webhook_events keeps a default partition for rows no partition covers;
+// category rows carry their event's own time, however old, so the sink
+// creates a missing partition when an insert finds none instead.
+type PartitionService struct {
+	db       *gorm.DB
+	tenants  *TenantDBManager
+	interval string
+	premake  int
+	// webhook_events partitions older than this, or than the longest events
+	// retention policy, are dropped; 0 keeps them
+	eventRetention time.Duration
+	archive        Archive // nil when archiving is disabled
+	batchSize      int
+	logger         *slog.Logger
+}
+
+// NewPartitionService creates a service that keeps premake partitions
+// ahead of the current one, archiving dropped event partitions in batches
+// of batchSize rows if archive is set
+func NewPartitionService(db *gorm.DB, tenants *TenantDBManager, interval string, premake, eventRetentionDays int, archive Archive, batchSize int, logger *slog.Logger) *PartitionService {
+	return &PartitionService{
+		db:             db,
+		tenants:        tenants,
+		interval:       interval,
+		premake:        premake,
+		eventRetention: time.Duration(eventRetentionDays) * 24 * time.Hour,
+		archive:        archive,
+		batchSize:      batchSize,
+		logger:         logger,
+	}
+}
+
+// Enabled reports whether new tables in db are created partitioned
+func (s *PartitionService) Enabled(db *gorm.DB) bool {
+	return s.interval != PartitionNone && s.interval != "" && db.Dialector.Name() == models.DriverPostgres
+}
+
+// Run maintains partitions now and then every hour until ctx is cancelled
+func (s *PartitionService) Run(ctx context.Context) {
+	if !s.Enabled(s.db) {
+		return
+	}
+	ticker := time.NewTicker(partitionMaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Maintain(ctx); err != nil && ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "partition maintenance failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain partitions webhook_events if it isn't yet, creates the coming
+// partitions of it and of every partitioned category table, and drops
+// event partitions past the event retention. A table that fails doesn't
+// stop the others; the errors are returned together.
+func (s *PartitionService) Maintain(ctx context.Context) error {
+	if !s.Enabled(s.db) {
+		return nil
+	}
+	if err := s.ConvertEvents(ctx); err != nil {
+		return err
+	}
+	var errs []error
+	if err := s.EnsurePartitions(ctx, s.db, EventsTable); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", EventsTable, err))
+	}
+	if s.eventRetention > 0 {
+		retention, err := s.eventsRetention(ctx)
+		if err == nil {
+			var dropped int64
+			dropped, err = s.DropExpired(ctx, s.db, EventsTable, time.Now().Add(-retention), s.archive, "events")
+			if dropped > 0 {
+				s.logger.InfoContext(ctx, "dropped expired event partitions", "rows", dropped)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", EventsTable, err))
+		}
+	}
+
+	dbs, err := s.tenantDatabases(ctx)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, db := range dbs {
+		tables, err := s.partitionedTables(ctx, db)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, table := range tables {
+			if err := s.EnsurePartitions(ctx, db, table); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", table, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// eventsRetention returns how long webhook_events partitions are kept. The
+// partitions hold every organization's events, so the configured retention
+// is extended to the longest events retention policy rather than cut short
+// what an organization chose to keep.
+func (s *PartitionService) eventsRetention(ctx context.Context) (time.Duration, error) {
+	var longest int
+	err := s.db.WithContext(ctx).Model(&models.RetentionPolicy{}).Where("target = ?", models.RetentionEvents).
+		Select("COALESCE(MAX(max_age_days), 0)").Scan(&longest).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load events retention policies: %w", err)
+	}
+	if policy := time.Duration(longest) * 24 * time.Hour; policy > s.eventRetention {
+		return policy, nil
+	}
+	return s.eventRetention, nil
+}
+
+// tenantDatabases returns each distinct Postgres database organizations
+// with webhooks store their tables in
+func (s *PartitionService) tenantDatabases(ctx context.Context) ([]*gorm.DB, error) {
+	var orgIDs []uint
+	err := s.db.WithContext(ctx).Model(&models.HeliusWebhook{}).Distinct("organization_id").
+		Order("organization_id").Pluck("organization_id", &orgIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load organizations: %w", err)
+	}
+	seen := make(map[*gorm.DB]bool)
+	var dbs []*gorm.DB
+	for _, orgID := range orgIDs {
+		db, err := s.tenants.ForOrganization(orgID)
+		if err != nil {
+			s.logger.WarnContext(ctx, "skipping partitions of unreachable database", "organization_id", orgID, "error", err)
+			continue
+		}
+		if seen[db] || db.Dialector.Name() != models.DriverPostgres {
+			continue
+		}
+		seen[db] = true
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// partitionedTables lists the partitioned category tables in db
+func (s *PartitionService) partitionedTables(ctx context.Context, db *gorm.DB) ([]string, error) {
+	var tables []string
+	err := db.WithContext(ctx).Raw(`SELECT c.relname FROM pg_partitioned_table p
+		JOIN pg_class c ON c.oid = p.partrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema() AND c.relname LIKE 'user\_%'
+		ORDER BY c.relname`).Scan(&tables).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitioned tables: %w", err)
+	}
+	return tables, nil
+}
+
+// IsPartitioned reports whether table is a partitioned table
+func (s *PartitionService) IsPartitioned(ctx context.Context, db *gorm.DB, table string) (bool, error) {
+	if db.Dialector.Name() != models.DriverPostgres {
+		return false, nil
+	}
+	var partitioned bool
+	err := db.WithContext(ctx).Raw(`SELECT EXISTS (SELECT 1 FROM pg_partitioned_table
+		WHERE partrelid = to_regclass(?))`, table).Scan(&partitioned).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s: %w", table, err)
+	}
+	return partitioned, nil
+}
+
+// List returns a partitioned table's partitions in range order, with the
+// default partition last
+func (s *PartitionService) List(ctx context.Context, db *gorm.DB, table string) ([]Partition, error) {
+	partitioned, err := s.IsPartitioned(ctx, db, table)
+	if err != nil {
+		return nil, err
+	}
+	if !partitioned {
+		return nil, fmt.Errorf("%w: %s", ErrNotPartitioned, table)
+	}
+
+	var rows []struct {
+		Name  string
+		Bound string
+		Rows  int64
+		Bytes int64
+	}
+	err = db.WithContext(ctx).Raw(`SELECT c.relname AS name, pg_get_expr(c.relpartbound, c.oid) AS bound,
+		GREATEST(c.reltuples, 0)::bigint AS rows, pg_total_relation_size(c.oid) AS bytes
+		FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = CAST(? AS regclass)`, table).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %s: %w", table, err)
+	}
+
+	partitions := make([]Partition, 0, len(rows))
+	for _, row := range rows {
+		p := Partition{Name: row.Name, Rows: row.Rows, Bytes: row.Bytes}
+		if row.Bound == "DEFAULT" {
+			p.Default = true
+		} else {
+			match := partitionBound.FindStringSubmatch(row.Bound)
+			if match == nil {
+				return nil, fmt.Errorf("unsupported bound of partition %s: %s", row.Name, row.Bound)
+			}
+			if p.From, err = parsePartitionBound(match[1]); err != nil {
+				return nil, fmt.Errorf("partition %s: %w", row.Name, err)
+			}
+			if p.To, err = parsePartitionBound(match[2]); err != nil {
+				return nil, fmt.Errorf("partition %s: %w", row.Name, err)
+			}
+		}
+		partitions = append(partitions, p)
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		a, b := partitions[i], partitions[j]
+		if a.Default || b.Default {
+			return b.Default && !a.Default
+		}
+		if a.From == nil || b.From == nil {
+			return a.From == nil && b.From != nil
+		}
+		return a.From.Before(*b.From)
+	})
+	return partitions, nil
+}
+
+// parsePartitionBound parses one bound rendered by pg_get_expr, returning
+// nil for MINVALUE and MAXVALUE
+func parsePartitionBound(bound string) (*time.Time, error) {
+	if bound == "MINVALUE" || bound == "MAXVALUE" {
+		return nil, nil
+	}
+	value := strings.Trim(bound, "'")
+	for _, layout := range []string{
+		"2006-01-02 15:04:05.999999999-07",
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999",
+	} {
+		if t, err := time.Parse(layout, value); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported partition bound %s", bound)
+}
+
+// periodStart returns the start of the partition period containing t.
+// Tables stay partitioned after partitioning is turned off, so they keep
+// getting monthly partitions then.
+func (s *PartitionService) periodStart(t time.Time) time.Time {
+	t = t.UTC()
+	if s.interval == PartitionDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// nextPeriod returns the start of the period after the one containing t
+func (s *PartitionService) nextPeriod(t time.Time) time.Time {
+	if s.interval == PartitionDaily {
+		return s.periodStart(t).AddDate(0, 0, 1)
+	}
+	return s.periodStart(t).AddDate(0, 1, 0)
+}
+
+// partitionName names a table's partition starting at from
+func (s *PartitionService) partitionName(table string, from time.Time) string {
+	if s.interval != PartitionDaily && from.Equal(s.periodStart(from)) {
+		return table + "_p" + from.Format("200601")
+	}
+	return table + "_p" + from.Format("20060102")
+}
+
+// EnsurePartitions creates the partitions covering the current period and
+// the premake periods after it, and the default partition of webhook_events
+func (s *PartitionService) EnsurePartitions(ctx context.Context, db *gorm.DB, table string) error {
+	if table == EventsTable {
+		err := s.ddl(ctx, db, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %[1]s_default PARTITION OF %[1]s DEFAULT", table))
+		if err != nil {
+			return fmt.Errorf("failed to create default partition: %w", err)
+		}
+	}
+	from := s.periodStart(time.Now())
+	to := from
+	for i := 0; i <= s.premake; i++ {
+		to = s.nextPeriod(to)
+	}
+	return s.cover(ctx, db, table, from, to)
+}
+
+// EnsurePartitionFor creates the partition for the period containing t if
+// no partition covers t
+func (s *PartitionService) EnsurePartitionFor(ctx context.Context, db *gorm.DB, table string, t time.Time) error {
+	from := s.periodStart(t)
+	return s.cover(ctx, db, table, from, s.nextPeriod(from))
+}
+
+// cover creates partitions for the parts of [from, to) that no partition
+// covers, ending each at a period boundary or the next partition
+func (s *PartitionService) cover(ctx context.Context, db *gorm.DB, table string, from, to time.Time) error {
+	partitions, err := s.List(ctx, db, table)
+	if err != nil {
+		return err
+	}
+
+	cursor := from
+	for cursor.Before(to) {
+		var covering *Partition
+		for i := range partitions {
+			if partitions[i].contains(cursor) {
+				covering = &partitions[i]
+				break
+			}
+		}
+		if covering != nil {
+			if covering.To == nil {
+				return nil
+			}
+			cursor = *covering.To
+			continue
+		}
+
+		end := s.nextPeriod(cursor)
+		for _, p := range partitions {
+			if p.From != nil && p.From.After(cursor) && p.From.Before(end) {
+				end = *p.From
+			}
+		}
+		name := s.partitionName(table, cursor)
+		err := s.ddl(ctx, db, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+			name, table, formatPartitionBound(cursor), formatPartitionBound(end)))
+		if err != nil {
+			return fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+		start := cursor
+		partitions = append(partitions, Partition{Name: name, From: &start, To: &end})
+		cursor = end
+	}
+	return nil
+}
+
+// formatPartitionBound renders t as a literal both timestamp and timestamptz
+// columns read as the same UTC instant
+func formatPartitionBound(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05+00")
+}
+
+// DropExpired detaches and drops the table's partitions that end at or
+// before cutoff and returns how many rows they held. With an archive, each
+// partition is archived in batches after it is detached, when no writes
+// can reach it; if that fails it is attached again and left for the next
+// run. The default partition is never dropped.
+func (s *PartitionService) DropExpired(ctx context.Context, db *gorm.DB, table string, cutoff time.Time, archive Archive, keyPrefix string) (int64, error) {
+	partitions, err := s.List(ctx, db, table)
+	if err != nil {
+		return 0, err
+	}
+	var dropped int64
+	for _, p := range partitions {
+		if p.Default || p.To == nil || p.To.After(cutoff) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return dropped, err
+		}
+		n, err := s.drop(ctx, db, table, p, archive, keyPrefix)
+		dropped += n
+		if err != nil {
+			return dropped, fmt.Errorf("partition %s: %w", p.Name, err)
+		}
+	}
+	return dropped, nil
+}
+
+func (s *PartitionService) drop(ctx context.Context, db *gorm.DB, table string, p Partition, archive Archive, keyPrefix string) (int64, error) {
+	detach := fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", table, p.Name)
+	dropTable := fmt.Sprintf("DROP TABLE %s", p.Name)
+	if archive == nil {
+		if err := s.ddl(ctx, db, detach, dropTable); err != nil {
+			return 0, fmt.Errorf("failed to drop partition: %w", err)
+		}
+		return p.Rows, nil
+	}
+
+	if err := s.ddl(ctx, db, detach); err != nil {
+		return 0, fmt.Errorf("failed to detach partition: %w", err)
+	}
+	archived, err := s.archivePartition(ctx, db, p.Name, archive, keyPrefix)
+	if err != nil {
+		from, to := "MINVALUE", "MAXVALUE"
+		if p.From != nil {
+			from = "'" + formatPartitionBound(*p.From) + "'"
+		}
+		if p.To != nil {
+			to = "'" + formatPartitionBound(*p.To) + "'"
+		}
+		attach := fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM (%s) TO (%s)", table, p.Name, from, to)
+		// Not ctx, which may be why archiving failed
+		if attachErr := s.ddl(context.Background(), db, attach); attachErr != nil {
+			return 0, errors.Join(err, fmt.Errorf("failed to attach partition again: %w", attachErr))
+		}
+		return 0, err
+	}
+	if err := s.ddl(ctx, db, dropTable); err != nil {
+		return archived, fmt.Errorf("failed to drop archived partition: %w", err)
+	}
+	return archived, nil
+}
+
+// archivePartition stores every row of a detached partition in batches
+// keyed by the partition name and the batch's ID range
+func (s *PartitionService) archivePartition(ctx context.Context, db *gorm.DB, name string, archive Archive, keyPrefix string) (int64, error) {
+	var archived int64
+	var lastID uint64
+	for {
+		rows, err := db.WithContext(ctx).Raw(fmt.Sprintf("SELECT * FROM %s WHERE id > ? ORDER BY id LIMIT ?", name), lastID, s.batchSize).Rows()
+		if err != nil {
+			return archived, fmt.Errorf("failed to load rows: %w", err)
+		}
+		batch, ids, err := scanRecords(rows)
+		if err != nil {
+			return archived, fmt.Errorf("failed to load rows: %w", err)
+		}
+		if len(batch) == 0 {
+			return archived, nil
+		}
+
+		body, err := encodeJSONLines(batch)
+		if err != nil {
+			return archived, fmt.Errorf("failed to encode archive: %w", err)
+		}
+		key := fmt.Sprintf("%s/%s/%d-%d.jsonl.gz", keyPrefix, name, ids[0], ids[len(ids)-1])
+		if err := archive.Put(ctx, key, body); err != nil {
+			return archived, fmt.Errorf("failed to archive %s to %s: %w", key, archive.Location(), err)
+		}
+		archived += int64(len(batch))
+		lastID = ids[len(ids)-1]
+		if len(batch) < s.batchSize {
+			return archived, nil
+		}
+	}
+}
+
+// ConvertEvents turns webhook_events into a partitioned table if it isn't
+// one, keeping the existing table as its first partition. Rows are neither
+// copied nor rescanned under lock: a validated CHECK constraint proves
+// they fit the partition and a prebuilt unique index becomes its share of
+// the primary key, so writes are only blocked while the tables are renamed.
+func (s *PartitionService) ConvertEvents(ctx context.Context) error {
+	partitioned, err := s.IsPartitioned(ctx, s.db, EventsTable)
+	if err != nil || partitioned {
+		return err
+	}
+	// The legacy partition ends two periods ahead, so events keep arriving
+	// within it however long the steps before the swap take
+	boundary := s.nextPeriod(s.nextPeriod(time.Now()))
+	s.logger.InfoContext(ctx, "partitioning webhook_events", "legacy_until", boundary)
+
+	db := s.db.WithContext(ctx)
+	prepare := []string{
+		// gorm always sets created_at, but range partitions reject NULL keys
+		`UPDATE webhook_events SET created_at = COALESCE(updated_at, "timestamp", now()) WHERE created_at IS NULL`,
+		"ALTER TABLE webhook_events DROP CONSTRAINT IF EXISTS " + eventsPartitionCheck,
+		fmt.Sprintf("ALTER TABLE webhook_events ADD CONSTRAINT %s CHECK (created_at IS NOT NULL AND created_at < '%s') NOT VALID",
+			eventsPartitionCheck, formatPartitionBound(boundary)),
+		"ALTER TABLE webhook_events VALIDATE CONSTRAINT " + eventsPartitionCheck,
+		"CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS webhook_events_id_created_at_key ON webhook_events (id, created_at)",
+	}
+	for _, statement := range prepare {
+		if err := db.Exec(statement).Error; err != nil {
+			// Events from after the boundary would violate a leftover check
+			db.Exec("ALTER TABLE webhook_events DROP CONSTRAINT IF EXISTS " + eventsPartitionCheck)
+			return fmt.Errorf("failed to prepare webhook_events for partitioning: %w", err)
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", partitionLockKey).Error; err != nil {
+			return err
+		}
+		// Another replica may have converted it while this one prepared
+		var partitioned bool
+		if err := tx.Raw(`SELECT EXISTS (SELECT 1 FROM pg_partitioned_table
+			WHERE partrelid = to_regclass('webhook_events'))`).Scan(&partitioned).Error; err != nil {
+			return err
+		}
+		if partitioned {
+			return nil
+		}
+
+		var indexes []struct {
+			Name       string
+			Definition string
+		}
+		err := tx.Raw(`SELECT indexname AS name, indexdef AS definition FROM pg_indexes
+			WHERE schemaname = current_schema() AND tablename = 'webhook_events'
+			AND indexname NOT IN ('webhook_events_pkey', 'webhook_events_id_created_at_key')`).Scan(&indexes).Error
+		if err != nil {
+			return err
+		}
+		var sequence string
+		if err := tx.Raw("SELECT pg_get_serial_sequence('webhook_events', 'id')").Scan(&sequence).Error; err != nil {
+			return err
+		}
+
+		statements := []string{
+			"SET LOCAL lock_timeout = '" + partitionLockTimeout + "'",
+			"LOCK TABLE webhook_events IN ACCESS EXCLUSIVE MODE",
+			// The validated check lets these skip scanning the table
+			"ALTER TABLE webhook_events ALTER COLUMN created_at SET NOT NULL",
+			"ALTER TABLE webhook_events ADD CONSTRAINT webhook_events_id_created_at_key UNIQUE USING INDEX webhook_events_id_created_at_key",
+			"ALTER TABLE webhook_events RENAME TO " + eventsLegacyPartition,
+			"ALTER INDEX webhook_events_pkey RENAME TO " + eventsLegacyPartition + "_pkey",
+		}
+		for _, index := range indexes {
+			statements = append(statements, fmt.Sprintf("ALTER INDEX %s RENAME TO %s_legacy", index.Name, index.Name))
+		}
+		statements = append(statements,
+			fmt.Sprintf("CREATE TABLE webhook_events (LIKE %s INCLUDING DEFAULTS) PARTITION BY RANGE (%s)",
+				eventsLegacyPartition, eventsPartitionColumn),
+			"ALTER TABLE webhook_events ADD PRIMARY KEY (id, created_at)",
+		)
+		if sequence != "" {
+			statements = append(statements, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY webhook_events.id", sequence))
+		}
+		for _, index := range indexes {
+			// Still names the schema's webhook_events, now the new parent
+			statements = append(statements, index.Definition)
+		}
+		statements = append(statements,
+			// Matching indexes of the legacy table are attached, not rebuilt
+			fmt.Sprintf("ALTER TABLE webhook_events ATTACH PARTITION %s FOR VALUES FROM (MINVALUE) TO ('%s')",
+				eventsLegacyPartition, formatPartitionBound(boundary)),
+			fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", eventsLegacyPartition, eventsPartitionCheck),
+		)
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Exec("ALTER TABLE webhook_events DROP CONSTRAINT IF EXISTS " + eventsPartitionCheck)
+		return fmt.Errorf("failed to partition webhook_events: %w", err)
+	}
+	return s.EnsurePartitions(ctx, s.db, EventsTable)
+}
+
+// PartitionRenames extends table renames with renames of each table's
+// partitions, so partitions keep the name of the table they belong to
+// and a swapped-in table's new partitions don't collide with old ones
+func (s *PartitionService) PartitionRenames(ctx context.Context, db *gorm.DB, renames [][2]string) ([][2]string, error) {
+	if db.Dialector.Name() != models.DriverPostgres {
+		return renames, nil
+	}
+	var extended [][2]string
+	for _, r := range renames {
+		extended = append(extended, r)
+		partitioned, err := s.IsPartitioned(ctx, db, r[0])
+		if err != nil {
+			return nil, err
+		}
+		if !partitioned {
+			continue
+		}
+		partitions, err := s.List(ctx, db, r[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range partitions {
+			if strings.HasPrefix(p.Name, r[0]+"_") {
+				extended = append(extended, [2]string{p.Name, r[1] + strings.TrimPrefix(p.Name, r[0])})
+			}
+		}
+	}
+	return extended, nil
+}
+
+// ddl runs statements in one transaction that gives up waiting for locks
+// after partitionLockTimeout
+func (s *PartitionService) ddl(ctx context.Context, db *gorm.DB, statements ...string) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL lock_timeout = '" + partitionLockTimeout + "'").Error; err != nil {
+			return err
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// isMissingPartition reports whether err is Postgres refusing a row that
+// no partition of the table covers
+func isMissingPartition(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23514" && strings.HasPrefix(pgErr.Message, "no partition of relation")
+}
+
+// isStaleTable reports whether err means a table is no longer the one a
+// write was prepared for: another process dropped it or swapped in one
+// partitioned differently, so the upsert's conflict target matches no
+// unique constraint
+func isStaleTable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "42P10" || pgErr.Code == "42P01")
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParsePartitionBound(t *testing.T) {
+	tests := []struct {
+		bound string
+		want  string
+	}{
+		{"MINVALUE", "<nil>"},
+		{"MAXVALUE", "<nil>"},
+		{"'2024-05-01 00:00:00+00'", "2024-05-01T00:00:00Z"},
+		{"'2024-05-01 02:00:00+02'", "2024-05-01T00:00:00Z"},
+		{"'2024-05-01 05:30:00+05:30'", "2024-05-01T00:00:00Z"},
+		{"'2024-05-01 00:00:00'", "2024-05-01T00:00:00Z"},
+		{"'2024-05-01 00:00:00.5'", "2024-05-01T00:00:00.5Z"},
+	}
+	for _, tt := range tests {
+		got, err := parsePartitionBound(tt.bound)
+		if err != nil {
+			t.Errorf("parsePartitionBound(%s): %v", tt.bound, err)
+			continue
+		}
+		s := "<nil>"
+		if got != nil {
+			s = got.Format(time.RFC3339Nano)
+		}
+		if s != tt.want {
+			t.Errorf("parsePartitionBound(%s) = %s, want %s", tt.bound, s, tt.want)
+		}
+	}
+	if _, err := parsePartitionBound("'yesterday'"); err == nil {
+		t.Error("parsePartitionBound('yesterday') succeeded")
+	}
+}
+
+func TestPartitionPeriods(t *testing.T) {
+	at := time.Date(2024, 12, 31, 23, 30, 0, 0, time.FixedZone("", -2*60*60)) // 2025-01-01 01:30 UTC
+	tests := []struct {
+		interval   string
+		start      string
+		next       string
+		name       string
+		middleName string // Of a partition starting mid-period
+	}{
+		{PartitionDaily, "2025-01-01", "2025-01-02", "t_p20250101", "t_p20250115"},
+		{PartitionMonthly, "2025-01-01", "2025-02-01", "t_p202501", "t_p20250115"},
+		// Tables stay partitioned monthly after partitioning is turned off
+		{PartitionNone, "2025-01-01", "2025-02-01", "t_p202501", "t_p20250115"},
+	}
+	for _, tt := range tests {
+		s := NewPartitionService(nil, nil, tt.interval, 1, 0, nil, 100, testLogger())
+		if got := s.periodStart(at).Format(time.DateOnly); got != tt.start {
+			t.Errorf("%s periodStart = %s, want %s", tt.interval, got, tt.start)
+		}
+		if got := s.nextPeriod(at).Format(time.DateOnly); got != tt.next {
+			t.Errorf("%s nextPeriod = %s, want %s", tt.interval, got, tt.next)
+		}
+		if got := s.partitionName("t", s.periodStart(at)); got != tt.name {
+			t.Errorf("%s partitionName = %s, want %s", tt.interval, got, tt.name)
+		}
+		if got := s.partitionName("t", time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)); got != tt.middleName {
+			t.Errorf("%s partitionName mid-period = %s, want %s", tt.interval, got, tt.middleName)
+		}
+	}
+}
+
+func TestPartitionContains(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	tests := []struct {
+		partition Partition
+		at        time.Time
+		want      bool
+	}{
+		{Partition{From: &from, To: &to}, from, true},
+		{Partition{From: &from, To: &to}, to, false},
+		{Partition{From: &from, To: &to}, from.Add(-time.Nanosecond), false},
+		{Partition{To: &to}, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{Partition{From: &from}, to.AddDate(10, 0, 0), true},
+		{Partition{Default: true}, from, false},
+	}
+	for i, tt := range tests {
+		if got := tt.partition.contains(tt.at); got != tt.want {
+			t.Errorf("%d: contains(%s) = %v, want %v", i, tt.at, got, tt.want)
+		}
+	}
+}
+
+// partitionNames lists the partitions of table
+func partitionNames(t *testing.T, s *PartitionService, table string) []string {
+	t.Helper()
+	partitions, err := s.List(context.Background(), s.db, table)
+	if err != nil {
+		t.Fatalf("List(%s): %v", table, err)
+	}
+	names := make([]string, len(partitions))
+	for i, p := range partitions {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func TestEnsurePartitionsCreatesTheComingPeriods(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s := NewPartitionService(db, NewTenantDBManager(db, TenantPoolLimits{}), PartitionMonthly, 2, 0, nil, 100, testLogger())
+	table := TableName(1, NFTBidsCategory)
+	if err := db.Exec(NFTBidsCategory.PartitionedTableSQL(table)).Error; err != nil {
+		t.Fatalf("failed to create %s: %v", table, err)
+	}
+
+	if err := s.EnsurePartitions(ctx, db, table); err != nil {
+		t.Fatalf("EnsurePartitions: %v", err)
+	}
+	// Again, with the partitions in place
+	if err := s.EnsurePartitions(ctx, db, table); err != nil {
+		t.Fatalf("second EnsurePartitions: %v", err)
+	}
+	now := s.periodStart(time.Now())
+	var want []string
+	for i := range 3 {
+		want = append(want, s.partitionName(table, now.AddDate(0, i, 0)))
+	}
+	if got := partitionNames(t, s, table); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("partitions = %v, want %v", got, want)
+	}
+
+	// An old row gets its own period's partition
+	old := time.Date(2020, 2, 29, 12, 0, 0, 0, time.UTC)
+	if err := s.EnsurePartitionFor(ctx, db, table, old); err != nil {
+		t.Fatalf("EnsurePartitionFor: %v", err)
+	}
+	if got := partitionNames(t, s, table); got[0] != table+"_p202002" || len(got) != 4 {
+		t.Errorf("partitions after EnsurePartitionFor(%s) = %v", old, got)
+	}
+	args := NFTBidsCategory.InsertArgs(nil, 1, bidValues("Bidder111", "1", old))
+	if err := db.Exec(NFTBidsCategory.PartitionedInsertSQL(table, 1), args...).Error; err != nil {
+		t.Fatalf("failed to insert into the old partition: %v", err)
+	}
+}
+
+func TestEnsurePartitionsFillsGapsUpToExistingPartitions(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s := NewPartitionService(db, NewTenantDBManager(db, TenantPoolLimits{}), PartitionMonthly, 1, 0, nil, 100, testLogger())
+	table := TableName(1, NFTBidsCategory)
+	now := s.periodStart(time.Now())
+	mid := now.AddDate(0, 0, 10)
+	err := db.Exec(NFTBidsCategory.PartitionedTableSQL(table)).Error
+	if err == nil {
+		// A partition starting mid-period, as converting a table leaves behind
+		err = db.Exec(fmt.Sprintf("CREATE TABLE %s_old PARTITION OF %s FOR VALUES FROM (MINVALUE) TO ('%s')",
+			table, table, formatPartitionBound(mid))).Error
+	}
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", table, err)
+	}
+
+	if err := s.EnsurePartitions(ctx, db, table); err != nil {
+		t.Fatalf("EnsurePartitions: %v", err)
+	}
+	want := []string{table + "_old", s.partitionName(table, mid), s.partitionName(table, now.AddDate(0, 1, 0))}
+	if got := partitionNames(t, s, table); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("partitions = %v, want %v", got, want)
+	}
+}
+
+func TestDropExpiredDropsPartitionsEndingBeforeTheCutoff(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s := NewPartitionService(db, NewTenantDBManager(db, TenantPoolLimits{}), PartitionMonthly, 1, 0, nil, 100, testLogger())
+	table := TableName(1, NFTBidsCategory)
+	if err := db.Exec(NFTBidsCategory.PartitionedTableSQL(table)).Error; err != nil {
+		t.Fatalf("failed to create %s: %v", table, err)
+	}
+	for i, at := range []time.Time{
+		time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+	} {
+		if err := s.EnsurePartitionFor(ctx, db, table, at); err != nil {
+			t.Fatalf("EnsurePartitionFor: %v", err)
+		}
+		args := NFTBidsCategory.InsertArgs(nil, uint(i+1), bidValues("Bidder111", "1", at))
+		if err := db.Exec(NFTBidsCategory.PartitionedInsertSQL(table, 1), args...).Error; err != nil {
+			t.Fatalf("failed to insert: %v", err)
+		}
+	}
+	if err := db.Exec("ANALYZE " + table).Error; err != nil {
+		t.Fatalf("failed to analyze %s: %v", table, err)
+	}
+
+	// February ends after the cutoff, so only January goes
+	dropped, err := s.DropExpired(ctx, db, table, time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC), nil, "")
+	if err != nil {
+		t.Fatalf("DropExpired: %v", err)
+	}
+	if dropped != 2 {
+		t.Errorf("DropExpired reported %d rows, want 2", dropped)
+	}
+	want := []string{table + "_p202402", table + "_p202403"}
+	if got := partitionNames(t, s, table); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("partitions = %v, want %v", got, want)
+	}
+	if n := countRows(t, db, table); n != 2 {
+		t.Errorf("%d rows left, want 2", n)
+	}
+}
+
+func TestMaintainKeepsEventsForTheLongestPolicy(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s := NewPartitionService(db, NewTenantDBManager(db, TenantPoolLimits{}), PartitionDaily, 1, 30, nil, 100, testLogger())
+	if err := s.Maintain(ctx); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+	if partitioned, err := s.IsPartitioned(ctx, db, EventsTable); err != nil || !partitioned {
+		t.Fatalf("IsPartitioned(%s) = %v, %v after Maintain", EventsTable, partitioned, err)
+	}
+
+	// The legacy partition holds everything up to the conversion; take it
+	// out so older events get partitions of their own
+	err := db.Exec(fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", EventsTable, eventsLegacyPartition)).Error
+	if err == nil {
+		err = db.Exec("DROP TABLE " + eventsLegacyPartition).Error
+	}
+	if err != nil {
+		t.Fatalf("failed to drop the legacy partition: %v", err)
+	}
+	old := time.Now().AddDate(0, 0, -60)
+	if err := s.EnsurePartitionFor(ctx, db, EventsTable, old); err != nil {
+		t.Fatalf("EnsurePartitionFor: %v", err)
+	}
+	oldPartition := s.partitionName(EventsTable, s.periodStart(old))
+
+	orgID, _ := createTestOrganization(t, db, 0)
+	policy := models.RetentionPolicy{OrganizationID: orgID, Target: models.RetentionEvents, MaxAgeDays: 90}
+	if err := db.Create(&policy).Error; err != nil {
+		t.Fatalf("failed to create retention policy: %v", err)
+	}
+	if err := s.Maintain(ctx); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+	if got := partitionNames(t, s, EventsTable); got[0] != oldPartition {
+		t.Fatalf("partitions = %v, want %s kept for the 90 day policy", got, oldPartition)
+	}
+
+	if err := db.Delete(&policy).Error; err != nil {
+		t.Fatalf("failed to delete retention policy: %v", err)
+	}
+	if err := s.Maintain(ctx); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+	got := partitionNames(t, s, EventsTable)
+	if got[0] == oldPartition {
+		t.Errorf("partitions = %v, want %s dropped past the 30 day retention", got, oldPartition)
+	}
+	if got[len(got)-1] != EventsTable+"_default" {
+		t.Errorf("partitions = %v, want the default partition kept", got)
+	}
+}
@@ -0,0 +1,436 @@
+package services
+
+import (
+	"backend/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultQueryLimit = 50
+	maxQueryLimit     = 500
+)
+
+var (
+	ErrUnknownCategory = errors.New("unknown data category")
+	ErrInvalidField    = errors.New("invalid field")
+	ErrInvalidSort     = errors.New("invalid sort field")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrFilterNotValid  = errors.New("filter does not apply to this category")
+)
+
+// DataQuery filters, sorts and pages an indexed category
+type DataQuery struct {
+	Address     string
+	Marketplace string
+	Platform    string
+	From        time.Time
+	To          time.Time
+	MinAmount   *float64
+	MaxAmount   *float64
+	Sort        string // column name, prefixed with "-" for descending
+	Cursor      string
+	Limit       int
+	Fields      []string
+}
+
+// DataPage is one page of rows from an indexed category
+type DataPage struct {
+	Rows       []map[string]interface{} `json:"rows"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// queryCursor identifies the last row of a page by its sort key. The sort
+// value is kept as text so decimals keep their precision.
+type queryCursor struct {
+	Value     string `json:"v"`
+	WebhookID uint   `json:"w"`
+	ID        int64  `json:"i"`
+}
+
+// QueryService reads indexed data from each organization's tenant database
+type QueryService struct {
+	db      *gorm.DB
+	tenants *TenantDBManager
+
+	mu sync.Mutex
+	// Category tables known to exist, per tenant pool
+	tables map[ensuredTable]struct{}
+}
+
+func NewQueryService(db *gorm.DB, tenants *TenantDBManager) *QueryService {
+	s := &QueryService{db: db, tenants: tenants, tables: make(map[ensuredTable]struct{})}
+	tenants.BeforeClose(s.forgetTables)
+	return s
+}
+
+// Query returns rows of categoryName across all of orgID's webhooks
+func (s *QueryService) Query(orgID uint, categoryName string, q DataQuery) (*DataPage, error) {
+	category, ok := CategoryByName(categoryName)
+	if !ok {
+		return nil, ErrUnknownCategory
+	}
+
+	sortColumn, desc := "timestamp", true
+	if q.Sort != "" {
+		sortColumn, desc = strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+	}
+	if _, ok := category.Column(sortColumn); !ok && sortColumn != "id" && sortColumn != "created_at" {
+		return nil, ErrInvalidSort
+	}
+
+	fields, err := selectFields(category, q.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = defaultQueryLimit
+	}
+	if q.Limit > maxQueryLimit {
+		q.Limit = maxQueryLimit
+	}
+
+	tenantDB, err := s.tenants.ForOrganization(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args, err := buildDataFilters(category, q)
+	if err != nil {
+		return nil, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		value, err := cursorArg(tenantDB.Dialector.Name(), category, sortColumn, cursor.Value)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, fmt.Sprintf("(%s, webhook_id, id) %s (?, ?, ?)", sortColumn, comparison))
+		args = append(args, value, cursor.WebhookID, cursor.ID)
+	}
+
+	page := &DataPage{Rows: []map[string]interface{}{}}
+	var rows []map[string]interface{}
+	for attempt := 0; ; attempt++ {
+		source, err := s.unionSource(tenantDB, orgID, category)
+		if err != nil {
+			return nil, err
+		}
+		if source == "" {
+			return page, nil
+		}
+
+		sql := "SELECT * FROM (" + source + ") AS data"
+		if len(where) > 0 {
+			sql += " WHERE " + strings.Join(where, " AND ")
+		}
+		sql += fmt.Sprintf(" ORDER BY %[1]s %[2]s, webhook_id %[2]s, id %[2]s LIMIT %[3]d", sortColumn, direction, q.Limit+1)
+
+		err = tenantDB.Raw(sql, args...).Scan(&rows).Error
+		if isStaleTable(err) && attempt == 0 {
+			// A table known to exist has since been dropped
+			s.forgetTables(tenantDB)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", category.Name, err)
+		}
+		break
+	}
+
+	if len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		last := rows[len(rows)-1]
+		page.NextCursor = encodeCursor(queryCursor{
+			Value:     cursorValue(last[sortColumn]),
+			WebhookID: uint(toInt64(last["webhook_id"])),
+			ID:        toInt64(last["id"]),
+		})
+	}
+
+	for _, row := range rows {
+		page.Rows = append(page.Rows, projectRow(row, fields))
+	}
+	return page, nil
+}
+
+// unionSource builds a UNION ALL over the organization's existing tables
+// for category, or returns "" when there are none. The database is only
+// asked which tables exist when a webhook's table isn't known to yet.
+func (s *QueryService) unionSource(tenantDB *gorm.DB, orgID uint, category *Category) (string, error) {
+	var webhookIDs []uint
+	err := s.db.Model(&models.HeliusWebhook{}).
+		Where("organization_id = ?", orgID).
+		Order("id").
+		Pluck("id", &webhookIDs).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	s.mu.Lock()
+	unknown := false
+	for _, id := range webhookIDs {
+		if _, ok := s.tables[ensuredTable{db: tenantDB, table: TableName(id, category)}]; !ok {
+			unknown = true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if unknown {
+		tables, err := tenantDB.Migrator().GetTables()
+		if err != nil {
+			return "", fmt.Errorf("failed to list tables: %w", err)
+		}
+		s.mu.Lock()
+		for _, table := range tables {
+			s.tables[ensuredTable{db: tenantDB, table: table}] = struct{}{}
+		}
+		s.mu.Unlock()
+	}
+
+	columns := "id, " + strings.Join(category.ColumnNames(), ", ") + ", created_at"
+	final := ""
+	if dialectFor(tenantDB.Dialector.Name()).explicitID {
+		// Collapses rows written twice that ClickHouse hasn't merged yet
+		final = " FINAL"
+	}
+	var parts []string
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range webhookIDs {
+		table := TableName(id, category)
+		if _, ok := s.tables[ensuredTable{db: tenantDB, table: table}]; !ok {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("SELECT %d AS webhook_id, %s FROM %s%s", id, columns, table, final))
+	}
+	return strings.Join(parts, " UNION ALL "), nil
+}
+
+// forgetTables drops what is known about db's tables
+func (s *QueryService) forgetTables(db *gorm.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.tables {
+		if key.db == db {
+			delete(s.tables, key)
+		}
+	}
+}
+
+func buildDataFilters(category *Category, q DataQuery) ([]string, []interface{}, error) {
+	var where []string
+	var args []interface{}
+
+	if q.Address != "" {
+		if len(category.AddressColumns) == 0 {
+			return nil, nil, fmt.Errorf("%w: address", ErrFilterNotValid)
+		}
+		var ors []string
+		for _, col := range category.AddressColumns {
+			ors = append(ors, col+" = ?")
+			args = append(args, q.Address)
+		}
+		where = append(where, "("+strings.Join(ors, " OR ")+")")
+	}
+	if q.Marketplace != "" {
+		if category.MarketplaceColumn == "" {
+			return nil, nil, fmt.Errorf("%w: marketplace", ErrFilterNotValid)
+		}
+		where = append(where, category.MarketplaceColumn+" = ?")
+		args = append(args, q.Marketplace)
+	}
+	if q.Platform != "" {
+		if category.PlatformColumn == "" {
+			return nil, nil, fmt.Errorf("%w: platform", ErrFilterNotValid)
+		}
+		where = append(where, category.PlatformColumn+" = ?")
+		args = append(args, q.Platform)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, q.To)
+	}
+	if q.MinAmount != nil {
+		where = append(where, category.AmountColumn+" >= ?")
+		args = append(args, *q.MinAmount)
+	}
+	if q.MaxAmount != nil {
+		where = append(where, category.AmountColumn+" <= ?")
+		args = append(args, *q.MaxAmount)
+	}
+	return where, args, nil
+}
+
+// selectFields validates the requested fields, defaulting to every column.
+// webhook_id is synthesised by the query so rows from several webhooks can
+// be told apart.
+func selectFields(category *Category, requested []string) ([]Column, error) {
+	all := []Column{{Name: "id"}, {Name: "webhook_id"}}
+	all = append(all, category.Columns...)
+	all = append(all, Column{Name: "created_at", Type: ColumnTimestamp})
+	if len(requested) == 0 {
+		return all, nil
+	}
+
+	var fields []Column
+	for _, name := range requested {
+		found := false
+		for _, col := range all {
+			if col.Name == name {
+				fields = append(fields, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidField, name)
+		}
+	}
+	return fields, nil
+}
+
+// projectRow keeps the selected fields and normalises driver-specific
+// values into JSON-friendly types
+func projectRow(row map[string]interface{}, fields []Column) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	for _, col := range fields {
+		value := row[col.Name]
+		if col.Type == ColumnDecimal {
+			value = toFloat64(value)
+		}
+		out[col.Name] = value
+	}
+	return out
+}
+
+func encodeCursor(c queryCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*queryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c queryCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// cursorValue formats a row's sort value as cursor text
+func cursorValue(v interface{}) string {
+	switch n := v.(type) {
+	case string:
+		return n
+	case []byte:
+		return string(n)
+	case time.Time:
+		return n.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	case fmt.Stringer:
+		return n.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// cursorArg checks a cursor's sort value and returns it for binding.
+// Decimals are bound as text, which the database converts exactly, except
+// on ClickHouse, which stores them as floats and doesn't compare those with
+// text.
+func cursorArg(driver string, category *Category, sortColumn, value string) (interface{}, error) {
+	if sortColumn == "id" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return id, nil
+	}
+	column, ok := category.Column(sortColumn)
+	if sortColumn == "created_at" {
+		column, ok = Column{Name: sortColumn, Type: ColumnTimestamp}, true
+	}
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	switch column.Type {
+	case ColumnDecimal:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		if driver == models.DriverClickHouse {
+			return f, nil
+		}
+	case ColumnTimestamp:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return t, nil
+	}
+	return value, nil
+}
+
+func toFloat64(v interface{}) interface{} {
+	switch n := v.(type) {
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return f
+		}
+	case []byte:
+		if f, err := strconv.ParseFloat(string(n), 64); err == nil {
+			return f
+		}
+	case fmt.Stringer:
+		if f, err := strconv.ParseFloat(n.String(), 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
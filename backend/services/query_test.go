@@ -0,0 +1,156 @@
+package services
+
+import (
+	"backend/models"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCursorKeepsTheSortValue(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	tests := []struct {
+		name   string
+		driver string
+		column string
+		value  interface{}
+		want   interface{}
+	}{
+		// Postgres returns DECIMAL as text, which float64 would round
+		{"decimal text", models.DriverPostgres, "amount", "12345678901234.123456789012345678", "12345678901234.123456789012345678"},
+		{"decimal bytes", models.DriverMySQL, "amount", []byte("0.100000000000000001"), "0.100000000000000001"},
+		{"clickhouse float", models.DriverClickHouse, "amount", 0.1, 0.1},
+		{"timestamp", models.DriverPostgres, "timestamp", at, at},
+		{"created_at", models.DriverPostgres, "created_at", at, at},
+		{"text", models.DriverPostgres, "bidder", "Bidder111", "Bidder111"},
+		{"id", models.DriverPostgres, "id", int64(42), uint64(42)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(queryCursor{Value: cursorValue(tt.value), WebhookID: 3, ID: 7})
+			cursor, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			if cursor.WebhookID != 3 || cursor.ID != 7 {
+				t.Errorf("cursor = %+v, want webhook 3 and id 7", cursor)
+			}
+			got, err := cursorArg(tt.driver, NFTBidsCategory, tt.column, cursor.Value)
+			if err != nil {
+				t.Fatalf("cursorArg: %v", err)
+			}
+			if want, ok := tt.want.(time.Time); ok {
+				if g, ok := got.(time.Time); !ok || !g.Equal(want) {
+					t.Errorf("cursorArg = %v, want %v", got, want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("cursorArg = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidCursorsAreRejected(t *testing.T) {
+	for _, raw := range []string{"%%%", "bm90IGpzb24"} {
+		if _, err := decodeCursor(raw); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) = %v, want ErrInvalidCursor", raw, err)
+		}
+	}
+
+	tests := []struct {
+		column string
+		value  string
+	}{
+		{"amount", "1; DROP TABLE users"},
+		{"timestamp", "yesterday"},
+		{"id", "-1"},
+		{"price", "1"}, // Not an nft_bids column
+	}
+	for _, tt := range tests {
+		if _, err := cursorArg(models.DriverPostgres, NFTBidsCategory, tt.column, tt.value); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursorArg(%s, %q) = %v, want ErrInvalidCursor", tt.column, tt.value, err)
+		}
+	}
+}
+
+func TestQueryPagesThroughEveryRow(t *testing.T) {
+	db := testDB(t)
+	tenants := NewTenantDBManager(db, TenantPoolLimits{})
+	queries := NewQueryService(db, tenants)
+	orgID, webhooks := createTestOrganization(t, db, 3)
+
+	// Amounts tie across webhooks and differ only beyond float64 precision
+	amounts := []string{"5", "0.1000000000000000001", "0.1", "5", "0.1000000000000000001", "7.25", "0.1"}
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	insert := func(webhookID uint, values []string) {
+		t.Helper()
+		table := TableName(webhookID, NFTBidsCategory)
+		if err := db.Exec(NFTBidsCategory.CreateTableSQL(models.DriverPostgres, table)).Error; err != nil {
+			t.Fatalf("failed to create %s: %v", table, err)
+		}
+		for i, amount := range values {
+			args := NFTBidsCategory.InsertArgs(nil, uint(i+1), bidValues("Bidder111", amount, at.Add(time.Duration(i)*time.Minute)))
+			if err := db.Exec(NFTBidsCategory.InsertSQL(models.DriverPostgres, table, 1), args...).Error; err != nil {
+				t.Fatalf("failed to insert into %s: %v", table, err)
+			}
+		}
+	}
+	// The third webhook has no table yet
+	insert(webhooks[0], amounts[:4])
+	insert(webhooks[1], amounts[4:])
+
+	pageThrough := func(sort string, limit int) []string {
+		t.Helper()
+		var seen []string
+		q := DataQuery{Sort: sort, Limit: limit}
+		for pages := 0; ; pages++ {
+			if pages > 20 {
+				t.Fatal("pagination doesn't end")
+			}
+			page, err := queries.Query(orgID, NFTBidsCategory.Name, q)
+			if err != nil {
+				t.Fatalf("Query(%+v): %v", q, err)
+			}
+			for _, row := range page.Rows {
+				seen = append(seen, fmt.Sprintf("%v/%v", row["webhook_id"], row["id"]))
+			}
+			if page.NextCursor == "" {
+				return seen
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+
+	for _, sort := range []string{"-amount", "amount", "timestamp", "-created_at", "id"} {
+		all := pageThrough(sort, maxQueryLimit)
+		if len(all) != len(amounts) {
+			t.Fatalf("sorted by %s, one page holds %d rows, want %d", sort, len(all), len(amounts))
+		}
+		paged := pageThrough(sort, 2)
+		if fmt.Sprint(paged) != fmt.Sprint(all) {
+			t.Errorf("sorted by %s, pages of 2 returned %v, want %v", sort, paged, all)
+		}
+	}
+
+	// Rows equal as float64 but not as DECIMAL are told apart by the cursor
+	page, err := queries.Query(orgID, NFTBidsCategory.Name, DataQuery{Sort: "amount", Limit: 2})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	page, err = queries.Query(orgID, NFTBidsCategory.Name, DataQuery{Sort: "amount", Limit: 10, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(page.Rows) != 5 {
+		t.Errorf("second page after both 0.1 rows has %d rows, want 5", len(page.Rows))
+	}
+
+	// A table created after the first query is picked up
+	insert(webhooks[2], []string{"9"})
+	if all := pageThrough("-amount", maxQueryLimit); len(all) != len(amounts)+1 || all[0] != fmt.Sprintf("%d/1", webhooks[2]) {
+		t.Errorf("after creating the third webhook's table, rows are %v", all)
+	}
+}
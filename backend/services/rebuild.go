@@ -0,0 +1,763 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// RebuildTableSuffix names the table a rebuild fills next to the live
+	// one, such as user_7_nft_bids_next
+	RebuildTableSuffix = "_next"
+	// RetiredTableSuffix names the live table a rebuild replaced, kept for
+	// rollback until the job's retention period ends
+	RetiredTableSuffix = "_old"
+
+	rebuildPollInterval = 10 * time.Second
+)
+
+var (
+	ErrRebuildNotFound = errors.New("rebuild job not found")
+	ErrRebuildActive   = errors.New("table has a rebuild in progress or awaiting cleanup")
+	ErrRebuildSink     = errors.New("organization streams events instead of writing database tables")
+	ErrRebuildState    = errors.New("rebuild job is not in a state that allows this")
+	ErrRebuildVerify   = errors.New("rebuilt table does not cover the live table")
+)
+
+// RebuildService rebuilds a webhook's category table from its stored
+// events without downtime. A job replays every stored event of the
+// category, including ones never processed, into the _next table, catches
+// up with events received meanwhile, copies over the live rows whose events
+// were pruned, compares the result with the live table and swaps the two by
+// renaming them. The replaced table is kept as
+// _old so the swap can be rolled back until the retention period ends.
+type RebuildService struct {
+	db         *gorm.DB
+	tenants    *TenantDBManager
+	sinks      *SinkManager
+	partitions *PartitionService
+	replays    *ReplayService
+	helius     *HeliusService
+	retention  time.Duration
+	logger     *slog.Logger
+}
+
+// NewRebuildService creates a service that keeps replaced tables for
+// retention after a swap
+func NewRebuildService(db *gorm.DB, tenants *TenantDBManager, sinks *SinkManager, partitions *PartitionService, replays *ReplayService, helius *HeliusService, retention time.Duration, logger *slog.Logger) *RebuildService {
+	return &RebuildService{
+		db:         db,
+		tenants:    tenants,
+		sinks:      sinks,
+		partitions: partitions,
+		replays:    replays,
+		helius:     helius,
+		retention:  retention,
+		logger:     logger,
+	}
+}
+
+// Create queues a rebuild of one of a webhook's category tables. With
+// force the swap goes ahead even if live rows are missing from the rebuilt
+// table, for example because a filter now drops them.
+func (s *RebuildService) Create(webhookID uint, categoryName string, force bool, requestedByID uint) (*models.RebuildJob, error) {
+	var webhook models.HeliusWebhook
+	if err := s.db.First(&webhook, webhookID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load webhook %d: %w", webhookID, err)
+	}
+	if _, ok := CategoryByName(categoryName); !ok {
+		return nil, ErrUnknownCategory
+	}
+	sink, release, err := s.sinks.ForOrganization(webhook.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	release()
+	if sink != Sink(s.sinks.Database()) {
+		return nil, ErrRebuildSink
+	}
+
+	var active int64
+	err = s.db.Model(&models.RebuildJob{}).
+		Where("webhook_id = ? AND category = ? AND status IN ?", webhook.ID, categoryName, []string{
+			models.RebuildPending, models.RebuildBuilding, models.RebuildVerifying, models.RebuildSwapped,
+		}).Count(&active).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rebuild jobs: %w", err)
+	}
+	if active > 0 {
+		return nil, ErrRebuildActive
+	}
+
+	job := &models.RebuildJob{
+		OrganizationID: webhook.OrganizationID,
+		WebhookID:      webhook.ID,
+		Category:       categoryName,
+		Status:         models.RebuildPending,
+		Force:          force,
+		RequestedByID:  requestedByID,
+	}
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to create rebuild job: %w", err)
+	}
+	return job, nil
+}
+
+// List returns the rebuild jobs of a webhook, or of every webhook when
+// webhookID is zero, newest first
+func (s *RebuildService) List(webhookID uint) ([]models.RebuildJob, error) {
+	query := s.db.Order("id DESC")
+	if webhookID != 0 {
+		query = query.Where("webhook_id = ?", webhookID)
+	}
+	var jobs []models.RebuildJob
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list rebuild jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Get returns a rebuild job
+func (s *RebuildService) Get(id uint) (*models.RebuildJob, error) {
+	var job models.RebuildJob
+	err := s.db.First(&job, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRebuildNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rebuild job: %w", err)
+	}
+	return &job, nil
+}
+
+// Cancel stops a rebuild that hasn't started swapping. The partly built
+// table is left for inspection and dropped by the next rebuild.
+func (s *RebuildService) Cancel(id uint) (*models.RebuildJob, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	result := s.db.Model(job).Where("status IN ?", []string{models.RebuildPending, models.RebuildBuilding}).
+		Updates(map[string]interface{}{"status": models.RebuildCancelled, "finished_at": time.Now()})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to cancel rebuild job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrRebuildState
+	}
+	if job.ReplayJobID != 0 {
+		if _, err := s.replays.Cancel(0, job.ReplayJobID); err != nil {
+			return nil, err
+		}
+	}
+	return s.Get(id)
+}
+
+// Run advances queued and building jobs one at a time until ctx is
+// cancelled, and drops replaced tables whose retention period has ended
+func (s *RebuildService) Run(ctx context.Context) {
+	ticker := time.NewTicker(rebuildPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var ids []uint
+			err := s.db.Model(&models.RebuildJob{}).
+				Where("status IN ? OR (status = ? AND updated_at < ?)",
+					[]string{models.RebuildPending, models.RebuildBuilding},
+					models.RebuildVerifying, time.Now().Add(-replayStaleAfter)).
+				Order("id").Pluck("id", &ids).Error
+			if err != nil {
+				s.logger.Error("failed to poll rebuild jobs", "error", err)
+				continue
+			}
+			for _, id := range ids {
+				if err := s.Execute(ctx, id, nil); err != nil && ctx.Err() == nil {
+					s.logger.Error("rebuild job failed", "rebuild_id", id, "error", err)
+				}
+				if ctx.Err() != nil {
+					return
+				}
+			}
+
+			var expired []uint
+			err = s.db.Model(&models.RebuildJob{}).
+				Where("status = ? AND retain_until < ?", models.RebuildSwapped, time.Now()).
+				Order("id").Pluck("id", &expired).Error
+			if err != nil {
+				s.logger.Error("failed to poll swapped rebuild jobs", "error", err)
+				continue
+			}
+			for _, id := range expired {
+				if _, err := s.Finalize(ctx, id); err != nil {
+					s.logger.Error("failed to drop replaced table", "rebuild_id", id, "error", err)
+				}
+			}
+		}
+	}
+}
+
+// Execute takes a job as far as it can: it prepares the _next table,
+// replays events into it, calling progress after each batch, then verifies
+// and swaps. If ctx is cancelled during the replay the job resumes from
+// its last saved event next time.
+func (s *RebuildService) Execute(ctx context.Context, id uint, progress func(*models.ReplayJob)) error {
+	job, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if job.Status == models.RebuildPending {
+		if err := s.prepare(ctx, job); err != nil {
+			return s.fail(job, err)
+		}
+	}
+
+	if job.Status == models.RebuildBuilding {
+		err := s.replays.Execute(ctx, job.ReplayJobID, progress)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && !errors.Is(err, ErrReplayNotClaimable) {
+			s.logger.WarnContext(ctx, "rebuild replay stopped", "rebuild_id", job.ID, "error", err)
+		}
+		replay, err := s.replays.Get(0, job.ReplayJobID)
+		if err != nil {
+			return err
+		}
+		switch replay.Status {
+		case models.ReplayCompleted:
+		case models.ReplayPending, models.ReplayRunning:
+			// Running in another process, which finishes the job
+			return nil
+		default:
+			return s.fail(job, fmt.Errorf("replay %d %s: %s", replay.ID, replay.Status, replay.LastError))
+		}
+
+		result := s.db.Model(job).Where("status = ?", models.RebuildBuilding).Updates(map[string]interface{}{
+			"status":        models.RebuildVerifying,
+			"last_event_id": replay.LastEventID,
+		})
+		if result.Error != nil {
+			return fmt.Errorf("failed to save rebuild job: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+	} else if job.Status == models.RebuildVerifying {
+		// Left behind by a process that stopped mid-swap
+		result := s.db.Model(job).
+			Where("status = ? AND updated_at < ?", models.RebuildVerifying, time.Now().Add(-replayStaleAfter)).
+			Update("last_error", "")
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim rebuild job: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrRebuildState
+		}
+	} else {
+		return ErrRebuildState
+	}
+
+	return s.finish(ctx, job)
+}
+
+// prepare creates an empty _next table and the replay that fills it
+func (s *RebuildService) prepare(ctx context.Context, job *models.RebuildJob) error {
+	category, _ := CategoryByName(job.Category)
+	db, err := s.tenants.ForOrganization(job.OrganizationID)
+	if err != nil {
+		return err
+	}
+	next := TableName(job.WebhookID, category) + RebuildTableSuffix
+
+	// Left over from a cancelled, failed or rolled back rebuild
+	if err := db.WithContext(ctx).Exec("DROP TABLE IF EXISTS " + next).Error; err != nil {
+		return fmt.Errorf("failed to drop %s: %w", next, err)
+	}
+	s.sinks.Database().Forget(db, next)
+	// Created like any new table, so a rebuild also partitions a table
+	// created before partitioning was turned on
+	if err := s.sinks.Database().Ensure(ctx, db, category, next); err != nil {
+		return err
+	}
+
+	replay := &models.ReplayJob{
+		OrganizationID: job.OrganizationID,
+		WebhookID:      job.WebhookID,
+		Category:       job.Category,
+		Target:         ReplayTargetRebuild,
+		RatePerSecond:  s.replays.defaultRate,
+		Status:         models.ReplayPending,
+		RequestedByID:  job.RequestedByID,
+	}
+	if err := s.replays.create(replay); err != nil {
+		return err
+	}
+
+	result := s.db.Model(job).Where("status = ?", models.RebuildPending).Updates(map[string]interface{}{
+		"status":        models.RebuildBuilding,
+		"replay_job_id": replay.ID,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to save rebuild job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrRebuildState
+	}
+	job.Status = models.RebuildBuilding
+	job.ReplayJobID = replay.ID
+	return nil
+}
+
+// finish catches the _next table up, compares it with the live table,
+// swaps them if every live row is covered and catches the new live table up
+func (s *RebuildService) finish(ctx context.Context, job *models.RebuildJob) error {
+	category, _ := CategoryByName(job.Category)
+	db, err := s.tenants.ForOrganization(job.OrganizationID)
+	if err != nil {
+		return s.fail(job, err)
+	}
+	live := TableName(job.WebhookID, category)
+	next := live + RebuildTableSuffix
+	old := live + RetiredTableSuffix
+	logger := s.logger.With("rebuild_id", job.ID, "table", live)
+
+	// A process that stopped right after swapping leaves no _next table
+	hasLive := true
+	migrator := db.WithContext(ctx).Migrator()
+	if migrator.HasTable(next) || !migrator.HasTable(old) {
+		if hasLive, err = s.verifyAndSwap(ctx, db, category, job, logger); err != nil {
+			return s.fail(job, err)
+		}
+	}
+
+	// Events written between the last catch-up and the swap went to the
+	// replaced table; rewriting them is harmless for the others
+	updates := map[string]interface{}{"status": models.RebuildSwapped}
+	if _, err := s.catchUp(ctx, job, job.LastEventID, ""); err != nil {
+		logger.ErrorContext(ctx, "failed to catch up swapped table", "error", err)
+		updates["last_error"] = fmt.Sprintf("catching up after the swap: %v", err)
+	}
+	now := time.Now()
+	updates["swapped_at"] = now
+	if hasLive {
+		updates["retain_until"] = now.Add(s.retention)
+	} else {
+		updates["status"] = models.RebuildCompleted
+		updates["finished_at"] = now
+	}
+	if err := s.db.Model(job).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to save rebuild job: %w", err)
+	}
+	return nil
+}
+
+// verifyAndSwap catches the _next table up and swaps it in if it covers the
+// live table. It reports whether there was a live table to replace.
+func (s *RebuildService) verifyAndSwap(ctx context.Context, db *gorm.DB, category *Category, job *models.RebuildJob, logger *slog.Logger) (bool, error) {
+	live := TableName(job.WebhookID, category)
+	next := live + RebuildTableSuffix
+	old := live + RetiredTableSuffix
+
+	lastEventID, err := s.catchUp(ctx, job, job.LastEventID, RebuildTableSuffix)
+	if err != nil {
+		return false, fmt.Errorf("failed to catch up %s: %w", next, err)
+	}
+	job.LastEventID = lastEventID
+
+	carried, err := s.carryOver(ctx, db, category, job, live, next)
+	if err != nil {
+		return false, err
+	}
+	if carried > 0 {
+		logger.InfoContext(ctx, "copied live rows whose events are no longer stored", "rows", carried)
+	}
+
+	if err := s.compare(ctx, db, category, live, next, job); err != nil {
+		return false, err
+	}
+	err = s.db.Model(job).Select("last_event_id", "live_rows", "next_rows", "legacy_rows", "missing_rows",
+		"added_rows", "changed_rows", "live_checksum", "next_checksum").Updates(job).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to save rebuild job: %w", err)
+	}
+	logger.InfoContext(ctx, "rebuilt table compared", "live_rows", job.LiveRows, "next_rows", job.NextRows,
+		"missing", job.MissingRows, "added", job.AddedRows, "changed", job.ChangedRows, "legacy", job.LegacyRows)
+	if (job.MissingRows > 0 || job.LegacyRows > 0) && !job.Force {
+		return false, fmt.Errorf("%w: %d live rows missing, %d without an event ID; rebuild with force to swap anyway",
+			ErrRebuildVerify, job.MissingRows, job.LegacyRows)
+	}
+
+	renames := [][2]string{{next, live}}
+	hasLive := db.WithContext(ctx).Migrator().HasTable(live)
+	if hasLive {
+		if db.WithContext(ctx).Migrator().HasTable(old) {
+			return false, fmt.Errorf("%s still exists from an earlier rebuild; drop it first", old)
+		}
+		renames = [][2]string{{live, old}, {next, live}}
+	}
+	if err := s.rename(ctx, db, renames); err != nil {
+		return false, err
+	}
+	s.sinks.Database().Forget(db, live, next, old)
+	logger.InfoContext(ctx, "rebuilt table swapped in")
+	return hasLive, nil
+}
+
+// Rollback swaps the replaced table back in. Events received since the
+// swap are written to it again with the current processors.
+func (s *RebuildService) Rollback(ctx context.Context, id uint) (*models.RebuildJob, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.RebuildSwapped {
+		return nil, ErrRebuildState
+	}
+	category, _ := CategoryByName(job.Category)
+	db, err := s.tenants.ForOrganization(job.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	live := TableName(job.WebhookID, category)
+	next := live + RebuildTableSuffix
+	old := live + RetiredTableSuffix
+
+	if err := s.rename(ctx, db, [][2]string{{live, next}, {old, live}}); err != nil {
+		return nil, err
+	}
+	s.sinks.Database().Forget(db, live, next, old)
+
+	updates := map[string]interface{}{"status": models.RebuildRolledBack, "finished_at": time.Now()}
+	if _, err := s.catchUp(ctx, job, job.LastEventID, ""); err != nil {
+		updates["last_error"] = fmt.Sprintf("catching up after the rollback: %v", err)
+	}
+	if err := s.db.Model(job).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to save rebuild job: %w", err)
+	}
+	return s.Get(id)
+}
+
+// Finalize drops the table a swap replaced, ending the rollback period
+func (s *RebuildService) Finalize(ctx context.Context, id uint) (*models.RebuildJob, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.RebuildSwapped {
+		return nil, ErrRebuildState
+	}
+	category, _ := CategoryByName(job.Category)
+	db, err := s.tenants.ForOrganization(job.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	old := TableName(job.WebhookID, category) + RetiredTableSuffix
+	if err := db.WithContext(ctx).Exec("DROP TABLE IF EXISTS " + old).Error; err != nil {
+		return nil, fmt.Errorf("failed to drop %s: %w", old, err)
+	}
+	err = s.db.Model(job).Where("status = ?", models.RebuildSwapped).
+		Updates(map[string]interface{}{"status": models.RebuildCompleted, "finished_at": time.Now()}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save rebuild job: %w", err)
+	}
+	return s.Get(id)
+}
+
+// rename applies renames atomically: in one transaction on Postgres, whose
+// DDL is transactional, as one statement on MySQL and with EXCHANGE TABLES
+// on ClickHouse
+func (s *RebuildService) rename(ctx context.Context, db *gorm.DB, renames [][2]string) error {
+	renames, err := s.partitions.PartitionRenames(ctx, db, renames)
+	if err != nil {
+		return err
+	}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, statement := range RenameTablesSQL(db.Dialector.Name(), renames) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to swap tables: %w", err)
+	}
+	return nil
+}
+
+// catchUp writes the job's events after afterID to the tables with suffix
+// and returns the ID of the last one. Events that fail are logged and
+// skipped, as in a replay.
+func (s *RebuildService) catchUp(ctx context.Context, job *models.RebuildJob, afterID uint, suffix string) (uint, error) {
+	category, _ := CategoryByName(job.Category)
+	lastID := afterID
+	for {
+		var batch []models.WebhookEvent
+		err := s.db.WithContext(ctx).
+			Where("webhook_id = ? AND event_type = ? AND id > ?", job.WebhookID, category.EventType, lastID).
+			Order("id").Limit(replayBatchSize).Find(&batch).Error
+		if err != nil {
+			return lastID, fmt.Errorf("failed to load events: %w", err)
+		}
+		for i := range batch {
+			if err := s.helius.Reprocess(ctx, &batch[i], ReprocessOptions{TableSuffix: suffix}); err != nil {
+				if ctx.Err() != nil {
+					return lastID, ctx.Err()
+				}
+				s.logger.WarnContext(ctx, "failed to catch up event", "rebuild_id", job.ID,
+					"event_id", batch[i].ID, "error", err)
+			}
+			lastID = batch[i].ID
+		}
+		if len(batch) < replayBatchSize {
+			return lastID, nil
+		}
+	}
+}
+
+// carryOver copies the live rows whose events are no longer stored, such as
+// ones pruned by a retention policy, to the _next table, since replaying
+// can't rebuild them. Rows without an event ID are left for compare.
+func (s *RebuildService) carryOver(ctx context.Context, db *gorm.DB, category *Category, job *models.RebuildJob, live, next string) (int64, error) {
+	if !db.WithContext(ctx).Migrator().HasTable(live) {
+		return 0, nil
+	}
+	rows, err := db.WithContext(ctx).Raw(category.SelectRowsSQL(db.Dialector.Name(), live)).Rows()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", live, err)
+	}
+	defer rows.Close()
+
+	var carried int64
+	batch := make([]*SinkRecord, 0, replayBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(batch))
+		for i, record := range batch {
+			ids[i] = record.EventID
+		}
+		var stored []uint
+		err := s.db.WithContext(ctx).Model(&models.WebhookEvent{}).Where("id IN ?", ids).Pluck("id", &stored).Error
+		if err != nil {
+			return fmt.Errorf("failed to load events: %w", err)
+		}
+		replayed := make(map[uint]bool, len(stored))
+		for _, id := range stored {
+			replayed[id] = true
+		}
+		var orphans []*SinkRecord
+		for _, record := range batch {
+			if !replayed[record.EventID] {
+				orphans = append(orphans, record)
+			}
+		}
+		batch = batch[:0]
+		if len(orphans) == 0 {
+			return nil
+		}
+
+		sink := s.sinks.Database()
+		if err := sink.insert(ctx, db, next, orphans); err != nil {
+			// Written one at a time, old rows may need partitions created
+			for _, record := range orphans {
+				if err := sink.insert(ctx, db, next, []*SinkRecord{record}); err != nil {
+					return fmt.Errorf("failed to copy event %d to %s: %w", record.EventID, next, err)
+				}
+			}
+		}
+		carried += int64(len(orphans))
+		return nil
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(category.Columns)+1)
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return carried, fmt.Errorf("failed to read %s: %w", live, err)
+		}
+		if values[0] == nil {
+			continue
+		}
+		key, err := strconv.ParseUint(formatColumn(values[0]), 10, 64)
+		if err != nil {
+			return carried, fmt.Errorf("invalid event ID %v: %w", values[0], err)
+		}
+		batch = append(batch, &SinkRecord{
+			OrganizationID: job.OrganizationID,
+			WebhookID:      job.WebhookID,
+			EventID:        uint(key),
+			Category:       category,
+			Values:         values[1:],
+		})
+		if len(batch) == replayBatchSize {
+			if err := flush(); err != nil {
+				return carried, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return carried, fmt.Errorf("failed to read %s: %w", live, err)
+	}
+	return carried, flush()
+}
+
+// compare walks the live and rebuilt tables in event order and records on
+// job how their rows differ and a checksum of each
+func (s *RebuildService) compare(ctx context.Context, db *gorm.DB, category *Category, live, next string, job *models.RebuildJob) error {
+	liveRows, err := openTableCursor(ctx, db, category, live)
+	if err != nil {
+		return err
+	}
+	defer liveRows.close()
+	nextRows, err := openTableCursor(ctx, db, category, next)
+	if err != nil {
+		return err
+	}
+	defer nextRows.close()
+
+	var missing, added, changed int64
+	for !liveRows.done || !nextRows.done {
+		switch {
+		case nextRows.done || (!liveRows.done && liveRows.key < nextRows.key):
+			missing++
+			err = liveRows.next()
+		case liveRows.done || nextRows.key < liveRows.key:
+			added++
+			err = nextRows.next()
+		default:
+			if liveRows.row != nextRows.row {
+				changed++
+			}
+			if err = liveRows.next(); err == nil {
+				err = nextRows.next()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to compare %s with %s: %w", live, next, err)
+		}
+	}
+
+	job.LiveRows = liveRows.count
+	job.NextRows = nextRows.count
+	job.LegacyRows = liveRows.legacy
+	job.MissingRows = missing
+	job.AddedRows = added
+	job.ChangedRows = changed
+	job.LiveChecksum = hex.EncodeToString(liveRows.checksum.Sum(nil))
+	job.NextChecksum = hex.EncodeToString(nextRows.checksum.Sum(nil))
+	return nil
+}
+
+// fail records err on the job and returns it
+func (s *RebuildService) fail(job *models.RebuildJob, err error) error {
+	saveErr := s.db.Model(job).Updates(map[string]interface{}{
+		"status":      models.RebuildFailed,
+		"last_error":  err.Error(),
+		"finished_at": time.Now(),
+	}).Error
+	if saveErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to save rebuild job: %w", saveErr))
+	}
+	return err
+}
+
+// tableCursor reads a category table in event order, hashing each row's
+// data columns. Rows without an event ID are counted and skipped.
+type tableCursor struct {
+	rows     *sql.Rows
+	values   []interface{}
+	key      uint64
+	row      [sha256.Size]byte
+	done     bool
+	count    int64
+	legacy   int64
+	checksum hash.Hash
+}
+
+// openTableCursor positions a cursor on the first row of table, which may
+// not exist
+func openTableCursor(ctx context.Context, db *gorm.DB, category *Category, table string) (*tableCursor, error) {
+	c := &tableCursor{values: make([]interface{}, len(category.Columns)+1), checksum: sha256.New()}
+	if !db.WithContext(ctx).Migrator().HasTable(table) {
+		c.done = true
+		return c, nil
+	}
+	rows, err := db.WithContext(ctx).Raw(category.SelectRowsSQL(db.Dialector.Name(), table)).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	c.rows = rows
+	return c, c.next()
+}
+
+func (c *tableCursor) next() error {
+	dest := make([]interface{}, len(c.values))
+	for i := range c.values {
+		dest[i] = &c.values[i]
+	}
+	for c.rows.Next() {
+		if err := c.rows.Scan(dest...); err != nil {
+			return err
+		}
+		c.count++
+		if c.values[0] == nil {
+			c.legacy++
+			continue
+		}
+		key, err := strconv.ParseUint(formatColumn(c.values[0]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid event ID %v: %w", c.values[0], err)
+		}
+		c.key = key
+
+		h := sha256.New()
+		for _, value := range c.values[1:] {
+			h.Write([]byte(formatColumn(value)))
+			h.Write([]byte{0})
+		}
+		h.Sum(c.row[:0])
+		fmt.Fprintf(c.checksum, "%d:%x\n", c.key, c.row)
+		return nil
+	}
+	c.done = true
+	return c.rows.Err()
+}
+
+func (c *tableCursor) close() {
+	if c.rows != nil {
+		c.rows.Close()
+	}
+}
+
+// formatColumn renders a scanned value the same way whichever driver read it
+func formatColumn(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
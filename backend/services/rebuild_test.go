@@ -0,0 +1,209 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestRenameTablesSQL(t *testing.T) {
+	swap := [][2]string{{"t", "t_old"}, {"t_next", "t"}}
+	tests := []struct {
+		driver  string
+		renames [][2]string
+		want    []string
+	}{
+		{models.DriverPostgres, swap, []string{
+			"ALTER TABLE t RENAME TO t_old",
+			"ALTER TABLE t_next RENAME TO t",
+		}},
+		{models.DriverMySQL, swap, []string{"RENAME TABLE t TO t_old, t_next TO t"}},
+		// Two renames would leave no t between them
+		{models.DriverClickHouse, swap, []string{
+			"EXCHANGE TABLES t AND t_next",
+			"RENAME TABLE t_next TO t_old",
+		}},
+		{models.DriverClickHouse, [][2]string{{"t_next", "t"}}, []string{"RENAME TABLE t_next TO t"}},
+	}
+	for _, tt := range tests {
+		if got := RenameTablesSQL(tt.driver, tt.renames); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("RenameTablesSQL(%s, %v) = %q, want %q", tt.driver, tt.renames, got, tt.want)
+		}
+	}
+}
+
+func TestFormatColumnMatchesAcrossDrivers(t *testing.T) {
+	at := time.Date(2024, 5, 1, 2, 0, 0, 0, time.FixedZone("", 2*60*60))
+	tests := []struct {
+		a, b interface{}
+	}{
+		{[]byte("1.5"), "1.5"},
+		{int64(7), uint64(7)},
+		{at, at.UTC()},
+	}
+	for _, tt := range tests {
+		if a, b := formatColumn(tt.a), formatColumn(tt.b); a != b {
+			t.Errorf("formatColumn(%#v) = %s, but %s for %#v", tt.a, a, b, tt.b)
+		}
+	}
+}
+
+func newTestRebuilds(s *testServices, db *gorm.DB) *RebuildService {
+	return NewRebuildService(db, s.tenants, s.sinks, s.partitions, s.replays, s.helius, time.Hour, testLogger())
+}
+
+// bidderOf returns the bidder of event's row in table
+func bidderOf(t *testing.T, db *gorm.DB, table string, eventID uint) string {
+	t.Helper()
+	var bidder string
+	if err := db.Raw("SELECT bidder FROM "+table+" WHERE event_id = ?", eventID).Scan(&bidder).Error; err != nil {
+		t.Fatalf("failed to load row: %v", err)
+	}
+	return bidder
+}
+
+// rebuild creates and executes a rebuild job, returning it and the error
+// Execute returned
+func rebuild(t *testing.T, rebuilds *RebuildService, webhookID uint, force bool) (*models.RebuildJob, error) {
+	t.Helper()
+	job, err := rebuilds.Create(webhookID, NFTBidsCategory.Name, force, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	runErr := rebuilds.Execute(context.Background(), job.ID, nil)
+	if job, err = rebuilds.Get(job.ID); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return job, runErr
+}
+
+func TestRebuildSwapsAndRollsBack(t *testing.T) {
+	for _, interval := range []string{PartitionNone, PartitionMonthly} {
+		t.Run(interval, func(t *testing.T) {
+			db := testDB(t)
+			ctx := context.Background()
+			s := newTestServices(t, db, interval)
+			rebuilds := newTestRebuilds(s, db)
+			orgID, webhooks := createTestOrganization(t, db, 1)
+			live := TableName(webhooks[0], NFTBidsCategory)
+			at := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+			events := storeBids(t, db, webhooks[0], at, at, at)
+			replayAll(t, s, orgID, webhooks[0], ReplayTargetLive)
+
+			// A row whose event was pruned, which replaying can't rebuild
+			const prunedID = 1_000_000
+			pruned := &SinkRecord{
+				OrganizationID: orgID,
+				WebhookID:      webhooks[0],
+				EventID:        prunedID,
+				Category:       NFTBidsCategory,
+				Values:         bidValues("Pruned", "1", at),
+			}
+			if err := s.sinks.Database().insert(ctx, db, live, []*SinkRecord{pruned}); err != nil {
+				t.Fatalf("failed to insert pruned row: %v", err)
+			}
+			// And an event the processors now decode differently
+			payload := fmt.Sprintf(`{"nft_address": "Nft111", "bidder": "Changed", "amount": 1.5, "timestamp": %d}`, at.Unix())
+			if err := db.Model(&events[1]).Update("payload", payload).Error; err != nil {
+				t.Fatalf("failed to update event: %v", err)
+			}
+
+			job, err := rebuild(t, rebuilds, webhooks[0], false)
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if job.Status != models.RebuildSwapped {
+				t.Fatalf("rebuild %s: %s", job.Status, job.LastError)
+			}
+			if job.LiveRows != 4 || job.NextRows != 4 || job.MissingRows != 0 || job.AddedRows != 0 || job.ChangedRows != 1 {
+				t.Errorf("rebuild compared %d live with %d rebuilt rows, %d missing, %d added and %d changed; want 4, 4, 0, 0 and 1",
+					job.LiveRows, job.NextRows, job.MissingRows, job.AddedRows, job.ChangedRows)
+			}
+			if got := bidderOf(t, db, live, events[1].ID); got != "Changed" {
+				t.Errorf("swapped table has bidder %s, want the rebuilt row", got)
+			}
+			if got := bidderOf(t, db, live, prunedID); got != "Pruned" {
+				t.Errorf("swapped table has bidder %q for the pruned event, want it carried over", got)
+			}
+			if n := countRows(t, db, live+RetiredTableSuffix); n != 4 {
+				t.Errorf("replaced table has %d rows, want 4", n)
+			}
+			// The sink writes to the swapped-in table
+			storeBids(t, db, webhooks[0], at)
+			replayAll(t, s, orgID, webhooks[0], ReplayTargetLive)
+			if n := countRows(t, db, live); n != 5 {
+				t.Errorf("swapped table has %d rows after another event, want 5", n)
+			}
+
+			job, err = rebuilds.Rollback(ctx, job.ID)
+			if err != nil {
+				t.Fatalf("Rollback: %v", err)
+			}
+			if job.Status != models.RebuildRolledBack {
+				t.Errorf("job is %s after rolling back", job.Status)
+			}
+			if got := bidderOf(t, db, live, events[1].ID); got != "Bidder1" {
+				t.Errorf("rolled back table has bidder %s, want the original row", got)
+			}
+			// Caught up with the event received after the swap
+			if n := countRows(t, db, live); n != 5 {
+				t.Errorf("rolled back table has %d rows, want 5", n)
+			}
+			if db.Migrator().HasTable(live + RetiredTableSuffix) {
+				t.Errorf("%s still exists after rolling back", live+RetiredTableSuffix)
+			}
+
+			// Again, this time for good
+			if job, err = rebuild(t, rebuilds, webhooks[0], false); err != nil || job.Status != models.RebuildSwapped {
+				t.Fatalf("second rebuild = %s, %v", job.Status, err)
+			}
+			if job, err = rebuilds.Finalize(ctx, job.ID); err != nil {
+				t.Fatalf("Finalize: %v", err)
+			}
+			if job.Status != models.RebuildCompleted || db.Migrator().HasTable(live+RetiredTableSuffix) {
+				t.Errorf("job is %s after finalizing, want completed with the replaced table dropped", job.Status)
+			}
+		})
+	}
+}
+
+func TestRebuildKeepsTheLiveTableWhenRowsWouldBeLost(t *testing.T) {
+	db := testDB(t)
+	s := newTestServices(t, db, PartitionNone)
+	rebuilds := newTestRebuilds(s, db)
+	orgID, webhooks := createTestOrganization(t, db, 1)
+	live := TableName(webhooks[0], NFTBidsCategory)
+	at := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	storeBids(t, db, webhooks[0], at, at)
+	replayAll(t, s, orgID, webhooks[0], ReplayTargetLive)
+	// Written before rows carried an event ID
+	err := db.Exec("INSERT INTO "+live+" (nft_address, bidder, amount, timestamp) VALUES (?, ?, ?, ?)",
+		bidValues("Legacy", "1", at)...).Error
+	if err != nil {
+		t.Fatalf("failed to insert legacy row: %v", err)
+	}
+
+	job, err := rebuild(t, rebuilds, webhooks[0], false)
+	if !errors.Is(err, ErrRebuildVerify) {
+		t.Fatalf("Execute = %v, want ErrRebuildVerify", err)
+	}
+	if job.Status != models.RebuildFailed || job.LegacyRows != 1 {
+		t.Errorf("job is %s with %d legacy rows, want failed with 1", job.Status, job.LegacyRows)
+	}
+	if n := countRows(t, db, live); n != 3 || db.Migrator().HasTable(live+RetiredTableSuffix) {
+		t.Errorf("live table has %d rows after a refused swap, want it untouched with 3", n)
+	}
+
+	job, err = rebuild(t, rebuilds, webhooks[0], true)
+	if err != nil || job.Status != models.RebuildSwapped {
+		t.Fatalf("forced rebuild = %s, %v", job.Status, err)
+	}
+	if n := countRows(t, db, live); n != 2 {
+		t.Errorf("forced rebuild left %d rows, want the 2 with events", n)
+	}
+}
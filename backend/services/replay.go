@@ -0,0 +1,431 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// Replay targets
+const (
+	ReplayTargetLive   = "live"
+	ReplayTargetShadow = "shadow"
+	// Set by rebuild jobs, which run their replays themselves
+	ReplayTargetRebuild = "rebuild"
+)
+
+// ShadowTableSuffix is appended to the table names shadow replays write to,
+// so user_7_nft_bids is replayed into user_7_nft_bids_shadow
+const ShadowTableSuffix = "_shadow"
+
+const (
+	replayBatchSize    = 500
+	replayConcurrency  = 32 // Events of a batch written at once
+	replayPollInterval = 5 * time.Second
+	// A running job that hasn't saved progress for this long is assumed to
+	// belong to a process that died and is picked up again
+	replayStaleAfter = 5 * time.Minute
+)
+
+var (
+	ErrReplayNotFound     = errors.New("replay job not found")
+	ErrReplayTarget       = errors.New("replay target must be live or shadow")
+	ErrReplayRange        = errors.New("replay range ends before it starts")
+	ErrReplayRate         = errors.New("replay rate can't be negative")
+	ErrReplayWebhook      = errors.New("webhook does not belong to the organization")
+	ErrReplayNotClaimable = errors.New("replay job is finished or running elsewhere")
+)
+
+// ReplayInput selects the events a replay job reruns. Zero values leave a
+// bound open.
+type ReplayInput struct {
+	WebhookID     uint       `json:"webhook_id"`
+	Category      string     `json:"category"`
+	FromEventID   uint       `json:"from_event_id"`
+	ToEventID     uint       `json:"to_event_id"`
+	FromSlot      uint64     `json:"from_slot"`
+	ToSlot        uint64     `json:"to_slot"`
+	FromTime      *time.Time `json:"from_time"`
+	ToTime        *time.Time `json:"to_time"`
+	Target        string     `json:"target"`          // Defaults to live
+	RatePerSecond float64    `json:"rate_per_second"` // Defaults to the configured rate
+}
+
+// ReplayService reruns stored webhook events through the current filter
+// and processors, for example after a decoder fix. Rows are upserted by
+// event ID, so replaying an event again replaces its row instead of adding
+// one. Jobs run in the server's background loop or in the foreground from
+// the CLI, and resume from their last saved event.
+//
+// Rows written before the event_id column existed have no event ID and are
+// not replaced; replay those into the shadow tables instead.
+type ReplayService struct {
+	db          *gorm.DB
+	helius      *HeliusService
+	defaultRate float64
+	logger      *slog.Logger
+}
+
+// NewReplayService creates a service that replays at defaultRate events per
+// second unless a job sets its own rate
+func NewReplayService(db *gorm.DB, helius *HeliusService, defaultRate float64, logger *slog.Logger) *ReplayService {
+	return &ReplayService{
+		db:          db,
+		helius:      helius,
+		defaultRate: defaultRate,
+		logger:      logger,
+	}
+}
+
+// Create validates input and queues a replay job for the organization
+func (s *ReplayService) Create(orgID, requestedByID uint, input ReplayInput) (*models.ReplayJob, error) {
+	job := &models.ReplayJob{
+		OrganizationID: orgID,
+		WebhookID:      input.WebhookID,
+		Category:       input.Category,
+		FromEventID:    input.FromEventID,
+		ToEventID:      input.ToEventID,
+		FromSlot:       input.FromSlot,
+		ToSlot:         input.ToSlot,
+		FromTime:       input.FromTime,
+		ToTime:         input.ToTime,
+		Target:         input.Target,
+		RatePerSecond:  input.RatePerSecond,
+		Status:         models.ReplayPending,
+		RequestedByID:  requestedByID,
+	}
+	if job.Target == "" {
+		job.Target = ReplayTargetLive
+	}
+	if job.Target != ReplayTargetLive && job.Target != ReplayTargetShadow {
+		return nil, ErrReplayTarget
+	}
+	if job.RatePerSecond < 0 {
+		return nil, ErrReplayRate
+	}
+	if job.RatePerSecond == 0 {
+		job.RatePerSecond = s.defaultRate
+	}
+	if job.Category != "" {
+		if _, ok := CategoryByName(job.Category); !ok {
+			return nil, ErrUnknownCategory
+		}
+	}
+	if (job.ToEventID != 0 && job.ToEventID < job.FromEventID) ||
+		(job.ToSlot != 0 && job.ToSlot < job.FromSlot) ||
+		(job.FromTime != nil && job.ToTime != nil && job.ToTime.Before(*job.FromTime)) {
+		return nil, ErrReplayRange
+	}
+	if job.WebhookID != 0 {
+		var count int64
+		err := s.db.Model(&models.HeliusWebhook{}).
+			Where("id = ? AND organization_id = ?", job.WebhookID, orgID).Count(&count).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to load webhook: %w", err)
+		}
+		if count == 0 {
+			return nil, ErrReplayWebhook
+		}
+	}
+
+	if err := s.create(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// create counts the events a job covers and queues it
+func (s *ReplayService) create(job *models.ReplayJob) error {
+	if err := s.events(context.Background(), job).Count(&job.Total).Error; err != nil {
+		return fmt.Errorf("failed to count events: %w", err)
+	}
+	if err := s.db.Create(job).Error; err != nil {
+		return fmt.Errorf("failed to create replay job: %w", err)
+	}
+	return nil
+}
+
+// List returns the organization's replay jobs, newest first. An orgID of
+// zero lists every organization's jobs.
+func (s *ReplayService) List(orgID uint) ([]models.ReplayJob, error) {
+	query := s.db.Order("id DESC")
+	if orgID != 0 {
+		query = query.Where("organization_id = ?", orgID)
+	}
+	var jobs []models.ReplayJob
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list replay jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Get returns one of the organization's replay jobs. An orgID of zero
+// matches any organization.
+func (s *ReplayService) Get(orgID, id uint) (*models.ReplayJob, error) {
+	query := s.db.Where("id = ?", id)
+	if orgID != 0 {
+		query = query.Where("organization_id = ?", orgID)
+	}
+	var job models.ReplayJob
+	err := query.First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReplayNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load replay job: %w", err)
+	}
+	return &job, nil
+}
+
+// Cancel stops a pending or running job. A running job stops after the
+// batch it is working on.
+func (s *ReplayService) Cancel(orgID, id uint) (*models.ReplayJob, error) {
+	job, err := s.Get(orgID, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = s.db.Model(&models.ReplayJob{}).
+		Where("id = ? AND status IN ?", job.ID, []string{models.ReplayPending, models.ReplayRunning}).
+		Updates(map[string]interface{}{"status": models.ReplayCancelled, "finished_at": now}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel replay job: %w", err)
+	}
+	return s.Get(orgID, id)
+}
+
+// Run executes queued jobs one at a time until ctx is cancelled, along with
+// running jobs whose process stopped saving progress. Rebuild replays are
+// left to RebuildService.
+func (s *ReplayService) Run(ctx context.Context) {
+	ticker := time.NewTicker(replayPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var ids []uint
+			err := s.db.Model(&models.ReplayJob{}).
+				Where("status = ? OR (status = ? AND updated_at < ?)",
+					models.ReplayPending, models.ReplayRunning, time.Now().Add(-replayStaleAfter)).
+				Where("target <> ?", ReplayTargetRebuild).
+				Order("id").Pluck("id", &ids).Error
+			if err != nil {
+				s.logger.Error("failed to poll replay jobs", "error", err)
+				continue
+			}
+			for _, id := range ids {
+				err := s.Execute(ctx, id, nil)
+				if err != nil && !errors.Is(err, ErrReplayNotClaimable) && ctx.Err() == nil {
+					s.logger.Error("replay job failed", "replay_id", id, "error", err)
+				}
+				if ctx.Err() != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Execute claims a job and replays its remaining events, calling progress
+// with the job after each batch. If ctx is cancelled the job is put back in
+// the queue to be resumed later.
+func (s *ReplayService) Execute(ctx context.Context, id uint, progress func(*models.ReplayJob)) error {
+	job, err := s.claim(ctx, id)
+	if err != nil {
+		return err
+	}
+	logger := s.logger.With("replay_id", job.ID, "organization_id", job.OrganizationID, "target", job.Target)
+	logger.InfoContext(ctx, "replay started", "last_event_id", job.LastEventID, "total", job.Total)
+
+	runErr := s.replay(ctx, job, progress)
+	now := time.Now()
+	updates := map[string]interface{}{}
+	switch {
+	case errors.Is(runErr, errReplayCancelled):
+		logger.InfoContext(ctx, "replay cancelled", "processed", job.Processed, "failed", job.Failed)
+		return nil
+	case ctx.Err() != nil:
+		// Interrupted; another run picks up from the last saved event
+		updates["status"] = models.ReplayPending
+		runErr = ctx.Err()
+	case runErr != nil:
+		updates["status"] = models.ReplayFailed
+		updates["last_error"] = runErr.Error()
+		updates["finished_at"] = now
+	default:
+		updates["status"] = models.ReplayCompleted
+		updates["finished_at"] = now
+	}
+	// Saved even when ctx is done so the job isn't left looking stale
+	err = s.db.Model(job).Where("status = ?", models.ReplayRunning).Updates(updates).Error
+	if err != nil {
+		return errors.Join(runErr, fmt.Errorf("failed to save replay job: %w", err))
+	}
+	if status := updates["status"]; status != models.ReplayPending {
+		job.Status = status.(string)
+		job.FinishedAt = &now
+	}
+	logger.InfoContext(ctx, "replay stopped", "status", updates["status"], "processed", job.Processed, "failed", job.Failed)
+	if progress != nil {
+		progress(job)
+	}
+	return runErr
+}
+
+var errReplayCancelled = errors.New("replay job cancelled")
+
+// claim marks a pending or stale job as running by this process
+func (s *ReplayService) claim(ctx context.Context, id uint) (*models.ReplayJob, error) {
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&models.ReplayJob{}).
+		Where("id = ? AND (status = ? OR (status = ? AND updated_at < ?))",
+			id, models.ReplayPending, models.ReplayRunning, now.Add(-replayStaleAfter)).
+		Updates(map[string]interface{}{
+			"status":     models.ReplayRunning,
+			"started_at": gorm.Expr("COALESCE(started_at, ?)", now),
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim replay job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(0, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrReplayNotClaimable
+	}
+	return s.Get(0, id)
+}
+
+// replay works through a claimed job's events in batches, saving progress
+// after each one
+func (s *ReplayService) replay(ctx context.Context, job *models.ReplayJob, progress func(*models.ReplayJob)) error {
+	opts := ReprocessOptions{}
+	switch job.Target {
+	case ReplayTargetShadow:
+		opts.TableSuffix = ShadowTableSuffix
+	case ReplayTargetRebuild:
+		opts.TableSuffix = RebuildTableSuffix
+	}
+	limit := rate.Inf
+	if job.RatePerSecond > 0 {
+		limit = rate.Limit(job.RatePerSecond)
+	}
+	limiter := rate.NewLimiter(limit, 1)
+
+	for {
+		var batch []models.WebhookEvent
+		err := s.events(ctx, job).
+			Where("webhook_events.id > ?", job.LastEventID).
+			Order("webhook_events.id").Limit(replayBatchSize).Find(&batch).Error
+		if err != nil {
+			return fmt.Errorf("failed to load events: %w", err)
+		}
+
+		// Events are written concurrently so batched sink writes fill up;
+		// progress only advances past events whose outcome is known
+		outcomes := make([]error, len(batch))
+		finished := make([]bool, len(batch))
+		slots := make(chan struct{}, replayConcurrency)
+		var wg sync.WaitGroup
+		for i := range batch {
+			if err := limiter.Wait(ctx); err != nil {
+				break
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				// Replays fix stored data; subscribers and destinations already saw these events
+				err := s.helius.Reprocess(ctx, &batch[i], opts)
+				outcomes[i], finished[i] = err, err == nil || ctx.Err() == nil
+			}()
+		}
+		wg.Wait()
+
+		for i := range batch {
+			if !finished[i] {
+				break
+			}
+			if outcomes[i] != nil {
+				job.Failed++
+				job.LastError = fmt.Sprintf("event %d: %v", batch[i].ID, outcomes[i])
+			} else {
+				job.Processed++
+			}
+			job.LastEventID = batch[i].ID
+		}
+
+		// Saving progress is also the job's heartbeat; a job cancelled
+		// meanwhile is no longer running and matches nothing
+		result := s.db.Model(job).Where("status = ?", models.ReplayRunning).Updates(map[string]interface{}{
+			"processed":     job.Processed,
+			"failed":        job.Failed,
+			"last_event_id": job.LastEventID,
+			"last_error":    job.LastError,
+		})
+		if result.Error != nil {
+			return fmt.Errorf("failed to save replay progress: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errReplayCancelled
+		}
+		if progress != nil {
+			progress(job)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(batch) < replayBatchSize {
+			return nil
+		}
+	}
+}
+
+// events selects the stored events a job covers
+func (s *ReplayService) events(ctx context.Context, job *models.ReplayJob) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.WebhookEvent{}).
+		Joins("JOIN helius_webhooks ON helius_webhooks.id = webhook_events.webhook_id").
+		Where("helius_webhooks.organization_id = ?", job.OrganizationID)
+	if job.WebhookID != 0 {
+		query = query.Where("webhook_events.webhook_id = ?", job.WebhookID)
+	}
+	if category, ok := CategoryByName(job.Category); ok {
+		query = query.Where("webhook_events.event_type = ?", category.EventType)
+	}
+	if job.FromEventID != 0 {
+		query = query.Where("webhook_events.id >= ?", job.FromEventID)
+	}
+	if job.ToEventID != 0 {
+		query = query.Where("webhook_events.id <= ?", job.ToEventID)
+	}
+	if job.FromSlot != 0 {
+		query = query.Where("webhook_events.slot >= ?", job.FromSlot)
+	}
+	if job.ToSlot != 0 {
+		query = query.Where("webhook_events.slot <= ?", job.ToSlot)
+	}
+	if job.FromTime != nil {
+		query = query.Where("webhook_events.timestamp >= ?", *job.FromTime)
+	}
+	if job.ToTime != nil {
+		query = query.Where("webhook_events.timestamp < ?", *job.ToTime)
+	}
+	return query
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReplayCreateRejectsInvalidInput(t *testing.T) {
+	from := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	to := from.Add(-time.Hour)
+	tests := []struct {
+		name  string
+		input ReplayInput
+		want  error
+	}{
+		{"target", ReplayInput{Target: ReplayTargetRebuild}, ErrReplayTarget},
+		{"rate", ReplayInput{RatePerSecond: -1}, ErrReplayRate},
+		{"category", ReplayInput{Category: "nft_mints"}, ErrUnknownCategory},
+		{"event range", ReplayInput{FromEventID: 10, ToEventID: 9}, ErrReplayRange},
+		{"slot range", ReplayInput{FromSlot: 10, ToSlot: 9}, ErrReplayRange},
+		{"time range", ReplayInput{FromTime: &from, ToTime: &to}, ErrReplayRange},
+	}
+	// Invalid input is rejected before the database is needed
+	s := NewReplayService(nil, nil, 0, testLogger())
+	for _, tt := range tests {
+		if _, err := s.Create(1, 1, tt.input); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Create = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// replayAll queues and runs a replay of every event of the webhook
+func replayAll(t *testing.T, s *testServices, orgID, webhookID uint, target string) *models.ReplayJob {
+	t.Helper()
+	job, err := s.replays.Create(orgID, 0, ReplayInput{WebhookID: webhookID, Target: target})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := s.replays.Execute(context.Background(), job.ID, nil); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	job, err = s.replays.Get(orgID, job.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if job.Status != models.ReplayCompleted {
+		t.Fatalf("replay %s: %s", job.Status, job.LastError)
+	}
+	return job
+}
+
+func TestReplayTwiceLeavesOneRowPerEvent(t *testing.T) {
+	for _, interval := range []string{PartitionNone, PartitionMonthly} {
+		t.Run(interval, func(t *testing.T) {
+			db := testDB(t)
+			s := newTestServices(t, db, interval)
+			orgID, webhooks := createTestOrganization(t, db, 1)
+			table := TableName(webhooks[0], NFTBidsCategory)
+			at := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+			events := storeBids(t, db, webhooks[0], at, at.Add(time.Hour), at.Add(2*time.Hour))
+
+			for range 2 {
+				if job := replayAll(t, s, orgID, webhooks[0], ReplayTargetLive); job.Processed != 3 || job.Failed != 0 {
+					t.Fatalf("replay processed %d and failed %d events, want 3 and 0", job.Processed, job.Failed)
+				}
+				if n := countRows(t, db, table); n != 3 {
+					t.Fatalf("%s has %d rows after replaying, want 3", table, n)
+				}
+			}
+
+			// An event decoded with a different timestamp, as a decoder fix
+			// may do, moves its row rather than adding one; partitioned
+			// tables key rows by timestamp too
+			moved := at.AddDate(0, 2, 0)
+			payload := fmt.Sprintf(`{"nft_address": "Nft111", "bidder": "Bidder0", "amount": 1.5, "timestamp": %d}`, moved.Unix())
+			if err := db.Model(&events[0]).Update("payload", payload).Error; err != nil {
+				t.Fatalf("failed to update event: %v", err)
+			}
+			replayAll(t, s, orgID, webhooks[0], ReplayTargetLive)
+			if n := countRows(t, db, table); n != 3 {
+				t.Errorf("%s has %d rows after replaying a moved event, want 3", table, n)
+			}
+			var stored time.Time
+			if err := db.Raw("SELECT timestamp FROM "+table+" WHERE event_id = ?", events[0].ID).Scan(&stored).Error; err != nil {
+				t.Fatalf("failed to load row: %v", err)
+			}
+			// Stored as the wall clock of the decoder's zone
+			if stored.Month() != moved.Month() {
+				t.Errorf("event %d stored at %s, want it moved to %s", events[0].ID, stored, moved)
+			}
+		})
+	}
+}
+
+func TestReplayResumesAfterTheLastSavedEvent(t *testing.T) {
+	db := testDB(t)
+	s := newTestServices(t, db, PartitionNone)
+	orgID, webhooks := createTestOrganization(t, db, 1)
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	events := storeBids(t, db, webhooks[0], at, at, at, at, at)
+
+	job, err := s.replays.Create(orgID, 0, ReplayInput{WebhookID: webhooks[0]})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if job.Total != 5 {
+		t.Errorf("job covers %d events, want 5", job.Total)
+	}
+	// As a process that died after saving its first batch would leave it
+	err = db.Model(job).Updates(map[string]interface{}{
+		"status":        models.ReplayRunning,
+		"processed":     3,
+		"last_event_id": events[2].ID,
+		"updated_at":    time.Now().Add(-2 * replayStaleAfter),
+	}).Error
+	if err != nil {
+		t.Fatalf("failed to update job: %v", err)
+	}
+
+	if err := s.replays.Execute(context.Background(), job.ID, nil); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	job, err = s.replays.Get(orgID, job.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if job.Status != models.ReplayCompleted || job.Processed != 5 || job.LastEventID != events[4].ID {
+		t.Errorf("job = %s with %d processed up to event %d, want completed with 5 up to %d",
+			job.Status, job.Processed, job.LastEventID, events[4].ID)
+	}
+	// Only the events after the saved one were replayed
+	if n := countRows(t, db, TableName(webhooks[0], NFTBidsCategory)); n != 2 {
+		t.Errorf("%d rows written, want 2", n)
+	}
+
+	// A job running elsewhere isn't claimed again
+	if err := db.Model(job).Updates(map[string]interface{}{"status": models.ReplayRunning, "updated_at": time.Now()}).Error; err != nil {
+		t.Fatalf("failed to update job: %v", err)
+	}
+	if err := s.replays.Execute(context.Background(), job.ID, nil); !errors.Is(err, ErrReplayNotClaimable) {
+		t.Errorf("Execute of a running job = %v, want ErrReplayNotClaimable", err)
+	}
+}
+
+func TestShadowReplayLeavesLiveTablesAlone(t *testing.T) {
+	db := testDB(t)
+	s := newTestServices(t, db, PartitionNone)
+	orgID, webhooks := createTestOrganization(t, db, 1)
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	events := storeBids(t, db, webhooks[0], at, at)
+
+	replayAll(t, s, orgID, webhooks[0], ReplayTargetShadow)
+	table := TableName(webhooks[0], NFTBidsCategory)
+	if n := countRows(t, db, table+ShadowTableSuffix); n != 2 {
+		t.Errorf("shadow table has %d rows, want 2", n)
+	}
+	if db.Migrator().HasTable(table) {
+		t.Errorf("shadow replay created the live table %s", table)
+	}
+	var processed int64
+	if err := db.Model(&models.WebhookEvent{}).Where("id IN ? AND processed", []uint{events[0].ID, events[1].ID}).Count(&processed).Error; err != nil {
+		t.Fatalf("failed to count events: %v", err)
+	}
+	if processed != 0 {
+		t.Errorf("shadow replay marked %d events processed", processed)
+	}
+}
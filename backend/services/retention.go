@@ -0,0 +1,460 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Pause between deletes so pruning never holds locks for long or starves
+// live writes
+const retentionBatchPause = 100 * time.Millisecond
+
+var (
+	ErrRetentionTarget   = errors.New("retention target must be events or a data category")
+	ErrRetentionAge      = errors.New("max_age_days must be at least 1")
+	ErrRetentionNotFound = errors.New("retention policy not found")
+	ErrArchiveDisabled   = errors.New("archiving was requested but no archive is configured")
+)
+
+// RetentionInput sets an organization's retention for one target
+type RetentionInput struct {
+	Target     string `json:"target"` // "events" or a data category
+	MaxAgeDays int    `json:"max_age_days"`
+	Archive    bool   `json:"archive"`
+}
+
+// StorageUsage reports the storage an organization's data takes
+type StorageUsage struct {
+	OrganizationID uint           `json:"organization_id"`
+	Events         EventStorage   `json:"events"`
+	Tables         []TableStorage `json:"tables"`
+	TotalBytes     int64          `json:"total_bytes"`
+}
+
+// EventStorage describes an organization's raw webhook events
+type EventStorage struct {
+	Count        int64      `json:"count"`
+	PayloadBytes int64      `json:"payload_bytes"`
+	Oldest       *time.Time `json:"oldest"`
+}
+
+// TableStorage describes one category table in the organization's database
+type TableStorage struct {
+	Table     string `json:"table"`
+	WebhookID uint   `json:"webhook_id"`
+	Category  string `json:"category"`
+	Rows      int64  `json:"rows"` // Estimated from table statistics
+	Bytes     int64  `json:"bytes"`
+}
+
+// RetentionService prunes raw events and category rows older than each
+// organization's retention policies allow, archiving them first if asked,
+// and reports storage use
+type RetentionService struct {
+	db         *gorm.DB
+	tenants    *TenantDBManager
+	partitions *PartitionService
+	archive    Archive // nil when archiving is disabled
+	batchSize  int
+	interval   time.Duration
+	logger     *slog.Logger
+}
+
+// NewRetentionService creates a service that applies every policy each
+// interval, deleting at most batchSize rows per statement
+func NewRetentionService(db *gorm.DB, tenants *TenantDBManager, partitions *PartitionService, archive Archive, batchSize int, interval time.Duration, logger *slog.Logger) *RetentionService {
+	return &RetentionService{
+		db:         db,
+		tenants:    tenants,
+		partitions: partitions,
+		archive:    archive,
+		batchSize:  batchSize,
+		interval:   interval,
+		logger:     logger,
+	}
+}
+
+// ListPolicies returns the organization's retention policies, or every
+// organization's when orgID is zero
+func (s *RetentionService) ListPolicies(orgID uint) ([]models.RetentionPolicy, error) {
+	query := s.db.Order("organization_id, target")
+	if orgID != 0 {
+		query = query.Where("organization_id = ?", orgID)
+	}
+	var policies []models.RetentionPolicy
+	if err := query.Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+// SetPolicy creates or replaces the organization's policy for a target
+func (s *RetentionService) SetPolicy(orgID uint, input RetentionInput) (*models.RetentionPolicy, error) {
+	if _, ok := CategoryByName(input.Target); !ok && input.Target != models.RetentionEvents {
+		return nil, ErrRetentionTarget
+	}
+	if input.MaxAgeDays < 1 {
+		return nil, ErrRetentionAge
+	}
+	if input.Archive && s.archive == nil {
+		return nil, ErrArchiveDisabled
+	}
+
+	var policy models.RetentionPolicy
+	err := s.db.Where("organization_id = ? AND target = ?", orgID, input.Target).First(&policy).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load retention policy: %w", err)
+	}
+	policy.OrganizationID = orgID
+	policy.Target = input.Target
+	policy.MaxAgeDays = input.MaxAgeDays
+	policy.Archive = input.Archive
+	if err := s.db.Save(&policy).Error; err != nil {
+		return nil, fmt.Errorf("failed to save retention policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// DeletePolicy removes the organization's policy for a target, keeping
+// that data indefinitely again
+func (s *RetentionService) DeletePolicy(orgID uint, target string) (*models.RetentionPolicy, error) {
+	var policy models.RetentionPolicy
+	err := s.db.Where("organization_id = ? AND target = ?", orgID, target).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRetentionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load retention policy: %w", err)
+	}
+	if err := s.db.Delete(&policy).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete retention policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// Run applies every policy each interval until ctx is cancelled
+func (s *RetentionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.PruneAll(ctx, 0)
+		}
+	}
+}
+
+// PruneAll applies the organization's policies, or every organization's
+// when orgID is zero, and returns them with the outcome recorded
+func (s *RetentionService) PruneAll(ctx context.Context, orgID uint) []models.RetentionPolicy {
+	policies, err := s.ListPolicies(orgID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to load retention policies", "error", err)
+		return nil
+	}
+	for i := range policies {
+		if ctx.Err() != nil {
+			break
+		}
+		s.Prune(ctx, &policies[i])
+	}
+	return policies
+}
+
+// Prune deletes the rows a policy no longer retains and records the outcome
+// on it. Rows are archived before each batch is deleted, so a failed upload
+// stops the run with nothing lost.
+func (s *RetentionService) Prune(ctx context.Context, policy *models.RetentionPolicy) {
+	logger := s.logger.With("organization_id", policy.OrganizationID, "target", policy.Target)
+	cutoff := time.Now().AddDate(0, 0, -policy.MaxAgeDays)
+	archive := s.archive
+	if !policy.Archive {
+		archive = nil
+	}
+
+	var pruned int64
+	var err error
+	category, isCategory := CategoryByName(policy.Target)
+	switch {
+	case policy.Archive && s.archive == nil:
+		// Set before the archive was turned off; nothing is deleted unarchived
+		err = ErrArchiveDisabled
+	case policy.Target == models.RetentionEvents:
+		pruned, err = s.pruneEvents(ctx, policy.OrganizationID, cutoff, archive)
+	case isCategory:
+		pruned, err = s.pruneCategory(ctx, policy.OrganizationID, category, cutoff, archive)
+	default:
+		err = ErrRetentionTarget
+	}
+
+	now := time.Now()
+	policy.LastRunAt = &now
+	policy.LastPruned = pruned
+	policy.LastError = ""
+	if err != nil {
+		policy.LastError = err.Error()
+		logger.ErrorContext(ctx, "retention run failed", "pruned", pruned, "error", err)
+	} else if pruned > 0 {
+		logger.InfoContext(ctx, "pruned expired rows", "pruned", pruned, "cutoff", cutoff)
+	}
+	saveErr := s.db.Model(policy).Select("last_run_at", "last_pruned", "last_error").Updates(policy).Error
+	if saveErr != nil {
+		logger.ErrorContext(ctx, "failed to record retention run", "error", saveErr)
+	}
+}
+
+// pruneEvents deletes the organization's raw events received before cutoff
+func (s *RetentionService) pruneEvents(ctx context.Context, orgID uint, cutoff time.Time, archive Archive) (int64, error) {
+	webhooks := s.db.Unscoped().Model(&models.HeliusWebhook{}).Select("id").Where("organization_id = ?", orgID)
+
+	var pruned int64
+	for {
+		var batch []models.WebhookEvent
+		err := s.db.WithContext(ctx).Unscoped().
+			Where("webhook_id IN (?) AND created_at < ?", webhooks, cutoff).
+			Order("id").Limit(s.batchSize).Find(&batch).Error
+		if err != nil {
+			return pruned, fmt.Errorf("failed to load expired events: %w", err)
+		}
+		if len(batch) == 0 {
+			return pruned, nil
+		}
+
+		ids := make([]uint, len(batch))
+		for i := range batch {
+			ids[i] = batch[i].ID
+		}
+		if archive != nil {
+			key := fmt.Sprintf("org-%d/events/%d-%d.jsonl.gz", orgID, ids[0], ids[len(ids)-1])
+			if err := s.store(ctx, archive, key, batch); err != nil {
+				return pruned, err
+			}
+		}
+		result := s.db.WithContext(ctx).Unscoped().Where("id IN ?", ids).Delete(&models.WebhookEvent{})
+		if result.Error != nil {
+			return pruned, fmt.Errorf("failed to delete expired events: %w", result.Error)
+		}
+		pruned += result.RowsAffected
+
+		if len(batch) < s.batchSize || result.RowsAffected == 0 {
+			return pruned, nil
+		}
+		if err := pause(ctx); err != nil {
+			return pruned, err
+		}
+	}
+}
+
+// pruneCategory deletes rows timestamped before cutoff from the category
+// table of each of the organization's webhooks
+func (s *RetentionService) pruneCategory(ctx context.Context, orgID uint, category *Category, cutoff time.Time, archive Archive) (int64, error) {
+	db, err := s.tenants.ForOrganization(orgID)
+	if err != nil {
+		return 0, err
+	}
+	// Deleted webhooks' tables are kept, and pruned like the others
+	var webhookIDs []uint
+	err = s.db.WithContext(ctx).Unscoped().Model(&models.HeliusWebhook{}).
+		Where("organization_id = ?", orgID).Order("id").Pluck("id", &webhookIDs).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	var pruned int64
+	for _, webhookID := range webhookIDs {
+		table := TableName(webhookID, category)
+		if !db.WithContext(ctx).Migrator().HasTable(table) {
+			continue
+		}
+		n, err := s.pruneTable(ctx, db, orgID, category, table, cutoff, archive)
+		pruned += n
+		if err != nil {
+			return pruned, fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return pruned, nil
+}
+
+func (s *RetentionService) pruneTable(ctx context.Context, db *gorm.DB, orgID uint, category *Category, table string, cutoff time.Time, archive Archive) (int64, error) {
+	var pruned int64
+	// Partitions that end before cutoff are dropped whole, leaving only the
+	// partition cutoff falls in to delete from
+	partitioned, err := s.partitions.IsPartitioned(ctx, db, table)
+	if err != nil {
+		return 0, err
+	}
+	if partitioned {
+		dropped, err := s.partitions.DropExpired(ctx, db, table, cutoff, archive, fmt.Sprintf("org-%d", orgID))
+		pruned += dropped
+		if err != nil {
+			return pruned, err
+		}
+	}
+
+	for {
+		rows, err := db.WithContext(ctx).Raw(category.ExpiredRowsSQL(table), cutoff.UTC(), s.batchSize).Rows()
+		if err != nil {
+			return pruned, fmt.Errorf("failed to load expired rows: %w", err)
+		}
+		batch, ids, err := scanRecords(rows)
+		if err != nil {
+			return pruned, fmt.Errorf("failed to load expired rows: %w", err)
+		}
+		if len(batch) == 0 {
+			return pruned, nil
+		}
+
+		if archive != nil {
+			key := fmt.Sprintf("org-%d/%s/%d-%d.jsonl.gz", orgID, table, ids[0], ids[len(ids)-1])
+			if err := s.store(ctx, archive, key, batch); err != nil {
+				return pruned, err
+			}
+		}
+		result := db.WithContext(ctx).Exec(category.DeleteRowsSQL(table), ids)
+		if result.Error != nil {
+			return pruned, fmt.Errorf("failed to delete expired rows: %w", result.Error)
+		}
+		pruned += result.RowsAffected
+
+		if len(batch) < s.batchSize || result.RowsAffected == 0 {
+			return pruned, nil
+		}
+		if err := pause(ctx); err != nil {
+			return pruned, err
+		}
+	}
+}
+
+// store archives a batch of rows as compressed JSON Lines
+func (s *RetentionService) store(ctx context.Context, archive Archive, key string, rows interface{}) error {
+	var body []byte
+	var err error
+	switch rows := rows.(type) {
+	case []models.WebhookEvent:
+		body, err = encodeJSONLines(rows)
+	case []map[string]interface{}:
+		body, err = encodeJSONLines(rows)
+	default:
+		err = fmt.Errorf("unsupported archive rows %T", rows)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode archive: %w", err)
+	}
+	if err := archive.Put(ctx, key, body); err != nil {
+		return fmt.Errorf("failed to archive %s to %s: %w", key, archive.Location(), err)
+	}
+	return nil
+}
+
+// Storage reports the storage the organization's raw events and category
+// tables take, including shadow, rebuilt and replaced tables
+func (s *RetentionService) Storage(ctx context.Context, orgID uint) (*StorageUsage, error) {
+	usage := &StorageUsage{OrganizationID: orgID, Tables: []TableStorage{}}
+	err := s.db.WithContext(ctx).Raw(`SELECT COUNT(*) AS count,
+		COALESCE(SUM(pg_column_size(payload)), 0) AS payload_bytes,
+		MIN(created_at) AS oldest
+		FROM webhook_events
+		WHERE webhook_id IN (SELECT id FROM helius_webhooks WHERE organization_id = ?)`, orgID).
+		Scan(&usage.Events).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure events: %w", err)
+	}
+	usage.TotalBytes = usage.Events.PayloadBytes
+
+	db, err := s.tenants.ForOrganization(orgID)
+	if err != nil {
+		return nil, err
+	}
+	var webhookIDs []uint
+	err = s.db.WithContext(ctx).Model(&models.HeliusWebhook{}).
+		Where("organization_id = ?", orgID).Order("id").Pluck("id", &webhookIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	var stats []struct {
+		Name          string
+		EstimatedRows int64
+		Bytes         int64
+	}
+	if err := db.WithContext(ctx).Raw(TableStatsSQL(db.Dialector.Name())).Scan(&stats).Error; err != nil {
+		return nil, fmt.Errorf("failed to measure tables: %w", err)
+	}
+	tables := make(map[string]TableStorage, len(stats))
+	for _, st := range stats {
+		tables[st.Name] = TableStorage{Table: st.Name, Rows: st.EstimatedRows, Bytes: st.Bytes}
+	}
+	for _, webhookID := range webhookIDs {
+		for _, category := range Categories {
+			for _, suffix := range []string{"", ShadowTableSuffix, RebuildTableSuffix, RetiredTableSuffix} {
+				t, ok := tables[TableName(webhookID, category)+suffix]
+				if !ok {
+					continue
+				}
+				t.WebhookID, t.Category = webhookID, category.Name
+				usage.Tables = append(usage.Tables, t)
+				usage.TotalBytes += t.Bytes
+			}
+		}
+	}
+	return usage, nil
+}
+
+// scanRecords reads rows into maps keyed by column, returning them with
+// the value of each row's id column
+func scanRecords(rows *sql.Rows) ([]map[string]interface{}, []uint64, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	var records []map[string]interface{}
+	var ids []uint64
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			value := values[i]
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			record[column] = value
+			if column == "id" {
+				id, err := strconv.ParseUint(formatColumn(value), 10, 64)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid id %v: %w", value, err)
+				}
+				ids = append(ids, id)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, ids, rows.Err()
+}
+
+// pause waits between batches unless ctx is cancelled
+func pause(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(retentionBatchPause):
+		return nil
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"backend/models"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var errUploadFailed = errors.New("upload failed")
+
+// fakeArchive keeps objects in memory. Puts beyond the first failAfter
+// fail, unless failAfter is negative.
+type fakeArchive struct {
+	mu        sync.Mutex
+	objects   map[string][]byte
+	keys      []string // In the order they were put
+	failAfter int
+}
+
+func newFakeArchive() *fakeArchive {
+	return &fakeArchive{objects: make(map[string][]byte), failAfter: -1}
+}
+
+func (a *fakeArchive) Put(ctx context.Context, key string, body []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failAfter >= 0 && len(a.keys) >= a.failAfter {
+		return errUploadFailed
+	}
+	a.objects[key] = body
+	a.keys = append(a.keys, key)
+	return nil
+}
+
+func (a *fakeArchive) Location() string {
+	return "memory"
+}
+
+// setFailAfter fails Puts once n objects are stored, or never if n is negative
+func (a *fakeArchive) setFailAfter(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failAfter = n
+}
+
+// Keys returns the keys stored so far, in order
+func (a *fakeArchive) Keys() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.keys...)
+}
+
+// rows decodes the gzipped JSON Lines object stored under key
+func (a *fakeArchive) rows(t *testing.T, key string) []map[string]interface{} {
+	t.Helper()
+	a.mu.Lock()
+	body, ok := a.objects[key]
+	a.mu.Unlock()
+	if !ok {
+		t.Fatalf("no archive object %s", key)
+	}
+	return decodeJSONLines(t, body)
+}
+
+func decodeJSONLines(t *testing.T, body []byte) []map[string]interface{} {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("archive object isn't gzipped: %v", err)
+	}
+	var rows []map[string]interface{}
+	lines := bufio.NewScanner(gz)
+	for lines.Scan() {
+		var row map[string]interface{}
+		if err := json.Unmarshal(lines.Bytes(), &row); err != nil {
+			t.Fatalf("archive line %q isn't JSON: %v", lines.Text(), err)
+		}
+		rows = append(rows, row)
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatalf("failed to read archive object: %v", err)
+	}
+	return rows
+}
+
+func TestStoreWritesGzippedJSONLines(t *testing.T) {
+	ctx := context.Background()
+	s := &RetentionService{}
+	archive := newFakeArchive()
+
+	rows := []map[string]interface{}{
+		{"id": 1, "bidder": "Bidder0", "amount": "1.5"},
+		{"id": 2, "bidder": "Bidder1", "amount": "2.5"},
+	}
+	if err := s.store(ctx, archive, "org-1/nft_bids/1-2.jsonl.gz", rows); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	got := archive.rows(t, "org-1/nft_bids/1-2.jsonl.gz")
+	if len(got) != 2 || got[0]["bidder"] != "Bidder0" || got[1]["amount"] != "2.5" || got[1]["id"] != float64(2) {
+		t.Errorf("archived %v, want the rows one per line", got)
+	}
+
+	event := models.WebhookEvent{WebhookID: 3, EventType: "NFT_BID", Payload: `{"bidder": "Bidder0"}`}
+	event.ID = 7
+	if err := s.store(ctx, archive, "org-1/events/7-7.jsonl.gz", []models.WebhookEvent{event}); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	got = archive.rows(t, "org-1/events/7-7.jsonl.gz")
+	if len(got) != 1 || got[0]["ID"] != float64(7) || got[0]["payload"] != event.Payload {
+		t.Errorf("archived %v, want event 7 with its payload", got)
+	}
+
+	if err := s.store(ctx, archive, "other", []string{"row"}); err == nil {
+		t.Error("store of unsupported rows = nil, want an error")
+	}
+	archive.setFailAfter(0)
+	if err := s.store(ctx, archive, "failed", rows); !errors.Is(err, errUploadFailed) {
+		t.Errorf("store with a failing archive = %v, want the upload error", err)
+	}
+}
+
+func TestLocalArchiveReplacesObjects(t *testing.T) {
+	dir := t.TempDir()
+	archive := NewLocalArchive(dir)
+	for _, body := range []string{"first", "second"} {
+		if err := archive.Put(context.Background(), "org-1/events/1-2.jsonl.gz", []byte(body)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	path := filepath.Join(dir, "org-1", "events", "1-2.jsonl.gz")
+	body, err := os.ReadFile(path)
+	if err != nil || string(body) != "second" {
+		t.Errorf("%s holds %q, %v; want the last object put", path, body, err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+// expireEvents backdates when events were received
+func expireEvents(t *testing.T, db *gorm.DB, events []models.WebhookEvent, at time.Time) {
+	t.Helper()
+	ids := make([]uint, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+	}
+	err := db.Model(&models.WebhookEvent{}).Where("id IN ?", ids).Update("created_at", at).Error
+	if err != nil {
+		t.Fatalf("failed to backdate events: %v", err)
+	}
+}
+
+func TestPruneEventsArchivesEachBatchBeforeDeleting(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s := newTestServices(t, db, PartitionNone)
+	archive := newFakeArchive()
+	retention := NewRetentionService(db, s.tenants, s.partitions, archive, 2, time.Hour, testLogger())
+	orgID, webhooks := createTestOrganization(t, db, 1)
+	now := time.Now()
+	expired := storeBids(t, db, webhooks[0], now, now, now, now, now)
+	expireEvents(t, db, expired, now.AddDate(0, 0, -60))
+	storeBids(t, db, webhooks[0], now)
+
+	policy, err := retention.SetPolicy(orgID, RetentionInput{Target: models.RetentionEvents, MaxAgeDays: 30, Archive: true})
+	if err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+
+	// The second batch fails to upload, so only the first is deleted
+	archive.setFailAfter(1)
+	retention.Prune(ctx, policy)
+	if !strings.Contains(policy.LastError, errUploadFailed.Error()) || policy.LastPruned != 2 {
+		t.Errorf("run pruned %d with error %q, want 2 before the upload failed", policy.LastPruned, policy.LastError)
+	}
+	if n := countRows(t, db, "webhook_events"); n != 4 {
+		t.Fatalf("%d events left after a failed upload, want the 4 not archived", n)
+	}
+
+	archive.setFailAfter(-1)
+	retention.Prune(ctx, policy)
+	if policy.LastError != "" || policy.LastPruned != 3 {
+		t.Errorf("run pruned %d with error %q, want the 3 left", policy.LastPruned, policy.LastError)
+	}
+	if n := countRows(t, db, "webhook_events"); n != 1 {
+		t.Errorf("%d events left, want the 1 retained", n)
+	}
+
+	// Batches of two, keyed by the range of IDs they hold
+	var want []string
+	for _, batch := range [][2]int{{0, 1}, {2, 3}, {4, 4}} {
+		want = append(want, fmt.Sprintf("org-%d/events/%d-%d.jsonl.gz", orgID, expired[batch[0]].ID, expired[batch[1]].ID))
+	}
+	if got := archive.Keys(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("archived %v, want %v", got, want)
+	}
+	for i, key := range want {
+		rows := archive.rows(t, key)
+		if len(rows) != 2-i/2 || rows[0]["ID"] != float64(expired[2*i].ID) {
+			t.Errorf("%s holds %d events starting at %v, want event %d first", key, len(rows), rows[0]["ID"], expired[2*i].ID)
+		}
+	}
+}
+
+func TestPruneCategoryArchivesEachBatchBeforeDeleting(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s := newTestServices(t, db, PartitionNone)
+	archive := newFakeArchive()
+	retention := NewRetentionService(db, s.tenants, s.partitions, archive, 2, time.Hour, testLogger())
+	orgID, webhooks := createTestOrganization(t, db, 1)
+	table := TableName(webhooks[0], NFTBidsCategory)
+	old := time.Now().AddDate(0, 0, -60).UTC().Truncate(time.Second)
+	storeBids(t, db, webhooks[0], old, old, old, time.Now())
+	replayAll(t, s, orgID, webhooks[0], ReplayTargetLive)
+
+	policy, err := retention.SetPolicy(orgID, RetentionInput{Target: NFTBidsCategory.Name, MaxAgeDays: 30, Archive: true})
+	if err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+
+	archive.setFailAfter(0)
+	retention.Prune(ctx, policy)
+	if policy.LastError == "" || policy.LastPruned != 0 {
+		t.Errorf("run pruned %d with error %q, want nothing and the upload error", policy.LastPruned, policy.LastError)
+	}
+	if n := countRows(t, db, table); n != 4 {
+		t.Fatalf("%d rows left after a failed upload, want all 4", n)
+	}
+
+	archive.setFailAfter(-1)
+	retention.Prune(ctx, policy)
+	if policy.LastError != "" || policy.LastPruned != 3 {
+		t.Errorf("run pruned %d with error %q, want the 3 expired rows", policy.LastPruned, policy.LastError)
+	}
+	if n := countRows(t, db, table); n != 1 {
+		t.Errorf("%d rows left, want the 1 retained", n)
+	}
+
+	keys := archive.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("archived %v, want a batch of 2 rows and one of 1", keys)
+	}
+	for i, key := range keys {
+		if !strings.HasPrefix(key, fmt.Sprintf("org-%d/%s/", orgID, table)) {
+			t.Errorf("archive key %s isn't under the organization's table", key)
+		}
+		rows := archive.rows(t, key)
+		if len(rows) != 2-i || !strings.HasPrefix(fmt.Sprint(rows[0]["bidder"]), "Bidder") {
+			t.Errorf("%s holds %v, want %d bid rows", key, rows, 2-i)
+		}
+	}
+}
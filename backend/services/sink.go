@@ -0,0 +1,456 @@
+package services
+
+import (
+	"backend/models"
+	"backend/tracing"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidSinkConfig = errors.New("invalid sink configuration")
+
+// SinkRecord is one processed event, normalized to its category's columns
+type SinkRecord struct {
+	OrganizationID uint
+	WebhookID      uint
+	EventID        uint
+	Category       *Category
+	Values         []interface{} // In Category.Columns order
+	// Written to the tables with this suffix instead of the live ones, such
+	// as a replay's shadow tables; only database sinks support it
+	TableSuffix string
+}
+
+// Fields returns the record's columns keyed by name
+func (r *SinkRecord) Fields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(r.Values))
+	for i, column := range r.Category.Columns {
+		fields[column.Name] = r.Values[i]
+	}
+	return fields
+}
+
+// jsonFields returns the record's columns keyed by name, with times in UTC
+// RFC 3339 as every JSON consumer receives them
+func (r *SinkRecord) jsonFields() map[string]interface{} {
+	fields := r.Fields()
+	for name, value := range fields {
+		if t, ok := value.(time.Time); ok {
+			fields[name] = t.UTC().Format(time.RFC3339)
+		}
+	}
+	return fields
+}
+
+// MarshalJSON encodes the record as the message body written to streaming sinks
+func (r *SinkRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		EventID   uint                   `json:"event_id"`
+		WebhookID uint                   `json:"webhook_id"`
+		Category  string                 `json:"category"`
+		Data      map[string]interface{} `json:"data"`
+	}{r.EventID, r.WebhookID, r.Category.Name, r.jsonFields()})
+}
+
+// Sink is a destination for processed events
+type Sink interface {
+	Write(ctx context.Context, record *SinkRecord) error
+	Close() error
+}
+
+// DatabaseSink writes records to the category tables in the organization's
+// database, using the DDL dialect of its driver
+type DatabaseSink struct {
+	tenants    *TenantDBManager
+	partitions *PartitionService
+	buffer     *writeBuffer // Nil when every row is written on its own
+
+	mu sync.Mutex
+	// Tables known to exist with an event_id column, per tenant pool, and
+	// whether each is partitioned
+	ensured map[ensuredTable]bool
+}
+
+type ensuredTable struct {
+	db    *gorm.DB
+	table string
+}
+
+func NewDatabaseSink(tenants *TenantDBManager, partitions *PartitionService, batching WriteBatching) *DatabaseSink {
+	s := &DatabaseSink{
+		tenants:    tenants,
+		partitions: partitions,
+		ensured:    make(map[ensuredTable]bool),
+	}
+	if batching.MaxRows > 1 {
+		s.buffer = newWriteBuffer(s, batching)
+	}
+	tenants.BeforeClose(s.release)
+	return s
+}
+
+// Write upserts the record by event ID, creating the webhook's table if it
+// doesn't exist, so writing the same event twice leaves one row. With
+// batching enabled the row is inserted together with others bound for the
+// same table, and Write returns once that insert commits.
+func (s *DatabaseSink) Write(ctx context.Context, record *SinkRecord) error {
+	db, err := s.tenants.ForOrganization(record.OrganizationID)
+	if err != nil {
+		return err
+	}
+	tableName := TableName(record.WebhookID, record.Category) + record.TableSuffix
+
+	spanCtx, span := tracing.Start(ctx, "sink.insert", trace.WithAttributes(attribute.String("db.sql.table", tableName)))
+	if s.buffer != nil {
+		err = s.buffer.write(spanCtx, db, tableName, record)
+	} else {
+		err = s.insert(spanCtx, db, tableName, []*SinkRecord{record})
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// insert upserts records of one category into table with a single statement
+func (s *DatabaseSink) insert(ctx context.Context, db *gorm.DB, table string, records []*SinkRecord) error {
+	category := records[0].Category
+	partitioned, err := s.ensureTable(ctx, db, category, table)
+	if err != nil {
+		return err
+	}
+	args := make([]interface{}, 0, len(records)*(len(category.Columns)+1))
+	moved := make([]interface{}, 0, 3*len(records))
+	for _, record := range records {
+		args = category.InsertArgs(args, record.EventID, record.Values)
+		moved = append(moved, uint64(record.EventID))
+	}
+	for _, record := range records {
+		moved = append(moved, uint64(record.EventID), record.Fields()[PartitionColumn])
+	}
+	exec := func() error {
+		if !partitioned {
+			return db.WithContext(ctx).Exec(category.InsertSQL(db.Dialector.Name(), table, len(records)), args...).Error
+		}
+		// Rows conflict on event ID and timestamp, so a row whose timestamp
+		// changed is deleted rather than replaced
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(category.DeleteMovedSQL(table, len(records)), moved...).Error; err != nil {
+				return err
+			}
+			return tx.Exec(category.PartitionedInsertSQL(table, len(records)), args...).Error
+		})
+	}
+
+	err = exec()
+	if isStaleTable(err) || (!partitioned && isMissingPartition(err)) {
+		// Another replica or the CLI replaced the table since it was
+		// ensured here, for example by a rebuild or partition conversion
+		s.Forget(db, table)
+		if partitioned, err = s.ensureTable(ctx, db, category, table); err != nil {
+			return err
+		}
+		err = exec()
+	}
+	if partitioned && len(records) == 1 && isMissingPartition(err) {
+		// The event is older or newer than the partitions made ahead of time
+		if t, ok := records[0].Fields()[PartitionColumn].(time.Time); ok {
+			// TIMESTAMP columns store the wall clock, whatever its zone
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+			if err = s.partitions.EnsurePartitionFor(ctx, db, table, t); err == nil {
+				err = exec()
+			}
+		}
+	}
+	return err
+}
+
+// Ensure creates a category table the way the first write to it would
+func (s *DatabaseSink) Ensure(ctx context.Context, db *gorm.DB, category *Category, table string) error {
+	_, err := s.ensureTable(ctx, db, category, table)
+	return err
+}
+
+// ensureTable creates a category table, partitioned if partitioning is
+// enabled, or adds the event_id column to one created before writes were
+// keyed by event. It reports whether the table is partitioned, which it
+// may be from before partitioning was turned off.
+func (s *DatabaseSink) ensureTable(ctx context.Context, db *gorm.DB, category *Category, table string) (partitioned bool, err error) {
+	key := ensuredTable{db: db, table: table}
+	s.mu.Lock()
+	partitioned, ok := s.ensured[key]
+	s.mu.Unlock()
+	if ok {
+		return partitioned, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "sink.create_table", trace.WithAttributes(attribute.String("db.sql.table", table)))
+	defer func() { tracing.End(span, err) }()
+
+	driver := db.Dialector.Name()
+	createSQL := category.CreateTableSQL(driver, table)
+	if s.partitions.Enabled(db) {
+		createSQL = category.PartitionedTableSQL(table)
+	}
+	if err := db.WithContext(ctx).Exec(createSQL).Error; err != nil {
+		return false, fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+	if upgrade := category.AddEventIDSQL(driver, table); upgrade != "" && !db.WithContext(ctx).Migrator().HasColumn(table, "event_id") {
+		if err := db.WithContext(ctx).Exec(upgrade).Error; err != nil {
+			return false, fmt.Errorf("failed to add event_id to %s: %w", table, err)
+		}
+	}
+	if partitioned, err = s.partitions.IsPartitioned(ctx, db, table); err != nil {
+		return false, err
+	}
+	if partitioned {
+		if err := s.partitions.EnsurePartitions(ctx, db, table); err != nil {
+			return false, fmt.Errorf("failed to create partitions of %s: %w", table, err)
+		}
+	}
+
+	s.mu.Lock()
+	s.ensured[key] = partitioned
+	s.mu.Unlock()
+	return partitioned, nil
+}
+
+// Forget drops tables from the cache of ensured tables, so a table dropped
+// or renamed away is created again by the next write to it
+func (s *DatabaseSink) Forget(db *gorm.DB, tables ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, table := range tables {
+		delete(s.ensured, ensuredTable{db: db, table: table})
+	}
+}
+
+// release writes the rows buffered for db and forgets its tables, before
+// the TenantDBManager closes it
+func (s *DatabaseSink) release(db *gorm.DB) {
+	if s.buffer != nil {
+		s.buffer.drop(db)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.ensured {
+		if key.db == db {
+			delete(s.ensured, key)
+		}
+	}
+}
+
+// Close writes the rows still buffered and stops batching; tenant pools are
+// owned by the TenantDBManager
+func (s *DatabaseSink) Close() error {
+	if s.buffer != nil {
+		s.buffer.close()
+	}
+	return nil
+}
+
+// SinkManager hands out the sink configured by each organization, opening
+// connections lazily and reopening them when the configuration changes
+type SinkManager struct {
+	platform *gorm.DB
+	database *DatabaseSink
+	// Shares one dial between callers asking for the same configuration
+	opening singleflight.Group
+
+	mu    sync.Mutex
+	sinks map[uint]*openSink
+}
+
+type openSink struct {
+	sink      Sink
+	updatedAt time.Time
+	users     int  // Callers that haven't released it yet
+	retired   bool // Replaced or shut down; closed once users reaches 0
+}
+
+func NewSinkManager(platform *gorm.DB, tenants *TenantDBManager, partitions *PartitionService, batching WriteBatching) *SinkManager {
+	return &SinkManager{
+		platform: platform,
+		database: NewDatabaseSink(tenants, partitions, batching),
+		sinks:    make(map[uint]*openSink),
+	}
+}
+
+// Database returns the sink writing to organizations' databases, whatever
+// sink they have configured
+func (m *SinkManager) Database() *DatabaseSink {
+	return m.database
+}
+
+// ForOrganization returns the sink for orgID's processed events and a func
+// the caller must call once it has finished writing to it. A sink replaced
+// after a configuration change is closed when its last user releases it.
+func (m *SinkManager) ForOrganization(orgID uint) (Sink, func(), error) {
+	var cfg models.SinkConfig
+	err := m.platform.Where("organization_id = ?", orgID).First(&cfg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && cfg.Driver == models.SinkPostgres) {
+		return m.database, func() {}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load sink config: %w", err)
+	}
+
+	if open := m.acquire(orgID, cfg.UpdatedAt); open != nil {
+		return open.sink, func() { m.release(open) }, nil
+	}
+
+	// Dial without holding m.mu, which every organization's writes need
+	key := fmt.Sprintf("%d@%d", orgID, cfg.UpdatedAt.UnixNano())
+	_, err, _ = m.opening.Do(key, func() (interface{}, error) {
+		if open := m.acquire(orgID, cfg.UpdatedAt); open != nil {
+			m.release(open)
+			return nil, nil
+		}
+		sink, err := OpenSink(&cfg)
+		if err != nil {
+			return nil, err
+		}
+		m.install(orgID, cfg.UpdatedAt, sink)
+		return nil, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if open := m.acquire(orgID, cfg.UpdatedAt); open != nil {
+		return open.sink, func() { m.release(open) }, nil
+	}
+	// The configuration changed again while the sink was being opened
+	return m.ForOrganization(orgID)
+}
+
+// acquire returns orgID's open sink for the configuration saved at
+// updatedAt, counting the caller as a user, or nil if it isn't open
+func (m *SinkManager) acquire(orgID uint, updatedAt time.Time) *openSink {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	open, ok := m.sinks[orgID]
+	if !ok || !open.updatedAt.Equal(updatedAt) {
+		return nil
+	}
+	open.users++
+	return open
+}
+
+// install makes sink orgID's open sink, retiring the one it replaces. A
+// sink for an older configuration than the open one is closed instead.
+func (m *SinkManager) install(orgID uint, updatedAt time.Time, sink Sink) {
+	m.mu.Lock()
+	current, ok := m.sinks[orgID]
+	if ok && current.updatedAt.After(updatedAt) {
+		m.mu.Unlock()
+		sink.Close()
+		return
+	}
+	m.sinks[orgID] = &openSink{sink: sink, updatedAt: updatedAt}
+	idle := ok && m.retire(current)
+	m.mu.Unlock()
+
+	if idle {
+		current.sink.Close()
+	}
+}
+
+// release counts a user of open out, closing it if it was the last user of
+// a retired sink
+func (m *SinkManager) release(open *openSink) {
+	m.mu.Lock()
+	open.users--
+	idle := open.retired && open.users == 0
+	m.mu.Unlock()
+
+	if idle {
+		open.sink.Close()
+	}
+}
+
+// retire marks open for closing and reports whether it has no users left,
+// in which case the caller closes it. m.mu must be held.
+func (m *SinkManager) retire(open *openSink) bool {
+	open.retired = true
+	return open.users == 0
+}
+
+// Close closes every open streaming sink, once in-flight writes to it have
+// finished, and flushes the database sink
+func (m *SinkManager) Close() {
+	m.mu.Lock()
+	var idle []Sink
+	for orgID, open := range m.sinks {
+		if m.retire(open) {
+			idle = append(idle, open.sink)
+		}
+		delete(m.sinks, orgID)
+	}
+	m.mu.Unlock()
+
+	for _, sink := range idle {
+		sink.Close()
+	}
+	m.database.Close()
+}
+
+// OpenSink connects to the streaming sink described by cfg
+func OpenSink(cfg *models.SinkConfig) (Sink, error) {
+	if err := ValidateSinkConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	addresses := splitCommaList(cfg.Addresses)
+	switch cfg.Driver {
+	case models.SinkKafka:
+		return NewKafkaSink(addresses, cfg.Prefix, cfg.Username, cfg.Password, cfg.TLS), nil
+	case models.SinkNATS:
+		return NewNATSSink(addresses, cfg.Prefix, cfg.Username, cfg.Password, cfg.TLS)
+	case models.SinkRedis:
+		return NewRedisSink(addresses[0], cfg.Prefix, cfg.Username, cfg.Password, cfg.TLS), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported driver %q", ErrInvalidSinkConfig, cfg.Driver)
+	}
+}
+
+// ValidateSinkConfig checks that cfg names a known driver and, for streaming
+// sinks, at least one address
+func ValidateSinkConfig(cfg *models.SinkConfig) error {
+	switch cfg.Driver {
+	case models.SinkPostgres:
+		return nil
+	case models.SinkKafka, models.SinkNATS, models.SinkRedis:
+		if len(splitCommaList(cfg.Addresses)) == 0 {
+			return fmt.Errorf("%w: at least one address is required", ErrInvalidSinkConfig)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported driver %q", ErrInvalidSinkConfig, cfg.Driver)
+	}
+}
+
+func splitCommaList(addresses string) []string {
+	var list []string
+	for _, address := range strings.Split(addresses, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			list = append(list, address)
+		}
+	}
+	return list
+}
+
+// sinkName joins a configured prefix and a category name with sep
+func sinkName(prefix, sep string, category *Category) string {
+	if prefix == "" {
+		prefix = "helixscan"
+	}
+	return prefix + sep + category.Name
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// KafkaSink publishes records to one topic per category, keyed by webhook
+// so a webhook's events stay ordered within a partition
+type KafkaSink struct {
+	writer kafkaWriter
+	prefix string
+}
+
+// kafkaWriter is the part of *kafka.Writer the sink uses
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+func NewKafkaSink(brokers []string, prefix, username, password string, useTLS bool) *KafkaSink {
+	transport := &kafka.Transport{}
+	if username != "" {
+		transport.SASL = plain.Mechanism{Username: username, Password: password}
+	}
+	if useTLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return &KafkaSink{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+			Transport:              transport,
+		},
+		prefix: prefix,
+	}
+}
+
+// Write publishes the record to "<prefix>.<category>"
+func (s *KafkaSink) Write(ctx context.Context, record *SinkRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	err = s.writer.WriteMessages(ctx, kafka.Message{
+		Topic: sinkName(s.prefix, ".", record.Category),
+		Key:   []byte(strconv.FormatUint(uint64(record.WebhookID), 10)),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "event_id", Value: []byte(strconv.FormatUint(uint64(record.EventID), 10))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write to kafka: %w", err)
+	}
+	return nil
+}
+
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
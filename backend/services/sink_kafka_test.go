@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeKafkaWriter records the messages a KafkaSink writes
+type fakeKafkaWriter struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+	fail     error
+	closed   bool
+}
+
+func (w *fakeKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fail != nil {
+		return w.fail
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeKafkaWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestKafkaSinkWritesToTheCategoryTopic(t *testing.T) {
+	writer := &fakeKafkaWriter{}
+	sink := &KafkaSink{writer: writer, prefix: "acme"}
+	record := bidRecord(3, "Bidder111")
+	record.WebhookID = 7
+
+	if err := sink.Write(context.Background(), record); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(writer.messages) != 1 {
+		t.Fatalf("%d messages written, want 1", len(writer.messages))
+	}
+	msg := writer.messages[0]
+	if msg.Topic != "acme.nft_bids" {
+		t.Errorf("topic = %s, want acme.nft_bids", msg.Topic)
+	}
+	// Keyed by webhook so its events share a partition
+	if string(msg.Key) != "7" {
+		t.Errorf("key = %s, want the webhook ID", msg.Key)
+	}
+	if len(msg.Headers) != 1 || msg.Headers[0].Key != "event_id" || string(msg.Headers[0].Value) != "3" {
+		t.Errorf("headers = %v, want event_id 3", msg.Headers)
+	}
+	want, _ := json.Marshal(record)
+	if string(msg.Value) != string(want) {
+		t.Errorf("value = %s, want %s", msg.Value, want)
+	}
+
+	if err := sink.Close(); err != nil || !writer.closed {
+		t.Errorf("Close = %v, writer closed %v", err, writer.closed)
+	}
+}
+
+func TestKafkaSinkReturnsWriteErrors(t *testing.T) {
+	errBroker := errors.New("broker unavailable")
+	sink := &KafkaSink{writer: &fakeKafkaWriter{fail: errBroker}}
+	if err := sink.Write(context.Background(), bidRecord(1, "Bidder111")); !errors.Is(err, errBroker) {
+		t.Errorf("Write = %v, want the writer's error", err)
+	}
+}
+
+func TestNewKafkaSinkDefaultsTheTopicPrefix(t *testing.T) {
+	writer := &fakeKafkaWriter{}
+	sink := NewKafkaSink([]string{"localhost:9092"}, "", "", "", false)
+	sink.writer.Close()
+	sink.writer = writer
+	if err := sink.Write(context.Background(), bidRecord(1, "Bidder111")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if topic := writer.messages[0].Topic; topic != "helixscan.nft_bids" {
+		t.Errorf("topic = %s, want helixscan.nft_bids", topic)
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Window in which JetStream discards republished events with the same ID
+const natsDuplicateWindow = 10 * time.Minute
+
+// NATSSink publishes records to JetStream subjects "<prefix>.<category>",
+// creating a stream that captures "<prefix>.>" if needed
+type NATSSink struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	prefix string
+}
+
+func NewNATSSink(servers []string, prefix, username, password string, useTLS bool) (*NATSSink, error) {
+	if prefix == "" {
+		prefix = "helixscan"
+	}
+
+	opts := []nats.Option{nats.Name("helixscan")}
+	if username != "" {
+		opts = append(opts, nats.UserInfo(username, password))
+	}
+	if useTLS {
+		opts = append(opts, nats.Secure())
+	}
+	conn, err := nats.Connect(strings.Join(servers, ","), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open jetstream: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       strings.ToUpper(strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(prefix)),
+		Subjects:   []string{prefix + ".>"},
+		Duplicates: natsDuplicateWindow,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create jetstream stream: %w", err)
+	}
+
+	return &NATSSink{conn: conn, js: js, prefix: prefix}, nil
+}
+
+// Write publishes the record and waits for the stream's acknowledgement.
+// The event ID is used as the message ID so retries are deduplicated.
+func (s *NATSSink) Write(ctx context.Context, record *SinkRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	_, err = s.js.Publish(ctx, sinkName(s.prefix, ".", record.Category), data,
+		jetstream.WithMsgID(strconv.FormatUint(uint64(record.EventID), 10)))
+	if err != nil {
+		return fmt.Errorf("failed to publish to jetstream: %w", err)
+	}
+	return nil
+}
+
+func (s *NATSSink) Close() error {
+	return s.conn.Drain()
+}
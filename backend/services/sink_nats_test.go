@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// runNATS starts an embedded NATS server with JetStream enabled
+func runNATS(t *testing.T) *server.Server {
+	t.Helper()
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create nats server: %v", err)
+	}
+	ns.Start()
+	t.Cleanup(ns.Shutdown)
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server didn't start")
+	}
+	return ns
+}
+
+func TestNATSSinkPublishesToJetStream(t *testing.T) {
+	ns := runNATS(t)
+	ctx := context.Background()
+	sink, err := NewNATSSink([]string{ns.ClientURL()}, "acme", "", "", false)
+	if err != nil {
+		t.Fatalf("NewNATSSink: %v", err)
+	}
+	defer sink.Close()
+
+	// A retried write is deduplicated by event ID
+	record := bidRecord(3, "Bidder111")
+	for range 2 {
+		if err := sink.Write(ctx, record); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := sink.Write(ctx, bidRecord(4, "Bidder111")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	stream, err := sink.js.Stream(ctx, "ACME")
+	if err != nil {
+		t.Fatalf("failed to load stream: %v", err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatalf("failed to load stream info: %v", err)
+	}
+	if info.State.Msgs != 2 {
+		t.Errorf("stream has %d messages, want 2", info.State.Msgs)
+	}
+	if subjects := info.Config.Subjects; len(subjects) != 1 || subjects[0] != "acme.>" {
+		t.Errorf("stream captures %v, want acme.>", subjects)
+	}
+
+	msg, err := stream.GetMsg(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to load message: %v", err)
+	}
+	want, _ := json.Marshal(record)
+	if msg.Subject != "acme.nft_bids" || string(msg.Data) != string(want) {
+		t.Errorf("message on %s = %s, want %s on acme.nft_bids", msg.Subject, msg.Data, want)
+	}
+	if id := msg.Header.Get(jetstream.MsgIDHeader); id != "3" {
+		t.Errorf("message ID = %q, want the event ID", id)
+	}
+}
+
+func TestNATSSinkDefaultsTheSubjectPrefix(t *testing.T) {
+	ns := runNATS(t)
+	sink, err := NewNATSSink([]string{ns.ClientURL()}, "", "", "", false)
+	if err != nil {
+		t.Fatalf("NewNATSSink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(context.Background(), bidRecord(1, "Bidder111")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	stream, err := sink.js.Stream(context.Background(), "HELIXSCAN")
+	if err != nil {
+		t.Fatalf("failed to load stream: %v", err)
+	}
+	if msg, err := stream.GetMsg(context.Background(), 1); err != nil || msg.Subject != "helixscan.nft_bids" {
+		t.Errorf("GetMsg = %v, %v, want a message on helixscan.nft_bids", msg, err)
+	}
+}
+
+func TestNewNATSSinkFailsWithoutAServer(t *testing.T) {
+	ns := runNATS(t)
+	url := ns.ClientURL()
+	ns.Shutdown()
+	if _, err := NewNATSSink([]string{url}, "", "", "", false); err == nil {
+		t.Error("NewNATSSink succeeded with the server down")
+	}
+}
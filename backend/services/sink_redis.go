@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Approximate number of entries kept in each category stream
+const redisStreamMaxLen = 1_000_000
+
+// RedisSink appends records to one Redis stream per category, keyed
+// "<prefix>:<category>"
+type RedisSink struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisSink(address, prefix, username, password string, useTLS bool) *RedisSink {
+	opts := &redis.Options{
+		Addr:     address,
+		Username: username,
+		Password: password,
+	}
+	if useTLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return &RedisSink{client: redis.NewClient(opts), prefix: prefix}
+}
+
+// Write adds the record to its category stream, trimming old entries
+func (s *RedisSink) Write(ctx context.Context, record *SinkRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	err = s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: sinkName(s.prefix, ":", record.Category),
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"event_id":   record.EventID,
+			"webhook_id": record.WebhookID,
+			"data":       data,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to write to redis stream: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisSink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisSinkAppendsToTheCategoryStream(t *testing.T) {
+	server := miniredis.RunT(t)
+	sink := NewRedisSink(server.Addr(), "acme", "", "", false)
+	defer sink.Close()
+
+	records := []*SinkRecord{bidRecord(1, "Bidder111"), bidRecord(2, "Bidder222")}
+	for _, record := range records {
+		if err := sink.Write(context.Background(), record); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	entries, err := server.Stream("acme:nft_bids")
+	if err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+	if len(entries) != len(records) {
+		t.Fatalf("stream has %d entries, want %d", len(entries), len(records))
+	}
+	for i, entry := range entries {
+		fields := make(map[string]string)
+		for j := 0; j+1 < len(entry.Values); j += 2 {
+			fields[entry.Values[j]] = entry.Values[j+1]
+		}
+		want, _ := json.Marshal(records[i])
+		if fields["event_id"] != []string{"1", "2"}[i] || fields["webhook_id"] != "1" || fields["data"] != string(want) {
+			t.Errorf("entry %d = %v, want event %d with its record", i, fields, records[i].EventID)
+		}
+	}
+}
+
+func TestRedisSinkReturnsWriteErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	sink := NewRedisSink(server.Addr(), "", "", "", false)
+	defer sink.Close()
+
+	server.Close()
+	if err := sink.Write(context.Background(), bidRecord(1, "Bidder111")); err == nil {
+		t.Error("Write succeeded with the server down")
+	}
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSinkRecordMarshalJSON(t *testing.T) {
+	record := &SinkRecord{
+		OrganizationID: 1,
+		WebhookID:      2,
+		EventID:        3,
+		Category:       NFTBidsCategory,
+		Values:         bidValues("Bidder111", 1.5, time.Date(2024, 5, 1, 2, 0, 0, 0, time.FixedZone("", 2*60*60))),
+		TableSuffix:    ShadowTableSuffix,
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"event_id":3,"webhook_id":2,"category":"nft_bids","data":{"amount":1.5,"bidder":"Bidder111","nft_address":"Nft111","timestamp":"2024-05-01T00:00:00Z"}}`
+	if string(body) != want {
+		t.Errorf("Marshal = %s, want %s", body, want)
+	}
+}
+
+func TestValidateSinkConfig(t *testing.T) {
+	tests := []struct {
+		cfg   models.SinkConfig
+		valid bool
+	}{
+		{models.SinkConfig{Driver: models.SinkPostgres}, true},
+		{models.SinkConfig{Driver: models.SinkKafka, Addresses: "a:9092, b:9092"}, true},
+		{models.SinkConfig{Driver: models.SinkNATS, Addresses: "nats://a:4222"}, true},
+		{models.SinkConfig{Driver: models.SinkRedis, Addresses: "a:6379"}, true},
+		{models.SinkConfig{Driver: models.SinkKafka, Addresses: " , "}, false},
+		{models.SinkConfig{Driver: models.SinkRedis}, false},
+		{models.SinkConfig{Driver: "kinesis", Addresses: "a"}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateSinkConfig(&tt.cfg)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateSinkConfig(%s %q) = %v", tt.cfg.Driver, tt.cfg.Addresses, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidSinkConfig) {
+			t.Errorf("ValidateSinkConfig(%s %q) = %v, want ErrInvalidSinkConfig", tt.cfg.Driver, tt.cfg.Addresses, err)
+		}
+	}
+}
+
+func TestSinkName(t *testing.T) {
+	if got := sinkName("", ".", NFTBidsCategory); got != "helixscan.nft_bids" {
+		t.Errorf("sinkName without a prefix = %s", got)
+	}
+	if got := sinkName("acme", ":", TokenPricesCategory); got != "acme:token_prices" {
+		t.Errorf("sinkName with a prefix = %s", got)
+	}
+}
+
+func TestDatabaseSinkUpsertsByEvent(t *testing.T) {
+	for _, interval := range []string{PartitionNone, PartitionMonthly} {
+		for _, batching := range []WriteBatching{{}, {MaxRows: 10, Linger: time.Millisecond}} {
+			t.Run(fmt.Sprintf("%s/%d", interval, batching.MaxRows), func(t *testing.T) {
+				db := testDB(t)
+				ctx := context.Background()
+				tenants := NewTenantDBManager(db, TenantPoolLimits{})
+				partitions := NewPartitionService(db, tenants, interval, 1, 0, nil, 100, testLogger())
+				sink := NewDatabaseSink(tenants, partitions, batching)
+				t.Cleanup(func() { sink.Close() })
+				table := TableName(1, NFTBidsCategory)
+
+				at := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+				record := bidRecord(1, "Bidder111")
+				record.Values = bidValues("Bidder111", "1.5", at)
+				for _, bidder := range []string{"Bidder111", "Bidder222"} {
+					record.Values[1] = bidder
+					if err := sink.Write(ctx, record); err != nil {
+						t.Fatalf("Write: %v", err)
+					}
+				}
+				if n := countRows(t, db, table); n != 1 {
+					t.Fatalf("%s has %d rows after writing one event twice, want 1", table, n)
+				}
+				var bidder string
+				if err := db.Raw("SELECT bidder FROM " + table + " WHERE event_id = 1").Scan(&bidder).Error; err != nil {
+					t.Fatalf("failed to load row: %v", err)
+				}
+				if bidder != "Bidder222" {
+					t.Errorf("row has bidder %s, want the later write's", bidder)
+				}
+
+				// Partitioned tables get partitions for events of any age
+				record = bidRecord(2, "Bidder111")
+				record.Values = bidValues("Bidder111", "1.5", time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC))
+				if err := sink.Write(ctx, record); err != nil {
+					t.Fatalf("Write of an old event: %v", err)
+				}
+				if partitioned, _ := partitions.IsPartitioned(ctx, db, table); partitioned != (interval != PartitionNone) {
+					t.Errorf("IsPartitioned = %v with partitioning %s", partitioned, interval)
+				}
+			})
+		}
+	}
+}
+
+func TestDatabaseSinkAddsEventIDToOldTables(t *testing.T) {
+	db := testDB(t)
+	tenants := NewTenantDBManager(db, TenantPoolLimits{})
+	sink := NewDatabaseSink(tenants, NewPartitionService(db, tenants, PartitionNone, 1, 0, nil, 100, testLogger()), WriteBatching{})
+	table := TableName(1, NFTBidsCategory)
+	// As tables were created before writes were keyed by event
+	err := db.Exec("CREATE TABLE " + table + ` (id SERIAL PRIMARY KEY, nft_address TEXT, bidder TEXT,
+		amount DECIMAL, timestamp TIMESTAMP, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`).Error
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", table, err)
+	}
+
+	for range 2 {
+		if err := sink.Write(context.Background(), bidRecord(1, "Bidder111")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if n := countRows(t, db, table); n != 1 {
+		t.Errorf("%s has %d rows, want 1", table, n)
+	}
+}
+
+func TestDatabaseSinkRecoversFromReplacedTables(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	tenants := NewTenantDBManager(db, TenantPoolLimits{})
+	partitions := NewPartitionService(db, tenants, PartitionNone, 1, 0, nil, 100, testLogger())
+	sink := NewDatabaseSink(tenants, partitions, WriteBatching{})
+	table := TableName(1, NFTBidsCategory)
+	if err := sink.Write(ctx, bidRecord(1, "Bidder111")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// Dropped by another replica
+	if err := db.Exec("DROP TABLE " + table).Error; err != nil {
+		t.Fatalf("failed to drop %s: %v", table, err)
+	}
+	if err := sink.Write(ctx, bidRecord(2, "Bidder111")); err != nil {
+		t.Fatalf("Write after the table was dropped: %v", err)
+	}
+	if n := countRows(t, db, table); n != 1 {
+		t.Errorf("%s has %d rows, want 1", table, n)
+	}
+
+	// Swapped for a partitioned one, whose keys include the timestamp
+	err := db.Exec("DROP TABLE " + table).Error
+	if err == nil {
+		err = db.Exec(NFTBidsCategory.PartitionedTableSQL(table)).Error
+	}
+	if err != nil {
+		t.Fatalf("failed to replace %s: %v", table, err)
+	}
+	if err := sink.Write(ctx, bidRecord(3, "Bidder111")); err != nil {
+		t.Fatalf("Write after the table was partitioned: %v", err)
+	}
+	if n := countRows(t, db, table); n != 1 {
+		t.Errorf("partitioned %s has %d rows, want 1", table, n)
+	}
+}
+
+func TestSinkManagerReopensChangedSinks(t *testing.T) {
+	db := testDB(t)
+	tenants := NewTenantDBManager(db, TenantPoolLimits{})
+	sinks := NewSinkManager(db, tenants, NewPartitionService(db, tenants, PartitionNone, 1, 0, nil, 100, testLogger()), WriteBatching{})
+	t.Cleanup(sinks.Close)
+	orgID, _ := createTestOrganization(t, db, 0)
+
+	sink, release, err := sinks.ForOrganization(orgID)
+	if err != nil || sink != Sink(sinks.Database()) {
+		t.Fatalf("ForOrganization without a sink config = %T, %v, want the database sink", sink, err)
+	}
+	release()
+
+	// Kafka writers connect on first write
+	cfg := models.SinkConfig{OrganizationID: orgID, Driver: models.SinkKafka, Addresses: "localhost:9092"}
+	if err := db.Create(&cfg).Error; err != nil {
+		t.Fatalf("failed to create sink config: %v", err)
+	}
+	first, release, err := sinks.ForOrganization(orgID)
+	if err != nil {
+		t.Fatalf("ForOrganization: %v", err)
+	}
+	release()
+	if _, ok := first.(*KafkaSink); !ok {
+		t.Fatalf("ForOrganization = %T, want *KafkaSink", first)
+	}
+	if again, release, _ := sinks.ForOrganization(orgID); again != first {
+		t.Error("ForOrganization opened the unchanged sink again")
+	} else {
+		release()
+	}
+
+	if err := db.Model(&cfg).Update("prefix", "acme").Error; err != nil {
+		t.Fatalf("failed to update sink config: %v", err)
+	}
+	changed, release, err := sinks.ForOrganization(orgID)
+	if err != nil {
+		t.Fatalf("ForOrganization after the config changed: %v", err)
+	}
+	release()
+	if changed == first {
+		t.Error("ForOrganization kept the sink after its config changed")
+	}
+}
+
+func TestStreamEventCarriesTheDecodedRecord(t *testing.T) {
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	webhook := &models.HeliusWebhook{OrganizationID: 1}
+	webhook.ID = 2
+	event := &models.WebhookEvent{
+		WebhookID: 2,
+		EventType: NFTBidsCategory.EventType,
+		Payload:   fmt.Sprintf(`{"nft_address": "Nft111", "bidder": "Bidder111", "amount": 1.5, "timestamp": %d, "raw": "unused"}`, at.Unix()),
+	}
+	event.ID = 3
+	record, err := DecodeEvent(webhook, event)
+	if err != nil {
+		t.Fatalf("DecodeEvent: %v", err)
+	}
+
+	e := NewStreamEvent(webhook, event, record)
+	if e.ID != 3 || e.Category != NFTBidsCategory.Name {
+		t.Errorf("stream event %d of category %s, want 3 of %s", e.ID, e.Category, NFTBidsCategory.Name)
+	}
+	want := `{"amount":1.5,"bidder":"Bidder111","nft_address":"Nft111","timestamp":"2024-05-01T00:00:00Z"}`
+	if string(e.Data) != want {
+		t.Errorf("Data = %s, want %s", e.Data, want)
+	}
+}
+
+// closeRecorder is a sink that only records being closed
+type closeRecorder struct {
+	closed bool
+}
+
+func (s *closeRecorder) Write(ctx context.Context, record *SinkRecord) error {
+	return nil
+}
+
+func (s *closeRecorder) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestSinkManagerClosesReplacedSinksOnceReleased(t *testing.T) {
+	m := &SinkManager{sinks: make(map[uint]*openSink), database: &DatabaseSink{ensured: map[ensuredTable]bool{}}}
+	t0 := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	first, second, stale := &closeRecorder{}, &closeRecorder{}, &closeRecorder{}
+
+	m.install(1, t0, first)
+	open := m.acquire(1, t0)
+	if open == nil || open.sink != first {
+		t.Fatal("acquire didn't return the installed sink")
+	}
+
+	// Replaced while a writer still holds it
+	m.install(1, t0.Add(time.Minute), second)
+	if first.closed {
+		t.Error("replaced sink closed while in use")
+	}
+	if m.acquire(1, t0) != nil {
+		t.Error("acquire returned the replaced sink")
+	}
+	m.release(open)
+	if !first.closed {
+		t.Error("replaced sink not closed once released")
+	}
+
+	// A sink opened for an older config than the open one loses
+	m.install(1, t0, stale)
+	if !stale.closed || second.closed {
+		t.Errorf("installing a stale sink closed it %v and the current one %v, want only the stale one", stale.closed, second.closed)
+	}
+
+	open = m.acquire(1, t0.Add(time.Minute))
+	m.Close()
+	if second.closed {
+		t.Error("Close closed a sink while in use")
+	}
+	m.release(open)
+	if !second.closed {
+		t.Error("sink not closed once released after Close")
+	}
+}
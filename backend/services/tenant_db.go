@@ -0,0 +1,300 @@
+package services
+
+import (
+	"backend/models"
+	"backend/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/driver/clickhouse"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const connectionTestTimeout = 5 * time.Second
+
+// TenantPoolLimits sizes each organization's connection pool
+type TenantPoolLimits struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+var ErrUnsupportedDriver = errors.New("unsupported database driver")
+
+// TenantDBManager hands out connection pools for the databases configured
+// by each organization. Organizations without a DatabaseConfig use the
+// platform database.
+type TenantDBManager struct {
+	platform *gorm.DB
+	limits   TenantPoolLimits
+	// Shares one connection attempt between callers for the same pool
+	opening singleflight.Group
+
+	mu      sync.Mutex
+	pools   map[uint]*tenantPool
+	configs map[uint]cachedConfig
+	// Bumped by Invalidate so loads that raced it aren't cached
+	generation uint64
+	// Called with each pool before it is closed
+	beforeClose []func(*gorm.DB)
+}
+
+type tenantPool struct {
+	db        *gorm.DB
+	dsn       string
+	updatedAt time.Time // Of the configuration the pool was opened for
+}
+
+type cachedConfig struct {
+	cfg     *models.DatabaseConfig // Nil when the organization has none
+	expires time.Time
+}
+
+// How long a replica trusts a cached configuration that another replica
+// may have changed
+const tenantConfigTTL = 30 * time.Second
+
+func NewTenantDBManager(platform *gorm.DB, limits TenantPoolLimits) *TenantDBManager {
+	return &TenantDBManager{
+		platform: platform,
+		limits:   limits,
+		pools:    make(map[uint]*tenantPool),
+		configs:  make(map[uint]cachedConfig),
+	}
+}
+
+// ForOrganization returns the database holding orgID's indexed tables.
+// Pools are reopened when the organization's configuration changes.
+func (m *TenantDBManager) ForOrganization(orgID uint) (*gorm.DB, error) {
+	cfg, err := m.config(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return m.platform, nil
+	}
+
+	// The driver is part of the key so switching drivers reopens the pool
+	dsn := cfg.Driver + ":" + cfg.DSN()
+	if db := m.pool(orgID, dsn); db != nil {
+		return db, nil
+	}
+
+	// Connect without holding m.mu, which every organization's lookups need
+	db, err, _ := m.opening.Do(fmt.Sprintf("%d/%s", orgID, dsn), func() (interface{}, error) {
+		if db := m.pool(orgID, dsn); db != nil {
+			return db, nil
+		}
+		return m.open(orgID, cfg, dsn)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.(*gorm.DB), nil
+}
+
+// Invalidate drops orgID's cached configuration, so the next lookup reads
+// the saved one and reopens the pool if it changed
+func (m *TenantDBManager) Invalidate(orgID uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.configs, orgID)
+	m.generation++
+}
+
+// config returns orgID's database configuration, or nil if it has none,
+// from the cache while it is fresh
+func (m *TenantDBManager) config(orgID uint) (*models.DatabaseConfig, error) {
+	m.mu.Lock()
+	cached, ok := m.configs[orgID]
+	generation := m.generation
+	m.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.cfg, nil
+	}
+
+	cached = cachedConfig{cfg: &models.DatabaseConfig{}, expires: time.Now().Add(tenantConfigTTL)}
+	err := m.platform.Where("organization_id = ?", orgID).First(cached.cfg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		cached.cfg = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load database config: %w", err)
+	}
+
+	m.mu.Lock()
+	if m.generation == generation {
+		m.configs[orgID] = cached
+	}
+	m.mu.Unlock()
+	return cached.cfg, nil
+}
+
+// pool returns orgID's open pool if it was opened for dsn
+func (m *TenantDBManager) pool(orgID uint, dsn string) *gorm.DB {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if pool, ok := m.pools[orgID]; ok && pool.dsn == dsn {
+		return pool.db
+	}
+	return nil
+}
+
+// open connects to cfg's database and makes it orgID's pool, closing the
+// pool it replaces. If a pool for a newer configuration was opened
+// meanwhile, that one is kept and returned instead.
+func (m *TenantDBManager) open(orgID uint, cfg *models.DatabaseConfig, dsn string) (*gorm.DB, error) {
+	db, err := openTenantDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(m.limits.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(m.limits.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(m.limits.ConnMaxLifetime)
+
+	m.mu.Lock()
+	current, ok := m.pools[orgID]
+	if ok && current.updatedAt.After(cfg.UpdatedAt) {
+		m.mu.Unlock()
+		closeGormDB(db)
+		return current.db, nil
+	}
+	m.pools[orgID] = &tenantPool{db: db, dsn: dsn, updatedAt: cfg.UpdatedAt}
+	m.mu.Unlock()
+
+	if ok {
+		m.closePool(current.db)
+	}
+	return db, nil
+}
+
+// BeforeClose registers fn to be called with each tenant pool that is about
+// to be closed, because its configuration changed or the manager is closing,
+// so state kept per pool can be flushed and released
+func (m *TenantDBManager) BeforeClose(fn func(*gorm.DB)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.beforeClose = append(m.beforeClose, fn)
+}
+
+// closePool runs the BeforeClose hooks for db and closes it
+func (m *TenantDBManager) closePool(db *gorm.DB) {
+	m.mu.Lock()
+	hooks := m.beforeClose
+	m.mu.Unlock()
+	for _, fn := range hooks {
+		fn(db)
+	}
+	closeGormDB(db)
+}
+
+// Close closes every open tenant pool
+func (m *TenantDBManager) Close() {
+	m.mu.Lock()
+	pools := m.pools
+	m.pools = make(map[uint]*tenantPool)
+	m.mu.Unlock()
+
+	for _, pool := range pools {
+		m.closePool(pool.db)
+	}
+}
+
+// TenantPoolStats sums connection statistics across open tenant pools
+type TenantPoolStats struct {
+	Pools        int
+	InUse        int
+	Idle         int
+	WaitCount    int64
+	WaitDuration time.Duration
+}
+
+// Stats returns connection statistics summed across open tenant pools
+func (m *TenantDBManager) Stats() TenantPoolStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := TenantPoolStats{Pools: len(m.pools)}
+	for _, pool := range m.pools {
+		sqlDB, err := pool.db.DB()
+		if err != nil {
+			continue
+		}
+		s := sqlDB.Stats()
+		stats.InUse += s.InUse
+		stats.Idle += s.Idle
+		stats.WaitCount += s.WaitCount
+		stats.WaitDuration += s.WaitDuration
+	}
+	return stats
+}
+
+// TestConnection opens cfg's database and pings it
+func TestConnection(cfg *models.DatabaseConfig) error {
+	db, err := openTenantDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeGormDB(db)
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach %s database: %w", cfg.Driver, err)
+	}
+	return nil
+}
+
+// ValidateDriver checks that driver is supported, treating "" as Postgres
+func ValidateDriver(driver string) error {
+	switch driver {
+	case "", models.DriverPostgres, models.DriverMySQL, models.DriverClickHouse:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedDriver, driver)
+	}
+}
+
+func openTenantDB(cfg *models.DatabaseConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case "", models.DriverPostgres:
+		dialector = postgres.Open(cfg.DSN())
+	case models.DriverMySQL:
+		dialector = mysql.Open(cfg.DSN())
+	case models.DriverClickHouse:
+		dialector = clickhouse.Open(cfg.DSN())
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedDriver, cfg.Driver)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to tenant database: %w", err)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		closeGormDB(db)
+		return nil, fmt.Errorf("failed to enable tracing: %w", err)
+	}
+	return db, nil
+}
+
+func closeGormDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"backend/models"
+	"testing"
+)
+
+func TestTenantDBManagerCachesConfigsUntilInvalidated(t *testing.T) {
+	db := testDB(t)
+	tenants := NewTenantDBManager(db, TenantPoolLimits{})
+	t.Cleanup(tenants.Close)
+	orgID, _ := createTestOrganization(t, db, 0)
+
+	if got, err := tenants.ForOrganization(orgID); err != nil || got != db {
+		t.Fatalf("ForOrganization without a config = %v, %v, want the platform database", got, err)
+	}
+
+	// Nothing listens on port 1, so opening this pool fails
+	cfg := models.DatabaseConfig{OrganizationID: orgID, Driver: models.DriverPostgres, Host: "127.0.0.1", Port: "1", DbName: "db", Username: "u"}
+	if err := db.Create(&cfg).Error; err != nil {
+		t.Fatalf("failed to create database config: %v", err)
+	}
+	if got, err := tenants.ForOrganization(orgID); err != nil || got != db {
+		t.Errorf("ForOrganization with a cached config = %v, %v, want the platform database still", got, err)
+	}
+
+	tenants.Invalidate(orgID)
+	if _, err := tenants.ForOrganization(orgID); err == nil {
+		t.Error("ForOrganization after Invalidate didn't connect to the saved database")
+	}
+}
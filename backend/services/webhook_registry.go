@@ -0,0 +1,163 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookRegistry registers Helius webhooks that deliver to this
+// environment's callback URL and keeps existing ones pointed at it
+type WebhookRegistry struct {
+	db          *gorm.DB
+	apiClient   *HeliusAPIClient
+	callbackURL string
+	authHeader  string
+}
+
+// NewWebhookRegistry creates a registry whose webhooks deliver to
+// callbackURL. Helius sends authHeader as the Authorization header of each
+// delivery.
+func NewWebhookRegistry(db *gorm.DB, apiClient *HeliusAPIClient, callbackURL, authHeader string) *WebhookRegistry {
+	return &WebhookRegistry{
+		db:          db,
+		apiClient:   apiClient,
+		callbackURL: callbackURL,
+		authHeader:  authHeader,
+	}
+}
+
+// CallbackURL returns the URL Helius delivers this environment's events to
+func (r *WebhookRegistry) CallbackURL() string {
+	return r.callbackURL
+}
+
+// AuthHeader returns the Authorization header deliveries must carry
+func (r *WebhookRegistry) AuthHeader() string {
+	return r.authHeader
+}
+
+// Register creates a new webhook configuration for an organization
+func (r *WebhookRegistry) Register(ctx context.Context, orgID uint, accountKeys []string, eventTypes []string) (*models.HeliusWebhook, error) {
+	resp, err := r.apiClient.RegisterWebhook(ctx, r.registration(accountKeys, eventTypes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to register webhook with Helius: %w", err)
+	}
+
+	webhook := &models.HeliusWebhook{
+		OrganizationID: orgID,
+		WebhookURL:     r.callbackURL,
+		WebhookID:      resp.WebhookID,
+		AccountKeys:    strings.Join(accountKeys, ","), // Store as comma-separated string
+		EventTypes:     strings.Join(eventTypes, ","),  // Store as comma-separated string
+		IsActive:       true,
+	}
+
+	if err := r.db.WithContext(ctx).Create(webhook).Error; err != nil {
+		return nil, fmt.Errorf("failed to store webhook in database: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// List returns the webhooks of orgID, or of every organization when orgID
+// is zero
+func (r *WebhookRegistry) List(ctx context.Context, orgID uint) ([]models.HeliusWebhook, error) {
+	query := r.db.WithContext(ctx).Order("id")
+	if orgID != 0 {
+		query = query.Where("organization_id = ?", orgID)
+	}
+	var webhooks []models.HeliusWebhook
+	if err := query.Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// Get returns a webhook by ID
+func (r *WebhookRegistry) Get(ctx context.Context, id uint) (*models.HeliusWebhook, error) {
+	var webhook models.HeliusWebhook
+	if err := r.db.WithContext(ctx).First(&webhook, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to load webhook %d: %w", id, err)
+	}
+	return &webhook, nil
+}
+
+// WebhookEventStats summarises the events a webhook has received. Failed
+// events carry an error message; pending ones have not been tried yet.
+type WebhookEventStats struct {
+	Total          int64      `json:"total"`
+	Processed      int64      `json:"processed"`
+	Filtered       int64      `json:"filtered"`
+	Failed         int64      `json:"failed"`
+	Pending        int64      `json:"pending"`
+	LastReceivedAt *time.Time `json:"last_received_at"`
+}
+
+// EventStats counts a webhook's events by outcome
+func (r *WebhookRegistry) EventStats(ctx context.Context, webhookID uint) (*WebhookEventStats, error) {
+	var stats WebhookEventStats
+	err := r.db.WithContext(ctx).Model(&models.WebhookEvent{}).
+		Select(`COUNT(*) AS total,
+			COUNT(*) FILTER (WHERE processed AND NOT filtered) AS processed,
+			COUNT(*) FILTER (WHERE filtered) AS filtered,
+			COUNT(*) FILTER (WHERE NOT processed AND error_message <> '') AS failed,
+			COUNT(*) FILTER (WHERE NOT processed AND COALESCE(error_message, '') = '') AS pending,
+			MAX(created_at) AS last_received_at`).
+		Where("webhook_id = ?", webhookID).
+		Scan(&stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count events: %w", err)
+	}
+	return &stats, nil
+}
+
+// Stale returns the webhooks registered with a callback URL other than the
+// current one, such as those created before the public URL changed
+func (r *WebhookRegistry) Stale(ctx context.Context) ([]models.HeliusWebhook, error) {
+	var webhooks []models.HeliusWebhook
+	if err := r.db.WithContext(ctx).Where("webhook_url <> ?", r.callbackURL).Order("id").Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// Repoint edits every stale webhook in Helius to deliver to the current
+// callback URL and records the change. It carries on past failures and
+// returns the webhooks it updated along with any errors.
+func (r *WebhookRegistry) Repoint(ctx context.Context) ([]models.HeliusWebhook, error) {
+	stale, err := r.Stale(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var repointed []models.HeliusWebhook
+	var errs []error
+	for _, webhook := range stale {
+		req := r.registration(splitCommaList(webhook.AccountKeys), splitCommaList(webhook.EventTypes))
+		if err := r.apiClient.EditWebhook(ctx, webhook.WebhookID, req); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %d: failed to edit in Helius: %w", webhook.ID, err))
+			continue
+		}
+		if err := r.db.WithContext(ctx).Model(&webhook).Update("webhook_url", r.callbackURL).Error; err != nil {
+			errs = append(errs, fmt.Errorf("webhook %d: failed to store new URL: %w", webhook.ID, err))
+			continue
+		}
+		repointed = append(repointed, webhook)
+	}
+	return repointed, errors.Join(errs...)
+}
+
+func (r *WebhookRegistry) registration(accountKeys, eventTypes []string) WebhookRegistrationRequest {
+	return WebhookRegistrationRequest{
+		WebhookURL:       r.callbackURL,
+		AccountAddresses: accountKeys,
+		EventTypes:       eventTypes,
+		AuthHeader:       r.authHeader,
+	}
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// WorkerPool runs submitted jobs on a fixed number of goroutines
+type WorkerPool struct {
+	name   string
+	jobs   chan func(context.Context)
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWorkerPool starts size workers sharing a queue of queueSize jobs
+func NewWorkerPool(name string, size, queueSize int) *WorkerPool {
+	if size <= 0 {
+		size = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &WorkerPool{
+		name:   name,
+		jobs:   make(chan func(context.Context), queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				job(p.ctx)
+			}
+		}()
+	}
+	return p
+}
+
+// Name identifies the pool in logs and metrics
+func (p *WorkerPool) Name() string {
+	return p.name
+}
+
+// Submit queues job without blocking. It returns false if the queue is full
+// or the pool is shutting down.
+func (p *WorkerPool) Submit(job func(context.Context)) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Running reports whether the pool is accepting jobs
+func (p *WorkerPool) Running() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return !p.closed
+}
+
+// QueueDepth returns the number of jobs waiting for a worker
+func (p *WorkerPool) QueueDepth() int {
+	return len(p.jobs)
+}
+
+// Shutdown stops accepting jobs and waits for queued and running jobs to
+// finish. If ctx ends first, running jobs see their context cancelled.
+func (p *WorkerPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"backend/tracing"
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// A table's flusher stops after this long without writes and is started
+// again by the next one
+const flusherIdleTimeout = time.Minute
+
+// WriteBatching limits how the database sink groups rows into one insert
+type WriteBatching struct {
+	MaxRows int           // Rows per insert; 1 or less writes every row on its own
+	Linger  time.Duration // How long a batch waits for more rows once it has one
+}
+
+// writeBuffer groups the rows concurrent writers send to the same table and
+// upserts them with one multi-row statement. Writers wait until the statement
+// holding their row commits, so an event is only acknowledged as processed
+// once its row is stored.
+type writeBuffer struct {
+	sink    *DatabaseSink
+	maxRows int
+	linger  time.Duration
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex
+	queues map[ensuredTable]*tableQueue
+	closed bool
+}
+
+// tableQueue holds the writes waiting for one table's flusher
+type tableQueue struct {
+	writes  chan *pendingWrite
+	stopped chan struct{} // Closed once the flusher has returned
+}
+
+type pendingWrite struct {
+	ctx    context.Context
+	record *SinkRecord
+	done   chan error
+}
+
+func newWriteBuffer(sink *DatabaseSink, batching WriteBatching) *writeBuffer {
+	return &writeBuffer{
+		sink:    sink,
+		maxRows: batching.MaxRows,
+		linger:  batching.Linger,
+		queues:  make(map[ensuredTable]*tableQueue),
+	}
+}
+
+// write queues record for table and waits for its batch to commit. Once the
+// buffer is closed the record is written on its own.
+func (b *writeBuffer) write(ctx context.Context, db *gorm.DB, table string, record *SinkRecord) error {
+	w := &pendingWrite{ctx: ctx, record: record, done: make(chan error, 1)}
+	queued, err := b.enqueue(ctx, ensuredTable{db: db, table: table}, w)
+	if err != nil {
+		return err
+	}
+	if !queued {
+		return b.sink.insert(ctx, db, table, []*SinkRecord{record})
+	}
+
+	select {
+	case err := <-w.done:
+		return err
+	case <-ctx.Done():
+		// The row may still be written; the event stays unprocessed either way
+		return ctx.Err()
+	}
+}
+
+// enqueue hands w to the flusher of its table, starting one for a table
+// without one. It returns false once the buffer is closed.
+func (b *writeBuffer) enqueue(ctx context.Context, key ensuredTable, w *pendingWrite) (bool, error) {
+	for {
+		// Queues are only closed or removed under the write lock, so one
+		// looked up under the read lock can be sent to until it is released
+		b.mu.RLock()
+		if b.closed {
+			b.mu.RUnlock()
+			return false, nil
+		}
+		if queue, ok := b.queues[key]; ok {
+			defer b.mu.RUnlock()
+			select {
+			case queue.writes <- w:
+				return true, nil
+			case <-ctx.Done():
+				return false, ctx.Err()
+			}
+		}
+		b.mu.RUnlock()
+
+		b.mu.Lock()
+		if _, ok := b.queues[key]; !ok && !b.closed {
+			queue := &tableQueue{writes: make(chan *pendingWrite, b.maxRows), stopped: make(chan struct{})}
+			b.queues[key] = queue
+			b.wg.Add(1)
+			go b.run(key, queue)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// run flushes one table's queue until it is closed or has been idle for
+// flusherIdleTimeout
+func (b *writeBuffer) run(key ensuredTable, queue *tableQueue) {
+	defer b.wg.Done()
+	defer close(queue.stopped)
+	idle := time.NewTimer(flusherIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case first, ok := <-queue.writes:
+			if !ok {
+				return
+			}
+			b.flush(key.db, key.table, b.collect(first, queue.writes))
+		case <-idle.C:
+			if b.reap(key, queue) {
+				return
+			}
+		}
+		idle.Reset(flusherIdleTimeout)
+	}
+}
+
+// reap removes an idle queue from the buffer, reporting whether it did
+func (b *writeBuffer) reap(key ensuredTable, queue *tableQueue) bool {
+	// Writers may hold the read lock while blocked on a full queue that only
+	// this flusher drains, so it doesn't wait for the write lock
+	if !b.mu.TryLock() {
+		return false
+	}
+	defer b.mu.Unlock()
+	if len(queue.writes) > 0 || b.queues[key] != queue {
+		return false
+	}
+	delete(b.queues, key)
+	return true
+}
+
+// collect gathers up to maxRows writes starting with first. Writes already
+// queued are always taken; after that it waits up to linger for more.
+func (b *writeBuffer) collect(first *pendingWrite, queue chan *pendingWrite) []*pendingWrite {
+	batch := []*pendingWrite{first}
+	var deadline <-chan time.Time
+	if b.linger > 0 {
+		timer := time.NewTimer(b.linger)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for len(batch) < b.maxRows {
+		select {
+		case w, ok := <-queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, w)
+			continue
+		default:
+		}
+		if deadline == nil {
+			return batch
+		}
+
+		select {
+		case w, ok := <-queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, w)
+		case <-deadline:
+			deadline = nil
+		}
+	}
+	return batch
+}
+
+// flush upserts a batch and reports the outcome to each writer. If the
+// statement fails, its rows are retried one at a time so a bad row only
+// fails its own event.
+func (b *writeBuffer) flush(db *gorm.DB, table string, batch []*pendingWrite) {
+	// An upsert may not touch the same row twice, so an event written twice
+	// in one batch keeps its last record, as writing them in turn would
+	index := make(map[uint]int, len(batch))
+	records := make([]*SinkRecord, 0, len(batch))
+	for _, w := range batch {
+		if i, ok := index[w.record.EventID]; ok {
+			records[i] = w.record
+			continue
+		}
+		index[w.record.EventID] = len(records)
+		records = append(records, w.record)
+	}
+
+	// Writers may give up while others still wait, so the batch doesn't
+	// share their cancellation, only the first one's trace
+	ctx, span := tracing.Start(context.WithoutCancel(batch[0].ctx), "sink.flush", trace.WithAttributes(
+		attribute.String("db.sql.table", table),
+		attribute.Int("helixscan.batch_rows", len(records)),
+	))
+	err := b.sink.insert(ctx, db, table, records)
+	defer func() { tracing.End(span, err) }()
+	sinkBatchRows.WithLabelValues(categoryLabel(records[0].Category)).Observe(float64(len(records)))
+
+	if err == nil || len(records) == 1 {
+		for _, w := range batch {
+			w.done <- err
+		}
+		return
+	}
+	errs := make(map[uint]error, len(records))
+	for _, record := range records {
+		errs[record.EventID] = b.sink.insert(ctx, db, table, []*SinkRecord{record})
+	}
+	for _, w := range batch {
+		w.done <- errs[w.record.EventID]
+	}
+}
+
+// drop flushes the writes queued for db, a tenant pool about to be closed,
+// and stops their flushers. Writes arriving later for db start new ones,
+// which fail on the closed pool and are reaped once idle.
+func (b *writeBuffer) drop(db *gorm.DB) {
+	var stopped []chan struct{}
+	b.mu.Lock()
+	if b.closed {
+		// close stops every flusher
+		b.mu.Unlock()
+		return
+	}
+	for key, queue := range b.queues {
+		if key.db == db {
+			close(queue.writes)
+			delete(b.queues, key)
+			stopped = append(stopped, queue.stopped)
+		}
+	}
+	b.mu.Unlock()
+	for _, c := range stopped {
+		<-c
+	}
+}
+
+// close flushes the queued writes and stops the flushers
+func (b *writeBuffer) close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, queue := range b.queues {
+			close(queue.writes)
+		}
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const testTable = "user_1_nft_bids"
+
+// fakeInserts stands in for a tenant database: statements aren't run, but
+// the event IDs of each insert are recorded and fail can reject one
+type fakeInserts struct {
+	latency time.Duration // Simulated round trip per statement
+	conns   chan struct{} // Limits statements in flight, as a pool would
+	fail    func(eventIDs []uint64) error
+
+	mu         sync.Mutex
+	statements [][]uint64
+	values     map[uint64][]interface{} // Last values written per event
+}
+
+// open returns a DB whose inserts are recorded by f, and a sink writing
+// testTable to it as if the table existed
+func (f *fakeInserts) open(tb testing.TB, batching WriteBatching) (*gorm.DB, *DatabaseSink) {
+	tb.Helper()
+	db := dryRunDB(tb)
+	f.values = make(map[uint64][]interface{})
+	width := len(NFTBidsCategory.Columns) + 1
+	err := db.Callback().Raw().Before("gorm:raw").Register("test:record", func(tx *gorm.DB) {
+		vars := tx.Statement.Vars
+		ids := make([]uint64, 0, len(vars)/width)
+		for i := 0; i+width <= len(vars); i += width {
+			ids = append(ids, vars[i].(uint64))
+		}
+		if f.conns != nil {
+			f.conns <- struct{}{}
+			defer func() { <-f.conns }()
+		}
+		if f.latency > 0 {
+			time.Sleep(f.latency)
+		}
+		if f.fail != nil {
+			if err := f.fail(ids); err != nil {
+				tx.AddError(err)
+				return
+			}
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.statements = append(f.statements, ids)
+		for i, id := range ids {
+			f.values[id] = vars[i*width+1 : (i+1)*width]
+		}
+	})
+	if err != nil {
+		tb.Fatalf("failed to register callback: %v", err)
+	}
+
+	s := &DatabaseSink{ensured: map[ensuredTable]bool{{db: db, table: testTable}: false}}
+	if batching.MaxRows > 1 {
+		s.buffer = newWriteBuffer(s, batching)
+	}
+	tb.Cleanup(func() { s.Close() })
+	return db, s
+}
+
+func (f *fakeInserts) recorded() ([][]uint64, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rows := 0
+	for _, ids := range f.statements {
+		rows += len(ids)
+	}
+	return append([][]uint64(nil), f.statements...), rows
+}
+
+func bidRecord(eventID uint, bidder string) *SinkRecord {
+	return &SinkRecord{
+		OrganizationID: 1,
+		WebhookID:      1,
+		EventID:        eventID,
+		Category:       NFTBidsCategory,
+		Values:         bidValues(bidder, "1.5", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)),
+	}
+}
+
+func pending(eventID uint, bidder string) *pendingWrite {
+	return &pendingWrite{ctx: context.Background(), record: bidRecord(eventID, bidder), done: make(chan error, 1)}
+}
+
+func TestWriteBufferBatchesConcurrentWrites(t *testing.T) {
+	f := &fakeInserts{latency: time.Millisecond}
+	db, s := f.open(t, WriteBatching{MaxRows: 10, Linger: 20 * time.Millisecond})
+
+	const writers = 50
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.buffer.write(context.Background(), db, testTable, bidRecord(uint(i+1), "Bidder111"))
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	statements, rows := f.recorded()
+	if rows != writers {
+		t.Errorf("%d rows inserted, want %d", rows, writers)
+	}
+	if len(statements) >= writers {
+		t.Errorf("%d inserts for %d writes, want them batched", len(statements), writers)
+	}
+	for _, ids := range statements {
+		if len(ids) > 10 {
+			t.Errorf("insert of %d rows exceeds the batch size of 10", len(ids))
+		}
+	}
+}
+
+func TestWriteBufferFlushKeepsTheLastRecordPerEvent(t *testing.T) {
+	f := &fakeInserts{}
+	db, s := f.open(t, WriteBatching{MaxRows: 10})
+
+	batch := []*pendingWrite{pending(1, "first"), pending(2, "other"), pending(1, "second")}
+	s.buffer.flush(db, testTable, batch)
+
+	for _, w := range batch {
+		if err := <-w.done; err != nil {
+			t.Errorf("event %d: %v", w.record.EventID, err)
+		}
+	}
+	statements, _ := f.recorded()
+	if fmt.Sprint(statements) != "[[1 2]]" {
+		t.Fatalf("inserts = %v, want one insert of events 1 and 2", statements)
+	}
+	if bidder := f.values[1][1]; bidder != "second" {
+		t.Errorf("event 1 written with bidder %v, want the later record's", bidder)
+	}
+}
+
+func TestWriteBufferFlushRetriesRowsOfAFailedBatchAlone(t *testing.T) {
+	errBadRow := errors.New("bad row")
+	f := &fakeInserts{fail: func(ids []uint64) error {
+		for _, id := range ids {
+			if id == 3 {
+				return errBadRow
+			}
+		}
+		return nil
+	}}
+	db, s := f.open(t, WriteBatching{MaxRows: 10})
+
+	var batch []*pendingWrite
+	for id := uint(1); id <= 5; id++ {
+		batch = append(batch, pending(id, "Bidder111"))
+	}
+	s.buffer.flush(db, testTable, batch)
+
+	for _, w := range batch {
+		err := <-w.done
+		if w.record.EventID == 3 && !errors.Is(err, errBadRow) {
+			t.Errorf("event 3 = %v, want its own error", err)
+		}
+		if w.record.EventID != 3 && err != nil {
+			t.Errorf("event %d = %v, want it written despite event 3", w.record.EventID, err)
+		}
+	}
+	statements, _ := f.recorded()
+	if fmt.Sprint(statements) != "[[1] [2] [4] [5]]" {
+		t.Errorf("inserts = %v, want the good rows one at a time", statements)
+	}
+}
+
+func TestWriteBufferDropFlushesAndRemovesAPoolsQueues(t *testing.T) {
+	f := &fakeInserts{latency: 5 * time.Millisecond}
+	db, s := f.open(t, WriteBatching{MaxRows: 10, Linger: time.Hour})
+
+	w := pending(1, "Bidder111")
+	if queued, err := s.buffer.enqueue(context.Background(), ensuredTable{db: db, table: testTable}, w); !queued || err != nil {
+		t.Fatalf("enqueue = %v, %v, want the write queued", queued, err)
+	}
+
+	// The linger would hold the write for an hour
+	s.release(db)
+	if err := <-w.done; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, rows := f.recorded(); rows != 1 {
+		t.Errorf("%d rows written by the time the pool was released, want 1", rows)
+	}
+	s.buffer.mu.RLock()
+	queues := len(s.buffer.queues)
+	s.buffer.mu.RUnlock()
+	s.mu.Lock()
+	ensured := len(s.ensured)
+	s.mu.Unlock()
+	if queues != 0 || ensured != 0 {
+		t.Errorf("%d queues and %d ensured tables kept for the released pool", queues, ensured)
+	}
+}
+
+func TestWriteBufferReapsIdleQueues(t *testing.T) {
+	f := &fakeInserts{}
+	db, s := f.open(t, WriteBatching{MaxRows: 10})
+	if err := s.buffer.write(context.Background(), db, testTable, bidRecord(1, "Bidder111")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	key := ensuredTable{db: db, table: testTable}
+	s.buffer.mu.RLock()
+	queue := s.buffer.queues[key]
+	s.buffer.mu.RUnlock()
+	if !s.buffer.reap(key, queue) {
+		t.Fatal("idle queue wasn't reaped")
+	}
+	// The flusher is still running here, as run only returns after reaping
+	close(queue.writes)
+	<-queue.stopped
+
+	// The next write starts a new flusher
+	if err := s.buffer.write(context.Background(), db, testTable, bidRecord(2, "Bidder111")); err != nil {
+		t.Fatalf("write after reaping: %v", err)
+	}
+	if _, rows := f.recorded(); rows != 2 {
+		t.Errorf("%d rows written, want 2", rows)
+	}
+}
+
+func TestWriteBufferWritesAloneOnceClosed(t *testing.T) {
+	f := &fakeInserts{}
+	db, s := f.open(t, WriteBatching{MaxRows: 10, Linger: time.Hour})
+	s.Close()
+	if err := s.buffer.write(context.Background(), db, testTable, bidRecord(1, "Bidder111")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if statements, _ := f.recorded(); fmt.Sprint(statements) != "[[1]]" {
+		t.Errorf("inserts = %v, want event 1 written on its own", statements)
+	}
+}
+
+// benchmarkWrites writes b.N events from concurrent writers to a database
+// of four connections that each take 200µs per statement
+func benchmarkWrites(b *testing.B, batching WriteBatching) {
+	f := &fakeInserts{latency: 200 * time.Microsecond, conns: make(chan struct{}, 4)}
+	db, s := f.open(b, batching)
+	var next sync.Mutex
+	id := uint(0)
+	write := func(record *SinkRecord) error {
+		if s.buffer == nil {
+			return s.insert(context.Background(), db, testTable, []*SinkRecord{record})
+		}
+		return s.buffer.write(context.Background(), db, testTable, record)
+	}
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			next.Lock()
+			id++
+			eventID := id
+			next.Unlock()
+			if err := write(bidRecord(eventID, "Bidder111")); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	statements, rows := f.recorded()
+	b.ReportMetric(float64(rows)/float64(len(statements)), "rows/insert")
+}
+
+func BenchmarkWriteUnbatched(b *testing.B) {
+	benchmarkWrites(b, WriteBatching{MaxRows: 1})
+}
+
+func BenchmarkWriteBatched(b *testing.B) {
+	benchmarkWrites(b, WriteBatching{MaxRows: 500, Linger: time.Millisecond})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// shutdownStep is one stage of draining the server
+type shutdownStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// shutdown runs steps in order, sharing ctx's deadline between them. Every
+// step runs even if an earlier one fails or the deadline passes, so
+// connections are always released. It reports whether everything drained
+// cleanly.
+func shutdown(ctx context.Context, logger *slog.Logger, steps []shutdownStep) bool {
+	clean := true
+	for _, step := range steps {
+		if err := step.run(ctx); err != nil {
+			logger.Error("shutdown step failed", "step", step.name, "error", err)
+			clean = false
+			continue
+		}
+		logger.Debug("shutdown step done", "step", step.name)
+	}
+	return clean
+}